@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// accessLogSweepInterval is how often the access logs of the data repositories are ingested
+const accessLogSweepInterval = 15 * time.Minute
+
+// accessLogReader is implemented by data repositories with access logs, ie. S3 server access logs, and that can
+// tell which of their objects are data
+type accessLogReader interface {
+	AccessLogs(ctx context.Context, id, cursor string) ([]*dataset.AccessLogRecord, string, error)
+	DataObject(key string) bool
+}
+
+// startAccessLogIngestion ingests the access logs of the data repositories in each account with an access report
+// repository, until the context is cancelled
+func (s *server) startAccessLogIngestion(ctx context.Context, interval time.Duration) {
+	for account, service := range s.datasetServices {
+		if service.AccessReportRepository == nil {
+			continue
+		}
+
+		account, service := account, service
+		s.run(func() { s.ingestAccessLogs(ctx, account, service, interval) })
+	}
+}
+
+// ingestAccessLogs ingests the access logs of the datasets in an account right away, and then periodically
+func (s *server) ingestAccessLogs(ctx context.Context, account string, service *dataset.Service, interval time.Duration) {
+	log.Infof("ingesting access logs of the data repositories in account '%s' every %s", account, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ingestAccountAccessLogs(ctx, account, service); err != nil {
+			log.WithContext(ctx).Errorf("failed to ingest access logs in account %s: %s", account, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ingestAccountAccessLogs ingests the new access logs of the datasets in an account.  A failure for one dataset
+// doesn't stop the others, it's retried in the next sweep.
+func (s *server) ingestAccountAccessLogs(ctx context.Context, account string, service *dataset.Service) error {
+	datasets, err := service.MetadataRepository.List(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range datasets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		reader, ok := service.DataRepository[m.DataStorage].(accessLogReader)
+		if !ok {
+			continue
+		}
+
+		if err := ingestDatasetAccessLogs(ctx, account, service, reader, m.ID); err != nil {
+			log.WithContext(ctx).Errorf("failed to ingest access logs of dataset %s in account %s: %s", m.ID, account, err)
+		}
+	}
+
+	return nil
+}
+
+// ingestDatasetAccessLogs adds the accesses to the data of a dataset from its new access logs to the access report
+// of the dataset, and writes them to the audit log.  The report keeps track of how far the access logs were ingested.
+func ingestDatasetAccessLogs(ctx context.Context, account string, service *dataset.Service, reader accessLogReader, id string) error {
+	report, err := service.AccessReportRepository.GetAccessReport(ctx, account, id)
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+			return err
+		}
+		report = &dataset.AccessReport{DatasetID: id, Principals: []*dataset.PrincipalAccess{}}
+	}
+
+	for {
+		records, cursor, err := reader.AccessLogs(ctx, id, report.LogCursor)
+		if err != nil {
+			return err
+		}
+
+		if cursor == report.LogCursor {
+			return nil
+		}
+
+		accesses := []*dataset.AccessLogRecord{}
+		for _, r := range records {
+			if reader.DataObject(r.Key) {
+				accesses = append(accesses, r)
+			}
+		}
+
+		// the group of the dataset is needed for the audit log, it's only resolved once
+		if report.Group == "" && len(accesses) > 0 {
+			d, err := resolveRepository(ctx, service, map[string]*activityDataset{}, accesses[0].Repository)
+			if err != nil {
+				log.WithContext(ctx).Infof("not writing access logs of dataset %s to the audit log: %s", id, err)
+			} else {
+				report.Group = d.group
+			}
+		}
+
+		for _, r := range accesses {
+			report.Add(r)
+		}
+		report.Sort()
+
+		now := time.Now().UTC().Truncate(time.Second)
+		report.UpdatedAt = &now
+		report.LogCursor = cursor
+
+		log.WithContext(ctx).Debugf("ingested %d accesses to the data of dataset %s, up to %s", len(accesses), id, cursor)
+
+		// the report is stored before writing to the audit log, so accesses aren't logged twice if it fails
+		if err := service.AccessReportRepository.PutAccessReport(ctx, account, report); err != nil {
+			return err
+		}
+
+		if report.Group == "" || len(accesses) == 0 {
+			continue
+		}
+
+		// the audit log is written when the context is done
+		logCtx, cancel := context.WithCancel(ctx)
+		auditLog := service.AuditLogRepository.Log(logCtx, report.Group, id)
+		for _, r := range accesses {
+			auditLog <- fmt.Sprintf("Data access in dataset %s: %s %s (Principal: %s %s, Requester: %s, Status: %d, Bytes: %d, SourceIP: %s, Time: %s)", id, r.Action, r.Key, r.PrincipalType, r.Principal, r.Requester, r.Status, r.Bytes, r.SourceIP, r.Time.Format(time.RFC3339))
+		}
+		cancel()
+	}
+}
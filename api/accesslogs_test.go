@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// mockAccessLogRepository returns batches of access log records by dataset, the cursor is the number of batches read
+type mockAccessLogRepository struct {
+	mockResolverRepository
+	batches map[string][][]*dataset.AccessLogRecord
+	errs    map[string]error
+}
+
+func (m *mockAccessLogRepository) AccessLogs(ctx context.Context, id, cursor string) ([]*dataset.AccessLogRecord, string, error) {
+	if err, ok := m.errs[id]; ok {
+		return nil, cursor, err
+	}
+
+	n, _ := strconv.Atoi(cursor)
+	if n >= len(m.batches[id]) {
+		return []*dataset.AccessLogRecord{}, cursor, nil
+	}
+	return m.batches[id][n], strconv.Itoa(n + 1), nil
+}
+
+// mockAccessReportRepository keeps the json of access reports in memory, and counts how often they're stored
+type mockAccessReportRepository struct {
+	dataset.AccessReportRepository
+	reports map[string][]byte
+	puts    int
+}
+
+func (m *mockAccessReportRepository) PutAccessReport(ctx context.Context, account string, report *dataset.AccessReport) error {
+	j, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	m.reports[account+"/"+report.DatasetID] = j
+	m.puts++
+	return nil
+}
+
+func (m *mockAccessReportRepository) GetAccessReport(ctx context.Context, account, datasetID string) (*dataset.AccessReport, error) {
+	j, ok := m.reports[account+"/"+datasetID]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "access report not found", nil)
+	}
+
+	report := &dataset.AccessReport{}
+	if err := json.Unmarshal(j, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func TestIngestDatasetAccessLogs(t *testing.T) {
+	instanceRole := "arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0"
+	tmpUser := "arn:aws:iam::012345678901:user/spinup/dataset/dataset-abc-DsTmpUsr"
+	readAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	batches := [][]*dataset.AccessLogRecord{
+		{
+			{Repository: "dataset-abc", Key: "raw/a.csv", Action: dataset.AccessRead, Requester: instanceRole, PrincipalType: dataset.AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 200, Bytes: 100, Time: readAt},
+			{Repository: "dataset-abc", Key: "_attachments/dua.pdf", Action: dataset.AccessRead, Requester: instanceRole, PrincipalType: dataset.AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 200, Bytes: 1000, Time: readAt},
+		},
+		{
+			{Repository: "dataset-abc", Key: "raw/b.csv", Action: dataset.AccessRead, Requester: instanceRole, PrincipalType: dataset.AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 200, Bytes: 50, Time: readAt.Add(time.Minute)},
+			{Repository: "dataset-abc", Key: "raw/b.csv", Action: dataset.AccessDelete, Requester: tmpUser, PrincipalType: dataset.AccessPrincipalUser, Principal: "dataset-abc-DsTmpUsr", Status: 403, Time: readAt.Add(2 * time.Minute)},
+		},
+	}
+
+	// the report after ingesting the first batch
+	first := `{"dataset_id":"abc","group":"group1","principals":[{"principal":"i-0123456789abcdef0","principal_type":"instance","requester":"` + instanceRole + `","reads":1,"bytes_read":100,"first_access":"2026-10-18T12:00:00Z","last_access":"2026-10-18T12:00:00Z"}],"log_cursor":"1"}`
+
+	tests := []struct {
+		name       string
+		report     string
+		tags       []*dataset.Tag
+		err        error
+		expectErr  bool
+		puts       int
+		cursor     string
+		principals int
+		reads      int64
+		bytesRead  int64
+		logs       int
+	}{
+		{
+			name:       "new report",
+			tags:       []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}},
+			puts:       2,
+			cursor:     "2",
+			principals: 2,
+			reads:      2,
+			bytesRead:  150,
+			logs:       3,
+		},
+		{
+			name:       "existing report",
+			report:     first,
+			tags:       []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}},
+			puts:       1,
+			cursor:     "2",
+			principals: 2,
+			reads:      2,
+			bytesRead:  150,
+			logs:       2,
+		},
+		{
+			name:   "no new access logs",
+			report: strings.Replace(first, `"log_cursor":"1"`, `"log_cursor":"2"`, 1),
+			tags:   []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}},
+			cursor: "2",
+			// unchanged from the stored report
+			principals: 1,
+			reads:      1,
+			bytesRead:  100,
+		},
+		{
+			name:       "no group",
+			puts:       2,
+			cursor:     "2",
+			principals: 2,
+			reads:      2,
+			bytesRead:  150,
+		},
+		{
+			name:      "failing access logs",
+			tags:      []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}},
+			err:       errors.New("boom"),
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		reportRepo := &mockAccessReportRepository{reports: map[string][]byte{}}
+		if test.report != "" {
+			reportRepo.reports["acct/abc"] = []byte(test.report)
+		}
+
+		reader := &mockAccessLogRepository{
+			mockResolverRepository: mockResolverRepository{tags: map[string][]*dataset.Tag{"abc": test.tags}},
+			batches:                map[string][][]*dataset.AccessLogRecord{"abc": batches},
+			errs:                   map[string]error{},
+		}
+		if test.err != nil {
+			reader.errs["abc"] = test.err
+		}
+		auditLogRepo := &mockAuditLogRepository{messages: make(chan string, 10)}
+
+		service := dataset.NewService(
+			dataset.WithAuditLogRepository(auditLogRepo),
+			dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": reader}),
+		)
+		service.AccessReportRepository = reportRepo
+
+		err := ingestDatasetAccessLogs(context.TODO(), "acct", service, reader, "abc")
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", test.name)
+			}
+			if reportRepo.puts != 0 {
+				t.Errorf("%s: expected no access report to be stored, got %d", test.name, reportRepo.puts)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected nil error, got %s", test.name, err)
+			continue
+		}
+
+		if reportRepo.puts != test.puts {
+			t.Errorf("%s: expected access report to be stored %d times, got %d", test.name, test.puts, reportRepo.puts)
+		}
+
+		report, err := reportRepo.GetAccessReport(context.TODO(), "acct", "abc")
+		if err != nil {
+			t.Errorf("%s: expected nil error getting access report, got %s", test.name, err)
+			continue
+		}
+
+		if report.LogCursor != test.cursor || len(report.Principals) != test.principals {
+			t.Errorf("%s: expected cursor %s and %d principals, got %+v", test.name, test.cursor, test.principals, report)
+			continue
+		}
+
+		// principals are sorted by their last access, so the instance is last once the user was denied
+		instance := report.Principals[len(report.Principals)-1]
+		if instance.Principal != "i-0123456789abcdef0" || instance.Reads != test.reads || instance.BytesRead != test.bytesRead {
+			t.Errorf("%s: expected %d reads of %d bytes by the instance, got %+v", test.name, test.reads, test.bytesRead, instance)
+		}
+
+		if test.principals == 2 {
+			if user := report.Principals[0]; user.PrincipalType != dataset.AccessPrincipalUser || user.Denied != 1 || user.Deletes != 0 {
+				t.Errorf("%s: expected the denied delete of the temporary user first, got %+v", test.name, user)
+			}
+		}
+
+		if n := len(auditLogRepo.messages); n != test.logs {
+			t.Errorf("%s: expected %d audit log messages, got %d", test.name, test.logs, n)
+		}
+
+		close(auditLogRepo.messages)
+		for l := range auditLogRepo.messages {
+			if !strings.HasPrefix(l, "Data access in dataset abc: ") || strings.Contains(l, "_attachments/") {
+				t.Errorf("%s: unexpected audit log message %q", test.name, l)
+			}
+		}
+	}
+}
+
+func TestIngestAccountAccessLogs(t *testing.T) {
+	readAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	groupTags := []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}}
+
+	reader := &mockAccessLogRepository{
+		mockResolverRepository: mockResolverRepository{tags: map[string][]*dataset.Tag{"abc": groupTags, "def": groupTags}},
+		batches: map[string][][]*dataset.AccessLogRecord{
+			"abc": {{{Repository: "dataset-abc", Key: "raw/a.csv", Action: dataset.AccessRead, PrincipalType: dataset.AccessPrincipalOther, Principal: "anonymous", Status: 200, Bytes: 1, Time: readAt}}},
+			"def": {{{Repository: "dataset-def", Key: "raw/a.csv", Action: dataset.AccessWrite, PrincipalType: dataset.AccessPrincipalOther, Principal: "anonymous", Status: 200, Time: readAt}}},
+		},
+		errs: map[string]error{"def": errors.New("boom")},
+	}
+	reportRepo := &mockAccessReportRepository{reports: map[string][]byte{}}
+
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(&mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+			"abc": {ID: "abc", Group: "group1", DataStorage: "s3"},
+			"def": {ID: "def", Group: "group1", DataStorage: "s3"},
+			"ghi": {ID: "ghi", Group: "group1", DataStorage: "other"},
+		}}),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{messages: make(chan string, 10)}),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{
+			"s3":    reader,
+			"other": &mockDataRepository{},
+		}),
+	)
+	service.AccessReportRepository = reportRepo
+
+	s := server{datasetServices: map[string]*dataset.Service{"acct": service}}
+	if err := s.ingestAccountAccessLogs(context.TODO(), "acct", service); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	// a failure for one dataset doesn't stop the others, datasets in data repositories without access logs don't
+	// get a report
+	for id, expected := range map[string]bool{"abc": true, "def": false, "ghi": false} {
+		if _, ok := reportRepo.reports["acct/"+id]; ok != expected {
+			t.Errorf("expected access report of dataset %s to exist: %t, got %t", id, expected, ok)
+		}
+	}
+
+	// a cancelled context stops the sweep
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	if err := s.ingestAccountAccessLogs(ctx, "acct", service); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled error, got %v", err)
+	}
+}
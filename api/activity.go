@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// activityRetryWait is how long to wait before receiving from an activity queue again after an error
+const activityRetryWait = 30 * time.Second
+
+// repositoryResolver is implemented by data repositories that can tell which dataset a data repository belongs to,
+// and which of its objects are data, so the object activity in data repositories can be tracked
+type repositoryResolver interface {
+	RepositoryDataset(ctx context.Context, name string) (string, []*dataset.Tag, error)
+	DataObject(key string) bool
+}
+
+// activityDataset is the dataset of a data repository with object activity
+type activityDataset struct {
+	id       string
+	group    string
+	resolver repositoryResolver
+	activity []*dataset.ObjectActivity
+}
+
+// startActivityTracking tracks the object activity in the data repositories of each account with an activity queue,
+// until the context is cancelled
+func (s *server) startActivityTracking(ctx context.Context) {
+	for account, service := range s.datasetServices {
+		if service.ActivityQueue == nil {
+			continue
+		}
+
+		account, service := account, service
+		s.run(func() { s.trackActivity(ctx, account, service) })
+	}
+}
+
+// trackActivity receives messages from the activity queue of an account and records their object activity.  Messages
+// are deleted once their activity is recorded, otherwise they're received again.
+func (s *server) trackActivity(ctx context.Context, account string, service *dataset.Service) {
+	log.Infof("tracking object activity in the data repositories of account '%s'", account)
+
+	// the dataset (and group) of a data repository never changes, so they're only resolved once
+	repositories := map[string]*activityDataset{}
+
+	for ctx.Err() == nil {
+		messages, err := service.ActivityQueue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Errorf("failed to receive object activity in account '%s', retrying in %s: %s", account, activityRetryWait, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(activityRetryWait):
+			}
+			continue
+		}
+
+		for _, m := range messages {
+			// tie the logs of the message together with its id
+			mctx := dataset.NewRequestIDContext(ctx, m.ID)
+
+			if err := s.recordActivity(mctx, account, service, repositories, m.Activity); err != nil {
+				log.WithContext(mctx).Errorf("failed to record object activity of message %s in account '%s', it will be received again: %s", m.ID, account, err)
+				continue
+			}
+
+			if err := service.ActivityQueue.Delete(mctx, m); err != nil {
+				log.WithContext(mctx).Errorf("failed to delete message %s from activity queue of account '%s': %s", m.ID, account, err)
+			}
+		}
+	}
+}
+
+// recordActivity groups object activity by dataset and records it for each dataset.  Activity in repositories that
+// don't belong to a dataset, and in objects that aren't data (ie. attachments) is ignored.
+func (s *server) recordActivity(ctx context.Context, account string, service *dataset.Service, repositories map[string]*activityDataset, activity []*dataset.ObjectActivity) error {
+	datasets := []*activityDataset{}
+	for _, a := range activity {
+		repository, err := resolveRepository(ctx, service, repositories, a.Repository)
+		if err != nil {
+			if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				log.WithContext(ctx).Warnf("ignoring object activity in %s, it's not a data repository of account '%s'", a.Repository, account)
+				continue
+			}
+			return err
+		}
+
+		if !repository.resolver.DataObject(a.Key) {
+			continue
+		}
+
+		var d *activityDataset
+		for _, existing := range datasets {
+			if existing.id == repository.id {
+				d = existing
+			}
+		}
+
+		if d == nil {
+			d = &activityDataset{id: repository.id, group: repository.group}
+			datasets = append(datasets, d)
+		}
+		d.activity = append(d.activity, a)
+	}
+
+	for _, d := range datasets {
+		if err := s.recordDatasetActivity(ctx, account, service, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveRepository returns the dataset of a data repository, asking the data repositories of the account that can
+// resolve it.  Resolved repositories are cached.
+func resolveRepository(ctx context.Context, service *dataset.Service, repositories map[string]*activityDataset, name string) (*activityDataset, error) {
+	if d, ok := repositories[name]; ok {
+		return d, nil
+	}
+
+	for _, dataRepo := range service.DataRepository {
+		resolver, ok := dataRepo.(repositoryResolver)
+		if !ok {
+			continue
+		}
+
+		id, tags, err := resolver.RepositoryDataset(ctx, name)
+		if err != nil {
+			if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		var group string
+		for _, t := range tags {
+			if aws.StringValue(t.Key) == "spinup:group" {
+				group = aws.StringValue(t.Value)
+			}
+		}
+
+		if group == "" {
+			msg := fmt.Sprintf("data repository %s of dataset %s doesn't have a spinup:group tag", name, id)
+			return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+		}
+
+		d := &activityDataset{id: id, group: group, resolver: resolver}
+		repositories[name] = d
+		return d, nil
+	}
+
+	return nil, apierror.New(apierror.ErrNotFound, "data repository not found: "+name, nil)
+}
+
+// recordDatasetActivity updates the time of the last data change in the metadata of the dataset, and writes the
+// object activity to the audit log of the dataset.  Changes to finalized datasets are policy violations, they're
+// also published as events.  Activity in deleted datasets is ignored.
+func (s *server) recordDatasetActivity(ctx context.Context, account string, service *dataset.Service, d *activityDataset) error {
+	metadata, err := service.MetadataRepository.Get(ctx, account, d.id)
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+			log.WithContext(ctx).Infof("ignoring object activity in deleted dataset %s", d.id)
+			return nil
+		}
+		return err
+	}
+
+	lastDataChange := lastActivity(d.activity)
+	if lastDataChange != nil && (metadata.LastDataChange == nil || lastDataChange.After(*metadata.LastDataChange)) {
+		log.WithContext(ctx).Debugf("updating last data change of dataset %s to %s", d.id, lastDataChange)
+
+		metadata.LastDataChange = lastDataChange
+		if _, err := service.MetadataRepository.Update(ctx, account, d.id, metadata); err != nil {
+			return err
+		}
+	}
+
+	// the audit log is written when the context is done
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	auditLog := service.AuditLogRepository.Log(logCtx, d.group, d.id)
+	for _, a := range d.activity {
+		auditLog <- fmt.Sprintf("Object %s in dataset %s: %s (Size: %d bytes, Principal: %s, SourceIP: %s, Time: %s)", a.Action, d.id, a.Key, a.Size, a.Principal, a.SourceIP, a.Time.Format(time.RFC3339))
+
+		if !activityViolation(metadata, a) {
+			continue
+		}
+
+		msg := fmt.Sprintf("Policy violation: object %s in finalized dataset %s: %s (Principal: %s, FinalizedAt: %s)", a.Action, d.id, a.Key, a.Principal, metadata.FinalizedAt.Format(time.RFC3339))
+		log.WithContext(ctx).Warn(msg)
+		auditLog <- msg
+
+		s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventPolicyViolation, account, d.group, d.id, "", map[string]interface{}{
+			"key":       a.Key,
+			"action":    a.Action,
+			"principal": a.Principal,
+			"source_ip": a.SourceIP,
+			"time":      a.Time,
+		}))
+	}
+
+	return nil
+}
+
+// lastActivity returns the time of the latest object activity, truncated to the second like the other metadata times
+func lastActivity(activity []*dataset.ObjectActivity) *time.Time {
+	var last *time.Time
+	for _, a := range activity {
+		if t := a.Time.UTC().Truncate(time.Second); last == nil || t.After(*last) {
+			last = &t
+		}
+	}
+	return last
+}
+
+// activityViolation returns true if the object activity changed the data of a finalized dataset.  Finalization times
+// are truncated to the second, so only activity in the following seconds is a violation.
+func activityViolation(metadata *dataset.Metadata, activity *dataset.ObjectActivity) bool {
+	if metadata.FinalizedAt == nil {
+		return false
+	}
+
+	return activity.Time.Truncate(time.Second).After(*metadata.FinalizedAt)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// mockActivityQueue hands out its messages one at a time and records the ids of the deleted messages.  Once all
+// messages are received, it cancels the context so the consumer stops.
+type mockActivityQueue struct {
+	messages []*dataset.ActivityMessage
+	deleted  []string
+	cancel   context.CancelFunc
+}
+
+func (m *mockActivityQueue) Receive(ctx context.Context) ([]*dataset.ActivityMessage, error) {
+	if len(m.messages) == 0 {
+		m.cancel()
+		return nil, ctx.Err()
+	}
+
+	message := m.messages[0]
+	m.messages = m.messages[1:]
+	return []*dataset.ActivityMessage{message}, nil
+}
+
+func (m *mockActivityQueue) Delete(ctx context.Context, message *dataset.ActivityMessage) error {
+	m.deleted = append(m.deleted, message.ID)
+	return nil
+}
+
+// mockResolverRepository resolves the datasets of data repositories named after them
+type mockResolverRepository struct {
+	dataset.DataRepository
+	tags map[string][]*dataset.Tag
+}
+
+func (m *mockResolverRepository) RepositoryDataset(ctx context.Context, name string) (string, []*dataset.Tag, error) {
+	id := strings.TrimPrefix(name, "dataset-")
+	tags, ok := m.tags[id]
+	if !ok {
+		return "", nil, apierror.New(apierror.ErrNotFound, "not a data repository: "+name, nil)
+	}
+	return id, tags, nil
+}
+
+func (m *mockResolverRepository) DataObject(key string) bool {
+	return !strings.HasPrefix(key, "_attachments/")
+}
+
+// mockEventPublisher sends the published events to a channel
+type mockEventPublisher struct {
+	events chan *dataset.Event
+}
+
+func (m *mockEventPublisher) Publish(ctx context.Context, event *dataset.Event) error {
+	m.events <- event
+	return nil
+}
+
+func TestLastActivity(t *testing.T) {
+	if last := lastActivity(nil); last != nil {
+		t.Errorf("expected nil last activity for no activity, got %s", last)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 30, 15, 500000000, time.UTC)
+	activity := []*dataset.ObjectActivity{
+		{Key: "a", Time: now.Add(-time.Hour)},
+		{Key: "b", Time: now.In(time.FixedZone("EST", -5*60*60))},
+		{Key: "c", Time: now.Add(-time.Minute)},
+	}
+
+	expected := time.Date(2026, 10, 18, 12, 30, 15, 0, time.UTC)
+	if last := lastActivity(activity); last == nil || !last.Equal(expected) || last.Location() != time.UTC {
+		t.Errorf("expected last activity %s, got %v", expected, last)
+	}
+}
+
+func TestActivityViolation(t *testing.T) {
+	finalized := time.Date(2026, 10, 18, 12, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		finalizedAt *time.Time
+		time        time.Time
+		violation   bool
+	}{
+		{nil, finalized.Add(time.Hour), false},
+		{&finalized, finalized.Add(-time.Second), false},
+		{&finalized, finalized.Add(500 * time.Millisecond), false},
+		{&finalized, finalized.Add(time.Second), true},
+		{&finalized, finalized.Add(time.Hour), true},
+	}
+
+	for _, test := range tests {
+		metadata := &dataset.Metadata{FinalizedAt: test.finalizedAt}
+		if v := activityViolation(metadata, &dataset.ObjectActivity{Key: "raw/a.csv", Time: test.time}); v != test.violation {
+			t.Errorf("expected violation %t for activity at %s (finalized at %v), got %t", test.violation, test.time, test.finalizedAt, v)
+		}
+	}
+}
+
+func TestTrackActivity(t *testing.T) {
+	written := time.Date(2026, 10, 18, 12, 30, 15, 0, time.UTC)
+	finalized := written.Add(-time.Hour)
+
+	groupTags := []*dataset.Tag{{Key: aws.String("spinup:group"), Value: aws.String("group1")}}
+	metadataRepo := &mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+		"abc": {ID: "abc", Group: "group1", DataStorage: "s3"},
+		"def": {ID: "def", Group: "group1", DataStorage: "s3", FinalizedAt: &finalized},
+	}}
+	auditLogRepo := &mockAuditLogRepository{messages: make(chan string, 10)}
+	publisher := &mockEventPublisher{events: make(chan *dataset.Event, 10)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := &mockActivityQueue{
+		cancel: cancel,
+		messages: []*dataset.ActivityMessage{
+			{
+				ID: "m1",
+				Activity: []*dataset.ObjectActivity{
+					{Repository: "dataset-abc", Key: "raw/a.csv", Action: dataset.ObjectCreated, Size: 42, Time: written.Add(-time.Second)},
+					{Repository: "dataset-abc", Key: "raw/b.csv", Action: dataset.ObjectCreated, Size: 10, Time: written},
+					{Repository: "dataset-abc", Key: "_attachments/readme.txt", Action: dataset.ObjectCreated, Time: written.Add(time.Second)},
+					{Repository: "someone-elses-bucket", Key: "raw/c.csv", Action: dataset.ObjectCreated, Time: written.Add(time.Second)},
+				},
+			},
+			{
+				ID:       "m2",
+				Activity: []*dataset.ObjectActivity{{Repository: "dataset-def", Key: "raw/a.csv", Action: dataset.ObjectDeleted, Principal: "AWS:AIDAEXAMPLE", Time: written}},
+			},
+			{
+				ID:       "m3",
+				Activity: []*dataset.ObjectActivity{{Repository: "dataset-ghi", Key: "raw/b.csv", Action: dataset.ObjectDeleted, Time: written}},
+			},
+		},
+	}
+
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(metadataRepo),
+		dataset.WithAuditLogRepository(auditLogRepo),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": &mockResolverRepository{tags: map[string][]*dataset.Tag{
+			"abc": groupTags,
+			"def": groupTags,
+			"ghi": groupTags,
+		}}}),
+	)
+	service.ActivityQueue = queue
+	service.EventPublisher = publisher
+
+	s := server{context: context.Background(), datasetServices: map[string]*dataset.Service{"acct": service}}
+
+	// returns once all messages are received
+	s.trackActivity(ctx, "acct", service)
+
+	if expected := []string{"m1", "m2", "m3"}; !reflect.DeepEqual(queue.deleted, expected) {
+		t.Errorf("expected deleted messages %v, got %v", expected, queue.deleted)
+	}
+
+	if last := metadataRepo.metadata["abc"].LastDataChange; last == nil || !last.Equal(written) {
+		t.Errorf("expected last data change %s, got %v", written, last)
+	}
+
+	if _, ok := metadataRepo.metadata["ghi"]; ok {
+		t.Error("expected metadata of deleted dataset ghi not to be recreated")
+	}
+
+	close(auditLogRepo.messages)
+	var logs []string
+	for l := range auditLogRepo.messages {
+		logs = append(logs, l)
+	}
+
+	expected := []string{
+		"Object created in dataset abc: raw/a.csv",
+		"Object created in dataset abc: raw/b.csv",
+		"Object deleted in dataset def: raw/a.csv",
+		"Policy violation: object deleted in finalized dataset def: raw/a.csv",
+	}
+	if len(logs) != len(expected) {
+		t.Fatalf("expected %d audit log messages, got %v", len(expected), logs)
+	}
+
+	for i, l := range logs {
+		if !strings.HasPrefix(l, expected[i]) {
+			t.Errorf("expected audit log message %q, got %q", expected[i], l)
+		}
+	}
+
+	select {
+	case event := <-publisher.events:
+		if event.Type != dataset.EventPolicyViolation || event.DatasetID != "def" || event.Group != "group1" || event.Data["key"] != "raw/a.csv" || event.Data["action"] != dataset.ObjectDeleted {
+			t.Errorf("expected policy violation for deleting raw/a.csv from dataset def, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for policy violation event")
+	}
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// encryption modes a classification can require
+const (
+	encryptionAES256 = "AES256"
+	encryptionKMS    = "aws:kms"
+)
+
+// classificationPolicy is the policy for datasets with a data classification
+type classificationPolicy struct {
+	name                string
+	requiredTags        []string
+	requireDUA          bool
+	allowDerivatives    bool
+	allowTemporaryUsers bool
+	allowSharing        bool
+	maxGrantDuration    time.Duration
+	encryption          string
+	network             *dataset.NetworkRestriction
+	finalizeRoles       []string
+}
+
+// networkRestrictor is implemented by data repositories that can restrict access by network
+type networkRestrictor interface {
+	SetNetworkRestriction(ctx context.Context, id string, restriction *dataset.NetworkRestriction) error
+}
+
+// defaultFinalizeRoles are the roles that can finalize datasets with a classification without finalizeRoles
+var defaultFinalizeRoles = []string{roleDataSteward}
+
+// classificationPolicies maps lower case data classifications to their policy
+type classificationPolicies map[string]*classificationPolicy
+
+// newClassificationPolicies creates the classification policies from the configuration
+func newClassificationPolicies(config map[string]common.Classification) (classificationPolicies, error) {
+	policies := make(classificationPolicies, len(config))
+	for name, c := range config {
+		p := &classificationPolicy{
+			name:                strings.ToLower(name),
+			requiredTags:        c.RequiredTags,
+			requireDUA:          c.RequireDUA,
+			allowDerivatives:    c.AllowDerivatives,
+			allowTemporaryUsers: c.AllowTemporaryUsers,
+			allowSharing:        c.AllowSharing,
+			encryption:          c.Encryption,
+			finalizeRoles:       c.FinalizeRoles,
+		}
+
+		// classified datasets are only finalized by data stewards, unless other roles are configured
+		if len(p.finalizeRoles) == 0 {
+			p.finalizeRoles = defaultFinalizeRoles
+		}
+
+		if c.MaxGrantDuration != "" {
+			d, err := time.ParseDuration(c.MaxGrantDuration)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid maxGrantDuration '%s' for classification %s", c.MaxGrantDuration, name)
+			}
+			p.maxGrantDuration = d
+		}
+
+		for _, r := range c.FinalizeRoles {
+			if r == "" {
+				return nil, fmt.Errorf("invalid empty finalize role for classification %s", name)
+			}
+		}
+
+		switch c.Encryption {
+		case "", encryptionAES256, encryptionKMS:
+		default:
+			return nil, fmt.Errorf("invalid encryption '%s' for classification %s", c.Encryption, name)
+		}
+
+		if len(c.AllowedVPCEndpoints) > 0 || len(c.AllowedSourceCIDRs) > 0 {
+			for _, v := range c.AllowedVPCEndpoints {
+				if !strings.HasPrefix(v, "vpce-") {
+					return nil, fmt.Errorf("invalid vpc endpoint id '%s' for classification %s", v, name)
+				}
+			}
+
+			// cidrs are stored in their canonical form, ie. 10.1.2.3/8 as 10.0.0.0/8
+			var cidrs []string
+			for _, cidr := range c.AllowedSourceCIDRs {
+				_, n, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid source cidr '%s' for classification %s", cidr, name)
+				}
+				cidrs = append(cidrs, n.String())
+			}
+
+			p.network = &dataset.NetworkRestriction{
+				VPCEndpoints: c.AllowedVPCEndpoints,
+				SourceCIDRs:  cidrs,
+			}
+		}
+
+		if _, ok := policies[p.name]; ok {
+			return nil, fmt.Errorf("duplicate classification %s", name)
+		}
+		policies[p.name] = p
+	}
+
+	return policies, nil
+}
+
+// forDataset returns the policies for the classifications of a dataset.  If any policies are configured,
+// datasets can only use the configured classifications.
+func (c classificationPolicies) forDataset(metadata *dataset.Metadata) ([]*classificationPolicy, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+
+	policies := []*classificationPolicy{}
+	for _, name := range metadata.DataClassifications {
+		p, ok := c[strings.ToLower(name)]
+		if !ok {
+			msg := fmt.Sprintf("unknown data classification '%s', must be one of %s", name, strings.Join(c.names(), ", "))
+			return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, nil
+}
+
+func (c classificationPolicies) names() []string {
+	names := make([]string, 0, len(c))
+	for n := range c {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkCreate enforces the classification policies when a dataset is provisioned, and returns the encryption mode
+// the data repository is provisioned with, empty for the default of the data repository.  KMS encryption satisfies
+// classifications that require AES256, so it's used if any of the classifications requires it.
+func (c classificationPolicies) checkCreate(metadata *dataset.Metadata, tags []*dataset.Tag, derivative bool) (string, error) {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	var encryption string
+	tagValues := make(map[string]string, len(tags))
+	for _, t := range tags {
+		tagValues[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	for _, p := range policies {
+		for _, t := range p.requiredTags {
+			if tagValues[t] == "" {
+				return "", apierror.New(apierror.ErrForbidden, fmt.Sprintf("%s datasets require the tag %s", p.name, t), nil)
+			}
+		}
+
+		if p.requireDUA && metadata.DuaURL == nil {
+			return "", apierror.New(apierror.ErrForbidden, fmt.Sprintf("%s datasets require a dua_url", p.name), nil)
+		}
+
+		if derivative && !p.allowDerivatives {
+			return "", apierror.New(apierror.ErrForbidden, fmt.Sprintf("derivatives are not allowed for %s datasets", p.name), nil)
+		}
+
+		if p.encryption != "" && encryption != encryptionKMS {
+			encryption = p.encryption
+		}
+	}
+
+	return encryption, nil
+}
+
+// checkGrant enforces the maximum grant duration of the classification policies and returns the duration of the grant.
+// If no duration is requested, the shortest maximum duration is used.  A zero duration is a grant that doesn't expire.
+func (c classificationPolicies) checkGrant(metadata *dataset.Metadata, duration time.Duration) (time.Duration, error) {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	var max time.Duration
+	var maxPolicy string
+	for _, p := range policies {
+		if p.maxGrantDuration > 0 && (max == 0 || p.maxGrantDuration < max) {
+			max = p.maxGrantDuration
+			maxPolicy = p.name
+		}
+	}
+
+	if max == 0 {
+		return duration, nil
+	}
+
+	if duration > max {
+		msg := fmt.Sprintf("access to %s datasets can be granted for at most %s", maxPolicy, max)
+		return 0, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	if duration == 0 {
+		return max, nil
+	}
+
+	return duration, nil
+}
+
+// checkTemporaryUser enforces whether temporary IAM users are allowed by the classification policies
+func (c classificationPolicies) checkTemporaryUser(metadata *dataset.Metadata) error {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		if !p.allowTemporaryUsers {
+			return apierror.New(apierror.ErrForbidden, fmt.Sprintf("temporary users are not allowed for %s datasets", p.name), nil)
+		}
+	}
+
+	return nil
+}
+
+// checkShare enforces whether sharing with other AWS accounts is allowed by the classification policies
+func (c classificationPolicies) checkShare(metadata *dataset.Metadata) error {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		if !p.allowSharing {
+			return apierror.New(apierror.ErrForbidden, fmt.Sprintf("sharing is not allowed for %s datasets", p.name), nil)
+		}
+	}
+
+	return nil
+}
+
+// checkFinalize enforces the roles that can finalize datasets with the classifications.  The caller needs one of the
+// finalize roles of every classification (data-steward if none are configured).  No role is implied, admins can only
+// finalize these datasets if admin is one of the finalize roles.
+func (c classificationPolicies) checkFinalize(metadata *dataset.Metadata, roles []string) error {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		allowed := false
+		for _, r := range p.finalizeRoles {
+			if contains(roles, r) {
+				allowed = true
+			}
+		}
+
+		if !allowed {
+			msg := fmt.Sprintf("only callers with the role %s can finalize %s datasets", strings.Join(p.finalizeRoles, " or "), p.name)
+			return apierror.New(apierror.ErrForbidden, msg, nil)
+		}
+	}
+
+	return nil
+}
+
+// networkRestriction returns the network restriction of the classification policies, or nil if none of the policies
+// restrict access by network (and the account restriction applies).  A dataset with multiple restricting classifications
+// is only accessible through the VPC endpoints and source CIDRs allowed by all of them.
+func (c classificationPolicies) networkRestriction(metadata *dataset.Metadata) (*dataset.NetworkRestriction, error) {
+	policies, err := c.forDataset(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var restriction *dataset.NetworkRestriction
+	names := []string{}
+	for _, p := range policies {
+		if p.network == nil {
+			continue
+		}
+
+		names = append(names, p.name)
+		if restriction == nil {
+			restriction = &dataset.NetworkRestriction{
+				VPCEndpoints: p.network.VPCEndpoints,
+				SourceCIDRs:  p.network.SourceCIDRs,
+			}
+			continue
+		}
+
+		restriction.VPCEndpoints = intersect(restriction.VPCEndpoints, p.network.VPCEndpoints)
+		restriction.SourceCIDRs = intersectCIDRs(restriction.SourceCIDRs, p.network.SourceCIDRs)
+	}
+
+	if restriction != nil && restriction.Empty() {
+		msg := fmt.Sprintf("classifications %s have no allowed vpc endpoints or source cidrs in common", strings.Join(names, ", "))
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	return restriction, nil
+}
+
+// intersect returns the strings that are in both a and b, in the order of a
+func intersect(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+
+	out := []string{}
+	for _, s := range a {
+		if in[s] {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// intersectCIDRs returns the address ranges that are in both a and b, in the order of a.  Two CIDR blocks either don't
+// overlap or one contains the other, so their intersection is the smaller block.
+func intersectCIDRs(a, b []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, x := range a {
+		_, xn, err := net.ParseCIDR(x)
+		if err != nil {
+			continue
+		}
+		xOnes, _ := xn.Mask.Size()
+
+		for _, y := range b {
+			_, yn, err := net.ParseCIDR(y)
+			if err != nil {
+				continue
+			}
+			yOnes, _ := yn.Mask.Size()
+
+			var n *net.IPNet
+			switch {
+			case xOnes <= yOnes && xn.Contains(yn.IP):
+				n = yn
+			case yOnes < xOnes && yn.Contains(xn.IP):
+				n = xn
+			default:
+				continue
+			}
+
+			if s := n.String(); !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pkg/errors"
+)
+
+func TestClassificationPolicies(t *testing.T) {
+	c, err := newClassificationPolicies(map[string]common.Classification{
+		"HIPAA": {
+			RequiredTags:     []string{"spinup:pi"},
+			RequireDUA:       true,
+			MaxGrantDuration: "72h",
+			Encryption:       encryptionKMS,
+		},
+		"pii": {
+			AllowDerivatives:    true,
+			AllowTemporaryUsers: true,
+			MaxGrantDuration:    "168h",
+		},
+		"low": {
+			AllowDerivatives:    true,
+			AllowTemporaryUsers: true,
+			AllowSharing:        true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isForbidden := func(err error) bool {
+		aerr, ok := errors.Cause(err).(apierror.Error)
+		return ok && aerr.Code == apierror.ErrForbidden
+	}
+
+	dua, _ := url.Parse("https://dua.example.edu/123")
+	hipaa := &dataset.Metadata{DataClassifications: []string{"hipaa"}, DuaURL: dua}
+	pii := &dataset.Metadata{DataClassifications: []string{"pii"}}
+	low := &dataset.Metadata{DataClassifications: []string{"low"}}
+	tags := []*dataset.Tag{{Key: aws.String("spinup:pi"), Value: aws.String("awong")}}
+
+	// test create
+	if encryption, err := c.checkCreate(hipaa, tags, false); err != nil || encryption != encryptionKMS {
+		t.Errorf("expected %s encryption and nil error, got '%s' and %v", encryptionKMS, encryption, err)
+	}
+
+	if _, err := c.checkCreate(hipaa, nil, false); !isForbidden(err) {
+		t.Errorf("expected forbidden error for missing tag, got %v", err)
+	}
+
+	if _, err := c.checkCreate(&dataset.Metadata{DataClassifications: []string{"HIPAA"}}, tags, false); !isForbidden(err) {
+		t.Errorf("expected forbidden error for missing dua url, got %v", err)
+	}
+
+	if _, err := c.checkCreate(hipaa, tags, true); !isForbidden(err) {
+		t.Errorf("expected forbidden error for derivative, got %v", err)
+	}
+
+	if encryption, err := c.checkCreate(pii, nil, true); err != nil || encryption != "" {
+		t.Errorf("expected default encryption and nil error, got '%s' and %v", encryption, err)
+	}
+
+	if _, err := c.checkCreate(&dataset.Metadata{DataClassifications: []string{"secret"}}, nil, false); err == nil {
+		t.Error("expected error for unknown classification, got nil")
+	}
+
+	// kms encryption wins over AES256
+	mixed, err := newClassificationPolicies(map[string]common.Classification{
+		"hipaa": {Encryption: encryptionKMS},
+		"pii":   {Encryption: encryptionAES256},
+		"low":   {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptionTests := []struct {
+		classifications []string
+		expected        string
+	}{
+		{[]string{"low"}, ""},
+		{[]string{"pii"}, encryptionAES256},
+		{[]string{"hipaa"}, encryptionKMS},
+		{[]string{"pii", "hipaa", "low"}, encryptionKMS},
+		{[]string{"hipaa", "pii"}, encryptionKMS},
+	}
+
+	for _, tst := range encryptionTests {
+		if encryption, err := mixed.checkCreate(&dataset.Metadata{DataClassifications: tst.classifications}, nil, false); err != nil || encryption != tst.expected {
+			t.Errorf("expected encryption '%s' for %v, got '%s' (%v)", tst.expected, tst.classifications, encryption, err)
+		}
+	}
+
+	// test grants
+	type grantTest struct {
+		metadata  *dataset.Metadata
+		requested time.Duration
+		expected  time.Duration
+		forbidden bool
+	}
+
+	grantTests := []grantTest{
+		{hipaa, 0, 72 * time.Hour, false},
+		{hipaa, 24 * time.Hour, 24 * time.Hour, false},
+		{hipaa, 96 * time.Hour, 0, true},
+		{&dataset.Metadata{DataClassifications: []string{"hipaa", "pii"}}, 0, 72 * time.Hour, false},
+		{pii, 96 * time.Hour, 96 * time.Hour, false},
+		{low, 0, 0, false},
+	}
+
+	for _, tst := range grantTests {
+		d, err := c.checkGrant(tst.metadata, tst.requested)
+		if tst.forbidden {
+			if !isForbidden(err) {
+				t.Errorf("expected forbidden error for grant of %s, got %v", tst.requested, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected nil error, got %s", err)
+		}
+
+		if d != tst.expected {
+			t.Errorf("expected grant duration %s, got %s", tst.expected, d)
+		}
+	}
+
+	// test temporary users
+	if err := c.checkTemporaryUser(hipaa); !isForbidden(err) {
+		t.Errorf("expected forbidden error for temporary user, got %v", err)
+	}
+
+	if err := c.checkTemporaryUser(low); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	// test sharing
+	if err := c.checkShare(hipaa); !isForbidden(err) {
+		t.Errorf("expected forbidden error for share, got %v", err)
+	}
+
+	if err := c.checkShare(low); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	// test no policies
+	var none classificationPolicies
+	if _, err := none.checkCreate(&dataset.Metadata{DataClassifications: []string{"anything"}}, nil, true); err != nil {
+		t.Errorf("expected nil error without policies, got %s", err)
+	}
+
+	// test invalid configuration
+	if _, err := newClassificationPolicies(map[string]common.Classification{"bad": {MaxGrantDuration: "forever"}}); err == nil {
+		t.Error("expected error for invalid duration, got nil")
+	}
+
+	if _, err := newClassificationPolicies(map[string]common.Classification{"bad": {Encryption: "rot13"}}); err == nil {
+		t.Error("expected error for invalid encryption, got nil")
+	}
+}
+
+func TestClassificationNetworkRestriction(t *testing.T) {
+	c, err := newClassificationPolicies(map[string]common.Classification{
+		"hipaa": {
+			AllowedVPCEndpoints: []string{"vpce-1", "vpce-2"},
+			AllowedSourceCIDRs:  []string{"10.0.0.0/8"},
+		},
+		"pii": {
+			AllowedVPCEndpoints: []string{"vpce-2", "vpce-3"},
+		},
+		"external": {
+			AllowedSourceCIDRs: []string{"192.0.2.0/24"},
+		},
+		"research": {
+			AllowedSourceCIDRs: []string{"10.1.2.3/16", "172.16.0.0/12", "2001:db8::/32"},
+		},
+		"campus": {
+			AllowedSourceCIDRs: []string{"0.0.0.0/0", "2001:db8:1::/48"},
+		},
+		"low": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type restrictionTest struct {
+		classifications []string
+		expected        *dataset.NetworkRestriction
+		forbidden       bool
+	}
+
+	tests := []restrictionTest{
+		{classifications: []string{"low"}},
+		{
+			classifications: []string{"hipaa"},
+			expected:        &dataset.NetworkRestriction{VPCEndpoints: []string{"vpce-1", "vpce-2"}, SourceCIDRs: []string{"10.0.0.0/8"}},
+		},
+		{
+			classifications: []string{"low", "pii"},
+			expected:        &dataset.NetworkRestriction{VPCEndpoints: []string{"vpce-2", "vpce-3"}},
+		},
+		{
+			classifications: []string{"hipaa", "pii"},
+			expected:        &dataset.NetworkRestriction{VPCEndpoints: []string{"vpce-2"}, SourceCIDRs: []string{}},
+		},
+		{classifications: []string{"pii", "external"}, forbidden: true},
+		{
+			classifications: []string{"research"},
+			expected:        &dataset.NetworkRestriction{SourceCIDRs: []string{"10.1.0.0/16", "172.16.0.0/12", "2001:db8::/32"}},
+		},
+		{
+			classifications: []string{"hipaa", "research"},
+			expected:        &dataset.NetworkRestriction{VPCEndpoints: []string{}, SourceCIDRs: []string{"10.1.0.0/16"}},
+		},
+		{
+			classifications: []string{"research", "campus"},
+			expected:        &dataset.NetworkRestriction{VPCEndpoints: []string{}, SourceCIDRs: []string{"10.1.0.0/16", "172.16.0.0/12", "2001:db8:1::/48"}},
+		},
+		{classifications: []string{"external", "research"}, forbidden: true},
+	}
+
+	for _, tst := range tests {
+		r, err := c.networkRestriction(&dataset.Metadata{DataClassifications: tst.classifications})
+		if tst.forbidden {
+			if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrForbidden {
+				t.Errorf("expected forbidden error for %v, got %v", tst.classifications, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected nil error for %v, got %s", tst.classifications, err)
+		}
+
+		if !reflect.DeepEqual(r, tst.expected) {
+			t.Errorf("expected restriction %+v for %v, got %+v", tst.expected, tst.classifications, r)
+		}
+	}
+
+	// test invalid configuration
+	if _, err := newClassificationPolicies(map[string]common.Classification{"bad": {AllowedVPCEndpoints: []string{"vpc-123"}}}); err == nil {
+		t.Error("expected error for invalid vpc endpoint, got nil")
+	}
+
+	if _, err := newClassificationPolicies(map[string]common.Classification{"bad": {AllowedSourceCIDRs: []string{"10.0.0.1"}}}); err == nil {
+		t.Error("expected error for invalid source cidr, got nil")
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/YaleSpinup/ds-api/webhook"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookWorkers is the number of workers delivering the events of each account to webhooks
+const webhookWorkers = 4
+
+// startWebhooks starts a webhook dispatcher for each account with a webhook repository.  The dispatchers deliver
+// events until the context is cancelled.
+func (s *server) startWebhooks(ctx context.Context) {
+	s.webhooks = make(map[string]*webhook.Dispatcher)
+
+	for account, service := range s.datasetServices {
+		if service.WebhookRepository == nil {
+			continue
+		}
+
+		d := webhook.New(account, service.WebhookRepository)
+		s.webhooks[account] = d
+
+		s.run(func() { d.Run(ctx, webhookWorkers) })
+	}
+}
+
+// eventPublishTimeout is how long publishing an event to the event publisher of an account may take
+const eventPublishTimeout = 30 * time.Second
+
+// publishEvent publishes a dataset lifecycle event to the webhooks and the event publisher of the account.  Events
+// are published in the background, failing to publish an event doesn't fail the request that caused it.
+func (s *server) publishEvent(ctx context.Context, account string, event *dataset.Event) {
+	if d, ok := s.webhooks[account]; ok {
+		if err := d.Publish(ctx, event); err != nil {
+			log.WithContext(ctx).Errorf("failed to publish %s event for dataset %s in account %s to webhooks: %s", event.Type, event.DatasetID, account, err)
+		}
+	}
+
+	service, ok := s.datasetServices[account]
+	if !ok || service.EventPublisher == nil {
+		return
+	}
+
+	// don't tie the publishing to the request, it's cancelled once the response is written.  The publishing is tracked
+	// with the other workers and isn't cancelled when the server stops, so stopping waits for in-flight events.
+	s.run(func() {
+		ctx, cancel := context.WithTimeout(dataset.NewRequestIDContext(context.WithoutCancel(s.context), event.RequestID), eventPublishTimeout)
+		defer cancel()
+
+		if err := service.EventPublisher.Publish(ctx, event); err != nil {
+			log.WithContext(ctx).Errorf("failed to publish %s event for dataset %s in account %s: %s", event.Type, event.DatasetID, account, err)
+		}
+	})
+}
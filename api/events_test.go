@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// slowEventPublisher records the published events after a delay, unless the context is cancelled first
+type slowEventPublisher struct {
+	delay     time.Duration
+	published []*dataset.Event
+}
+
+func (m *slowEventPublisher) Publish(ctx context.Context, event *dataset.Event) error {
+	select {
+	case <-time.After(m.delay):
+		m.published = append(m.published, event)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestPublishEventStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	publisher := &slowEventPublisher{delay: 50 * time.Millisecond}
+	s := server{
+		datasetServices: map[string]*dataset.Service{"acct": dataset.NewService(dataset.WithEventPublisher(publisher))},
+		context:         ctx,
+	}
+
+	s.publishEvent(context.Background(), "acct", &dataset.Event{Type: dataset.EventDatasetFinalized, DatasetID: "abc"})
+
+	// stopping the server waits for the event in flight instead of dropping it
+	cancel()
+	s.workers.Wait()
+
+	if len(publisher.published) != 1 {
+		t.Errorf("expected the event to be published before stopping, got %d events", len(publisher.published))
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// grantSweepInterval is how often expired grants are revoked
+const grantSweepInterval = 5 * time.Minute
+
+// expireGrants periodically revokes expired grants and shares until the context is cancelled
+func (s *server) expireGrants(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for account, service := range s.datasetServices {
+				if service.GrantRepository != nil {
+					if err := s.revokeExpiredGrants(ctx, service, account, time.Now()); err != nil {
+						log.WithContext(ctx).Errorf("failed to revoke expired grants in account %s: %s", account, err)
+					}
+				}
+
+				if service.ShareRepository != nil {
+					if err := revokeExpiredShares(ctx, service, account, time.Now()); err != nil {
+						log.WithContext(ctx).Errorf("failed to revoke expired shares in account %s: %s", account, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// revokeExpiredGrants revokes the grants in an account that are expired at the given time
+func (s *server) revokeExpiredGrants(ctx context.Context, service *dataset.Service, account string, now time.Time) error {
+	grants, err := service.GrantRepository.ListGrants(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range grants {
+		if !g.Expired(now) {
+			continue
+		}
+
+		log.WithContext(ctx).Infof("revoking expired access to data set '%s' in account %s for instance: %s", g.DatasetID, account, g.InstanceID)
+
+		if err := s.revokeGrant(ctx, service, account, g); err != nil {
+			log.WithContext(ctx).Errorf("failed to revoke expired grant for instance %s to dataset %s: %s", g.InstanceID, g.DatasetID, err)
+			continue
+		}
+
+		auditLog := service.AuditLogRepository.Log(ctx, g.Group, g.DatasetID)
+		auditLog <- fmt.Sprintf("Revoked expired instance access to dataset %s (InstanceID: %s, ExpiresAt: %s)", g.DatasetID, g.InstanceID, g.ExpiresAt.Format(time.RFC3339))
+
+		s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventAccessRevoked, account, g.Group, g.DatasetID, "", map[string]interface{}{
+			"principal":      g.InstanceID,
+			"principal_type": principalType(g.InstanceID),
+			"expired":        true,
+		}))
+	}
+
+	return nil
+}
+
+// revokeGrant revokes the access of an expired grant and deletes the grant.  Grants of deleted datasets are
+// just deleted.
+func (s *server) revokeGrant(ctx context.Context, service *dataset.Service, account string, g *dataset.Grant) error {
+	metadata, err := service.MetadataRepository.Get(ctx, account, g.DatasetID)
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+			return service.GrantRepository.DeleteGrant(ctx, account, g.DatasetID, g.InstanceID)
+		}
+		return err
+	}
+
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		return fmt.Errorf("data repository type not supported for this account: %s", metadata.DataStorage)
+	}
+
+	access, err := dataRepo.ListAccess(ctx, g.DatasetID)
+	if err != nil {
+		return err
+	}
+
+	// access may have been revoked already
+	if _, ok := access[g.InstanceID]; ok {
+		if err := dataRepo.RevokeAccess(ctx, g.DatasetID, g.InstanceID); err != nil {
+			return err
+		}
+	}
+
+	return service.GrantRepository.DeleteGrant(ctx, account, g.DatasetID, g.InstanceID)
+}
+
+// revokeExpiredShares revokes the shares in an account that are expired at the given time.  Shares of deleted
+// datasets are just deleted.
+func revokeExpiredShares(ctx context.Context, service *dataset.Service, account string, now time.Time) error {
+	shares, err := service.ShareRepository.ListShares(ctx, account, "")
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		if !share.Expired(now) {
+			continue
+		}
+
+		log.WithContext(ctx).Infof("revoking expired share %s of data set '%s' in account %s with account %s", share.ID, share.DatasetID, account, share.AccountID)
+
+		metadata, err := service.MetadataRepository.Get(ctx, account, share.DatasetID)
+		if err != nil {
+			if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				if err := service.ShareRepository.DeleteShare(ctx, account, share.DatasetID, share.ID); err != nil {
+					log.WithContext(ctx).Errorf("failed to delete share %s of deleted dataset %s: %s", share.ID, share.DatasetID, err)
+				}
+				continue
+			}
+			log.WithContext(ctx).Errorf("failed to get dataset %s to revoke expired share %s: %s", share.DatasetID, share.ID, err)
+			continue
+		}
+
+		if err := revokeShare(ctx, service, account, metadata, share); err != nil {
+			log.WithContext(ctx).Errorf("failed to revoke expired share %s of dataset %s: %s", share.ID, share.DatasetID, err)
+			continue
+		}
+
+		auditLog := service.AuditLogRepository.Log(ctx, share.Group, share.DatasetID)
+		auditLog <- fmt.Sprintf("Revoked expired share of dataset %s with account %s (%s)", share.DatasetID, share.AccountID, shareFields(share))
+	}
+
+	return nil
+}
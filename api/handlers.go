@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -13,7 +14,7 @@ import (
 // PingHandler responds to ping requests
 func (s *server) PingHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
-	log.Debug("Ping/Pong")
+	log.WithContext(r.Context()).Debug("Ping/Pong")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("pong"))
@@ -45,27 +46,68 @@ func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// handleError handles standard apierror return codes
+// requestIDHeader is the header with the id of a request
+const requestIDHeader = "X-Request-ID"
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Code      string           `json:"code"`
+	Message   string           `json:"message"`
+	RequestID string           `json:"request_id"`
+	Details   *json.RawMessage `json:"details,omitempty"`
+}
+
+// handleError handles standard apierror return codes and writes the error as json.  The message of errors that
+// aren't an apierror isn't returned, since it may contain internals of the AWS services.
 func handleError(w http.ResponseWriter, err error) {
-	log.Error(err.Error())
+	requestID := w.Header().Get(requestIDHeader)
+	if requestID == "" {
+		requestID = uuid.NewString()
+		w.Header().Set(requestIDHeader, requestID)
+	}
+
+	log.WithField("request_id", requestID).Error(err.Error())
+
+	output := errorResponse{
+		Code:      apierror.ErrInternalError,
+		Message:   "internal error",
+		RequestID: requestID,
+	}
+
 	if aerr, ok := errors.Cause(err).(apierror.Error); ok {
-		switch aerr.Code {
-		case apierror.ErrForbidden:
-			w.WriteHeader(http.StatusForbidden)
-		case apierror.ErrNotFound:
-			w.WriteHeader(http.StatusNotFound)
-		case apierror.ErrConflict:
-			w.WriteHeader(http.StatusConflict)
-		case apierror.ErrBadRequest:
-			w.WriteHeader(http.StatusBadRequest)
-		case apierror.ErrLimitExceeded:
-			w.WriteHeader(http.StatusTooManyRequests)
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		w.Write([]byte(aerr.Message))
-	} else {
+		output.Code = aerr.Code
+		output.Message = aerr.Message
+		output.Details = aerr.Details
+	}
+
+	j, jerr := json.Marshal(&output)
+	if jerr != nil {
+		log.Errorf("cannot encode error response into json: %s", jerr)
 		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errorStatus(output.Code))
+	w.Write(j)
+}
+
+// errorStatus returns the http status code for an apierror code
+func errorStatus(code string) int {
+	switch code {
+	case apierror.ErrForbidden:
+		return http.StatusForbidden
+	case apierror.ErrNotFound:
+		return http.StatusNotFound
+	case apierror.ErrConflict:
+		return http.StatusConflict
+	case apierror.ErrBadRequest:
+		return http.StatusBadRequest
+	case apierror.ErrLimitExceeded:
+		return http.StatusTooManyRequests
+	case apierror.ErrServiceUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
 	}
 }
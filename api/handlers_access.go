@@ -0,0 +1,468 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// grant types of dataset access
+const (
+	grantTypeInstance = "instance"
+	grantTypeRole     = "role"
+)
+
+// accessGrant is an instance or role with access to a dataset
+type accessGrant struct {
+	Type       string     `json:"type"`
+	Principal  string     `json:"principal"`
+	Role       string     `json:"role"`
+	Permission string     `json:"permission,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// accessPermissionLister is implemented by data repositories that can list the permission level of each grant
+type accessPermissionLister interface {
+	ListAccessPermissions(ctx context.Context, id string) (dataset.Access, map[string]string, error)
+}
+
+// AccessCreateHandler grants an instance or an existing IAM role access to a dataset
+func (s *server) AccessCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceGrant); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	input := struct {
+		InstanceID string `json:"instance_id"`
+		RoleArn    string `json:"role_arn"`
+		Permission string `json:"permission"`
+		Duration   string `json:"duration"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		msg := "cannot decode body into create access input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	principal, err := grantPrincipal(input.InstanceID, input.RoleArn)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var duration time.Duration
+	if input.Duration != "" {
+		if duration, err = time.ParseDuration(input.Duration); err != nil || duration <= 0 {
+			msg := fmt.Sprintf("invalid duration '%s'", input.Duration)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	user, _ := requestUser(r)
+
+	log.WithContext(r.Context()).Infof("provisioning access to data set '%s' in account '%s' for %s: %s", id, account, principalType(principal), principal)
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	permission, err := grantPermission(metadata, input.Permission)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err = requireApproval(service, metadata, dataset.ApprovalActionGrant); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	datasetAccess, expiresAt, err := s.grantAccess(r.Context(), service, account, group, id, principal, permission, user, duration, metadata)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	output := accessGrant{
+		Type:       principalType(principal),
+		Principal:  principal,
+		Role:       datasetAccess[principal],
+		Permission: permission,
+		ExpiresAt:  expiresAt,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode access output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// grantAccess grants an instance or role access to the data repository of a dataset with the permission level.
+// The duration is limited by the classification policies of the dataset, grants with a duration are recorded and
+// revoked once they expire.
+func (s *server) grantAccess(ctx context.Context, service *dataset.Service, account, group, id, principal, permission, user string, duration time.Duration, metadata *dataset.Metadata) (dataset.Access, *time.Time, error) {
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		return nil, nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	duration, err := s.classifications.checkGrant(metadata, duration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if duration > 0 && service.GrantRepository == nil {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "expiring grants are not supported for this account", nil)
+	}
+
+	// grant access to this data repository
+	datasetAccess, err := dataRepo.GrantAccess(ctx, id, principal, permission)
+	if err != nil {
+		// keep client errors from validating the role
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && (aerr.Code == apierror.ErrBadRequest || aerr.Code == apierror.ErrForbidden) {
+			return nil, nil, err
+		}
+		msg := fmt.Sprintf("failed to grant access to data repository for dataset %s", id)
+		return nil, nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	var expiresAt *time.Time
+	if duration > 0 {
+		now := time.Now().UTC().Truncate(time.Second)
+		expires := now.Add(duration)
+		expiresAt = &expires
+
+		if err = service.GrantRepository.PutGrant(ctx, account, &dataset.Grant{
+			DatasetID:  id,
+			Group:      group,
+			InstanceID: principal,
+			Permission: permission,
+			GrantedAt:  &now,
+			GrantedBy:  user,
+			ExpiresAt:  expiresAt,
+		}); err != nil {
+			// don't leave a grant behind that never expires
+			if rErr := dataRepo.RevokeAccess(ctx, id, principal); rErr != nil {
+				log.WithContext(ctx).Errorf("failed to revoke access for %s to dataset %s after failing to record grant: %s", principal, id, rErr)
+			}
+			msg := fmt.Sprintf("failed to record grant to data repository for dataset %s", id)
+			return nil, nil, apierror.New(apierror.ErrInternalError, msg, err)
+		}
+	} else if service.GrantRepository != nil {
+		// a grant without a duration replaces any earlier expiring grant
+		if err = service.GrantRepository.DeleteGrant(ctx, account, id, principal); err != nil {
+			log.WithContext(ctx).Warnf("failed to delete earlier grant for %s to dataset %s: %s", principal, id, err)
+		}
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
+	msg := fmt.Sprintf("Granted %s access to dataset %s (%s, Permission: %s)", principalType(principal), id, principalField(principal), permission)
+	if expiresAt != nil {
+		msg = fmt.Sprintf("Granted %s access to dataset %s (%s, Permission: %s, ExpiresAt: %s)", principalType(principal), id, principalField(principal), permission, expiresAt.Format(time.RFC3339))
+	}
+	auditLog <- msg
+
+	data := map[string]interface{}{
+		"principal":      principal,
+		"principal_type": principalType(principal),
+		"permission":     permission,
+	}
+	if expiresAt != nil {
+		data["expires_at"] = expiresAt.Format(time.RFC3339)
+	}
+	s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventAccessGranted, account, group, id, user, data))
+
+	return datasetAccess, expiresAt, nil
+}
+
+// grantPermission returns the permission level of a grant to the dataset.  Only derivatives that aren't finalized
+// can be written to, grants default to write access for those and read access for all other datasets.
+func grantPermission(metadata *dataset.Metadata, permission string) (string, error) {
+	writable := metadata.Derivative && metadata.FinalizedAt == nil
+
+	switch permission {
+	case "":
+		if writable {
+			return dataset.PermissionWrite, nil
+		}
+		return dataset.PermissionRead, nil
+	case dataset.PermissionRead:
+		return permission, nil
+	case dataset.PermissionWrite:
+		if !writable {
+			msg := fmt.Sprintf("write access is only allowed to derivative datasets that are not finalized, dataset %s is not writable", metadata.ID)
+			return "", apierror.New(apierror.ErrForbidden, msg, nil)
+		}
+		return permission, nil
+	default:
+		msg := fmt.Sprintf("invalid permission '%s', must be one of read or write", permission)
+		return "", apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+}
+
+// principalType returns the type of the principal of a grant, a role ARN or an instance id
+func principalType(principal string) string {
+	if strings.HasPrefix(principal, "arn:") {
+		return grantTypeRole
+	}
+	return grantTypeInstance
+}
+
+// principalField formats the principal of a grant for the audit log
+func principalField(principal string) string {
+	if principalType(principal) == grantTypeRole {
+		return "RoleArn: " + principal
+	}
+	return "InstanceID: " + principal
+}
+
+// AccessListHandler lists all instances and roles that have access to the dataset
+func (s *server) AccessListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("listing access to data set '%s' in account %s", id, account)
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	var datasetAccess dataset.Access
+	var permissions map[string]string
+	if lister, ok := dataRepo.(accessPermissionLister); ok {
+		datasetAccess, permissions, err = lister.ListAccessPermissions(r.Context(), id)
+	} else {
+		datasetAccess, err = dataRepo.ListAccess(r.Context(), id)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("failed to list access to data repository for dataset %s", id)
+		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
+		return
+	}
+
+	// grants to datasets that aren't writable only allow reads, whatever access policy is attached
+	if !metadata.Derivative || metadata.FinalizedAt != nil {
+		permissions = map[string]string{}
+		for principal := range datasetAccess {
+			permissions[principal] = dataset.PermissionRead
+		}
+	}
+
+	// add the expiration of expiring grants
+	expires := map[string]*time.Time{}
+	if service.GrantRepository != nil {
+		grants, err := service.GrantRepository.ListGrants(r.Context(), account)
+		if err != nil {
+			log.WithContext(r.Context()).Warnf("failed to list grants for dataset %s: %s", id, err)
+		}
+
+		for _, g := range grants {
+			if g.DatasetID == id {
+				expires[g.InstanceID] = g.ExpiresAt
+			}
+		}
+	}
+
+	grants := make([]accessGrant, 0, len(datasetAccess))
+	for principal, role := range datasetAccess {
+		grants = append(grants, accessGrant{
+			Type:       principalType(principal),
+			Principal:  principal,
+			Role:       role,
+			Permission: permissions[principal],
+			ExpiresAt:  expires[principal],
+		})
+	}
+
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Principal < grants[j].Principal })
+
+	output := struct {
+		ID     string        `json:"id"`
+		Access []accessGrant `json:"access"`
+	}{
+		id,
+		grants,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode access output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// AccessDeleteHandler revokes the access of an instance or role to a dataset.  The principal is the instance id
+// or the role ARN.
+func (s *server) AccessDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceRevoke); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+	principal := vars["principal"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("revoking access to data set '%s' in account %s for %s: %s", id, account, principalType(principal), principal)
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err = s.revokeAccess(r, service, account, group, id, principal, metadata); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte{})
+}
+
+// revokeAccess revokes the access of an instance or role to the data repository of a dataset, and deletes
+// any expiring grant
+func (s *server) revokeAccess(r *http.Request, service *dataset.Service, account, group, id, principal string, metadata *dataset.Metadata) error {
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	// list current access to this data repository
+	listAccess, err := dataRepo.ListAccess(r.Context(), id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to list access to data repository for dataset %s", id)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	// check if requested principal currently has access
+	if _, ok := listAccess[principal]; !ok {
+		msg := fmt.Sprintf("%s %s currently does not have access to data repository for dataset %s", principalType(principal), principal, id)
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	// revoke access to this data repository
+	if err = dataRepo.RevokeAccess(r.Context(), id, principal); err != nil {
+		msg := fmt.Sprintf("failed to revoke access to data repository for dataset %s", id)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	if service.GrantRepository != nil {
+		if err = service.GrantRepository.DeleteGrant(r.Context(), account, id, principal); err != nil {
+			log.WithContext(r.Context()).Warnf("failed to delete grant for %s to dataset %s: %s", principal, id, err)
+		}
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Revoked %s access to dataset %s (%s)", principalType(principal), id, principalField(principal))
+
+	user, _ := requestUser(r)
+	s.publishEvent(r.Context(), account, dataset.NewEvent(r.Context(), dataset.EventAccessRevoked, account, group, id, user, map[string]interface{}{
+		"principal":      principal,
+		"principal_type": principalType(principal),
+	}))
+
+	return nil
+}
+
+// grantPrincipal returns the principal of a grant request, which has either an instance id or a role ARN
+func grantPrincipal(instanceID, roleArn string) (string, error) {
+	switch {
+	case instanceID != "" && roleArn != "":
+		return "", apierror.New(apierror.ErrBadRequest, "only one of instance_id or role_arn is allowed", nil)
+	case roleArn != "":
+		if principalType(roleArn) != grantTypeRole {
+			return "", apierror.New(apierror.ErrBadRequest, "invalid role_arn "+roleArn, nil)
+		}
+		return roleArn, nil
+	case instanceID != "":
+		if principalType(instanceID) != grantTypeInstance {
+			return "", apierror.New(apierror.ErrBadRequest, "invalid instance_id "+instanceID, nil)
+		}
+		return instanceID, nil
+	default:
+		return "", apierror.New(apierror.ErrBadRequest, "instance_id or role_arn is required", nil)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+func TestGrantPrincipal(t *testing.T) {
+	type test struct {
+		instanceID string
+		roleArn    string
+		expected   string
+		err        bool
+	}
+
+	tests := []test{
+		{instanceID: "i-0123456789abcdef0", expected: "i-0123456789abcdef0"},
+		{roleArn: "arn:aws:iam::012345678901:role/apps/ecsTask", expected: "arn:aws:iam::012345678901:role/apps/ecsTask"},
+		{instanceID: "i-0123456789abcdef0", roleArn: "arn:aws:iam::012345678901:role/apps/ecsTask", err: true},
+		{instanceID: "arn:aws:iam::012345678901:role/apps/ecsTask", err: true},
+		{roleArn: "ecsTask", err: true},
+		{err: true},
+	}
+
+	for _, tst := range tests {
+		principal, err := grantPrincipal(tst.instanceID, tst.roleArn)
+		if tst.err {
+			if err == nil {
+				t.Errorf("expected error for %+v, got nil", tst)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected nil error for %+v, got %s", tst, err)
+		}
+
+		if principal != tst.expected {
+			t.Errorf("expected principal %s, got %s", tst.expected, principal)
+		}
+	}
+
+	if principalType("arn:aws:iam::012345678901:role/ecsTask") != grantTypeRole || principalType("i-0123456789abcdef0") != grantTypeInstance {
+		t.Error("expected role arns to be role grants and instance ids to be instance grants")
+	}
+}
+
+func TestGrantPermission(t *testing.T) {
+	finalized := time.Now()
+
+	type test struct {
+		metadata   *dataset.Metadata
+		permission string
+		expected   string
+		err        bool
+	}
+
+	tests := []test{
+		{metadata: &dataset.Metadata{}, expected: dataset.PermissionRead},
+		{metadata: &dataset.Metadata{}, permission: dataset.PermissionRead, expected: dataset.PermissionRead},
+		{metadata: &dataset.Metadata{}, permission: dataset.PermissionWrite, err: true},
+		{metadata: &dataset.Metadata{Derivative: true}, expected: dataset.PermissionWrite},
+		{metadata: &dataset.Metadata{Derivative: true}, permission: dataset.PermissionRead, expected: dataset.PermissionRead},
+		{metadata: &dataset.Metadata{Derivative: true}, permission: dataset.PermissionWrite, expected: dataset.PermissionWrite},
+		{metadata: &dataset.Metadata{Derivative: true, FinalizedAt: &finalized}, expected: dataset.PermissionRead},
+		{metadata: &dataset.Metadata{Derivative: true, FinalizedAt: &finalized}, permission: dataset.PermissionWrite, err: true},
+		{metadata: &dataset.Metadata{Derivative: true}, permission: "admin", err: true},
+	}
+
+	for _, tst := range tests {
+		permission, err := grantPermission(tst.metadata, tst.permission)
+		if tst.err {
+			if err == nil {
+				t.Errorf("expected error for %+v, got nil", tst)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected nil error for %+v, got %s", tst, err)
+		}
+
+		if permission != tst.expected {
+			t.Errorf("expected permission %s, got %s", tst.expected, permission)
+		}
+	}
+}
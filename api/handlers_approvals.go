@@ -0,0 +1,442 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// approvalExpiration is how long an approval request stays pending before it expires
+const approvalExpiration = 72 * time.Hour
+
+// approvalActions maps the actions that can be requested for approval to the action required to approve them
+var approvalActions = map[string]string{
+	dataset.ApprovalActionPromote: actionDatasetPromote,
+	dataset.ApprovalActionDelete:  actionDatasetDelete,
+	dataset.ApprovalActionGrant:   actionInstanceGrant,
+}
+
+// requireApproval returns a forbidden error if the action on a classified dataset has to go through an
+// approval request instead of running immediately
+func requireApproval(service *dataset.Service, metadata *dataset.Metadata, action string) error {
+	if service.ApprovalRepository == nil || len(metadata.DataClassifications) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("dataset is classified, %s requires an approved request", action)
+	return apierror.New(apierror.ErrForbidden, msg, nil)
+}
+
+// ApprovalCreateHandler opens a pending approval request for an action on a dataset
+func (s *server) ApprovalCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionApprovalRequest); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	user, ok := requestUser(r)
+	if !ok {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "X-Forwarded-User header is required", nil))
+		return
+	}
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ApprovalRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "approvals are not supported for this account", nil))
+		return
+	}
+
+	input := struct {
+		Action     string `json:"action"`
+		InstanceID string `json:"instance_id"`
+		RoleArn    string `json:"role_arn"`
+		Permission string `json:"permission"`
+		Duration   string `json:"duration"`
+		Comment    string `json:"comment"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		msg := "cannot decode body into create approval input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if _, ok := approvalActions[input.Action]; !ok {
+		msg := fmt.Sprintf("invalid approval action '%s', must be one of promote, delete or grant", input.Action)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	if input.Action == dataset.ApprovalActionGrant {
+		if _, err := grantPrincipal(input.InstanceID, input.RoleArn); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if input.Action != dataset.ApprovalActionGrant && (input.InstanceID != "" || input.RoleArn != "" || input.Permission != "" || input.Duration != "") {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "instance_id, role_arn, permission and duration are only allowed for grant approvals", nil))
+		return
+	}
+
+	var duration time.Duration
+	if input.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(input.Duration); err != nil || duration <= 0 {
+			msg := fmt.Sprintf("invalid duration '%s'", input.Duration)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Action == dataset.ApprovalActionPromote && metadata.FinalizedAt != nil {
+		handleError(w, apierror.New(apierror.ErrConflict, "dataset already finalized", nil))
+		return
+	}
+
+	// finalized datasets can't be deleted before their retention expired, the check is repeated when the request runs
+	if input.Action == dataset.ApprovalActionDelete {
+		if dataRepo, ok := service.DataRepository[metadata.DataStorage]; ok {
+			if err = checkRetention(r.Context(), dataRepo, metadata); err != nil {
+				handleError(w, err)
+				return
+			}
+		}
+	}
+
+	if input.Action == dataset.ApprovalActionGrant {
+		if input.Permission, err = grantPermission(metadata, input.Permission); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// reject durations over the classification maximum now, instead of when the approved grant runs
+		if _, err = s.classifications.checkGrant(metadata, duration); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.Add(approvalExpiration)
+
+	var client string
+	if identity, ok := dataset.IdentityFromContext(r.Context()); ok {
+		client = identity.Client
+	}
+
+	approval, err := service.ApprovalRepository.CreateApproval(r.Context(), account, &dataset.Approval{
+		ID:                uuid.NewString(),
+		DatasetID:         id,
+		Action:            input.Action,
+		InstanceID:        input.InstanceID,
+		RoleArn:           input.RoleArn,
+		Permission:        input.Permission,
+		Duration:          input.Duration,
+		Status:            dataset.ApprovalStatusPending,
+		Comment:           input.Comment,
+		RequestedAt:       &now,
+		RequestedBy:       user,
+		RequestedByClient: client,
+		ExpiresAt:         &expires,
+	})
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(approval)
+	if err != nil {
+		msg := "cannot encode approval output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Requested approval %s to %s dataset %s (RequestedBy: %s, ExpiresAt: %s)", approval.ID, approval.Action, id, user, expires.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ApprovalListHandler lists the approval requests for a dataset
+func (s *server) ApprovalListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ApprovalRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "approvals are not supported for this account", nil))
+		return
+	}
+
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	approvals, err := service.ApprovalRepository.ListApprovals(r.Context(), account, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// report pending requests past their expiration as expired, they are persisted as expired when decided
+	now := time.Now()
+	for _, a := range approvals {
+		a.Expire(now)
+	}
+
+	j, err := json.Marshal(approvals)
+	if err != nil {
+		msg := "cannot encode approvals output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ApprovalUpdateHandler approves or rejects a pending approval request.  Approved requests are run
+// immediately and the result is recorded in the approval.
+func (s *server) ApprovalUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+	approvalID := vars["approval_id"]
+
+	user, ok := requestUser(r)
+	if !ok {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "X-Forwarded-User header is required", nil))
+		return
+	}
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ApprovalRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "approvals are not supported for this account", nil))
+		return
+	}
+
+	input := struct {
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		msg := "cannot decode body into update approval input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if input.Decision != "approve" && input.Decision != "reject" {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "decision must be approve or reject", nil))
+		return
+	}
+
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	approval, err := service.ApprovalRepository.GetApproval(r.Context(), account, id, approvalID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// deciding on a request needs the same permission as running the action directly
+	if err = s.authorize(r, approvalActions[approval.Action]); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	identity, _ := dataset.IdentityFromContext(r.Context())
+	if err = checkApprover(identity, approval); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if approval.Status == dataset.ApprovalStatusPending && approval.Expire(now) {
+		if _, err = service.ApprovalRepository.UpdateApproval(r.Context(), account, approval); err != nil {
+			log.WithContext(r.Context()).Errorf("failed to mark approval %s for dataset %s as expired: %s", approval.ID, id, err)
+		}
+		auditLog <- fmt.Sprintf("Approval %s to %s dataset %s expired", approval.ID, approval.Action, id)
+
+		handleError(w, apierror.New(apierror.ErrConflict, "approval request has expired", nil))
+		return
+	}
+
+	if approval.Status != dataset.ApprovalStatusPending {
+		msg := fmt.Sprintf("approval request is not pending: %s", approval.Status)
+		handleError(w, apierror.New(apierror.ErrConflict, msg, nil))
+		return
+	}
+
+	approval.Decision = input.Decision
+	approval.DecidedAt = &now
+	approval.DecidedBy = user
+	if input.Comment != "" {
+		approval.Comment = input.Comment
+	}
+
+	approval.Status = dataset.ApprovalStatusApproved
+	if input.Decision == "reject" {
+		approval.Status = dataset.ApprovalStatusRejected
+	}
+
+	// the decision is only stored if the request is still pending, so an approved request only runs once
+	approval, err = service.ApprovalRepository.DecideApproval(r.Context(), account, approval)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Decision == "reject" {
+		auditLog <- fmt.Sprintf("Rejected approval %s to %s dataset %s (DecidedBy: %s)", approval.ID, approval.Action, id, user)
+	} else {
+		auditLog <- fmt.Sprintf("Approved approval %s to %s dataset %s (RequestedBy: %s, DecidedBy: %s)", approval.ID, approval.Action, id, approval.RequestedBy, user)
+
+		if err = s.runApproval(r, service, account, group, approval); err != nil {
+			log.WithContext(r.Context()).Errorf("failed to run approved %s for dataset %s: %s", approval.Action, id, err)
+			approval.Status = dataset.ApprovalStatusFailed
+			approval.Error = err.Error()
+			auditLog <- fmt.Sprintf("Failed to %s dataset %s for approval %s: %s", approval.Action, id, approval.ID, err)
+		} else {
+			approval.Status = dataset.ApprovalStatusCompleted
+		}
+
+		approval, err = service.ApprovalRepository.UpdateApproval(r.Context(), account, approval)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	j, err := json.Marshal(approval)
+	if err != nil {
+		msg := "cannot encode approval output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// checkApprover makes sure an approval request is decided by a bearer token user other than the requester.  The
+// X-Forwarded-User header of api clients and the shared token is set by the caller, so one person holding two sets
+// of credentials could approve their own request.
+func checkApprover(identity *dataset.Identity, approval *dataset.Approval) error {
+	if identity == nil || identity.User == "" {
+		return apierror.New(apierror.ErrForbidden, "approval requests can only be decided by bearer token users", nil)
+	}
+
+	if identity.User == approval.RequestedBy {
+		return apierror.New(apierror.ErrForbidden, "approval must be decided by a different user than the requester", nil)
+	}
+
+	return nil
+}
+
+// runApproval runs the action of an approved request.  The requester is recorded as the user making the change.
+func (s *server) runApproval(r *http.Request, service *dataset.Service, account, group string, approval *dataset.Approval) error {
+	id := approval.DatasetID
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		return err
+	}
+
+	switch approval.Action {
+	case dataset.ApprovalActionPromote:
+		if metadata.FinalizedAt != nil {
+			return apierror.New(apierror.ErrConflict, "dataset already finalized", nil)
+		}
+
+		if err = s.authorizeFinalize(r, metadata); err != nil {
+			return err
+		}
+
+		_, _, err = s.promoteDataset(r.Context(), service, account, group, id, approval.RequestedBy, metadata)
+	case dataset.ApprovalActionDelete:
+		err = s.deleteDataset(r.Context(), service, account, group, id, approval.RequestedBy, metadata)
+	case dataset.ApprovalActionGrant:
+		// the dataset may have been promoted since the approval was requested
+		var principal, permission string
+		if principal, err = grantPrincipal(approval.InstanceID, approval.RoleArn); err != nil {
+			break
+		}
+		if permission, err = grantPermission(metadata, approval.Permission); err != nil {
+			break
+		}
+		var duration time.Duration
+		if approval.Duration != "" {
+			if duration, err = time.ParseDuration(approval.Duration); err != nil {
+				break
+			}
+		}
+		_, _, err = s.grantAccess(r.Context(), service, account, group, id, principal, permission, approval.RequestedBy, duration, metadata)
+	default:
+		err = fmt.Errorf("unknown approval action '%s'", approval.Action)
+	}
+
+	return err
+}
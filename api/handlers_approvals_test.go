@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
+)
+
+func TestCheckApprover(t *testing.T) {
+	byUser := &dataset.Approval{RequestedBy: "alice"}
+	byClient := &dataset.Approval{RequestedBy: "alice", RequestedByClient: "portal"}
+
+	type test struct {
+		identity *dataset.Identity
+		approval *dataset.Approval
+		allowed  bool
+	}
+
+	tests := []test{
+		{&dataset.Identity{User: "bob"}, byUser, true},
+		{&dataset.Identity{User: "bob"}, byClient, true},
+		{&dataset.Identity{User: "alice"}, byUser, false},
+		{&dataset.Identity{User: "alice"}, byClient, false},
+		{&dataset.Identity{Client: "steward"}, byClient, false},
+		{&dataset.Identity{Client: "steward"}, byUser, false},
+		{&dataset.Identity{Roles: []string{roleAdmin}}, byUser, false},
+		{nil, byUser, false},
+	}
+
+	for _, tst := range tests {
+		err := checkApprover(tst.identity, tst.approval)
+		if tst.allowed && err != nil {
+			t.Errorf("expected %+v to decide %+v, got %s", tst.identity, tst.approval, err)
+		}
+
+		if !tst.allowed {
+			if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrForbidden {
+				t.Errorf("expected forbidden error for %+v deciding %+v, got %v", tst.identity, tst.approval, err)
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
@@ -16,6 +17,12 @@ const maxAttachmentSize = 32 * 1024 * 1024
 // AttachmentCreateHandler adds an attachment file to a dataset
 func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionAttachmentCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -28,7 +35,7 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -59,7 +66,7 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	log.Debugf("attachment name: %s", attachmentName)
+	log.WithContext(r.Context()).Debugf("attachment name: %s", attachmentName)
 
 	// get the (first) attachment file
 	attachment, attachmentHeader, err := r.FormFile("attachment")
@@ -69,7 +76,7 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer attachment.Close()
 
-	log.Debugf("attachment size (bytes): %v", attachmentHeader.Size)
+	log.WithContext(r.Context()).Debugf("attachment size (bytes): %v", attachmentHeader.Size)
 
 	if attachmentHeader.Size > maxAttachmentSize {
 		msg := fmt.Sprintf("attachment size too big (max limit is %d bytes)", maxAttachmentSize)
@@ -79,7 +86,7 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 
 	err = attachmentRepo.CreateAttachment(r.Context(), id, attachmentName, attachment)
 	if err != nil {
-		msg := fmt.Sprintf("failed to create attachment for dataset %s: %s", id, err)
+		msg := fmt.Sprintf("failed to create attachment for dataset %s", id)
 		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
 		return
 	}
@@ -90,7 +97,7 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset attachment output into json: %s", err)
+		msg := "cannot encode dataset attachment output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -100,6 +107,12 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 	msg := fmt.Sprintf("Created new attachment for dataset %s (Name: %s, Size: %d bytes)", id, attachmentName, attachmentHeader.Size)
 	auditLog <- msg
 
+	user, _ := requestUser(r)
+	s.publishEvent(r.Context(), account, dataset.NewEvent(r.Context(), dataset.EventAttachmentAdded, account, group, id, user, map[string]interface{}{
+		"name": attachmentName,
+		"size": attachmentHeader.Size,
+	}))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(j)
@@ -108,8 +121,15 @@ func (s *server) AttachmentCreateHandler(w http.ResponseWriter, r *http.Request)
 // AttachmentListHandler lists all attachments for a dataset
 func (s *server) AttachmentListHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionAttachmentRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
+	group := vars["group"]
 	id := vars["id"]
 
 	service, ok := s.datasetServices[account]
@@ -119,7 +139,7 @@ func (s *server) AttachmentListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -135,14 +155,14 @@ func (s *server) AttachmentListHandler(w http.ResponseWriter, r *http.Request) {
 	// list attachments for this data repository
 	datasetAttachments, err := attachmentRepo.ListAttachments(r.Context(), id, true)
 	if err != nil {
-		msg := fmt.Sprintf("failed to list attachments for dataset %s: %s", id, err)
+		msg := fmt.Sprintf("failed to list attachments for dataset %s", id)
 		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
 		return
 	}
 
 	j, err := json.Marshal(&datasetAttachments)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset attachments output into json: %s", err)
+		msg := "cannot encode dataset attachments output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -155,6 +175,12 @@ func (s *server) AttachmentListHandler(w http.ResponseWriter, r *http.Request) {
 // AttachmentDeleteHandler removes an attachment file from a dataset
 func (s *server) AttachmentDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionAttachmentDelete); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -173,7 +199,7 @@ func (s *server) AttachmentDeleteHandler(w http.ResponseWriter, r *http.Request)
 
 	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
-		msg := fmt.Sprintf("cannot decode body into delete attachment input: %s", err)
+		msg := "cannot decode body into delete attachment input"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -183,7 +209,7 @@ func (s *server) AttachmentDeleteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -199,7 +225,7 @@ func (s *server) AttachmentDeleteHandler(w http.ResponseWriter, r *http.Request)
 	// delete attachment from this data repository
 	err = attachmentRepo.DeleteAttachment(r.Context(), id, input.AttachmentName)
 	if err != nil {
-		msg := fmt.Sprintf("failed to delete attachment '%s' for dataset %s: %s", input.AttachmentName, id, err)
+		msg := fmt.Sprintf("failed to delete attachment '%s' for dataset %s", input.AttachmentName, id)
 		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
 		return
 	}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// batch actions
+const (
+	batchActionTag          = "tag"
+	batchActionLock         = "lock"
+	batchActionRevokeAccess = "revoke_access"
+	batchActionRotateKeys   = "rotate_keys"
+)
+
+// batchActions maps the batch actions to the action a caller needs to be allowed to perform
+var batchActions = map[string]string{
+	batchActionTag:          actionDatasetUpdate,
+	batchActionLock:         actionDatasetLock,
+	batchActionRevokeAccess: actionInstanceRevoke,
+	batchActionRotateKeys:   actionUserUpdate,
+}
+
+// batchScopes maps the batch actions to the resource an API client needs the write scope for, the batch path
+// itself is only scoped as datasets:write
+var batchScopes = map[string]string{
+	batchActionTag:          "datasets",
+	batchActionLock:         "datasets",
+	batchActionRevokeAccess: "instances",
+	batchActionRotateKeys:   "users",
+}
+
+// batchConcurrency is the maximum number of datasets a batch action runs on at the same time
+const batchConcurrency = 5
+
+// batchMaxDatasets is the maximum number of datasets in a batch
+const batchMaxDatasets = 100
+
+// dataTagger is implemented by data repositories that can be tagged after they're provisioned
+type dataTagger interface {
+	Tag(ctx context.Context, id string, tags []*dataset.Tag) error
+}
+
+// batchResult is the result of a batch action for one dataset
+type batchResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// batch result statuses
+const (
+	batchStatusSucceeded = "succeeded"
+	batchStatusFailed    = "failed"
+)
+
+// DatasetBatchHandler runs an action on a list of datasets and returns the result for each dataset.  The
+// action runs on at most batchConcurrency datasets at a time, a failure for one dataset doesn't stop the others.
+func (s *server) DatasetBatchHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	input := struct {
+		IDs    []string       `json:"ids"`
+		Action string         `json:"action"`
+		Tags   []*dataset.Tag `json:"tags"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		msg := "cannot decode body into batch input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	action, ok := batchActions[input.Action]
+	if !ok {
+		msg := fmt.Sprintf("invalid batch action '%s'", input.Action)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	if err := s.authorize(r, action); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := s.authorizeScope(r, account, group, batchScopes[input.Action], "write"); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	ids, err := batchIDs(input.IDs)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Action == batchActionTag {
+		if err = validateBatchTags(input.Tags); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	log.WithContext(r.Context()).Infof("running batch action %s on %d datasets in account %s", input.Action, len(ids), account)
+
+	results := runBatch(r.Context(), ids, batchConcurrency, func(ctx context.Context, id string) error {
+		metadata, err := getDataset(ctx, service, account, group, id)
+		if err != nil {
+			return err
+		}
+
+		dataRepo, ok := service.DataRepository[metadata.DataStorage]
+		if !ok {
+			msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+			return apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		switch input.Action {
+		case batchActionTag:
+			return batchTag(ctx, service, dataRepo, group, id, input.Tags)
+		case batchActionLock:
+			return batchLock(ctx, service, dataRepo, group, id, metadata)
+		case batchActionRevokeAccess:
+			return s.batchRevokeAccess(r.WithContext(ctx), service, dataRepo, account, group, id, metadata)
+		default:
+			return batchRotateKeys(ctx, service, dataRepo, group, id)
+		}
+	})
+
+	output := struct {
+		Action    string         `json:"action"`
+		Succeeded int            `json:"succeeded"`
+		Failed    int            `json:"failed"`
+		Results   []*batchResult `json:"results"`
+	}{
+		Action:  input.Action,
+		Results: results,
+	}
+
+	for _, result := range results {
+		if result.Status == batchStatusSucceeded {
+			output.Succeeded++
+		} else {
+			output.Failed++
+		}
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode batch output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// batchIDs validates the dataset ids of a batch and removes duplicates
+func batchIDs(ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, apierror.New(apierror.ErrBadRequest, "ids are required", nil)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	output := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return nil, apierror.New(apierror.ErrBadRequest, "ids cannot be empty", nil)
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			output = append(output, id)
+		}
+	}
+
+	if len(output) > batchMaxDatasets {
+		msg := fmt.Sprintf("at most %d datasets are allowed in a batch, got %d", batchMaxDatasets, len(output))
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	return output, nil
+}
+
+// validateBatchTags makes sure there are tags to add, and that they don't replace the tags set when the dataset
+// was created
+func validateBatchTags(tags []*dataset.Tag) error {
+	if len(tags) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "tags are required for the tag action", nil)
+	}
+
+	for _, t := range tags {
+		key := aws.StringValue(t.Key)
+		switch {
+		case key == "":
+			return apierror.New(apierror.ErrBadRequest, "tag keys cannot be empty", nil)
+		case key == "ID" || key == "Name" || key == "spinup:org" || key == "spinup:group":
+			return apierror.New(apierror.ErrBadRequest, "tag "+key+" cannot be changed", nil)
+		}
+	}
+
+	return nil
+}
+
+// runBatch runs f for each of the ids, with at most concurrency calls at the same time, and returns the results
+// in the order of the ids
+func runBatch(ctx context.Context, ids []string, concurrency int, f func(ctx context.Context, id string) error) []*batchResult {
+	results := make([]*batchResult, len(ids))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := &batchResult{ID: id, Status: batchStatusSucceeded}
+			if err := f(ctx, id); err != nil {
+				log.WithContext(ctx).Errorf("batch action failed for dataset %s: %s", id, err)
+
+				result.Status = batchStatusFailed
+				result.Code = apierror.ErrInternalError
+				result.Message = "internal error"
+				if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+					result.Code = aerr.Code
+					result.Message = aerr.Message
+				}
+			}
+			results[i] = result
+		}(i, id)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// batchTag adds tags to the data repository of a dataset
+func batchTag(ctx context.Context, service *dataset.Service, dataRepo dataset.DataRepository, group, id string, tags []*dataset.Tag) error {
+	tagger, ok := dataRepo.(dataTagger)
+	if !ok {
+		return apierror.New(apierror.ErrBadRequest, "tagging is not supported by the data repository", nil)
+	}
+
+	if err := tagger.Tag(ctx, id, tags); err != nil {
+		return errors.Wrapf(err, "tag data repository for dataset %s", id)
+	}
+
+	keys := make([]string, len(tags))
+	for i, t := range tags {
+		keys[i] = aws.StringValue(t.Key)
+	}
+
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
+	auditLog <- fmt.Sprintf("Tagged data repository for dataset %s (Tags: %v)", id, keys)
+
+	return nil
+}
+
+// batchLock write protects the data repository of a finalized dataset again, ie. if the protection was removed
+// outside of the api
+func batchLock(ctx context.Context, service *dataset.Service, dataRepo dataset.DataRepository, group, id string, metadata *dataset.Metadata) error {
+	// locking puts a retention on the data repository that can't be removed, so datasets that aren't finalized
+	// would be write protected for good
+	if metadata.FinalizedAt == nil {
+		msg := fmt.Sprintf("dataset %s is not finalized", id)
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	if err := dataRepo.Lock(ctx, id); err != nil {
+		msg := fmt.Sprintf("failed to lock data repository for dataset %s", id)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
+	auditLog <- fmt.Sprintf("Locked data repository for dataset %s", id)
+
+	return nil
+}
+
+// batchRevokeAccess revokes the access of all instances and roles to a dataset
+func (s *server) batchRevokeAccess(r *http.Request, service *dataset.Service, dataRepo dataset.DataRepository, account, group, id string, metadata *dataset.Metadata) error {
+	access, err := dataRepo.ListAccess(r.Context(), id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to list access to data repository for dataset %s", id)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	for principal := range access {
+		if err := s.revokeAccess(r, service, account, group, id, principal, metadata); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchRotateKeys replaces the access keys of the users of a dataset.  The new keys aren't returned, datasets
+// without users are skipped.
+func batchRotateKeys(ctx context.Context, service *dataset.Service, dataRepo dataset.DataRepository, group, id string) error {
+	// the data repository returns Forbidden if the dataset doesn't have users, see UserListHandler
+	users, err := dataRepo.ListUsers(ctx, id)
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrForbidden {
+			return nil
+		}
+		return errors.Wrapf(err, "list users of data repository for dataset %s", id)
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	if _, err = dataRepo.UpdateUser(ctx, id); err != nil {
+		return errors.Wrapf(err, "update user of data repository for dataset %s", id)
+	}
+
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
+	auditLog <- fmt.Sprintf("Updated key for user with access to dataset %s", id)
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRunBatch(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	results := runBatch(context.TODO(), ids, 3, func(ctx context.Context, id string) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		switch id {
+		case "b":
+			return apierror.New(apierror.ErrNotFound, "dataset not found", nil)
+		case "e":
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %d", maxRunning)
+	}
+
+	expected := []*batchResult{
+		{ID: "a", Status: batchStatusSucceeded},
+		{ID: "b", Status: batchStatusFailed, Code: apierror.ErrNotFound, Message: "dataset not found"},
+		{ID: "c", Status: batchStatusSucceeded},
+		{ID: "d", Status: batchStatusSucceeded},
+		{ID: "e", Status: batchStatusFailed, Code: apierror.ErrInternalError, Message: "internal error"},
+		{ID: "f", Status: batchStatusSucceeded},
+		{ID: "g", Status: batchStatusSucceeded},
+		{ID: "h", Status: batchStatusSucceeded},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		for i := range results {
+			t.Logf("result %d: %+v", i, results[i])
+		}
+		t.Errorf("expected results in the order of the ids")
+	}
+}
+
+func TestBatchIDs(t *testing.T) {
+	out, err := batchIDs([]string{"a", "b", "a", "c"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(out, []string{"a", "b", "c"}) {
+		t.Errorf("expected duplicate ids to be removed, got %v", out)
+	}
+
+	tooMany := make([]string, batchMaxDatasets+1)
+	for i := range tooMany {
+		tooMany[i] = string(rune('a'+i%26)) + string(rune('a'+i/26))
+	}
+
+	for name, ids := range map[string][]string{"nil": nil, "empty id": {"a", ""}, "too many": tooMany} {
+		if _, err := batchIDs(ids); err == nil {
+			t.Errorf("expected error for %s ids, got nil", name)
+		}
+	}
+}
+
+func TestValidateBatchTags(t *testing.T) {
+	if err := validateBatchTags([]*dataset.Tag{{Key: aws.String("Project"), Value: aws.String("foo")}}); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	tests := map[string][]*dataset.Tag{
+		"no tags":   nil,
+		"empty key": {{Key: aws.String(""), Value: aws.String("foo")}},
+		"nil key":   {{Value: aws.String("foo")}},
+		"id tag":    {{Key: aws.String("ID"), Value: aws.String("foo")}},
+		"org tag":   {{Key: aws.String("spinup:org"), Value: aws.String("foo")}},
+		"group tag": {{Key: aws.String("spinup:group"), Value: aws.String("foo")}},
+	}
+
+	for name, tags := range tests {
+		if err := validateBatchTags(tags); err == nil {
+			t.Errorf("expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestDatasetBatchHandler(t *testing.T) {
+	now := time.Now().UTC()
+
+	dataRepo := &mockDataRepository{}
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(&mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+			"abc": {ID: "abc", Group: "group1", DataStorage: "s3", FinalizedAt: &now},
+			"def": {ID: "def", Group: "group1", DataStorage: "s3"},
+		}}),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{messages: make(chan string, 10)}),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": dataRepo}),
+	)
+
+	secret, _ := bcrypt.GenerateFromPassword([]byte("clientsecret"), bcrypt.MinCost)
+	config := common.Config{
+		Token: "sometesttoken",
+		Clients: map[string]common.Client{
+			"datasets": {Secret: string(secret), Accounts: []string{"acct"}, Groups: []string{"group1"}, Verbs: []string{"datasets:write"}, Roles: []string{"admin"}},
+		},
+	}
+
+	handler, stop, err := NewHandler(config, map[string]*dataset.Service{"acct": service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	batch := func(action string) (int, []batchResult) {
+		body := fmt.Sprintf(`{"ids": ["abc", "def"], "action": "%s"}`, action)
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/ds/acct/datasets/group1/batch", strings.NewReader(body))
+		req.Header.Add("X-Auth-Client", "datasets")
+		req.Header.Add("X-Auth-Token", "clientsecret")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		output := struct {
+			Results []batchResult `json:"results"`
+		}{}
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return resp.StatusCode, output.Results
+	}
+
+	// the batch path only needs datasets:write, the instance and user actions need their own scopes
+	for _, action := range []string{"revoke_access", "rotate_keys"} {
+		if code, _ := batch(action); code != http.StatusForbidden {
+			t.Errorf("expected %d for batch %s without scope, got %d", http.StatusForbidden, action, code)
+		}
+	}
+
+	// only finalized datasets are locked
+	code, results := batch("lock")
+	if code != http.StatusOK {
+		t.Fatalf("expected %d for batch lock, got %d", http.StatusOK, code)
+	}
+
+	expected := []batchResult{
+		{ID: "abc", Status: batchStatusSucceeded},
+		{ID: "def", Status: batchStatusFailed, Code: apierror.ErrConflict, Message: "dataset def is not finalized"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected results %+v, got %+v", expected, results)
+	}
+
+	if !reflect.DeepEqual(dataRepo.calls, []string{"Lock"}) {
+		t.Errorf("expected only the finalized dataset to be locked, got %v", dataRepo.calls)
+	}
+}
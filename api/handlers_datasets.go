@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/YaleSpinup/ds-api/apierror"
 	"github.com/YaleSpinup/ds-api/dataset"
@@ -18,6 +21,12 @@ import (
 // * creates the metadata in the metadata repository
 func (s *server) DatasetCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -39,12 +48,12 @@ func (s *server) DatasetCreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
-		msg := fmt.Sprintf("cannot decode body into create dataset input: %s", err)
+		msg := "cannot decode body into create dataset input"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	log.Infof("creating data set (derivative: %t) in account '%s'", input.Derivative, account)
+	log.WithContext(r.Context()).Infof("creating data set (derivative: %t) in account '%s'", input.Derivative, account)
 
 	if input.Name == "" {
 		handleError(w, apierror.New(apierror.ErrBadRequest, "dataset name is required", nil))
@@ -56,26 +65,104 @@ func (s *server) DatasetCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataRepo, ok := service.DataRepository[input.Type]
-	if !ok {
-		msg := fmt.Sprintf("requested dataset type not supported for this account: %s", input.Type)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+	if input.Metadata == nil {
+		input.Metadata = &dataset.Metadata{}
+	}
+
+	log.WithContext(r.Context()).Debugf("decoded request body into data set input %+v", input)
+
+	id, dataRepoName, metadataOutput, tags, err := s.createDataset(r.Context(), service, account, group, input.Name, input.Type, input.Derivative, input.Tags, input.Metadata)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	output := struct {
+		ID         string            `json:"id"`
+		Repository string            `json:"repository"`
+		Metadata   *dataset.Metadata `json:"metadata"`
+	}{
+		id,
+		dataRepoName,
+		metadataOutput,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode dataset output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	log.Debugf("decoded request body into data set input %+v", input)
+	// create new audit log for this data set, with a retention period of 365 days
+	lErr := service.AuditLogRepository.CreateLog(r.Context(), group, id, int64(365), tags)
+	if lErr != nil {
+		log.WithContext(r.Context()).Errorf("failed creating job audit log for %s: %s", id, lErr)
+	} else {
+		// initialize audit log stream
+		auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+		msg := fmt.Sprintf("Created dataset %s (CreatedBy: %s)", id, metadataOutput.CreatedBy)
+		auditLog <- msg
+		auditLog <- string(j)
+	}
+
+	s.publishEvent(r.Context(), account, dataset.NewEvent(r.Context(), dataset.EventDatasetCreated, account, group, id, metadataOutput.CreatedBy, map[string]interface{}{
+		"name":                 metadataOutput.Name,
+		"data_storage":         metadataOutput.DataStorage,
+		"data_classifications": metadataOutput.DataClassifications,
+		"derivative":           metadataOutput.Derivative,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// createDataset creates a new dataset in the given data repository type
+// * generates an internal dataset id
+// * creates the dataset repository and access policy
+// * creates the metadata in the metadata repository
+// All actions are rolled back on failure.  Returns the new id, the data repository name, the created metadata and the applied tags.
+func (s *server) createDataset(ctx context.Context, service *dataset.Service, account, group, name, dataType string, derivative bool, tags []*dataset.Tag, metadata *dataset.Metadata) (string, string, *dataset.Metadata, []*dataset.Tag, error) {
+	dataRepo, ok := service.DataRepository[dataType]
+	if !ok {
+		msg := fmt.Sprintf("requested dataset type not supported for this account: %s", dataType)
+		return "", "", nil, nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	if err := validateSourceIDs(ctx, service, account, metadata.SourceIDs); err != nil {
+		return "", "", nil, nil, err
+	}
+
+	encryption, err := s.classifications.checkCreate(metadata, tags, derivative)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+
+	restriction, err := s.classifications.networkRestriction(metadata)
+	if err != nil {
+		return "", "", nil, nil, err
+	}
+
+	restrictor, ok := dataRepo.(networkRestrictor)
+	if restriction != nil && !ok {
+		msg := fmt.Sprintf("classified dataset requires a network restriction, which is not supported by data repository type %s", dataType)
+		return "", "", nil, nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
 
 	id := service.NewID()
 
-	log.Debugf("generated random id %s for new data set", id)
+	log.WithContext(ctx).Debugf("generated random id %s for new data set", id)
 
-	// override metadata ID, Name, DataStorage and Derivative
-	input.Metadata.ID = id
-	input.Metadata.Name = input.Name
-	input.Metadata.DataStorage = input.Type
-	input.Metadata.Derivative = input.Derivative
+	// override metadata ID, Name, Group, DataStorage and Derivative, the last data change is tracked from the activity queue
+	metadata.ID = id
+	metadata.Name = name
+	metadata.Group = group
+	metadata.DataStorage = dataType
+	metadata.Derivative = derivative
+	metadata.LastDataChange = nil
 
-	// set tags for ID, Name, Org
+	// set tags for ID, Name, Org and Group
 	// TODO: tag value validation, including the Name
 	// In general, allowed characters in tags are letters, numbers, spaces representable in UTF-8, and the following characters: . : + = @ _ / - (hyphen).
 	newTags := []*dataset.Tag{
@@ -85,115 +172,88 @@ func (s *server) DatasetCreateHandler(w http.ResponseWriter, r *http.Request) {
 		},
 		&dataset.Tag{
 			Key:   aws.String("Name"),
-			Value: aws.String(input.Name),
+			Value: aws.String(name),
 		},
 		&dataset.Tag{
 			Key:   aws.String("spinup:org"),
 			Value: aws.String(Org),
 		},
+		&dataset.Tag{
+			Key:   aws.String("spinup:group"),
+			Value: aws.String(group),
+		},
 	}
-	for _, t := range input.Tags {
-		if aws.StringValue(t.Key) != "ID" && aws.StringValue(t.Key) != "Name" && aws.StringValue(t.Key) != "spinup:org" {
+	for _, t := range tags {
+		if k := aws.StringValue(t.Key); k != "ID" && k != "Name" && k != "spinup:org" && k != "spinup:group" {
 			newTags = append(newTags, t)
 		}
 	}
-	input.Tags = newTags
 
-	// setup rollback function list and defer execution, note that we depend on the err variable defined above this
+	// setup rollback function list and defer execution, note that we depend on the err variable defined above
 	var rollBackTasks []func() error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error creating dataset: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error creating dataset: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
 
 	// create dataset storage location
 	var dataRepoName string
-	log.Infof("provisioning dataset repository for %s", id)
-	dataRepoName, err = dataRepo.Provision(r.Context(), id, input.Tags)
+	log.WithContext(ctx).Infof("provisioning dataset repository for %s", id)
+	dataRepoName, err = dataRepo.Provision(ctx, id, newTags, encryption)
 	if err != nil {
-		handleError(w, err)
-		return
+		return "", "", nil, nil, err
 	}
 
 	// append dataset cleanup to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			if err := dataRepo.Delete(r.Context(), id); err != nil {
+			if err := dataRepo.Delete(ctx, id); err != nil {
 				return err
 			}
 			return nil
 		}()
 	})
 
+	// override the account network restriction with the classification restriction
+	if restriction != nil {
+		log.WithContext(ctx).Infof("restricting network access for %s", id)
+		if err = restrictor.SetNetworkRestriction(ctx, id, restriction); err != nil {
+			return "", "", nil, nil, err
+		}
+	}
+
 	// generate dataset access policy
-	log.Infof("provisioning access policy for %s", id)
-	if err = dataRepo.SetPolicy(r.Context(), id, input.Derivative); err != nil {
-		handleError(w, err)
-		return
+	log.WithContext(ctx).Infof("provisioning access policy for %s", id)
+	if err = dataRepo.SetPolicy(ctx, id, derivative); err != nil {
+		return "", "", nil, nil, err
 	}
 
 	// create metadata in repository
-	log.Infof("adding dataset metadata for %s", id)
-	metadataOutput, err := service.MetadataRepository.Create(r.Context(), account, id, input.Metadata)
+	log.WithContext(ctx).Infof("adding dataset metadata for %s", id)
+	var metadataOutput *dataset.Metadata
+	metadataOutput, err = service.MetadataRepository.Create(ctx, account, id, metadata)
 	if err != nil {
-		handleError(w, err)
-		return
+		return "", "", nil, nil, err
 	}
 
-	// append metadata cleanup to rollback tasks
-	rollBackTasks = append(rollBackTasks, func() error {
-		return func() error {
-			if err := service.MetadataRepository.Delete(r.Context(), account, id); err != nil {
-				return err
-			}
-			return nil
-		}()
-	})
+	return id, dataRepoName, metadataOutput, newTags, nil
+}
 
-	output := struct {
-		ID         string            `json:"id"`
-		Repository string            `json:"repository"`
-		Metadata   *dataset.Metadata `json:"metadata"`
-	}{
-		id,
-		dataRepoName,
-		metadataOutput,
-	}
+func (s *server) DatasetListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
 
-	var j []byte
-	j, err = json.Marshal(&output)
-	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// create new audit log for this data set, with a retention period of 365 days
-	lErr := service.AuditLogRepository.CreateLog(r.Context(), group, id, int64(365), input.Tags)
-	if lErr != nil {
-		log.Errorf("failed creating job audit log for %s: %s", id, lErr)
-	} else {
-		// initialize audit log stream
-		auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
-		msg := fmt.Sprintf("Created dataset %s (CreatedBy: %s)", id, metadataOutput.CreatedBy)
-		auditLog <- msg
-		auditLog <- string(j)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(j)
-}
-
-func (s *server) DatasetListHandler(w http.ResponseWriter, r *http.Request) {
-	w = LogWriter{w}
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
 
-	log.Debugf("listing data sets for account %s, group %s", account, group)
+	log.WithContext(r.Context()).Debugf("listing data sets for account %s, group %s", account, group)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNotImplemented)
@@ -203,8 +263,15 @@ func (s *server) DatasetListHandler(w http.ResponseWriter, r *http.Request) {
 // DatasetShowHandler returns information about a dataset
 func (s *server) DatasetShowHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
+	group := vars["group"]
 	id := vars["id"]
 
 	service, ok := s.datasetServices[account]
@@ -214,10 +281,10 @@ func (s *server) DatasetShowHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("showing data set %s for account %s", id, account)
+	log.WithContext(r.Context()).Debugf("showing data set %s for account %s", id, account)
 
 	// get metadata from repository
-	metadataOutput, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadataOutput, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -256,7 +323,7 @@ func (s *server) DatasetShowHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
+		msg := "cannot encode dataset output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -271,13 +338,19 @@ func (s *server) DatasetShowHandler(w http.ResponseWriter, r *http.Request) {
 // If this is a derivative, it will be promoted to an original and instantly finalized
 func (s *server) DatasetPromoteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetPromote); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
 	id := vars["id"]
 
-	user := r.Header.Get("X-Forwarded-User")
-	if user == "" {
+	user, ok := requestUser(r)
+	if !ok {
 		handleError(w, apierror.New(apierror.ErrBadRequest, "X-Forwarded-User header is required", nil))
 		return
 	}
@@ -290,31 +363,28 @@ func (s *server) DatasetPromoteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get current metadata from repository
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	// if this is currently a derivative data set that is promoted to original
-	// we update the access policy for the data repository
-	if metadata.Derivative {
-		dataRepo, ok := service.DataRepository[metadata.DataStorage]
-		if !ok {
-			msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
-			handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
-			return
-		}
+	if metadata.FinalizedAt != nil {
+		handleError(w, apierror.New(apierror.ErrConflict, "dataset already finalized", nil))
+		return
+	}
 
-		if err = dataRepo.SetPolicy(r.Context(), id, false); err != nil {
-			msg := fmt.Sprintf("failed to set access policy for dataset %s", id)
-			handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
-			return
-		}
+	if err = s.authorizeFinalize(r, metadata); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	// finalize repository metadata
-	metadataOutput, err := service.MetadataRepository.Promote(r.Context(), account, id, user)
+	if err = requireApproval(service, metadata, dataset.ApprovalActionPromote); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	metadataOutput, task, err := s.promoteDataset(r.Context(), service, account, group, id, user, metadata)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -323,25 +393,244 @@ func (s *server) DatasetPromoteHandler(w http.ResponseWriter, r *http.Request) {
 	output := struct {
 		ID       string            `json:"id"`
 		Metadata *dataset.Metadata `json:"metadata"`
+		Task     *dataset.Task     `json:"task,omitempty"`
 	}{
 		id,
 		metadataOutput,
+		task,
 	}
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
+		msg := "cannot encode dataset output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// promoteDataset finalizes a dataset, promoting it to an original first if it's a derivative
+// * updates the access policy of a derivative
+// * write protects the data repository
+// * finalizes the metadata
+// * starts a task that creates the content manifest and references it from the metadata
+func (s *server) promoteDataset(ctx context.Context, service *dataset.Service, account, group, id, user string, metadata *dataset.Metadata) (*dataset.Metadata, *dataset.Task, error) {
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		return nil, nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	// setup rollback function list and defer execution, note that we depend on the err variable defined here
+	var err error
+	var rollBackTasks []func() error
+	defer func() {
+		if err != nil {
+			log.WithContext(ctx).Errorf("recovering from error promoting dataset: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			rollBack(&rollBackTasks)
+		}
+	}()
+
+	// if this is currently a derivative data set that is promoted to original
+	// we update the access policy for the data repository
+	if metadata.Derivative {
+		if err = dataRepo.SetPolicy(ctx, id, false); err != nil {
+			msg := fmt.Sprintf("failed to set access policy for dataset %s", id)
+			return nil, nil, apierror.New(apierror.ErrInternalError, msg, err)
+		}
+
+		// append restoring the derivative access policy to rollback tasks
+		rollBackTasks = append(rollBackTasks, func() error {
+			return dataRepo.SetPolicy(ctx, id, true)
+		})
+	}
+
+	// protect the data repository from any further changes, the api can still write the content manifest
+	log.WithContext(ctx).Infof("locking data repository for dataset %s", id)
+	if err = dataRepo.Lock(ctx, id); err != nil {
+		msg := fmt.Sprintf("failed to lock data repository for dataset %s", id)
+		return nil, nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	// append removing the write protection to rollback tasks
+	rollBackTasks = append(rollBackTasks, func() error {
+		return dataRepo.Unlock(ctx, id)
+	})
+
+	// finalize repository metadata
+	metadataOutput, err := service.MetadataRepository.Promote(ctx, account, id, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// write to audit log
-	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
 	if metadata.Derivative {
 		auditLog <- fmt.Sprintf("Promoted derivative dataset %s to original (ModifiedBy: %s)", id, user)
 	} else {
 		auditLog <- fmt.Sprintf("Finalized original dataset %s (ModifiedBy: %s)", id, user)
 	}
+	auditLog <- fmt.Sprintf("Locked data repository for dataset %s", id)
+
+	// record what the data looks like at the time of finalization in the background, since
+	// computing the checksums of every object can take much longer than a request
+	t := s.tasks.add(id, "manifest")
+	go s.createManifestTask(service, dataRepo, account, group, id, user, t.ID)
+
+	s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventDatasetFinalized, account, group, id, user, map[string]interface{}{
+		"promoted_derivative": metadata.Derivative,
+		"manifest_task":       t.ID,
+	}))
+
+	return metadataOutput, &t, nil
+}
+
+// createManifestTask creates the content manifest of a finalized dataset and references it from the dataset
+// metadata, tracking its status in the task registry.  The result is published as a manifest created or failed event.
+func (s *server) createManifestTask(service *dataset.Service, dataRepo dataset.DataRepository, account, group, id, user, taskID string) {
+	ctx := s.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.tasks.update(taskID, func(t *dataset.Task) { t.Status = dataset.TaskStatusRunning })
+
+	manifest, err := s.createManifest(ctx, service, dataRepo, account, id)
+
+	s.tasks.finish(taskID, err)
+
+	// write to audit log, cancelling the context flushes the messages
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	auditLog := service.AuditLogRepository.Log(logCtx, group, id)
+	if err != nil {
+		log.Errorf("failed to create content manifest for dataset %s (task %s): %s", id, taskID, err)
+		auditLog <- fmt.Sprintf("Failed to create content manifest for dataset %s (Task: %s): %s", id, taskID, err)
+
+		// the error is only reported in the task status, it may have details of the data repository
+		s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventManifestFailed, account, group, id, user, map[string]interface{}{
+			"manifest_task": taskID,
+		}))
+		return
+	}
+
+	auditLog <- fmt.Sprintf("Created content manifest for dataset %s (Objects: %d, SHA256: %s, Task: %s)", id, manifest.ObjectCount, manifest.SHA256, taskID)
+
+	s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventManifestCreated, account, group, id, user, map[string]interface{}{
+		"manifest_task":   taskID,
+		"manifest_sha256": manifest.SHA256,
+		"object_count":    manifest.ObjectCount,
+	}))
+}
+
+// createManifest creates the content manifest of a dataset and references it from the current dataset metadata
+func (s *server) createManifest(ctx context.Context, service *dataset.Service, dataRepo dataset.DataRepository, account, id string) (*dataset.ManifestReference, error) {
+	log.WithContext(ctx).Infof("creating content manifest for dataset %s", id)
+	manifest, err := dataRepo.CreateManifest(ctx, id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to create content manifest for dataset %s", id)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	metadata, err := service.MetadataRepository.Get(ctx, account, id)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.Manifest = manifest
+	if _, err = service.MetadataRepository.Update(ctx, account, id, metadata); err != nil {
+		msg := fmt.Sprintf("failed to update metadata with content manifest for dataset %s", id)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	return manifest, nil
+}
+
+// DatasetVerifyHandler verifies the current contents of a finalized dataset against its content manifest
+// By default only the object sizes and ETags are compared, pass checksums=true to also recompute the SHA-256 of every object
+func (s *server) DatasetVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	checksums := false
+	if c := r.URL.Query().Get("checksums"); c != "" {
+		var err error
+		if checksums, err = strconv.ParseBool(c); err != nil {
+			msg := fmt.Sprintf("invalid value for checksums: %s", c)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	log.WithContext(r.Context()).Infof("verifying data set %s for account %s (checksums: %t)", id, account, checksums)
+
+	// get metadata from repository
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if metadata.Manifest == nil {
+		msg := fmt.Sprintf("content manifest not found for dataset %s", id)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+		return
+	}
+
+	verification, err := dataRepo.VerifyManifest(r.Context(), id, metadata.Manifest, checksums)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	output := struct {
+		ID           string                        `json:"id"`
+		Manifest     *dataset.ManifestReference    `json:"manifest"`
+		Verification *dataset.ManifestVerification `json:"verification"`
+	}{
+		id,
+		metadata.Manifest,
+		verification,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode dataset verification output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Verified dataset %s against content manifest (Verified: %t, Checksums: %t, Missing: %d, Added: %d, Modified: %d)",
+		id, verification.Verified, checksums, len(verification.Missing), len(verification.Added), len(verification.Modified))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -352,13 +641,19 @@ func (s *server) DatasetPromoteHandler(w http.ResponseWriter, r *http.Request) {
 // Only the following fields can be updated: Description, ModifiedBy
 func (s *server) DatasetUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetUpdate); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
 	id := vars["id"]
 
-	user := r.Header.Get("X-Forwarded-User")
-	if user == "" {
+	user, ok := requestUser(r)
+	if !ok {
 		handleError(w, apierror.New(apierror.ErrBadRequest, "X-Forwarded-User header is required", nil))
 		return
 	}
@@ -377,7 +672,7 @@ func (s *server) DatasetUpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
-		msg := fmt.Sprintf("cannot decode body into update dataset input: %s", err)
+		msg := "cannot decode body into update dataset input"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -387,10 +682,10 @@ func (s *server) DatasetUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Infof("updating data set %s for account %s by user %s", id, account, user)
+	log.WithContext(r.Context()).Infof("updating data set %s for account %s by user %s", id, account, user)
 
 	// get current metadata from repository
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -421,7 +716,7 @@ func (s *server) DatasetUpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
+		msg := "cannot encode dataset output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -439,13 +734,19 @@ func (s *server) DatasetUpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) DatasetDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetDelete); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
 	id := vars["id"]
 
-	user := r.Header.Get("X-Forwarded-User")
-	if user == "" {
+	user, ok := requestUser(r)
+	if !ok {
 		handleError(w, apierror.New(apierror.ErrBadRequest, "X-Forwarded-User header is required", nil))
 		return
 	}
@@ -457,42 +758,106 @@ func (s *server) DatasetDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Infof("deleting data set %s for account %s by user %s", id, account, user)
+	log.WithContext(r.Context()).Infof("deleting data set %s for account %s by user %s", id, account, user)
 
 	// get metadata from repository
-	metadataOutput, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadataOutput, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	dataRepo, ok := service.DataRepository[metadataOutput.DataStorage]
-	if !ok {
-		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadataOutput.DataStorage)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+	// deleting a finalized dataset directly is the break-glass path, otherwise it needs an approved request
+	if metadataOutput.FinalizedAt != nil {
+		if err = s.authorize(r, actionDatasetPurge); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if err = requireApproval(service, metadataOutput, dataset.ApprovalActionDelete); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err = s.deleteDataset(r.Context(), service, account, group, id, user, metadataOutput); err != nil {
+		handleError(w, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte{})
+}
+
+// dataRetainer is implemented by data repositories that retain the data of finalized datasets for a period of time
+type dataRetainer interface {
+	Retention(ctx context.Context, id string) (time.Duration, error)
+}
+
+// checkRetention returns a conflict error if a finalized dataset is still in its retention period.  The retention
+// starts when the dataset is finalized, data repositories without retention can be deleted at any time.
+func checkRetention(ctx context.Context, dataRepo dataset.DataRepository, metadata *dataset.Metadata) error {
+	retainer, ok := dataRepo.(dataRetainer)
+	if metadata.FinalizedAt == nil || !ok {
+		return nil
+	}
+
+	retention, err := retainer.Retention(ctx, metadata.ID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get retention of data repository for dataset %s", metadata.ID)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	if until := metadata.FinalizedAt.Add(retention); time.Now().Before(until) {
+		msg := fmt.Sprintf("finalized dataset is retained until %s", until.UTC().Format(time.RFC3339))
+		return apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	return nil
+}
+
+// deleteDataset deletes the (empty) data repository and the metadata of a dataset.  Finalized datasets can only
+// be deleted once their retention expired.
+func (s *server) deleteDataset(ctx context.Context, service *dataset.Service, account, group, id, user string, metadata *dataset.Metadata) error {
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	if err := checkRetention(ctx, dataRepo, metadata); err != nil {
+		return err
+	}
+
 	// delete data repository (needs to be empty)
-	if err = dataRepo.Delete(r.Context(), id); err != nil {
+	if err := dataRepo.Delete(ctx, id); err != nil {
 		msg := fmt.Sprintf("failed to delete data repository for dataset %s", id)
-		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
-		return
+		return apierror.New(apierror.ErrInternalError, msg, err)
 	}
 
+	// revoke cross-account shares, their roles outlive the data repository
+	deleteShares(ctx, service, account, metadata)
+
 	// delete metadata
-	if err = service.MetadataRepository.Delete(r.Context(), account, id); err != nil {
+	if err := service.MetadataRepository.Delete(ctx, account, id); err != nil {
 		msg := fmt.Sprintf("failed to delete metadata for dataset %s", id)
-		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
-		return
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	// the access report is only available while the dataset exists, the accesses stay in the audit log
+	if service.AccessReportRepository != nil {
+		if err := service.AccessReportRepository.DeleteAccessReport(ctx, account, id); err != nil {
+			log.WithContext(ctx).Warnf("failed to delete access report of deleted dataset %s: %s", id, err)
+		}
 	}
 
 	// write to audit log
-	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog := service.AuditLogRepository.Log(ctx, group, id)
 	msg := fmt.Sprintf("Deleted dataset %s (DeletedBy: %s)", id, user)
 	auditLog <- msg
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-	w.Write([]byte{})
+	s.publishEvent(ctx, account, dataset.NewEvent(ctx, dataset.EventDatasetDeleted, account, group, id, user, nil))
+
+	return nil
 }
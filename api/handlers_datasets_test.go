@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockDataRepository records the calls to change a data repository
+type mockDataRepository struct {
+	dataset.DataRepository
+	calls       []string
+	lockErr     error
+	manifestErr error
+	retention   time.Duration
+}
+
+func (m *mockDataRepository) SetPolicy(ctx context.Context, id string, derivative bool) error {
+	m.calls = append(m.calls, fmt.Sprintf("SetPolicy(%t)", derivative))
+	return nil
+}
+
+func (m *mockDataRepository) Lock(ctx context.Context, id string) error {
+	m.calls = append(m.calls, "Lock")
+	return m.lockErr
+}
+
+func (m *mockDataRepository) Unlock(ctx context.Context, id string) error {
+	m.calls = append(m.calls, "Unlock")
+	return nil
+}
+
+func (m *mockDataRepository) Delete(ctx context.Context, id string) error {
+	m.calls = append(m.calls, "Delete")
+	return nil
+}
+
+func (m *mockDataRepository) CreateManifest(ctx context.Context, id string) (*dataset.ManifestReference, error) {
+	m.calls = append(m.calls, "CreateManifest")
+	return nil, m.manifestErr
+}
+
+func (m *mockDataRepository) Retention(ctx context.Context, id string) (time.Duration, error) {
+	return m.retention, nil
+}
+
+// failingMetadataRepository fails to finalize datasets
+type failingMetadataRepository struct {
+	mockMetadataRepository
+}
+
+func (m *failingMetadataRepository) Promote(ctx context.Context, account, id, user string) (*dataset.Metadata, error) {
+	return nil, apierror.New(apierror.ErrServiceUnavailable, "metadata repository unavailable", nil)
+}
+
+func TestPromoteDatasetRollback(t *testing.T) {
+	dataRepo := &mockDataRepository{}
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(&failingMetadataRepository{}),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{}),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": dataRepo}),
+	)
+
+	s := server{tasks: newTaskRegistry()}
+	metadata := &dataset.Metadata{ID: "abc", Group: "group1", DataStorage: "s3", Derivative: true}
+
+	// failing to finalize the metadata unlocks the data repository and restores the derivative policy
+	if _, _, err := s.promoteDataset(context.TODO(), service, "acct", "group1", "abc", "tester", metadata); err == nil {
+		t.Fatal("expected error promoting dataset, got nil")
+	}
+
+	expected := []string{"SetPolicy(false)", "Lock", "Unlock", "SetPolicy(true)"}
+	if !reflect.DeepEqual(dataRepo.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, dataRepo.calls)
+	}
+
+	// failing to lock only restores the derivative policy
+	dataRepo.calls = nil
+	dataRepo.lockErr = errors.New("boom")
+	if _, _, err := s.promoteDataset(context.TODO(), service, "acct", "group1", "abc", "tester", metadata); err == nil {
+		t.Fatal("expected error promoting dataset, got nil")
+	}
+
+	expected = []string{"SetPolicy(false)", "Lock", "SetPolicy(true)"}
+	if !reflect.DeepEqual(dataRepo.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, dataRepo.calls)
+	}
+}
+
+func TestPromoteDatasetEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	publisher := &mockEventPublisher{events: make(chan *dataset.Event, 10)}
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(&mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+			"abc": {ID: "abc", Group: "group1", DataStorage: "s3"},
+		}}),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{messages: make(chan string, 10)}),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": &mockDataRepository{manifestErr: errors.New("boom")}}),
+		dataset.WithEventPublisher(publisher),
+	)
+
+	s := server{
+		datasetServices: map[string]*dataset.Service{"acct": service},
+		context:         ctx,
+		tasks:           newTaskRegistry(),
+	}
+
+	metadata := &dataset.Metadata{ID: "abc", Group: "group1", DataStorage: "s3"}
+	if _, _, err := s.promoteDataset(ctx, service, "acct", "group1", "abc", "tester", metadata); err != nil {
+		t.Fatalf("expected nil error promoting dataset, got %s", err)
+	}
+
+	// the dataset is finalized even though its manifest failed
+	types := map[string]bool{}
+	for len(types) < 2 {
+		select {
+		case event := <-publisher.events:
+			types[event.Type] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", types)
+		}
+	}
+
+	if !types[dataset.EventDatasetFinalized] || !types[dataset.EventManifestFailed] {
+		t.Errorf("expected finalized and manifest failed events, got %v", types)
+	}
+}
+
+func TestDatasetDeleteFinalized(t *testing.T) {
+	psk := "sometesttoken"
+	now := time.Now().UTC()
+	expired := now.Add(-48 * time.Hour)
+
+	type test struct {
+		finalizedAt *time.Time
+		tokenRoles  []string
+		status      int
+		calls       []string
+	}
+
+	tests := []test{
+		// still in the retention period
+		{&now, []string{roleAdmin}, http.StatusConflict, nil},
+		// deleting finalized datasets directly needs the break-glass permission
+		{&expired, []string{roleDataSteward}, http.StatusForbidden, nil},
+		{&expired, []string{roleAdmin}, http.StatusNoContent, []string{"Delete"}},
+	}
+
+	for _, tst := range tests {
+		dataRepo := &mockDataRepository{retention: 24 * time.Hour}
+		service := dataset.NewService(
+			dataset.WithMetadataRepository(&mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+				"abc": {ID: "abc", Group: "group1", DataStorage: "s3", FinalizedAt: tst.finalizedAt},
+			}}),
+			dataset.WithAuditLogRepository(&mockAuditLogRepository{messages: make(chan string, 10)}),
+			dataset.WithDataRepository(map[string]dataset.DataRepository{"s3": dataRepo}),
+		)
+
+		handler, stop, err := NewHandler(common.Config{Token: psk, TokenRoles: tst.tokenRoles}, map[string]*dataset.Service{"acct": service})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := httptest.NewServer(handler)
+
+		hashedPSK, _ := bcrypt.GenerateFromPassword([]byte(psk), bcrypt.MinCost)
+
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/v1/ds/acct/datasets/group1/abc", nil)
+		req.Header.Add("X-Auth-Token", string(hashedPSK))
+		req.Header.Add("X-Forwarded-User", "tester")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		server.Close()
+		stop()
+
+		if resp.StatusCode != tst.status {
+			t.Errorf("expected %d deleting dataset finalized at %s with roles %v, got %d", tst.status, tst.finalizedAt, tst.tokenRoles, resp.StatusCode)
+		}
+
+		if !reflect.DeepEqual(dataRepo.calls, tst.calls) {
+			t.Errorf("expected data repository calls %v, got %v", tst.calls, dataRepo.calls)
+		}
+	}
+}
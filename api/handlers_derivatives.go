@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// DerivativeCreateHandler creates a new derivative dataset from a source dataset
+// * the derivative inherits the data classifications, DUA URL and data format of the source dataset
+// * the derivative source_ids point at the source dataset
+// * optionally, a subset of objects (by prefix or key) is copied from the source dataset in an asynchronous task
+func (s *server) DerivativeCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDerivativeCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	input := struct {
+		Name     string             `json:"name"`
+		Tags     []*dataset.Tag     `json:"tags"`
+		Metadata *dataset.Metadata  `json:"metadata"`
+		Copy     *dataset.CopyInput `json:"copy"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		msg := "cannot decode body into create derivative input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if input.Name == "" {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "dataset name is required", nil))
+		return
+	}
+
+	if input.Copy != nil && len(input.Copy.Prefixes) == 0 && len(input.Copy.Keys) == 0 {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "at least one prefix or key is required to copy objects", nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("creating derivative data set from source %s in account '%s'", id, account)
+
+	// get source metadata from repository
+	source, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Metadata == nil {
+		input.Metadata = &dataset.Metadata{}
+	}
+
+	// inherit from the source dataset
+	input.Metadata.SourceIDs = []string{id}
+	input.Metadata.DataClassifications = source.DataClassifications
+	input.Metadata.DuaURL = source.DuaURL
+	if input.Metadata.DataFormat == "" {
+		input.Metadata.DataFormat = source.DataFormat
+	}
+
+	newID, dataRepoName, metadataOutput, tags, err := s.createDataset(r.Context(), service, account, group, input.Name, source.DataStorage, true, input.Tags, input.Metadata)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// start copying objects from the source dataset in the background
+	var task *dataset.Task
+	if input.Copy != nil {
+		t := s.tasks.add(newID, "copy")
+		task = &t
+
+		go s.copyObjectsTask(service, service.DataRepository[source.DataStorage], group, id, newID, t.ID, input.Copy)
+	}
+
+	output := struct {
+		ID         string            `json:"id"`
+		Repository string            `json:"repository"`
+		Metadata   *dataset.Metadata `json:"metadata"`
+		Task       *dataset.Task     `json:"task,omitempty"`
+	}{
+		newID,
+		dataRepoName,
+		metadataOutput,
+		task,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode dataset output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	// create new audit log for the derivative data set, with a retention period of 365 days
+	lErr := service.AuditLogRepository.CreateLog(r.Context(), group, newID, int64(365), tags)
+	if lErr != nil {
+		log.WithContext(r.Context()).Errorf("failed creating job audit log for %s: %s", newID, lErr)
+	} else {
+		// initialize audit log stream
+		auditLog := service.AuditLogRepository.Log(r.Context(), group, newID)
+		auditLog <- fmt.Sprintf("Created derivative dataset %s from source dataset %s (CreatedBy: %s)", newID, id, metadataOutput.CreatedBy)
+		auditLog <- string(j)
+	}
+
+	// write to the source audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Created derivative dataset %s from dataset %s (CreatedBy: %s)", newID, id, metadataOutput.CreatedBy)
+
+	s.publishEvent(r.Context(), account, dataset.NewEvent(r.Context(), dataset.EventDatasetCreated, account, group, newID, metadataOutput.CreatedBy, map[string]interface{}{
+		"name":                 metadataOutput.Name,
+		"data_storage":         metadataOutput.DataStorage,
+		"data_classifications": metadataOutput.DataClassifications,
+		"derivative":           true,
+		"source_ids":           metadataOutput.SourceIDs,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// copyObjectsTask copies objects from the source dataset to the derivative dataset, tracking progress in the task registry
+func (s *server) copyObjectsTask(service *dataset.Service, dataRepo dataset.DataRepository, group, sourceID, id, taskID string, input *dataset.CopyInput) {
+	ctx := s.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.tasks.update(taskID, func(t *dataset.Task) { t.Status = dataset.TaskStatusRunning })
+
+	var progress dataset.CopyProgress
+	err := dataRepo.CopyObjects(ctx, sourceID, id, input, func(p dataset.CopyProgress) {
+		progress = p
+		s.tasks.update(taskID, func(t *dataset.Task) { t.Progress = &p })
+	})
+
+	s.tasks.finish(taskID, err)
+
+	// write to audit log, cancelling the context flushes the messages
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	auditLog := service.AuditLogRepository.Log(logCtx, group, id)
+	if err != nil {
+		log.Errorf("failed to copy objects from dataset %s to %s (task %s): %s", sourceID, id, taskID, err)
+		auditLog <- fmt.Sprintf("Failed to copy objects from source dataset %s (Task: %s, Copied: %d of %d objects): %s", sourceID, taskID, progress.ObjectsCopied, progress.ObjectsTotal, err)
+		return
+	}
+
+	auditLog <- fmt.Sprintf("Copied %d objects (%d bytes) from source dataset %s (Task: %s)", progress.ObjectsCopied, progress.BytesCopied, sourceID, taskID)
+}
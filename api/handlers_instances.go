@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/YaleSpinup/ds-api/apierror"
 	"github.com/YaleSpinup/ds-api/dataset"
@@ -14,6 +15,12 @@ import (
 // InstanceCreateHandler provisions access to a "dataset" for a given instance
 func (s *server) InstanceCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceGrant); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -28,63 +35,77 @@ func (s *server) InstanceCreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	input := struct {
 		InstanceID string `json:"instance_id"`
+		Permission string `json:"permission"`
+		Duration   string `json:"duration"`
 	}{}
 
 	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
-		msg := fmt.Sprintf("cannot decode body into create instance input: %s", err)
+		msg := "cannot decode body into create instance input"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	if input.InstanceID == "" {
+	if input.InstanceID == "" || principalType(input.InstanceID) != grantTypeInstance {
 		handleError(w, apierror.New(apierror.ErrBadRequest, "instance_id is required", nil))
 		return
 	}
 
-	log.Infof("provisioning access to data set '%s' in account '%s' for instance: %s", id, account, input.InstanceID)
+	var duration time.Duration
+	if input.Duration != "" {
+		if duration, err = time.ParseDuration(input.Duration); err != nil || duration <= 0 {
+			msg := fmt.Sprintf("invalid duration '%s'", input.Duration)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	user, _ := requestUser(r)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	log.WithContext(r.Context()).Infof("provisioning access to data set '%s' in account '%s' for instance: %s", id, account, input.InstanceID)
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	dataRepo, ok := service.DataRepository[metadata.DataStorage]
-	if !ok {
-		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
+	permission, err := grantPermission(metadata, input.Permission)
+	if err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// grant access to this data repository
-	datasetAccess, err := dataRepo.GrantAccess(r.Context(), id, input.InstanceID)
+	if err = requireApproval(service, metadata, dataset.ApprovalActionGrant); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	datasetAccess, expiresAt, err := s.grantAccess(r.Context(), service, account, group, id, input.InstanceID, permission, user, duration, metadata)
 	if err != nil {
-		msg := fmt.Sprintf("failed to grant access to data repository for dataset %s: %s", id, err)
-		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
+		handleError(w, err)
 		return
 	}
 
 	output := struct {
 		InstanceID string         `json:"instance_id"`
 		Access     dataset.Access `json:"access"`
+		Permission string         `json:"permission"`
+		ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
 	}{
 		input.InstanceID,
 		datasetAccess,
+		permission,
+		expiresAt,
 	}
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
+		msg := "cannot encode dataset output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
 
-	// write to audit log
-	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
-	msg := fmt.Sprintf("Granted instance access to dataset %s (InstanceID: %s)", id, input.InstanceID)
-	auditLog <- msg
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(j)
@@ -93,8 +114,15 @@ func (s *server) InstanceCreateHandler(w http.ResponseWriter, r *http.Request) {
 // InstanceListHandler lists all instances that have access to the dataset
 func (s *server) InstanceListHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
+	group := vars["group"]
 	id := vars["id"]
 
 	service, ok := s.datasetServices[account]
@@ -104,9 +132,9 @@ func (s *server) InstanceListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("listing instances with access to data set '%s' in account %s", id, account)
+	log.WithContext(r.Context()).Debugf("listing instances with access to data set '%s' in account %s", id, account)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -122,7 +150,7 @@ func (s *server) InstanceListHandler(w http.ResponseWriter, r *http.Request) {
 	// list access to this data repository
 	datasetAccess, err := dataRepo.ListAccess(r.Context(), id)
 	if err != nil {
-		msg := fmt.Sprintf("failed to list access to data repository for dataset %s: %s", id, err)
+		msg := fmt.Sprintf("failed to list access to data repository for dataset %s", id)
 		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
 		return
 	}
@@ -137,7 +165,7 @@ func (s *server) InstanceListHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(&output)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset output into json: %s", err)
+		msg := "cannot encode dataset output into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -150,6 +178,12 @@ func (s *server) InstanceListHandler(w http.ResponseWriter, r *http.Request) {
 // InstanceDeleteHandler removes access to a "dataset" for a given instance
 func (s *server) InstanceDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionInstanceRevoke); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -163,49 +197,19 @@ func (s *server) InstanceDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Infof("revoking access to data set '%s' in account %s for instance: %s", id, account, instanceID)
+	log.WithContext(r.Context()).Infof("revoking access to data set '%s' in account %s for instance: %s", id, account, instanceID)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	dataRepo, ok := service.DataRepository[metadata.DataStorage]
-	if !ok {
-		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
-		return
-	}
-
-	// list current access to this data repository
-	listAccess, err := dataRepo.ListAccess(r.Context(), id)
-	if err != nil {
-		msg := fmt.Sprintf("failed to list access to data repository for dataset %s: %s", id, err)
-		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
-		return
-	}
-
-	// check if requested instance currently has access
-	if _, ok := listAccess[instanceID]; !ok {
-		msg := fmt.Sprintf("instance %s currently does not have access to data repository for dataset %s", instanceID, id)
-		handleError(w, apierror.New(apierror.ErrBadRequest, msg, nil))
-		return
-	}
-
-	// revoke access to this data repository
-	err = dataRepo.RevokeAccess(r.Context(), id, instanceID)
-	if err != nil {
-		msg := fmt.Sprintf("failed to revoke access to data repository for dataset %s: %s", id, err)
-		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
+	if err = s.revokeAccess(r, service, account, group, id, instanceID, metadata); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// write to audit log
-	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
-	msg := fmt.Sprintf("Revoked instance access to dataset %s (InstanceID: %s)", id, instanceID)
-	auditLog <- msg
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 	w.Write([]byte{})
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLineageDepth is the number of hops followed in each direction if no depth is requested
+const defaultLineageDepth = 10
+
+// maxLineageDepth is the largest depth that can be requested
+const maxLineageDepth = 50
+
+// DatasetLineageHandler returns the lineage graph of a dataset: the transitive upstream sources (through source_ids)
+// and downstream derivatives of the dataset in the same account.  The depth query parameter limits the number of hops
+// followed in each direction.  Datasets of other groups are only included by their id.
+func (s *server) DatasetLineageHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	depth := defaultLineageDepth
+	if d := r.URL.Query().Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil || depth < 1 || depth > maxLineageDepth {
+			msg := fmt.Sprintf("invalid depth '%s', must be between 1 and %d", d, maxLineageDepth)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	log.WithContext(r.Context()).Debugf("building lineage for data set %s in account %s (depth: %d)", id, account, depth)
+
+	// make sure the dataset exists
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	datasets, err := service.MetadataRepository.List(r.Context(), account)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	lineage := dataset.NewLineage(id, datasets, depth)
+
+	// datasets of other groups are part of the graph, but only by their id
+	hidden := map[string]bool{}
+	for _, m := range datasets {
+		if !inGroup(r.Context(), m, group) {
+			hidden[m.ID] = true
+		}
+	}
+
+	for _, n := range lineage.Nodes {
+		if hidden[n.ID] {
+			n.Name = ""
+			n.DataClassifications = []string{}
+			n.FinalizedAt = nil
+		}
+	}
+
+	j, err := json.Marshal(lineage)
+	if err != nil {
+		msg := "cannot encode lineage output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// validateSourceIDs makes sure the source datasets exist in the same account
+func validateSourceIDs(ctx context.Context, service *dataset.Service, account string, sourceIDs []string) error {
+	for _, sid := range sourceIDs {
+		if sid == "" {
+			return apierror.New(apierror.ErrBadRequest, "invalid empty source id", nil)
+		}
+
+		log.WithContext(ctx).Debugf("validating source dataset %s exists in account %s", sid, account)
+
+		if _, err := service.MetadataRepository.Get(ctx, account, sid); err != nil {
+			if aerr, ok := errors.Cause(err).(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				msg := fmt.Sprintf("source dataset not found: %s", sid)
+				return apierror.New(apierror.ErrBadRequest, msg, err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
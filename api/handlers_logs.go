@@ -6,12 +6,21 @@ import (
 	"net/http"
 
 	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 // LogListHandler returns the audit logs for a dataset
 func (s *server) LogListHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionLogRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -24,12 +33,75 @@ func (s *server) LogListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	// get audit log for this dataset
 	auditLog, err := service.AuditLogRepository.GetLog(r.Context(), group, id)
 
 	j, err := json.Marshal(auditLog)
 	if err != nil {
-		msg := fmt.Sprintf("cannot encode dataset audit logs into json: %s", err)
+		msg := "cannot encode dataset audit logs into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// AccessReportHandler returns who accessed the data of a dataset, from the access logs of its data repository
+// that have been ingested so far
+func (s *server) AccessReportHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionLogRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.AccessReportRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "access reports are not supported for this account", nil))
+		return
+	}
+
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("getting access report of dataset %s in account %s", id, account)
+
+	report, err := service.AccessReportRepository.GetAccessReport(r.Context(), account, id)
+	if err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+			handleError(w, err)
+			return
+		}
+
+		// no access logs have been ingested yet
+		report = &dataset.AccessReport{DatasetID: id, Group: group, Principals: []*dataset.PrincipalAccess{}}
+	}
+	report.LogCursor = ""
+
+	j, err := json.Marshal(report)
+	if err != nil {
+		msg := "cannot encode access report into json"
 		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
 		return
 	}
@@ -0,0 +1,455 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// dataSharer is implemented by data repositories that can be shared with other AWS accounts
+type dataSharer interface {
+	CreateShare(ctx context.Context, id string, share *dataset.Share) error
+	DeleteShare(ctx context.Context, id string, share *dataset.Share) error
+}
+
+// ShareListHandler lists the AWS accounts a dataset is shared with
+func (s *server) ShareListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionShareRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ShareRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "shares are not supported for this account", nil))
+		return
+	}
+
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("listing shares of data set '%s' in account %s", id, account)
+
+	shares, err := service.ShareRepository.ListShares(r.Context(), account, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].SharedAt == nil || shares[j].SharedAt == nil {
+			return shares[i].ID < shares[j].ID
+		}
+		return shares[i].SharedAt.Before(*shares[j].SharedAt)
+	})
+
+	output := struct {
+		ID     string           `json:"id"`
+		Shares []*dataset.Share `json:"shares"`
+	}{
+		id,
+		shares,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode shares output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ShareCreateHandler shares a dataset with another AWS account.  Original datasets can only be shared read-only,
+// and the classification policies of the dataset must allow sharing.
+func (s *server) ShareCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionShareCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ShareRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "shares are not supported for this account", nil))
+		return
+	}
+
+	input := struct {
+		AccountID  string `json:"account_id"`
+		Access     string `json:"access"`
+		CreateRole bool   `json:"create_role"`
+		Duration   string `json:"duration"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		msg := "cannot decode body into create share input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if input.AccountID == "" {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "account_id is required", nil))
+		return
+	}
+
+	if input.Access == "" {
+		input.Access = dataset.ShareAccessRead
+	}
+
+	if input.Access != dataset.ShareAccessRead && input.Access != dataset.ShareAccessWrite {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "access must be read or write", nil))
+		return
+	}
+
+	var duration time.Duration
+	if input.Duration != "" {
+		if duration, err = time.ParseDuration(input.Duration); err != nil || duration <= 0 {
+			msg := fmt.Sprintf("invalid duration '%s'", input.Duration)
+			handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+			return
+		}
+	}
+
+	user, _ := requestUser(r)
+
+	log.WithContext(r.Context()).Infof("sharing data set '%s' in account %s with account %s (%s)", id, account, input.AccountID, input.Access)
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Access == dataset.ShareAccessWrite && !metadata.Derivative {
+		handleError(w, apierror.New(apierror.ErrForbidden, "original datasets can only be shared read-only", nil))
+		return
+	}
+
+	if err = s.classifications.checkShare(metadata); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// shares expire like grants
+	if duration, err = s.classifications.checkGrant(metadata, duration); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	sharer, err := repositorySharer(service, metadata)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	share := &dataset.Share{
+		ID:        uuid.New().String(),
+		DatasetID: id,
+		Group:     group,
+		AccountID: input.AccountID,
+		Access:    input.Access,
+		SharedAt:  &now,
+		SharedBy:  user,
+	}
+
+	if input.CreateRole {
+		share.ExternalID = uuid.New().String()
+	}
+
+	if duration > 0 {
+		expires := now.Add(duration)
+		share.ExpiresAt = &expires
+	}
+
+	if err = sharer.CreateShare(r.Context(), id, share); err != nil {
+		// keep client errors from validating the share
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok && (aerr.Code == apierror.ErrBadRequest || aerr.Code == apierror.ErrForbidden) {
+			handleError(w, err)
+			return
+		}
+		msg := fmt.Sprintf("failed to share data repository for dataset %s", id)
+		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
+		return
+	}
+
+	if err = service.ShareRepository.PutShare(r.Context(), account, share); err != nil {
+		// don't leave a share behind that can't be listed or revoked
+		if rErr := sharer.DeleteShare(r.Context(), id, share); rErr != nil {
+			log.WithContext(r.Context()).Errorf("failed to remove share %s of dataset %s after failing to record it: %s", share.ID, id, rErr)
+		}
+		msg := fmt.Sprintf("failed to record share of data repository for dataset %s", id)
+		handleError(w, apierror.New(apierror.ErrInternalError, msg, err))
+		return
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Shared dataset %s with account %s (%s)", id, share.AccountID, shareFields(share))
+
+	j, err := json.Marshal(share)
+	if err != nil {
+		msg := "cannot encode share output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ShareUpdateHandler changes the expiration of a share, expired shares are revoked by the grant sweeper
+func (s *server) ShareUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionShareRevoke); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+	shareID := vars["share_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ShareRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "shares are not supported for this account", nil))
+		return
+	}
+
+	input := struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		msg := "cannot decode body into update share input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if input.ExpiresAt == nil || !input.ExpiresAt.After(time.Now()) {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "expires_at must be in the future", nil))
+		return
+	}
+
+	share, err := service.ShareRepository.GetShare(r.Context(), account, id, shareID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// the new expiration can't exceed the maximum grant duration from now
+	max, err := s.classifications.checkGrant(metadata, 0)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	expires := input.ExpiresAt.UTC().Truncate(time.Second)
+	if max > 0 && expires.After(time.Now().Add(max)) {
+		msg := fmt.Sprintf("dataset %s can be shared for at most %s", id, max)
+		handleError(w, apierror.New(apierror.ErrForbidden, msg, nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("updating expiration of share %s of data set '%s' in account %s to %s", shareID, id, account, expires.Format(time.RFC3339))
+
+	share.ExpiresAt = &expires
+	if err = service.ShareRepository.PutShare(r.Context(), account, share); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Updated share of dataset %s with account %s (%s)", id, share.AccountID, shareFields(share))
+
+	j, err := json.Marshal(share)
+	if err != nil {
+		msg := "cannot encode share output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// ShareDeleteHandler revokes a share of a dataset
+func (s *server) ShareDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionShareRevoke); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+	shareID := vars["share_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.ShareRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "shares are not supported for this account", nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("revoking share %s of data set '%s' in account %s", shareID, id, account)
+
+	share, err := service.ShareRepository.GetShare(r.Context(), account, id, shareID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	metadata, err := getDataset(r.Context(), service, account, group, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err = revokeShare(r.Context(), service, account, metadata, share); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// write to audit log
+	auditLog := service.AuditLogRepository.Log(r.Context(), group, id)
+	auditLog <- fmt.Sprintf("Revoked share of dataset %s with account %s (%s)", id, share.AccountID, shareFields(share))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte{})
+}
+
+// revokeShare removes the access of a share from the data repository and deletes the share
+func revokeShare(ctx context.Context, service *dataset.Service, account string, metadata *dataset.Metadata, share *dataset.Share) error {
+	sharer, err := repositorySharer(service, metadata)
+	if err != nil {
+		return err
+	}
+
+	if err = sharer.DeleteShare(ctx, share.DatasetID, share); err != nil {
+		msg := fmt.Sprintf("failed to revoke share %s of data repository for dataset %s", share.ID, share.DatasetID)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	return service.ShareRepository.DeleteShare(ctx, account, share.DatasetID, share.ID)
+}
+
+// deleteShares revokes all shares of a deleted dataset.  Errors are logged, since the dataset is already gone.
+func deleteShares(ctx context.Context, service *dataset.Service, account string, metadata *dataset.Metadata) {
+	if service.ShareRepository == nil {
+		return
+	}
+
+	shares, err := service.ShareRepository.ListShares(ctx, account, metadata.ID)
+	if err != nil {
+		log.WithContext(ctx).Warnf("failed to list shares of deleted dataset %s: %s", metadata.ID, err)
+		return
+	}
+
+	for _, share := range shares {
+		if err := revokeShare(ctx, service, account, metadata, share); err != nil {
+			log.WithContext(ctx).Warnf("failed to revoke share %s of deleted dataset %s: %s", share.ID, metadata.ID, err)
+		}
+	}
+}
+
+// repositorySharer returns the data repository of a dataset, if it can be shared
+func repositorySharer(service *dataset.Service, metadata *dataset.Metadata) (dataSharer, error) {
+	dataRepo, ok := service.DataRepository[metadata.DataStorage]
+	if !ok {
+		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	sharer, ok := dataRepo.(dataSharer)
+	if !ok {
+		msg := fmt.Sprintf("data repository type %s can't be shared", metadata.DataStorage)
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	return sharer, nil
+}
+
+// shareFields formats a share for the audit log
+func shareFields(share *dataset.Share) string {
+	fields := fmt.Sprintf("ShareID: %s, Access: %s", share.ID, share.Access)
+	if share.RoleArn != "" {
+		fields += ", RoleArn: " + share.RoleArn
+	}
+	if share.SharedBy != "" {
+		fields += ", SharedBy: " + share.SharedBy
+	}
+	if share.ExpiresAt != nil {
+		fields += ", ExpiresAt: " + share.ExpiresAt.Format(time.RFC3339)
+	}
+	return fields
+}
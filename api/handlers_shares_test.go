@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+func TestShareFields(t *testing.T) {
+	expires := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]*dataset.Share{
+		"ShareID: abc, Access: read": {ID: "abc", Access: dataset.ShareAccessRead},
+		"ShareID: abc, Access: write, RoleArn: arn:aws:iam::012345678901:role/test/shareRole_abc, SharedBy: jdoe, ExpiresAt: 2024-01-02T03:04:05Z": {
+			ID:        "abc",
+			Access:    dataset.ShareAccessWrite,
+			RoleArn:   "arn:aws:iam::012345678901:role/test/shareRole_abc",
+			SharedBy:  "jdoe",
+			ExpiresAt: &expires,
+		},
+	}
+
+	for expected, share := range tests {
+		if out := shareFields(share); out != expected {
+			t.Errorf("expected %s, got %s", expected, out)
+		}
+	}
+}
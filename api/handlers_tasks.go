@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// TaskShowHandler returns the status of an asynchronous task for a dataset
+func (s *server) TaskShowHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionDatasetRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	id := vars["id"]
+	taskID := vars["task_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if _, err := getDataset(r.Context(), service, account, group, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("showing task %s for data set %s in account %s", taskID, id, account)
+
+	task, ok := s.tasks.get(id, taskID)
+	if !ok {
+		msg := fmt.Sprintf("task not found: %s", taskID)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	j, err := json.Marshal(&task)
+	if err != nil {
+		msg := "cannot encode task output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
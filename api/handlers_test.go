@@ -1,11 +1,17 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/YaleSpinup/ds-api/apierror"
 	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
 )
 
 func TestPingHandler(t *testing.T) {
@@ -60,3 +66,101 @@ func TestVersionHandler(t *testing.T) {
 			rr.Body.String(), expected)
 	}
 }
+
+func TestHandleError(t *testing.T) {
+	type test struct {
+		err     error
+		status  int
+		code    string
+		message string
+	}
+
+	tests := []test{
+		{apierror.New(apierror.ErrBadRequest, "bad request", nil), http.StatusBadRequest, apierror.ErrBadRequest, "bad request"},
+		{apierror.New(apierror.ErrForbidden, "forbidden", nil), http.StatusForbidden, apierror.ErrForbidden, "forbidden"},
+		{apierror.New(apierror.ErrNotFound, "not found", nil), http.StatusNotFound, apierror.ErrNotFound, "not found"},
+		{apierror.New(apierror.ErrConflict, "conflict", nil), http.StatusConflict, apierror.ErrConflict, "conflict"},
+		{apierror.New(apierror.ErrLimitExceeded, "slow down", nil), http.StatusTooManyRequests, apierror.ErrLimitExceeded, "slow down"},
+		{apierror.New(apierror.ErrServiceUnavailable, "unavailable", nil), http.StatusServiceUnavailable, apierror.ErrServiceUnavailable, "unavailable"},
+		{apierror.New(apierror.ErrInternalError, "boom", nil), http.StatusInternalServerError, apierror.ErrInternalError, "boom"},
+		{errors.Wrap(apierror.New(apierror.ErrNotFound, "not found", nil), "wrapped"), http.StatusNotFound, apierror.ErrNotFound, "not found"},
+		{errors.New("AccessDenied: arn:aws:iam::012345678901:role/secret"), http.StatusInternalServerError, apierror.ErrInternalError, "internal error"},
+	}
+
+	for _, tst := range tests {
+		rr := httptest.NewRecorder()
+		handleError(rr, tst.err)
+
+		if rr.Code != tst.status {
+			t.Errorf("expected status %d for %s, got %d", tst.status, tst.err, rr.Code)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected json content type, got %s", ct)
+		}
+
+		out := errorResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("expected json error body, got %s", rr.Body.String())
+		}
+
+		if out.Code != tst.code || out.Message != tst.message {
+			t.Errorf("expected code %s and message %s, got %+v", tst.code, tst.message, out)
+		}
+
+		if out.RequestID == "" || out.RequestID != rr.Header().Get(requestIDHeader) {
+			t.Errorf("expected request id in body and header, got %+v", out)
+		}
+	}
+
+	// details and an existing request id
+	rr := httptest.NewRecorder()
+	rr.Header().Set(requestIDHeader, "abc123")
+	handleError(rr, apierror.NewWithDetails(apierror.ErrBadRequest, "invalid input", json.RawMessage(`{"name":"required"}`), nil))
+
+	expected := `{"code":"BadRequest","message":"invalid input","request_id":"abc123","details":{"name":"required"}}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected body %s, got %s", expected, rr.Body.String())
+	}
+}
+
+// blockingActivityQueue blocks receiving messages until the context is cancelled
+type blockingActivityQueue struct {
+	dataset.ActivityQueue
+	receiving chan struct{}
+}
+
+func (q *blockingActivityQueue) Receive(ctx context.Context) ([]*dataset.ActivityMessage, error) {
+	q.receiving <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestNewHandlerStop(t *testing.T) {
+	queue := &blockingActivityQueue{receiving: make(chan struct{}, 1)}
+	service := dataset.NewService(dataset.WithActivityQueue(queue))
+
+	_, stop, err := NewHandler(common.Config{Token: "sometesttoken"}, map[string]*dataset.Service{"acct": service})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-queue.receiving:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the activity worker to start")
+	}
+
+	// stopping cancels the workers and waits for them to finish
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the workers to stop")
+	}
+}
@@ -14,8 +14,15 @@ import (
 // UserListHandler lists the users for a dataset
 func (s *server) UserListHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionUserRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
+	group := vars["group"]
 	id := vars["id"]
 
 	service, ok := s.datasetServices[account]
@@ -25,9 +32,9 @@ func (s *server) UserListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("listing users of dataset '%s' in account %s", id, account)
+	log.WithContext(r.Context()).Debugf("listing users of dataset '%s' in account %s", id, account)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -58,7 +65,7 @@ func (s *server) UserListHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(datasetUsers)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", datasetUsers, err)
+		log.WithContext(r.Context()).Errorf("cannot marshal reasponse(%v) into JSON: %s", datasetUsers, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -71,6 +78,12 @@ func (s *server) UserListHandler(w http.ResponseWriter, r *http.Request) {
 // UserCreateHandler creates a user for a dataset
 func (s *server) UserCreateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionUserCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -83,14 +96,19 @@ func (s *server) UserCreateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("creating user of dataset '%s' in account %s", id, account)
+	log.WithContext(r.Context()).Debugf("creating user of dataset '%s' in account %s", id, account)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
+	if err = s.classifications.checkTemporaryUser(metadata); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	dataRepo, ok := service.DataRepository[metadata.DataStorage]
 	if !ok {
 		msg := fmt.Sprintf("requested data repository type not supported for this account: %s", metadata.DataStorage)
@@ -106,7 +124,7 @@ func (s *server) UserCreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(user)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", user, err)
+		log.WithContext(r.Context()).Errorf("cannot marshal reasponse(%v) into JSON: %s", user, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -124,6 +142,12 @@ func (s *server) UserCreateHandler(w http.ResponseWriter, r *http.Request) {
 // UserDeleteHandler deletes a user of a dataset
 func (s *server) UserDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionUserDelete); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -136,9 +160,9 @@ func (s *server) UserDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("deleting user of dataset '%s' in account %s", id, account)
+	log.WithContext(r.Context()).Debugf("deleting user of dataset '%s' in account %s", id, account)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -171,6 +195,12 @@ func (s *server) UserDeleteHandler(w http.ResponseWriter, r *http.Request) {
 // UserUpdateHandler updates key for a user of a dataset
 func (s *server) UserUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
+
+	if err := s.authorize(r, actionUserUpdate); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	account := vars["account"]
 	group := vars["group"]
@@ -183,9 +213,9 @@ func (s *server) UserUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("updating user of dataset '%s' in account %s", id, account)
+	log.WithContext(r.Context()).Debugf("updating user of dataset '%s' in account %s", id, account)
 
-	metadata, err := service.MetadataRepository.Get(r.Context(), account, id)
+	metadata, err := getDataset(r.Context(), service, account, group, id)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -206,7 +236,7 @@ func (s *server) UserUpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 	j, err := json.Marshal(out)
 	if err != nil {
-		log.Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
+		log.WithContext(r.Context()).Errorf("cannot marshal reasponse(%v) into JSON: %s", out, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
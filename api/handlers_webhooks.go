@@ -0,0 +1,374 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/YaleSpinup/ds-api/webhook"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookListHandler lists the webhooks subscribed to the events of a group.  Secrets are only returned when a
+// webhook is created.
+func (s *server) WebhookListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionWebhookRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.WebhookRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "webhooks are not supported for this account", nil))
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("listing webhooks of group '%s' in account %s", group, account)
+
+	webhooks, err := service.WebhookRepository.ListWebhooks(r.Context(), account, group)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].CreatedAt == nil || webhooks[j].CreatedAt == nil {
+			return webhooks[i].ID < webhooks[j].ID
+		}
+		return webhooks[i].CreatedAt.Before(*webhooks[j].CreatedAt)
+	})
+
+	for _, wh := range webhooks {
+		wh.Secret = ""
+	}
+
+	output := struct {
+		Group    string             `json:"group"`
+		Webhooks []*dataset.Webhook `json:"webhooks"`
+	}{
+		group,
+		webhooks,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode webhooks output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// WebhookCreateHandler subscribes an HTTP endpoint to the events of the datasets in a group.  If no secret is
+// given, a random secret is generated.  The secret is only returned in the response of this request.
+func (s *server) WebhookCreateHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionWebhookCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.WebhookRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "webhooks are not supported for this account", nil))
+		return
+	}
+
+	input := struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		msg := "cannot decode body into create webhook input"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	if err = validateWebhook(r.Context(), input.URL, input.Events, s.allowHTTP); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if input.Secret == "" {
+		if input.Secret, err = newWebhookSecret(); err != nil {
+			handleError(w, apierror.New(apierror.ErrInternalError, "failed to generate webhook secret", err))
+			return
+		}
+	}
+
+	user, _ := requestUser(r)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	webhook := &dataset.Webhook{
+		ID:        uuid.New().String(),
+		Group:     group,
+		URL:       input.URL,
+		Events:    input.Events,
+		Secret:    input.Secret,
+		CreatedAt: &now,
+		CreatedBy: user,
+	}
+
+	log.WithContext(r.Context()).Infof("subscribing webhook %s to events of group '%s' in account %s: %s", webhook.ID, group, account, webhook.URL)
+
+	if err = service.WebhookRepository.PutWebhook(r.Context(), account, webhook); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	j, err := json.Marshal(webhook)
+	if err != nil {
+		msg := "cannot encode webhook output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// WebhookDeleteHandler unsubscribes a webhook, and deletes its dead letters
+func (s *server) WebhookDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionWebhookDelete); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	webhookID := vars["webhook_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.WebhookRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "webhooks are not supported for this account", nil))
+		return
+	}
+
+	if _, err := service.WebhookRepository.GetWebhook(r.Context(), account, group, webhookID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("deleting webhook %s of group '%s' in account %s", webhookID, group, account)
+
+	if err := service.WebhookRepository.DeleteWebhook(r.Context(), account, group, webhookID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	deadLetters, err := service.WebhookRepository.ListDeadLetters(r.Context(), account, group, webhookID)
+	if err != nil {
+		log.WithContext(r.Context()).Warnf("failed to list dead letters of deleted webhook %s: %s", webhookID, err)
+	}
+
+	for _, d := range deadLetters {
+		if err := service.WebhookRepository.DeleteDeadLetter(r.Context(), account, group, webhookID, d.ID); err != nil {
+			log.WithContext(r.Context()).Warnf("failed to delete dead letter %s of deleted webhook %s: %s", d.ID, webhookID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte{})
+}
+
+// DeadLetterListHandler lists the events that couldn't be delivered to a webhook
+func (s *server) DeadLetterListHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionWebhookRead); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	webhookID := vars["webhook_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	if service.WebhookRepository == nil {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "webhooks are not supported for this account", nil))
+		return
+	}
+
+	if _, err := service.WebhookRepository.GetWebhook(r.Context(), account, group, webhookID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Debugf("listing dead letters of webhook %s in account %s", webhookID, account)
+
+	deadLetters, err := service.WebhookRepository.ListDeadLetters(r.Context(), account, group, webhookID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	sort.Slice(deadLetters, func(i, j int) bool {
+		if deadLetters[i].FailedAt == nil || deadLetters[j].FailedAt == nil {
+			return deadLetters[i].ID < deadLetters[j].ID
+		}
+		return deadLetters[i].FailedAt.Before(*deadLetters[j].FailedAt)
+	})
+
+	output := struct {
+		WebhookID   string                `json:"webhook_id"`
+		DeadLetters []*dataset.DeadLetter `json:"dead_letters"`
+	}{
+		webhookID,
+		deadLetters,
+	}
+
+	j, err := json.Marshal(&output)
+	if err != nil {
+		msg := "cannot encode dead letters output into json"
+		handleError(w, apierror.New(apierror.ErrBadRequest, msg, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+// DeadLetterRedeliverHandler makes another attempt to deliver an event that couldn't be delivered to a webhook.
+// The dead letter is deleted once the event is delivered.
+func (s *server) DeadLetterRedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if err := s.authorize(r, actionWebhookCreate); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	vars := mux.Vars(r)
+	account := vars["account"]
+	group := vars["group"]
+	webhookID := vars["webhook_id"]
+	deadLetterID := vars["deadletter_id"]
+
+	service, ok := s.datasetServices[account]
+	if !ok {
+		msg := fmt.Sprintf("account not found: %s", account)
+		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
+		return
+	}
+
+	dispatcher, ok := s.webhooks[account]
+	if service.WebhookRepository == nil || !ok {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "webhooks are not supported for this account", nil))
+		return
+	}
+
+	webhook, err := service.WebhookRepository.GetWebhook(r.Context(), account, group, webhookID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	deadLetter, err := service.WebhookRepository.GetDeadLetter(r.Context(), account, group, webhookID, deadLetterID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.WithContext(r.Context()).Infof("redelivering event %s to webhook %s in account %s", deadLetter.Event.ID, webhookID, account)
+
+	if err = dispatcher.Deliver(r.Context(), webhook, deadLetter.Event); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err = service.WebhookRepository.DeleteDeadLetter(r.Context(), account, group, webhookID, deadLetterID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte{})
+}
+
+// validateWebhook checks the URL and the event types of a webhook.  The URL must be an absolute https URL, or
+// http if allowHTTP is set, that only resolves to public addresses, and all of the events must be known event types.
+func validateWebhook(ctx context.Context, rawURL string, events []string, allowHTTP bool) error {
+	if rawURL == "" {
+		return apierror.New(apierror.ErrBadRequest, "url is required", nil)
+	}
+
+	if err := webhook.CheckURL(ctx, rawURL, allowHTTP); err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if !dataset.ValidEventType(e) {
+			return apierror.New(apierror.ErrBadRequest, "invalid event type "+e, nil)
+		}
+	}
+
+	return nil
+}
+
+// newWebhookSecret returns a random hex encoded secret to sign the events delivered to a webhook
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
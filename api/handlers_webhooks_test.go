@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	type test struct {
+		url       string
+		events    []string
+		allowHTTP bool
+		valid     bool
+	}
+
+	// ip addresses don't need to be resolved, resolving hosts is tested in the webhook package
+	tests := []test{
+		{"https://93.184.216.34/hooks/ds", nil, false, true},
+		{"https://93.184.216.34/hooks/ds", []string{dataset.EventDatasetCreated, dataset.EventAccessRevoked}, false, true},
+		{"http://93.184.216.34:8080/receive", nil, true, true},
+		{"http://93.184.216.34:8080/receive", nil, false, false},
+		{"", nil, false, false},
+		{"93.184.216.34/hooks", nil, false, false},
+		{"ftp://93.184.216.34/hooks", nil, true, false},
+		{"https:///hooks", nil, false, false},
+		{"https://127.0.0.1:8080/receive", nil, false, false},
+		{"https://169.254.169.254/latest/meta-data", nil, false, false},
+		{"https://10.1.2.3/hooks", nil, false, false},
+		{"https://93.184.216.34/hooks/ds", []string{"dataset.updated"}, false, false},
+	}
+
+	for _, tst := range tests {
+		err := validateWebhook(context.TODO(), tst.url, tst.events, tst.allowHTTP)
+		if tst.valid && err != nil {
+			t.Errorf("expected nil error for %s %v (allow http: %t), got %s", tst.url, tst.events, tst.allowHTTP, err)
+		}
+		if !tst.valid && err == nil {
+			t.Errorf("expected error for %s %v (allow http: %t), got nil", tst.url, tst.events, tst.allowHTTP)
+		}
+	}
+}
+
+func TestNewWebhookSecret(t *testing.T) {
+	a, err := newWebhookSecret()
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	b, _ := newWebhookSecret()
+	if len(a) != 64 || a == b {
+		t.Errorf("expected distinct 64 character secrets, got %s and %s", a, b)
+	}
+}
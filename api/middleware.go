@@ -1,23 +1,192 @@
 package api
 
 import (
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/YaleSpinup/ds-api/jwt"
+	"github.com/google/uuid"
+	"github.com/gorilla/handlers"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// TokenMiddleware checks the tokens for non-public URLs
-func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.Handler {
+// apiClient is a named API client with a hashed secret and the scopes it's allowed to use
+type apiClient struct {
+	name     string
+	secret   []byte
+	roles    []string
+	accounts map[string]bool
+	groups   map[string]bool
+	verbs    map[string]bool
+}
+
+// scopeResources are the resources that can be used in client verbs
+var scopeResources = map[string]bool{
+	"*":           true,
+	"datasets":    true,
+	"attachments": true,
+	"instances":   true,
+	"logs":        true,
+	"users":       true,
+	"shares":      true,
+	"webhooks":    true,
+}
+
+// scopeActions are the actions that can be used in client verbs
+var scopeActions = map[string]bool{
+	"*":     true,
+	"read":  true,
+	"write": true,
+}
+
+// newAPIClients validates the configured API clients and their scopes
+func newAPIClients(config map[string]common.Client) (map[string]*apiClient, error) {
+	clients := make(map[string]*apiClient, len(config))
+	for name, c := range config {
+		if c.Secret == "" {
+			return nil, fmt.Errorf("secret is required for api client %s", name)
+		}
+
+		client := &apiClient{
+			name:     name,
+			secret:   []byte(c.Secret),
+			roles:    c.Roles,
+			accounts: make(map[string]bool),
+			groups:   make(map[string]bool),
+			verbs:    make(map[string]bool),
+		}
+
+		for _, a := range c.Accounts {
+			client.accounts[a] = true
+		}
+
+		for _, g := range c.Groups {
+			client.groups[g] = true
+		}
+
+		for _, v := range c.Verbs {
+			if v == "*" {
+				v = "*:*"
+			}
+
+			parts := strings.SplitN(v, ":", 2)
+			if len(parts) != 2 || !scopeResources[parts[0]] || !scopeActions[parts[1]] {
+				return nil, fmt.Errorf("invalid verb '%s' for api client %s", v, name)
+			}
+
+			client.verbs[v] = true
+		}
+
+		clients[name] = client
+	}
+
+	return clients, nil
+}
+
+// allowed returns true if the client is allowed to perform the action on the resource in the account and group
+func (c *apiClient) allowed(account, group, resource, action string) bool {
+	if !c.accounts["*"] && !c.accounts[account] {
+		return false
+	}
+
+	if !c.groups["*"] && !c.groups[group] {
+		return false
+	}
+
+	for _, v := range []string{resource + ":" + action, resource + ":*", "*:" + action, "*:*"} {
+		if c.verbs[v] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scopedGroups returns the groups the client is scoped to, or nil if it's allowed to access all groups
+func (c *apiClient) scopedGroups() []string {
+	if c.groups["*"] {
+		return nil
+	}
+
+	groups := make([]string, 0, len(c.groups))
+	for g := range c.groups {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	return groups
+}
+
+// requestScope determines the account, group, resource and action of a request from the request path
+// (/v1/ds/{account}/datasets/{group}[/{id}[/{resource}...]] or /v1/ds/{account}/webhooks/{group}[/...]) and
+// method.  It returns false if the path isn't a dataset or webhook path.
+func requestScope(method, path string) (account, group, resource, action string, ok bool) {
+	path = strings.TrimPrefix(path, "/v1/ds/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 || parts[0] == "" || (parts[1] != "datasets" && parts[1] != "webhooks") || parts[2] == "" {
+		return "", "", "", "", false
+	}
+
+	account = parts[0]
+	group = parts[2]
+
+	// dataset subresources (verify, lineage, derivatives, tasks, approvals) are scoped as datasets, webhooks and
+	// their dead letters as webhooks
+	resource = "datasets"
+	if parts[1] == "webhooks" {
+		resource = "webhooks"
+	} else if len(parts) > 4 {
+		switch parts[4] {
+		case "attachments", "instances", "logs", "users", "shares":
+			resource = parts[4]
+		case "access":
+			// instance and role grants are scoped as instances
+			resource = "instances"
+		}
+	}
+
+	action = "write"
+	if method == http.MethodGet || method == http.MethodHead {
+		action = "read"
+	}
+
+	return account, group, resource, action, true
+}
+
+// requestUser returns the acting user for a request.  The validated user from a bearer token always takes precedence,
+// otherwise the X-Forwarded-User header passed by callers using an API token is used.
+func requestUser(r *http.Request) (string, bool) {
+	if identity, ok := dataset.IdentityFromContext(r.Context()); ok && identity.User != "" {
+		return identity.User, true
+	}
+
+	user := r.Header.Get("X-Forwarded-User")
+	return user, user != ""
+}
+
+// TokenMiddleware checks the tokens for non-public URLs.  Requests with an Authorization bearer token are validated
+// against the trusted issuers, and are only allowed to access the groups in the token claims.  Requests with an
+// X-Auth-Client header are authenticated against the named API client and its scopes, otherwise the X-Auth-Token is
+// checked against the shared pre-shared key.  The identity of the caller is added to the request context.
+func TokenMiddleware(psk []byte, tokenRoles []string, clients map[string]*apiClient, validator *jwt.Validator, public map[string]string, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Debug("processing token middleware for protected URLs")
+		log.WithContext(r.Context()).Debug("processing token middleware for protected URLs")
 
 		// Handle CORS preflight checks
 		if r.Method == "OPTIONS" {
-			log.Info("setting CORS preflight options and returning")
+			log.WithContext(r.Context()).Info("setting CORS preflight options and returning")
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "X-Auth-Token")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-Auth-Token, X-Auth-Client, X-Request-ID")
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
 			return
@@ -25,26 +194,139 @@ func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.
 
 		uri, err := url.ParseRequestURI(r.RequestURI)
 		if err != nil {
-			log.Error("Unable to parse request URI ", err)
-			w.WriteHeader(http.StatusForbidden)
+			log.WithContext(r.Context()).Error("Unable to parse request URI ", err)
+			handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
 			return
 		}
 
 		if _, ok := public[uri.Path]; ok {
-			log.Infof("not authenticating request for '%s'", uri.Path)
-		} else {
-			log.Debugf("authenticating token for protected URL '%s'", r.URL)
+			log.WithContext(r.Context()).Infof("not authenticating request for '%s'", uri.Path)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		log.WithContext(r.Context()).Debugf("authenticating token for protected URL '%s'", r.URL)
+
+		if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+			if validator == nil {
+				log.WithContext(r.Context()).Warnf("bearer token authentication is not configured, rejecting request for '%s'", r.URL)
+				handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
+				return
+			}
 
-			htoken := r.Header.Get("X-Auth-Token")
+			claims, err := validator.Validate(r.Context(), strings.TrimPrefix(bearer, "Bearer "))
+			if err != nil {
+				log.WithContext(r.Context()).Warnf("Unable to validate bearer token for '%s': %s", r.URL, err)
+				handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
+				return
+			}
+
+			_, group, _, _, ok := requestScope(r.Method, uri.Path)
+			if !ok || !contains(claims.Groups, group) {
+				log.WithContext(r.Context()).Warnf("user '%s' is not allowed to access group '%s' for '%s'", claims.User, group, r.URL)
+				handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
+				return
+			}
+
+			log.WithContext(r.Context()).Infof("successfully authenticated bearer token for user '%s' for URL '%s'", claims.User, r.URL)
+
+			// bearer token users are always scoped to the groups in their token, so they can't reach the datasets of
+			// other groups through the path of their own group either
+			groups := append([]string{}, claims.Groups...)
+
+			r = r.WithContext(dataset.NewIdentityContext(r.Context(), &dataset.Identity{User: claims.User, Groups: groups, Roles: claims.Roles}))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		htoken := r.Header.Get("X-Auth-Token")
+
+		name := r.Header.Get("X-Auth-Client")
+		if name == "" {
 			if err := bcrypt.CompareHashAndPassword([]byte(htoken), psk); err != nil {
-				log.Warnf("Unable to authenticate session for '%s' with '%s'", r.URL, htoken)
-				w.WriteHeader(http.StatusForbidden)
+				log.WithContext(r.Context()).Warnf("Unable to authenticate session for '%s' with '%s'", r.URL, htoken)
+				handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
 				return
 			}
 
-			log.Infof("successfully authenticated token for URL '%s'", r.URL)
+			log.WithContext(r.Context()).Infof("successfully authenticated token for URL '%s'", r.URL)
+
+			r = r.WithContext(dataset.NewIdentityContext(r.Context(), &dataset.Identity{Roles: tokenRoles}))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		client, ok := clients[name]
+		if !ok || bcrypt.CompareHashAndPassword(client.secret, []byte(htoken)) != nil {
+			log.WithContext(r.Context()).Warnf("Unable to authenticate api client '%s' for '%s'", name, r.URL)
+			handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
+			return
+		}
+
+		account, group, resource, action, ok := requestScope(r.Method, uri.Path)
+		if !ok || !client.allowed(account, group, resource, action) {
+			log.WithContext(r.Context()).Warnf("api client '%s' is not allowed to %s %s for '%s'", name, action, resource, r.URL)
+			handleError(w, apierror.New(apierror.ErrForbidden, "forbidden", nil))
+			return
 		}
 
+		log.WithContext(r.Context()).Infof("successfully authenticated api client '%s' for URL '%s'", name, r.URL)
+
+		r = r.WithContext(dataset.NewIdentityContext(r.Context(), &dataset.Identity{Client: name, Groups: client.scopedGroups(), Roles: client.roles}))
 		h.ServeHTTP(w, r)
 	})
 }
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validRequestID matches the request ids accepted from callers, other ids are replaced so they can't inject into logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware accepts the X-Request-ID of a request or generates one.  The request id is returned in the
+// X-Request-ID response header and added to the request context, so it's included in logs, audit events, error
+// responses and AWS API calls.
+func RequestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		// the request header is also set for the access log
+		r.Header.Set(requestIDHeader, requestID)
+		w.Header().Set(requestIDHeader, requestID)
+
+		h.ServeHTTP(w, r.WithContext(dataset.NewRequestIDContext(r.Context(), requestID)))
+	})
+}
+
+// requestLogFormatter writes access log lines in the common log format, followed by the request id
+func requestLogFormatter(w io.Writer, params handlers.LogFormatterParams) {
+	host, _, err := net.SplitHostPort(params.Request.RemoteAddr)
+	if err != nil {
+		host = params.Request.RemoteAddr
+	}
+
+	uri := params.Request.RequestURI
+	if uri == "" {
+		uri = params.URL.RequestURI()
+	}
+
+	fmt.Fprintf(w, "%s - - [%s] \"%s %s %s\" %d %d %s\n",
+		host,
+		params.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		params.Request.Method,
+		uri,
+		params.Request.Proto,
+		params.StatusCode,
+		params.Size,
+		params.Request.Header.Get(requestIDHeader),
+	)
+}
@@ -1,11 +1,25 @@
 package api
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/YaleSpinup/ds-api/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -26,7 +40,7 @@ func TestTokenMiddleware(t *testing.T) {
 	}
 
 	// Start a new server with our token middleware and test handler
-	server := httptest.NewServer(TokenMiddleware(psk, pubUrls, okHandler))
+	server := httptest.NewServer(TokenMiddleware(psk, nil, nil, nil, pubUrls, okHandler))
 	defer server.Close()
 
 	// Test some public urls
@@ -82,7 +96,7 @@ func TestTokenMiddleware(t *testing.T) {
 
 	testHeaders := map[string]string{
 		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Headers": "X-Auth-Token",
+		"Access-Control-Allow-Headers": "Authorization, X-Auth-Token, X-Auth-Client, X-Request-ID",
 	}
 
 	for k, v := range testHeaders {
@@ -91,3 +105,252 @@ func TestTokenMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenMiddlewareClients(t *testing.T) {
+	psk := []byte("sometesttoken")
+	auditorSecret, _ := bcrypt.GenerateFromPassword([]byte("auditorsecret"), bcrypt.MinCost)
+	uploaderSecret, _ := bcrypt.GenerateFromPassword([]byte("uploadersecret"), bcrypt.MinCost)
+
+	clients, err := newAPIClients(map[string]common.Client{
+		"auditor": common.Client{
+			Secret:   string(auditorSecret),
+			Accounts: []string{"*"},
+			Groups:   []string{"*"},
+			Verbs:    []string{"*:read"},
+		},
+		"uploader": common.Client{
+			Secret:   string(uploaderSecret),
+			Accounts: []string{"acct1"},
+			Groups:   []string{"group1"},
+			Verbs:    []string{"attachments:*"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identity *dataset.Identity
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = dataset.IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(TokenMiddleware(psk, nil, clients, nil, map[string]string{}, okHandler))
+	defer server.Close()
+
+	type test struct {
+		client string
+		secret string
+		method string
+		path   string
+		status int
+	}
+
+	tests := []test{
+		{"auditor", "auditorsecret", http.MethodGet, "/v1/ds/acct1/datasets/group1/abc", http.StatusOK},
+		{"auditor", "auditorsecret", http.MethodGet, "/v1/ds/acct2/datasets/group2/abc/attachments", http.StatusOK},
+		{"auditor", "auditorsecret", http.MethodDelete, "/v1/ds/acct1/datasets/group1/abc", http.StatusForbidden},
+		{"auditor", "wrongsecret", http.MethodGet, "/v1/ds/acct1/datasets/group1/abc", http.StatusForbidden},
+		{"uploader", "uploadersecret", http.MethodPost, "/v1/ds/acct1/datasets/group1/abc/attachments", http.StatusOK},
+		{"uploader", "uploadersecret", http.MethodGet, "/v1/ds/acct1/datasets/group1/abc/attachments", http.StatusOK},
+		{"uploader", "uploadersecret", http.MethodGet, "/v1/ds/acct1/datasets/group1/abc", http.StatusForbidden},
+		{"uploader", "uploadersecret", http.MethodPost, "/v1/ds/acct2/datasets/group1/abc/attachments", http.StatusForbidden},
+		{"uploader", "uploadersecret", http.MethodPost, "/v1/ds/acct1/datasets/group2/abc/attachments", http.StatusForbidden},
+		{"uploader", "uploadersecret", http.MethodGet, "/v1/ds/something", http.StatusForbidden},
+		{"unknown", "uploadersecret", http.MethodGet, "/v1/ds/acct1/datasets/group1/abc/attachments", http.StatusForbidden},
+	}
+
+	client := &http.Client{}
+	for _, tst := range tests {
+		identity = nil
+
+		req, _ := http.NewRequest(tst.method, server.URL+tst.path, nil)
+		req.Header.Add("X-Auth-Client", tst.client)
+		req.Header.Add("X-Auth-Token", tst.secret)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tst.status {
+			t.Errorf("expected %d for %s %s as %s, got %d", tst.status, tst.method, tst.path, tst.client, resp.StatusCode)
+		}
+
+		if tst.status == http.StatusOK && (identity == nil || identity.Client != tst.client) {
+			t.Errorf("expected identity for client %s in request context, got %+v", tst.client, identity)
+		}
+	}
+
+	// test invalid verbs
+	if _, err := newAPIClients(map[string]common.Client{"bad": common.Client{Secret: "x", Verbs: []string{"buckets:read"}}}); err == nil {
+		t.Error("expected error for invalid verb, got nil")
+	}
+
+	if _, err := newAPIClients(map[string]common.Client{"bad": common.Client{Verbs: []string{"*"}}}); err == nil {
+		t.Error("expected error for missing secret, got nil")
+	}
+}
+
+// newTestIssuer returns a trusted issuer with a local JWKS file, and a function to sign tokens with its key
+func newTestIssuer(t *testing.T) (common.Issuer, func(claims map[string]interface{}) string) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "test", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+		},
+	})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := common.Issuer{Issuer: "https://idp.example.edu", Audience: "ds-api", JWKSFile: jwksFile}
+
+	return issuer, func(claims map[string]interface{}) string {
+		if _, ok := claims["aud"]; !ok {
+			claims["aud"] = "ds-api"
+		}
+
+		h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+		c, _ := json.Marshal(claims)
+		input := b64(h) + "." + b64(c)
+		digest := sha256.Sum256([]byte(input))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return input + "." + b64(sig)
+	}
+}
+
+func TestTokenMiddlewareBearer(t *testing.T) {
+	issuer, sign := newTestIssuer(t)
+
+	validator, err := jwt.NewValidator([]common.Issuer{issuer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(map[string]interface{}{
+		"iss":    "https://idp.example.edu",
+		"sub":    "awong",
+		"groups": []string{"group1"},
+		"exp":    time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	var user string
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = requestUser(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(TokenMiddleware([]byte("sometesttoken"), nil, nil, validator, map[string]string{}, okHandler))
+	defer server.Close()
+
+	type test struct {
+		token  string
+		path   string
+		status int
+	}
+
+	tests := []test{
+		{token, "/v1/ds/acct1/datasets/group1/abc", http.StatusOK},
+		{token, "/v1/ds/acct1/datasets/group2/abc", http.StatusForbidden},
+		{token + "x", "/v1/ds/acct1/datasets/group1/abc", http.StatusForbidden},
+		{"garbage", "/v1/ds/acct1/datasets/group1/abc", http.StatusForbidden},
+	}
+
+	client := &http.Client{}
+	for _, tst := range tests {
+		user = ""
+
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+tst.path, nil)
+		req.Header.Add("Authorization", "Bearer "+tst.token)
+		req.Header.Add("X-Forwarded-User", "someoneelse")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tst.status {
+			t.Errorf("expected %d for %s, got %d", tst.status, tst.path, resp.StatusCode)
+		}
+
+		// the validated subject replaces the X-Forwarded-User header
+		if tst.status == http.StatusOK && user != "awong" {
+			t.Errorf("expected acting user awong, got '%s'", user)
+		}
+	}
+
+	// test bearer tokens are rejected when no issuers are configured
+	noBearer := httptest.NewServer(TokenMiddleware([]byte("sometesttoken"), nil, nil, nil, map[string]string{}, okHandler))
+	defer noBearer.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, noBearer.URL+"/v1/ds/acct1/datasets/group1/abc", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected %d without configured issuers, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestRequestScope(t *testing.T) {
+	type test struct {
+		method   string
+		path     string
+		resource string
+		action   string
+	}
+
+	tests := []test{
+		{http.MethodGet, "/v1/ds/acct1/datasets/group1/abc", "datasets", "read"},
+		{http.MethodPost, "/v1/ds/acct1/datasets/group1/abc/approvals", "datasets", "write"},
+		{http.MethodPost, "/v1/ds/acct1/datasets/group1/abc/instances", "instances", "write"},
+		{http.MethodGet, "/v1/ds/acct1/datasets/group1/abc/access", "instances", "read"},
+		{http.MethodDelete, "/v1/ds/acct1/datasets/group1/abc/access/arn:aws:iam::012345678901:role/apps/ecsTask", "instances", "write"},
+		{http.MethodPatch, "/v1/ds/acct1/datasets/group1/abc/shares/0d1c5b6e", "shares", "write"},
+		{http.MethodGet, "/v1/ds/acct1/webhooks/group1", "webhooks", "read"},
+		{http.MethodPost, "/v1/ds/acct1/webhooks/group1/w1/deadletters/d1", "webhooks", "write"},
+	}
+
+	for _, tst := range tests {
+		account, group, resource, action, ok := requestScope(tst.method, tst.path)
+		if !ok || account != "acct1" || group != "group1" || resource != tst.resource || action != tst.action {
+			t.Errorf("expected acct1 group1 %s %s for %s %s, got %s %s %s %s (%t)", tst.resource, tst.action, tst.method, tst.path, account, group, resource, action, ok)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var got string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = dataset.RequestIDFromContext(r.Context())
+	}))
+
+	tests := map[string]bool{
+		"abc-123":                     true,
+		"":                            false,
+		"bad id\nwith a newline":      false,
+		strings.Repeat("a", 129):      false,
+		"Root=1-5759e988-bd862e3fe1b": false,
+	}
+
+	for requestID, accepted := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/ds/ping", nil)
+		req.Header.Set(requestIDHeader, requestID)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if got == "" || rr.Header().Get(requestIDHeader) != got {
+			t.Errorf("expected request id %s in the context and response header, got %s", rr.Header().Get(requestIDHeader), got)
+		}
+
+		if accepted != (got == requestID) {
+			t.Errorf("expected request id %q to be accepted: %t, got %s", requestID, accepted, got)
+		}
+	}
+}
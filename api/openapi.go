@@ -0,0 +1,546 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// openAPIDocument is the OpenAPI 3 document describing every route of the api
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPIPrefix is the path prefix of the api, paths in the document are relative to it
+const openAPIPrefix = "/v1/ds"
+
+// openAPIMethods are the keys of a path item that are operations
+var openAPIMethods = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+	"trace":   http.MethodTrace,
+}
+
+// routeVariable matches gorilla mux route variables with a pattern, ie. {principal:.+}
+var routeVariable = regexp.MustCompile(`\{([^}:]+):[^}]+\}`)
+
+// openAPISpec is the subset of an OpenAPI 3 document used to validate requests.  Only the few JSON Schema keywords
+// the document uses are supported (types, required, enum, formats, patterns and bounds), which keeps the validation
+// to a small amount of code instead of another dependency, and lets problems be reported in the details of the
+// usual api error body.
+type openAPISpec struct {
+	// operations are keyed by method and path template, ie. "GET /{account}/datasets/{group}"
+	operations map[string]*openAPIOperation
+	schemas    map[string]*openAPISchema
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+// openAPISchema is the subset of the OpenAPI schema object supported by the request validation
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Nullable             bool                      `json:"nullable"`
+	Enum                 []interface{}             `json:"enum"`
+	Pattern              string                    `json:"pattern"`
+	MinLength            *int                      `json:"minLength"`
+	MaxLength            *int                      `json:"maxLength"`
+	Minimum              *float64                  `json:"minimum"`
+	Maximum              *float64                  `json:"maximum"`
+	Items                *openAPISchema            `json:"items"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Required             []string                  `json:"required"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+	AllOf                []*openAPISchema          `json:"allOf"`
+
+	compiled   bool
+	pattern    *regexp.Regexp
+	additional *openAPISchema
+	closed     bool
+}
+
+// newOpenAPISpec parses the OpenAPI document and compiles the schemas used for request validation
+func newOpenAPISpec(document []byte) (*openAPISpec, error) {
+	doc := struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]*openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}{}
+
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %s", err)
+	}
+
+	spec := &openAPISpec{
+		operations: make(map[string]*openAPIOperation),
+		schemas:    doc.Components.Schemas,
+	}
+
+	for path, item := range doc.Paths {
+		for key, raw := range item {
+			method, ok := openAPIMethods[key]
+			if !ok {
+				continue
+			}
+
+			op := &openAPIOperation{}
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, fmt.Errorf("failed to parse openapi operation %s %s: %s", method, path, err)
+			}
+			spec.operations[method+" "+path] = op
+		}
+	}
+
+	var schemas []*openAPISchema
+	for _, s := range spec.schemas {
+		schemas = append(schemas, s)
+	}
+	for _, op := range spec.operations {
+		for _, p := range op.Parameters {
+			schemas = append(schemas, p.Schema)
+		}
+		if op.RequestBody != nil {
+			for _, c := range op.RequestBody.Content {
+				schemas = append(schemas, c.Schema)
+			}
+		}
+	}
+
+	for _, s := range schemas {
+		if err := spec.compile(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return spec, nil
+}
+
+// compile resolves the references and patterns of a schema and its subschemas
+func (o *openAPISpec) compile(s *openAPISchema) error {
+	if s == nil || s.compiled {
+		return nil
+	}
+	s.compiled = true
+
+	if s.Ref != "" {
+		if _, err := o.resolve(s); err != nil {
+			return err
+		}
+	}
+
+	if s.Pattern != "" && s.pattern == nil {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s' in openapi document: %s", s.Pattern, err)
+		}
+		s.pattern = p
+	}
+
+	// additional properties are allowed unless they're set to false
+	switch raw := string(bytes.TrimSpace(s.AdditionalProperties)); raw {
+	case "", "true":
+	case "false":
+		s.closed = true
+	default:
+		s.additional = &openAPISchema{}
+		if err := json.Unmarshal([]byte(raw), s.additional); err != nil {
+			return fmt.Errorf("invalid additionalProperties in openapi document: %s", err)
+		}
+	}
+
+	subschemas := append([]*openAPISchema{s.Items, s.additional}, s.AllOf...)
+	for _, p := range s.Properties {
+		subschemas = append(subschemas, p)
+	}
+
+	for _, sub := range subschemas {
+		if err := o.compile(sub); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the schema a reference points to
+func (o *openAPISpec) resolve(s *openAPISchema) (*openAPISchema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+
+	name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	ref, ok := o.schemas[name]
+	if !ok || name == s.Ref {
+		return nil, fmt.Errorf("unknown schema reference '%s' in openapi document", s.Ref)
+	}
+
+	return ref, nil
+}
+
+// operation returns the operation for the method and mux path template of a request
+func (o *openAPISpec) operation(method, template string) (*openAPIOperation, bool) {
+	path := routeVariable.ReplaceAllString(strings.TrimPrefix(template, openAPIPrefix), "{$1}")
+	op, ok := o.operations[method+" "+path]
+	return op, ok
+}
+
+// validate validates a decoded json value against a schema and returns a list of problems, prefixed with the path
+// of the offending value
+func (o *openAPISpec) validate(path string, value interface{}, s *openAPISchema) []string {
+	s, err := o.resolve(s)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s", path, err)}
+	}
+
+	if value == nil {
+		if s.Nullable || (s.Type == "" && len(s.AllOf) == 0 && s.Enum == nil) {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: must not be null", path)}
+	}
+
+	var problems []string
+	for _, sub := range s.AllOf {
+		problems = append(problems, o.validate(path, value, sub)...)
+	}
+
+	if s.Enum != nil && !enumContains(s.Enum, value) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprintf("'%v'", e)
+		}
+		problems = append(problems, fmt.Sprintf("%s: must be one of %s", path, strings.Join(allowed, ", ")))
+	}
+
+	switch s.Type {
+	case "":
+	case "string":
+		v, ok := value.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be a string", path))
+		}
+
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %d characters", path, *s.MinLength))
+		}
+
+		if s.MaxLength != nil && length > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %d characters", path, *s.MaxLength))
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%s: must match the pattern %s", path, s.Pattern))
+		}
+
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: must be an RFC 3339 date-time", path))
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be a number", path))
+		}
+
+		f, err := n.Float64()
+		if err != nil {
+			return append(problems, fmt.Sprintf("%s: must be a number", path))
+		}
+
+		if _, err := n.Int64(); s.Type == "integer" && err != nil {
+			return append(problems, fmt.Sprintf("%s: must be an integer", path))
+		}
+		problems = append(problems, s.validateRange(path, f)...)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: must be a boolean", path))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be an array", path))
+		}
+
+		if s.Items != nil {
+			for i, item := range items {
+				problems = append(problems, o.validate(fmt.Sprintf("%s[%d]", path, i), item, s.Items)...)
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: must be an object", path))
+		}
+
+		for _, r := range s.Required {
+			if _, ok := object[r]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: is required", path, r))
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				problems = append(problems, o.validate(path+"."+k, object[k], p)...)
+			} else if s.closed {
+				problems = append(problems, fmt.Sprintf("%s.%s: is not allowed", path, k))
+			} else if s.additional != nil {
+				problems = append(problems, o.validate(path+"."+k, object[k], s.additional)...)
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unsupported schema type '%s'", path, s.Type))
+	}
+
+	return problems
+}
+
+// validateRange validates a number against the minimum and maximum of a schema
+func (s *openAPISchema) validateRange(path string, f float64) []string {
+	var problems []string
+	if s.Minimum != nil && f < *s.Minimum {
+		problems = append(problems, fmt.Sprintf("%s: must be at least %v", path, *s.Minimum))
+	}
+
+	if s.Maximum != nil && f > *s.Maximum {
+		problems = append(problems, fmt.Sprintf("%s: must be at most %v", path, *s.Maximum))
+	}
+
+	return problems
+}
+
+// validateParameter validates the string value of a path or query parameter
+func (o *openAPISpec) validateParameter(path, value string, s *openAPISchema) []string {
+	s, err := o.resolve(s)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s", path, err)}
+	}
+
+	switch s.Type {
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return []string{fmt.Sprintf("%s: must be a boolean", path)}
+		}
+		return nil
+	case "integer", "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: must be a number", path)}
+		}
+
+		if s.Type == "integer" && f != float64(int64(f)) {
+			return []string{fmt.Sprintf("%s: must be an integer", path)}
+		}
+		return s.validateRange(path, f)
+	}
+
+	return o.validate(path, value, s)
+}
+
+// defaultMaxBodyBytes is the maximum size of a json request body, most bodies are only a few fields
+const defaultMaxBodyBytes = 64 << 10
+
+// maxBodyBytes are the maximum sizes of json request bodies that can be larger than the default, by operation id
+var maxBodyBytes = map[string]int64{
+	"createDataset":    1 << 20,
+	"updateDataset":    1 << 20,
+	"createDerivative": 1 << 20,
+}
+
+// validateRequest validates the parameters and json body of a request against the operation and returns a list of
+// problems.  The json body is limited to the maximum size of the operation, and restored so it can be read again
+// by the handler.
+func (o *openAPISpec) validateRequest(w http.ResponseWriter, r *http.Request, op *openAPIOperation) ([]string, error) {
+	var problems []string
+
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = vars[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		default:
+			continue
+		}
+
+		path := p.In + "." + p.Name
+		if !present || value == "" {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("%s: is required", path))
+			}
+			continue
+		}
+
+		if p.Schema != nil {
+			problems = append(problems, o.validateParameter(path, value, p.Schema)...)
+		}
+	}
+
+	if op.RequestBody == nil {
+		return problems, nil
+	}
+
+	// only json bodies are read and validated, multipart attachment uploads are streamed and limited by the handler
+	content, ok := op.RequestBody.Content["application/json"]
+	if !ok || content.Schema == nil {
+		return problems, nil
+	}
+
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	limit, ok := maxBodyBytes[op.OperationID]
+	if !ok {
+		limit = defaultMaxBodyBytes
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			msg := fmt.Sprintf("request body is larger than %d bytes", limit)
+			return nil, apierror.New(apierror.ErrBadRequest, msg, err)
+		}
+		return nil, apierror.New(apierror.ErrBadRequest, "failed to read request body", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			problems = append(problems, "body: is required")
+		}
+		return problems, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return append(problems, fmt.Sprintf("body: is not valid json: %s", err)), nil
+	}
+
+	return append(problems, o.validate("body", value, content.Schema)...), nil
+}
+
+// enumContains returns true if the value is one of the enum values
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if n, ok := value.(json.Number); ok {
+			if f, ok := e.(float64); ok && n.String() == strconv.FormatFloat(f, 'f', -1, 64) {
+				return true
+			}
+			continue
+		}
+
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAPIHandler responds with the OpenAPI document of the api
+func (s *server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
+
+// OpenAPIMiddleware validates requests against the OpenAPI document before they're handled.  Requests that don't
+// match the document are rejected with a bad request error listing the problems.
+func (s *server) OpenAPIMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || s.openapi == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		op, ok := s.openapi.operation(r.Method, template)
+		if !ok {
+			log.WithContext(r.Context()).Warnf("no openapi operation for %s %s", r.Method, template)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		problems, err := s.openapi.validateRequest(w, r, op)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		if len(problems) > 0 {
+			log.WithContext(r.Context()).Infof("request %s %s does not match the openapi document: %s", r.Method, r.URL.Path, strings.Join(problems, "; "))
+			details, err := json.Marshal(problems)
+			if err != nil {
+				handleError(w, err)
+				return
+			}
+
+			handleError(w, apierror.NewWithDetails(apierror.ErrBadRequest, "request does not match the api specification", details, nil))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
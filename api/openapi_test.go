@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec, err := newOpenAPISpec(openAPIDocument)
+	if err != nil {
+		t.Fatalf("expected nil error parsing the openapi document, got %s", err)
+	}
+
+	s := server{router: mux.NewRouter(), openapi: spec}
+	s.routes()
+
+	routes := 0
+	err = s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			// the subrouter doesn't have methods
+			return nil
+		}
+
+		for _, m := range methods {
+			routes++
+			if _, ok := spec.operation(m, template); !ok {
+				t.Errorf("expected openapi operation for route %s %s", m, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil error walking routes, got %s", err)
+	}
+
+	if routes != len(spec.operations) {
+		t.Errorf("expected %d routes for the openapi operations, got %d", len(spec.operations), routes)
+	}
+
+	for _, op := range spec.operations {
+		if op.OperationID == "" {
+			t.Errorf("expected operation id for all openapi operations")
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/ds/openapi.json", nil)
+	rr := httptest.NewRecorder()
+
+	s := server{}
+	http.HandlerFunc(s.OpenAPIHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	doc := struct {
+		OpenAPI string `json:"openapi"`
+	}{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("expected json openapi document, got %s", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected openapi version 3, got %s", doc.OpenAPI)
+	}
+}
+
+func TestOpenAPIMiddleware(t *testing.T) {
+	spec, err := newOpenAPISpec(openAPIDocument)
+	if err != nil {
+		t.Fatalf("expected nil error parsing the openapi document, got %s", err)
+	}
+	s := server{openapi: spec}
+
+	var body string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/v1/ds").Subrouter()
+	api.HandleFunc("/{account}/datasets/{group}", handler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/access", handler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/access/{principal:.+}", handler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/shares/{share_id}", handler).Methods(http.MethodPatch)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/verify", handler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/lineage", handler).Methods(http.MethodGet)
+	api.Use(s.OpenAPIMiddleware)
+
+	type test struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		problems []string
+	}
+
+	tests := []test{
+		{
+			method: http.MethodPost,
+			path:   "/v1/ds/spintst/datasets/123",
+			body:   `{"name":"foo","type":"s3","derivative":true,"tags":[{"key":"foo","value":"bar"}],"metadata":{"description":"bar"},"unknown":1}`,
+			status: http.StatusOK,
+		},
+		{
+			method: http.MethodPost,
+			path:   "/v1/ds/spintst/datasets/123",
+			body:   `{"name":"foo","type":"s3","metadata":null}`,
+			status: http.StatusOK,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/ds/spintst/datasets/123",
+			body:     `{"name":1,"derivative":"yes","tags":[{"key":true}],"metadata":{"data_classifications":"phi"}}`,
+			status:   http.StatusBadRequest,
+			problems: []string{"body.type: is required", "body.derivative: must be a boolean", "body.metadata.data_classifications: must be an array", "body.name: must be a string", "body.tags[0].key: must be a string"},
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/ds/spintst/datasets/123",
+			status:   http.StatusBadRequest,
+			problems: []string{"body: is required"},
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/ds/spintst/datasets/123",
+			body:     `{"name":`,
+			status:   http.StatusBadRequest,
+			problems: []string{"body: is not valid json: unexpected EOF"},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/v1/ds/spintst/datasets/dsgroup/123/access",
+			body:   `{"role_arn":"arn:aws:iam::012345678901:role/foo","permission":"read","duration":"24h"}`,
+			status: http.StatusOK,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/ds/spintst/datasets/dsgroup/123/access",
+			body:     `{"instance_id":"i-0123456789abcdef0","permission":"admin"}`,
+			status:   http.StatusBadRequest,
+			problems: []string{"body.permission: must be one of '', 'read', 'write'"},
+		},
+		{
+			method: http.MethodDelete,
+			path:   "/v1/ds/spintst/datasets/dsgroup/123/access/arn:aws:iam::012345678901:role/apps/foo",
+			status: http.StatusOK,
+		},
+		{
+			method:   http.MethodPatch,
+			path:     "/v1/ds/spintst/datasets/dsgroup/123/shares/abc",
+			body:     `{"expires_at":"tomorrow"}`,
+			status:   http.StatusBadRequest,
+			problems: []string{"body.expires_at: must be an RFC 3339 date-time"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/v1/ds/spintst/datasets/dsgroup/123/verify?checksums=true",
+			status: http.StatusOK,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/v1/ds/spintst/datasets/dsgroup/123/verify?checksums=maybe",
+			status:   http.StatusBadRequest,
+			problems: []string{"query.checksums: must be a boolean"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/v1/ds/spintst/datasets/dsgroup/123/lineage?depth=5",
+			status: http.StatusOK,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/v1/ds/spintst/datasets/dsgroup/123/lineage?depth=100",
+			status:   http.StatusBadRequest,
+			problems: []string{"query.depth: must be at most 50"},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/v1/ds/spintst/datasets/dsgroup/123/access",
+			body:   `{"instance_id":"` + strings.Repeat("i", defaultMaxBodyBytes) + `"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/v1/ds/spintst/datasets/dsgroup/123/lineage?depth=1.5",
+			status:   http.StatusBadRequest,
+			problems: []string{"query.depth: must be an integer"},
+		},
+	}
+
+	for _, tst := range tests {
+		body = ""
+		req := httptest.NewRequest(tst.method, tst.path, strings.NewReader(tst.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tst.status {
+			t.Errorf("expected status %d for %s %s, got %d (%s)", tst.status, tst.method, tst.path, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if tst.status == http.StatusOK {
+			if body != tst.body {
+				t.Errorf("expected handler to read body %s, got %s", tst.body, body)
+			}
+			continue
+		}
+
+		out := errorResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("expected json error response, got %s", err)
+		}
+
+		if out.Code != "BadRequest" {
+			t.Errorf("expected BadRequest error code, got %s", out.Code)
+		}
+
+		problems := []string{}
+		if out.Details != nil {
+			if err := json.Unmarshal(*out.Details, &problems); err != nil {
+				t.Fatalf("expected list of problems in details, got %s", *out.Details)
+			}
+		}
+
+		if strings.Join(problems, "\n") != strings.Join(tst.problems, "\n") {
+			t.Errorf("expected problems %v for %s %s, got %v", tst.problems, tst.method, tst.path, problems)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	log "github.com/sirupsen/logrus"
+)
+
+// actions that can be allowed to roles
+const (
+	actionDatasetCreate    = "dataset:create"
+	actionDatasetRead      = "dataset:read"
+	actionDatasetUpdate    = "dataset:update"
+	actionDatasetPromote   = "dataset:promote"
+	actionDatasetDelete    = "dataset:delete"
+	actionDatasetLock      = "dataset:lock"
+	actionDatasetPurge     = "dataset:purge"
+	actionDerivativeCreate = "derivative:create"
+	actionAttachmentCreate = "attachment:create"
+	actionAttachmentRead   = "attachment:read"
+	actionAttachmentDelete = "attachment:delete"
+	actionInstanceRead     = "instance:read"
+	actionInstanceGrant    = "instance:grant"
+	actionInstanceRevoke   = "instance:revoke"
+	actionLogRead          = "log:read"
+	actionUserRead         = "user:read"
+	actionUserCreate       = "user:create"
+	actionUserUpdate       = "user:update"
+	actionUserDelete       = "user:delete"
+	actionApprovalRequest  = "approval:request"
+	actionShareRead        = "share:read"
+	actionShareCreate      = "share:create"
+	actionShareRevoke      = "share:revoke"
+	actionWebhookRead      = "webhook:read"
+	actionWebhookCreate    = "webhook:create"
+	actionWebhookDelete    = "webhook:delete"
+)
+
+// roles with special meaning
+const (
+	roleAdmin       = "admin"
+	roleDataSteward = "data-steward"
+	roleContributor = "contributor"
+)
+
+// knownActions are all of the actions, used to validate configured roles
+var knownActions = map[string]bool{
+	actionDatasetCreate:    true,
+	actionDatasetRead:      true,
+	actionDatasetUpdate:    true,
+	actionDatasetPromote:   true,
+	actionDatasetDelete:    true,
+	actionDatasetLock:      true,
+	actionDatasetPurge:     true,
+	actionDerivativeCreate: true,
+	actionAttachmentCreate: true,
+	actionAttachmentRead:   true,
+	actionAttachmentDelete: true,
+	actionInstanceRead:     true,
+	actionInstanceGrant:    true,
+	actionInstanceRevoke:   true,
+	actionLogRead:          true,
+	actionUserRead:         true,
+	actionUserCreate:       true,
+	actionUserUpdate:       true,
+	actionUserDelete:       true,
+	actionApprovalRequest:  true,
+	actionShareRead:        true,
+	actionShareCreate:      true,
+	actionShareRevoke:      true,
+	actionWebhookRead:      true,
+	actionWebhookCreate:    true,
+	actionWebhookDelete:    true,
+}
+
+var viewerActions = []string{
+	actionDatasetRead,
+	actionAttachmentRead,
+	actionInstanceRead,
+	actionLogRead,
+	actionUserRead,
+	actionShareRead,
+}
+
+var contributorActions = append([]string{
+	actionDatasetCreate,
+	actionDatasetUpdate,
+	actionDerivativeCreate,
+	actionAttachmentCreate,
+	actionAttachmentDelete,
+	actionUserCreate,
+	actionUserUpdate,
+	actionApprovalRequest,
+}, viewerActions...)
+
+var dataStewardActions = append([]string{
+	actionDatasetPromote,
+	actionDatasetDelete,
+	actionDatasetLock,
+	actionInstanceGrant,
+	actionInstanceRevoke,
+	actionUserDelete,
+	actionShareCreate,
+	actionShareRevoke,
+	actionWebhookRead,
+	actionWebhookCreate,
+	actionWebhookDelete,
+}, contributorActions...)
+
+// defaultRoles are the built-in roles, they can be overridden or extended in the configuration
+var defaultRoles = map[string][]string{
+	"viewer":        viewerActions,
+	roleContributor: contributorActions,
+	roleDataSteward: dataStewardActions,
+	roleAdmin:       {"*"},
+}
+
+// defaultTokenRoles are the roles of callers using the shared legacy token, if none are configured.  Everyone with
+// the token shares them, so by default they can't finalize or delete datasets, or decide approval requests.
+var defaultTokenRoles = []string{roleContributor}
+
+// policy maps roles to the actions they are allowed to perform
+type policy struct {
+	roles map[string]map[string]bool
+}
+
+// newPolicy creates the authorization policy from the default roles and the configured roles.  Configured
+// roles replace default roles with the same name.
+func newPolicy(config map[string][]string) (*policy, error) {
+	p := &policy{roles: make(map[string]map[string]bool)}
+
+	for role, actions := range defaultRoles {
+		p.roles[role] = actionSet(actions)
+	}
+
+	for role, actions := range config {
+		for _, a := range actions {
+			if a != "*" && !knownActions[a] {
+				return nil, fmt.Errorf("invalid action '%s' for role %s", a, role)
+			}
+		}
+		p.roles[role] = actionSet(actions)
+	}
+
+	return p, nil
+}
+
+func actionSet(actions []string) map[string]bool {
+	set := make(map[string]bool, len(actions))
+	for _, a := range actions {
+		set[a] = true
+	}
+	return set
+}
+
+// allowed returns true if any of the roles is allowed to perform the action
+func (p *policy) allowed(roles []string, action string) bool {
+	for _, role := range roles {
+		if actions, ok := p.roles[role]; ok && (actions["*"] || actions[action]) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize returns a forbidden error if the caller of the request isn't allowed to perform the action
+func (s *server) authorize(r *http.Request, action string) error {
+	identity, ok := dataset.IdentityFromContext(r.Context())
+	if !ok {
+		return apierror.New(apierror.ErrForbidden, "unable to determine caller identity", nil)
+	}
+
+	p := s.policy
+	if p == nil {
+		var err error
+		if p, err = newPolicy(nil); err != nil {
+			return apierror.New(apierror.ErrInternalError, "failed to create authorization policy", err)
+		}
+	}
+
+	if !p.allowed(identity.Roles, action) {
+		log.WithContext(r.Context()).Warnf("caller%s with roles %v is not allowed to %s", identity.AuditAnnotation(), identity.Roles, action)
+		return apierror.New(apierror.ErrForbidden, "not allowed to "+action, nil)
+	}
+
+	return nil
+}
+
+// authorizeScope returns a forbidden error if the caller is an API client without the verb scope for the resource
+// and action.  The middleware only checks the scope of the request path, handlers that run actions on other
+// resources use this to check the scope of those actions.
+func (s *server) authorizeScope(r *http.Request, account, group, resource, action string) error {
+	identity, ok := dataset.IdentityFromContext(r.Context())
+	if !ok {
+		return apierror.New(apierror.ErrForbidden, "unable to determine caller identity", nil)
+	}
+
+	if identity.Client == "" {
+		return nil
+	}
+
+	client, ok := s.clients[identity.Client]
+	if !ok || !client.allowed(account, group, resource, action) {
+		log.WithContext(r.Context()).Warnf("api client '%s' is not allowed to %s %s", identity.Client, action, resource)
+		return apierror.New(apierror.ErrForbidden, fmt.Sprintf("not allowed to %s %s", action, resource), nil)
+	}
+
+	return nil
+}
+
+// authorizeFinalize makes sure the caller has one of the finalize roles of the classification policies of a dataset
+func (s *server) authorizeFinalize(r *http.Request, metadata *dataset.Metadata) error {
+	identity, ok := dataset.IdentityFromContext(r.Context())
+	if !ok {
+		return apierror.New(apierror.ErrForbidden, "unable to determine caller identity", nil)
+	}
+
+	return s.classifications.checkFinalize(metadata, identity.Roles)
+}
+
+// getDataset returns the metadata of a dataset in a group.  The group in the request path is only checked against
+// the scope of the caller, so datasets of other groups aren't found, and a caller scoped to one group can't reach
+// them through the path of its own group.
+func getDataset(ctx context.Context, service *dataset.Service, account, group, id string) (*dataset.Metadata, error) {
+	metadata, err := service.MetadataRepository.Get(ctx, account, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inGroup(ctx, metadata, group) {
+		log.WithContext(ctx).Warnf("dataset %s in account %s doesn't belong to group %s", id, account, group)
+		msg := fmt.Sprintf("dataset not found: %s", id)
+		return nil, apierror.New(apierror.ErrNotFound, msg, nil)
+	}
+
+	return metadata, nil
+}
+
+// inGroup returns true if a dataset belongs to the group.  Datasets created before their group was recorded in the
+// metadata can only be reached by callers that aren't scoped to groups, ie. the shared legacy token.
+func inGroup(ctx context.Context, metadata *dataset.Metadata, group string) bool {
+	if metadata.Group != "" {
+		return metadata.Group == group
+	}
+
+	identity, ok := dataset.IdentityFromContext(ctx)
+	return ok && identity.Groups == nil
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	p, err := newPolicy(map[string][]string{
+		"uploader": {actionAttachmentCreate, actionAttachmentRead},
+		"viewer":   {actionDatasetRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		roles   []string
+		action  string
+		allowed bool
+	}
+
+	tests := []test{
+		{[]string{"admin"}, actionDatasetDelete, true},
+		{[]string{"data-steward"}, actionDatasetPromote, true},
+		{[]string{"data-steward"}, actionInstanceGrant, true},
+		{[]string{"contributor"}, actionDatasetCreate, true},
+		{[]string{"contributor"}, actionUserCreate, true},
+		{[]string{"contributor"}, actionDatasetPromote, false},
+		{[]string{"contributor"}, actionInstanceGrant, false},
+		{[]string{"contributor"}, actionApprovalRequest, true},
+		{[]string{"viewer"}, actionApprovalRequest, false},
+		{[]string{"viewer"}, actionDatasetRead, true},
+		{[]string{"viewer"}, actionLogRead, false},
+		{[]string{"uploader"}, actionAttachmentCreate, true},
+		{[]string{"uploader"}, actionDatasetRead, false},
+		{[]string{"viewer", "uploader"}, actionAttachmentCreate, true},
+		{[]string{"unknown"}, actionDatasetRead, false},
+		{nil, actionDatasetRead, false},
+	}
+
+	for _, tst := range tests {
+		if allowed := p.allowed(tst.roles, tst.action); allowed != tst.allowed {
+			t.Errorf("expected allowed %t for roles %v and action %s, got %t", tst.allowed, tst.roles, tst.action, allowed)
+		}
+	}
+
+	if _, err := newPolicy(map[string][]string{"bad": {"dataset:explode"}}); err == nil {
+		t.Error("expected error for invalid action, got nil")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	p, err := newPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classifications, err := newClassificationPolicies(map[string]common.Classification{
+		"hipaa":    {FinalizeRoles: []string{"data-steward"}},
+		"pii":      {},
+		"research": {FinalizeRoles: []string{"data-steward", "admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server{policy: p, classifications: classifications}
+
+	request := func(identity *dataset.Identity) *http.Request {
+		r, _ := http.NewRequest(http.MethodPatch, "/v1/ds/acct/datasets/group/abc", nil)
+		if identity != nil {
+			r = r.WithContext(dataset.NewIdentityContext(context.Background(), identity))
+		}
+		return r
+	}
+
+	isForbidden := func(err error) bool {
+		aerr, ok := errors.Cause(err).(apierror.Error)
+		return ok && aerr.Code == apierror.ErrForbidden
+	}
+
+	if err := s.authorize(request(nil), actionDatasetRead); !isForbidden(err) {
+		t.Errorf("expected forbidden error without identity, got %v", err)
+	}
+
+	if err := s.authorize(request(&dataset.Identity{Roles: []string{"viewer"}}), actionDatasetPromote); !isForbidden(err) {
+		t.Errorf("expected forbidden error for viewer, got %v", err)
+	}
+
+	if err := s.authorize(request(&dataset.Identity{Roles: []string{"admin"}}), actionDatasetPromote); err != nil {
+		t.Errorf("expected nil error for admin, got %s", err)
+	}
+
+	// the finalize roles of the classifications don't include admin unless it's configured
+	finalizeTests := []struct {
+		classifications []string
+		roles           []string
+		forbidden       bool
+	}{
+		{[]string{"HIPAA", "pii"}, []string{"admin"}, true},
+		{[]string{"HIPAA", "pii"}, []string{"data-steward"}, false},
+		{[]string{"pii"}, []string{"admin"}, true},
+		{[]string{"pii"}, []string{"data-steward"}, false},
+		{[]string{"research"}, []string{"admin"}, false},
+		{[]string{"research"}, []string{"contributor"}, true},
+		{[]string{"hipaa", "research"}, []string{"admin"}, true},
+		{nil, []string{"viewer"}, false},
+	}
+
+	for _, tst := range finalizeTests {
+		metadata := &dataset.Metadata{DataClassifications: tst.classifications}
+		err := s.authorizeFinalize(request(&dataset.Identity{Roles: tst.roles}), metadata)
+		if tst.forbidden && !isForbidden(err) {
+			t.Errorf("expected forbidden error finalizing %v dataset as %v, got %v", tst.classifications, tst.roles, err)
+		} else if !tst.forbidden && err != nil {
+			t.Errorf("expected nil error finalizing %v dataset as %v, got %s", tst.classifications, tst.roles, err)
+		}
+	}
+
+	if err := s.authorizeFinalize(request(nil), &dataset.Metadata{}); !isForbidden(err) {
+		t.Errorf("expected forbidden error finalizing without identity, got %v", err)
+	}
+}
+
+type mockMetadataRepository struct {
+	dataset.MetadataRepository
+	metadata map[string]*dataset.Metadata
+}
+
+func (m *mockMetadataRepository) Get(ctx context.Context, account, id string) (*dataset.Metadata, error) {
+	metadata, ok := m.metadata[id]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	out := *metadata
+	return &out, nil
+}
+
+func (m *mockMetadataRepository) List(ctx context.Context, account string) ([]*dataset.Metadata, error) {
+	out := []*dataset.Metadata{}
+	for _, metadata := range m.metadata {
+		out = append(out, metadata)
+	}
+	return out, nil
+}
+
+func (m *mockMetadataRepository) Update(ctx context.Context, account, id string, metadata *dataset.Metadata) (*dataset.Metadata, error) {
+	if _, ok := m.metadata[id]; !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	out := *metadata
+	m.metadata[id] = &out
+	return metadata, nil
+}
+
+func (m *mockMetadataRepository) Promote(ctx context.Context, account, id, user string) (*dataset.Metadata, error) {
+	metadata, ok := m.metadata[id]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	now := time.Now().UTC()
+	metadata.FinalizedAt = &now
+	metadata.FinalizedBy = user
+	metadata.Derivative = false
+
+	out := *metadata
+	return &out, nil
+}
+
+func (m *mockMetadataRepository) Delete(ctx context.Context, account, id string) error {
+	if _, ok := m.metadata[id]; !ok {
+		return apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	delete(m.metadata, id)
+	return nil
+}
+
+type mockAuditLogRepository struct {
+	dataset.AuditLogRepository
+	messages chan string
+}
+
+func (m *mockAuditLogRepository) Log(ctx context.Context, group, stream string) chan string {
+	return m.messages
+}
+
+func (m *mockAuditLogRepository) GetLog(ctx context.Context, group, stream string) ([]string, error) {
+	return []string{"Created dataset " + stream}, nil
+}
+
+func TestGroupScope(t *testing.T) {
+	psk := "sometesttoken"
+	secret, _ := bcrypt.GenerateFromPassword([]byte("group1secret"), bcrypt.MinCost)
+
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(&mockMetadataRepository{metadata: map[string]*dataset.Metadata{
+			"abc":    {ID: "abc", Group: "group1"},
+			"def":    {ID: "def", Group: "group2"},
+			"legacy": {ID: "legacy"},
+		}}),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{}),
+	)
+
+	issuer, sign := newTestIssuer(t)
+	bearer := sign(map[string]interface{}{
+		"iss":    "https://idp.example.edu",
+		"sub":    "awong",
+		"groups": []string{"group1", "group3"},
+		"roles":  []string{"admin"},
+		"exp":    time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	handler, stop, err := NewHandler(common.Config{
+		Token:   psk,
+		Issuers: []common.Issuer{issuer},
+		Clients: map[string]common.Client{
+			"group1client": {
+				Secret:   string(secret),
+				Accounts: []string{"*"},
+				Groups:   []string{"group1"},
+				Verbs:    []string{"*:*"},
+				Roles:    []string{"admin"},
+			},
+		},
+	}, map[string]*dataset.Service{"acct": service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	hashedPSK, _ := bcrypt.GenerateFromPassword([]byte(psk), bcrypt.MinCost)
+
+	type test struct {
+		client string
+		path   string
+		status int
+	}
+
+	tests := []test{
+		{"group1client", "/v1/ds/acct/datasets/group1/abc/logs", http.StatusOK},
+		{"group1client", "/v1/ds/acct/datasets/group1/def/logs", http.StatusNotFound},
+		{"group1client", "/v1/ds/acct/datasets/group2/def/logs", http.StatusForbidden},
+		{"group1client", "/v1/ds/acct/datasets/group1/legacy/logs", http.StatusNotFound},
+		{"group1client", "/v1/ds/acct/datasets/group1/def", http.StatusNotFound},
+		{"group1client", "/v1/ds/acct/datasets/group1/def/tasks/123", http.StatusNotFound},
+		{"bearer", "/v1/ds/acct/datasets/group1/abc/logs", http.StatusOK},
+		{"bearer", "/v1/ds/acct/datasets/group1/def/logs", http.StatusNotFound},
+		{"bearer", "/v1/ds/acct/datasets/group3/def/logs", http.StatusNotFound},
+		{"bearer", "/v1/ds/acct/datasets/group2/def/logs", http.StatusForbidden},
+		{"bearer", "/v1/ds/acct/datasets/group1/legacy/logs", http.StatusNotFound},
+		{"", "/v1/ds/acct/datasets/group1/abc/logs", http.StatusOK},
+		{"", "/v1/ds/acct/datasets/group2/abc/logs", http.StatusNotFound},
+		{"", "/v1/ds/acct/datasets/group1/legacy/logs", http.StatusOK},
+	}
+
+	for _, tst := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+tst.path, nil)
+		switch tst.client {
+		case "":
+			req.Header.Add("X-Auth-Token", string(hashedPSK))
+		case "bearer":
+			req.Header.Add("Authorization", "Bearer "+bearer)
+		default:
+			req.Header.Add("X-Auth-Client", tst.client)
+			req.Header.Add("X-Auth-Token", "group1secret")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tst.status {
+			t.Errorf("expected %d for %s as '%s', got %d", tst.status, tst.path, tst.client, resp.StatusCode)
+		}
+	}
+}
@@ -11,9 +11,14 @@ func (s *server) routes() {
 	api.HandleFunc("/ping", s.PingHandler).Methods(http.MethodGet)
 	api.HandleFunc("/version", s.VersionHandler).Methods(http.MethodGet)
 	api.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	api.HandleFunc("/openapi.json", s.OpenAPIHandler).Methods(http.MethodGet)
+
+	// validate requests against the openapi document before they're handled
+	api.Use(s.OpenAPIMiddleware)
 
 	api.HandleFunc("/{account}/datasets/{group}", s.DatasetListHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/datasets/{group}", s.DatasetCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/batch", s.DatasetBatchHandler).Methods(http.MethodPost)
 	api.HandleFunc("/{account}/datasets/{group}/{id}", s.DatasetShowHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/datasets/{group}/{id}", s.DatasetPromoteHandler).Methods(http.MethodPatch)
 	api.HandleFunc("/{account}/datasets/{group}/{id}", s.DatasetUpdateHandler).Methods(http.MethodPut)
@@ -23,14 +28,41 @@ func (s *server) routes() {
 	api.HandleFunc("/{account}/datasets/{group}/{id}/attachments", s.AttachmentCreateHandler).Methods(http.MethodPost)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/attachments", s.AttachmentDeleteHandler).Methods(http.MethodDelete)
 
+	api.HandleFunc("/{account}/datasets/{group}/{id}/derivatives", s.DerivativeCreateHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/{account}/datasets/{group}/{id}/access", s.AccessListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/access", s.AccessCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/access/{principal:.+}", s.AccessDeleteHandler).Methods(http.MethodDelete)
+
 	api.HandleFunc("/{account}/datasets/{group}/{id}/instances", s.InstanceListHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/instances", s.InstanceCreateHandler).Methods(http.MethodPost)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/instances/{instance_id}", s.InstanceDeleteHandler).Methods(http.MethodDelete)
 
+	api.HandleFunc("/{account}/datasets/{group}/{id}/shares", s.ShareListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/shares", s.ShareCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/shares/{share_id}", s.ShareUpdateHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/shares/{share_id}", s.ShareDeleteHandler).Methods(http.MethodDelete)
+
+	api.HandleFunc("/{account}/datasets/{group}/{id}/approvals", s.ApprovalListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/approvals", s.ApprovalCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/approvals/{approval_id}", s.ApprovalUpdateHandler).Methods(http.MethodPatch)
+
 	api.HandleFunc("/{account}/datasets/{group}/{id}/logs", s.LogListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/accessreport", s.AccessReportHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/{account}/datasets/{group}/{id}/verify", s.DatasetVerifyHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/datasets/{group}/{id}/lineage", s.DatasetLineageHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/{account}/datasets/{group}/{id}/tasks/{task_id}", s.TaskShowHandler).Methods(http.MethodGet)
 
 	api.HandleFunc("/{account}/datasets/{group}/{id}/users", s.UserListHandler).Methods(http.MethodGet)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/users", s.UserCreateHandler).Methods(http.MethodPost)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/users", s.UserDeleteHandler).Methods(http.MethodDelete)
 	api.HandleFunc("/{account}/datasets/{group}/{id}/users", s.UserUpdateHandler).Methods(http.MethodPut)
+
+	api.HandleFunc("/{account}/webhooks/{group}", s.WebhookListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/webhooks/{group}", s.WebhookCreateHandler).Methods(http.MethodPost)
+	api.HandleFunc("/{account}/webhooks/{group}/{webhook_id}", s.WebhookDeleteHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/{account}/webhooks/{group}/{webhook_id}/deadletters", s.DeadLetterListHandler).Methods(http.MethodGet)
+	api.HandleFunc("/{account}/webhooks/{group}/{webhook_id}/deadletters/{deadletter_id}", s.DeadLetterRedeliverHandler).Methods(http.MethodPost)
 }
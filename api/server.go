@@ -7,13 +7,18 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/YaleSpinup/ds-api/common"
 	"github.com/YaleSpinup/ds-api/cwauditlogrepository"
 	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/YaleSpinup/ds-api/eventbridgepublisher"
+	"github.com/YaleSpinup/ds-api/jwt"
 	"github.com/YaleSpinup/ds-api/s3datarepository"
 	"github.com/YaleSpinup/ds-api/s3metadatarepository"
+	"github.com/YaleSpinup/ds-api/sqsactivityqueue"
+	"github.com/YaleSpinup/ds-api/webhook"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
@@ -29,6 +34,14 @@ type server struct {
 	router          *mux.Router
 	version         common.Version
 	context         context.Context
+	tasks           *taskRegistry
+	policy          *policy
+	clients         map[string]*apiClient
+	classifications classificationPolicies
+	openapi         *openAPISpec
+	webhooks        map[string]*webhook.Dispatcher
+	allowHTTP       bool
+	workers         sync.WaitGroup
 }
 
 // Org will carry throughout the api and get tagged on resources
@@ -45,6 +58,7 @@ func NewServer(config common.Config) error {
 		router:          mux.NewRouter(),
 		version:         config.Version,
 		context:         ctx,
+		tasks:           newTaskRegistry(),
 	}
 
 	if config.Org == "" {
@@ -57,6 +71,11 @@ func NewServer(config common.Config) error {
 	log.Debugf("Creating new session for MetadataRepository of type %s with configuration %+v (org: %s)", metadata.Type, metadata.Config, Org)
 
 	var metadataRepo dataset.MetadataRepository
+	var approvalRepo dataset.ApprovalRepository
+	var grantRepo dataset.GrantRepository
+	var shareRepo dataset.ShareRepository
+	var webhookRepo dataset.WebhookRepository
+	var accessReportRepo dataset.AccessReportRepository
 	var err error
 
 	switch metadata.Type {
@@ -69,10 +88,18 @@ func NewServer(config common.Config) error {
 		}
 		metadata.Config["prefix"] = prefix
 
-		metadataRepo, err = s3metadatarepository.NewDefaultRepository(metadata.Config)
+		s3MetadataRepo, err := s3metadatarepository.NewDefaultRepository(metadata.Config)
 		if err != nil {
 			return err
 		}
+
+		// approval requests, expiring grants, shares, webhooks and access reports are stored alongside the dataset metadata
+		metadataRepo = s3MetadataRepo
+		approvalRepo = s3MetadataRepo
+		grantRepo = s3MetadataRepo
+		shareRepo = s3MetadataRepo
+		webhookRepo = s3MetadataRepo
+		accessReportRepo = s3MetadataRepo
 	default:
 		return errors.New("failed to determine metadata repository type, or type not supported: " + metadata.Type)
 	}
@@ -122,27 +149,56 @@ func NewServer(config common.Config) error {
 		auditLogRepo.GroupPrefix = "/spinup/" + Org + "/"
 		auditLogRepo.StreamPrefix = "dataset-"
 
-		s.datasetServices[name] = dataset.NewService(
+		opts := []dataset.ServiceOption{
 			dataset.WithAuditLogRepository(auditLogRepo),
 			dataset.WithMetadataRepository(metadataRepo),
+			dataset.WithApprovalRepository(approvalRepo),
+			dataset.WithGrantRepository(grantRepo),
+			dataset.WithShareRepository(shareRepo),
+			dataset.WithWebhookRepository(webhookRepo),
+			dataset.WithAccessReportRepository(accessReportRepo),
 			dataset.WithDataRepository(dataRepos),
 			dataset.WithAttachmentRepository(attachmentRepos),
-		)
+		}
+
+		// publish dataset events to an event bus, if one is configured for the account
+		if _, ok := a.Config["eventBus"]; ok {
+			eventPublisher, err := eventbridgepublisher.NewDefaultPublisher(a.Config)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, dataset.WithEventPublisher(eventPublisher))
+		}
+
+		// track the object activity in the data repositories, if an activity queue is configured for the account
+		if _, ok := a.Config["activityQueueArn"]; ok {
+			activityQueue, err := sqsactivityqueue.NewDefaultQueue(a.Config)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, dataset.WithActivityQueue(activityQueue))
+		}
+
+		s.datasetServices[name] = dataset.NewService(opts...)
 	}
 
-	publicURLs := map[string]string{
-		"/v1/ds/ping":    "public",
-		"/v1/ds/version": "public",
-		"/v1/ds/metrics": "public",
+	handler, err := s.handler(config)
+	if err != nil {
+		return err
 	}
 
-	// load routes
-	s.routes()
+	// the workers run until the server stops
+	s.startWorkers(ctx)
+
+	// revoke expiring grants in the background
+	s.run(func() { s.expireGrants(ctx, grantSweepInterval) })
 
 	if config.ListenAddress == "" {
 		config.ListenAddress = ":8080"
 	}
-	handler := handlers.RecoveryHandler()(handlers.LoggingHandler(os.Stdout, TokenMiddleware([]byte(config.Token), publicURLs, s.router)))
+	// tie log entries with a context to the request
+	log.AddHook(dataset.RequestIDHook{})
+
 	srv := &http.Server{
 		Handler:      handler,
 		Addr:         config.ListenAddress,
@@ -158,6 +214,101 @@ func NewServer(config common.Config) error {
 	return nil
 }
 
+// NewHandler returns the http handler of the api for the given dataset services, with the same routes, middleware
+// and background workers as the server.  It can be used to run the api in-process, ie. to test api clients with
+// httptest.  The returned function stops the background workers and waits for them to finish.
+func NewHandler(config common.Config, services map[string]*dataset.Service) (http.Handler, func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		datasetServices: services,
+		router:          mux.NewRouter(),
+		version:         config.Version,
+		context:         ctx,
+		tasks:           newTaskRegistry(),
+	}
+
+	handler, err := s.handler(config)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	s.startWorkers(ctx)
+
+	stop := func() {
+		cancel()
+		s.workers.Wait()
+	}
+
+	return handler, stop, nil
+}
+
+// startWorkers starts the background workers that deliver events to webhooks, track the object activity and ingest
+// the access logs of the data repositories, until the context is cancelled
+func (s *server) startWorkers(ctx context.Context) {
+	s.startWebhooks(ctx)
+	s.startActivityTracking(ctx)
+	s.startAccessLogIngestion(ctx, accessLogSweepInterval)
+}
+
+// run runs a background worker, which is waited for when the workers are stopped
+func (s *server) run(f func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		f()
+	}()
+}
+
+// handler configures the authorization policies, loads the routes and wraps the router with the authentication,
+// logging and recovery middleware
+func (s *server) handler(config common.Config) (http.Handler, error) {
+	publicURLs := map[string]string{
+		"/v1/ds/ping":         "public",
+		"/v1/ds/version":      "public",
+		"/v1/ds/metrics":      "public",
+		"/v1/ds/openapi.json": "public",
+	}
+
+	var err error
+	if s.clients, err = newAPIClients(config.Clients); err != nil {
+		return nil, err
+	}
+
+	if s.policy, err = newPolicy(config.Roles); err != nil {
+		return nil, err
+	}
+
+	if s.classifications, err = newClassificationPolicies(config.Classifications); err != nil {
+		return nil, err
+	}
+
+	// webhooks must use https, unless plain http is explicitly allowed
+	s.allowHTTP = config.AllowHTTPWebhooks
+
+	tokenRoles := config.TokenRoles
+	if len(tokenRoles) == 0 {
+		tokenRoles = defaultTokenRoles
+	}
+
+	var validator *jwt.Validator
+	if len(config.Issuers) > 0 {
+		if validator, err = jwt.NewValidator(config.Issuers); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.openapi, err = newOpenAPISpec(openAPIDocument); err != nil {
+		return nil, err
+	}
+
+	// load routes
+	s.routes()
+
+	return handlers.RecoveryHandler()(RequestIDMiddleware(handlers.CustomLoggingHandler(os.Stdout, TokenMiddleware([]byte(config.Token), tokenRoles, s.clients, validator, publicURLs, s.router), requestLogFormatter))), nil
+}
+
 // LogWriter is an http.ResponseWriter
 type LogWriter struct {
 	http.ResponseWriter
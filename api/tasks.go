@@ -0,0 +1,88 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/google/uuid"
+)
+
+// taskRetention is how long finished tasks are kept in the registry
+const taskRetention = 24 * time.Hour
+
+// taskRegistry keeps track of asynchronous dataset tasks in memory
+type taskRegistry struct {
+	sync.Mutex
+	tasks map[string]*dataset.Task
+}
+
+func newTaskRegistry() *taskRegistry {
+	return &taskRegistry{tasks: map[string]*dataset.Task{}}
+}
+
+// add registers a new pending task for a dataset, and prunes old finished tasks
+func (r *taskRegistry) add(datasetID, taskType string) dataset.Task {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for id, t := range r.tasks {
+		if t.CompletedAt != nil && now.Sub(*t.CompletedAt) > taskRetention {
+			delete(r.tasks, id)
+		}
+	}
+
+	t := &dataset.Task{
+		ID:        uuid.New().String(),
+		DatasetID: datasetID,
+		Type:      taskType,
+		Status:    dataset.TaskStatusPending,
+		CreatedAt: now,
+	}
+	r.tasks[t.ID] = t
+
+	return *t
+}
+
+// get returns a copy of the task with the given id, if it belongs to the dataset
+func (r *taskRegistry) get(datasetID, id string) (dataset.Task, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.tasks[id]
+	if !ok || t.DatasetID != datasetID {
+		return dataset.Task{}, false
+	}
+
+	task := *t
+	if t.Progress != nil {
+		p := *t.Progress
+		task.Progress = &p
+	}
+
+	return task, true
+}
+
+// update applies the given function to the task with the given id
+func (r *taskRegistry) update(id string, f func(*dataset.Task)) {
+	r.Lock()
+	defer r.Unlock()
+
+	if t, ok := r.tasks[id]; ok {
+		f(t)
+	}
+}
+
+// finish marks the task as completed, or failed if err is not nil
+func (r *taskRegistry) finish(id string, err error) {
+	r.update(id, func(t *dataset.Task) {
+		now := time.Now().UTC().Truncate(time.Second)
+		t.CompletedAt = &now
+		t.Status = dataset.TaskStatusCompleted
+		if err != nil {
+			t.Status = dataset.TaskStatusFailed
+			t.Error = err.Error()
+		}
+	})
+}
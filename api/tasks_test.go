@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+func TestTaskRegistry(t *testing.T) {
+	r := newTaskRegistry()
+
+	task := r.add("dataset1", "copy")
+	if task.ID == "" || task.Status != dataset.TaskStatusPending {
+		t.Errorf("expected new pending task, got %+v", task)
+	}
+
+	if _, ok := r.get("dataset2", task.ID); ok {
+		t.Error("expected task not to be found for a different dataset")
+	}
+
+	r.update(task.ID, func(t *dataset.Task) {
+		t.Status = dataset.TaskStatusRunning
+		t.Progress = &dataset.CopyProgress{ObjectsTotal: 2}
+	})
+
+	got, ok := r.get("dataset1", task.ID)
+	if !ok || got.Status != dataset.TaskStatusRunning || got.Progress.ObjectsTotal != 2 {
+		t.Errorf("expected running task with progress, got %+v", got)
+	}
+
+	// make sure we got a copy
+	got.Progress.ObjectsTotal = 3
+	if got, _ := r.get("dataset1", task.ID); got.Progress.ObjectsTotal != 2 {
+		t.Error("expected registry task not to be modified")
+	}
+
+	r.finish(task.ID, errors.New("boom"))
+	got, _ = r.get("dataset1", task.ID)
+	if got.Status != dataset.TaskStatusFailed || got.Error != "boom" || got.CompletedAt == nil {
+		t.Errorf("expected failed task, got %+v", got)
+	}
+
+	// test old finished tasks are pruned
+	old := time.Now().Add(-2 * taskRetention)
+	r.update(task.ID, func(t *dataset.Task) { t.CompletedAt = &old })
+	task2 := r.add("dataset1", "copy")
+	if _, ok := r.get("dataset1", task.ID); ok {
+		t.Error("expected old task to be pruned")
+	}
+
+	r.finish(task2.ID, nil)
+	if got, _ := r.get("dataset1", task2.ID); got.Status != dataset.TaskStatusCompleted {
+		t.Errorf("expected completed task, got %+v", got)
+	}
+}
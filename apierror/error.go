@@ -1,6 +1,7 @@
 package apierror
 
 import (
+	"encoding/json"
 	"fmt"
 )
 
@@ -26,10 +27,12 @@ const ErrServiceUnavailable = "ServiceUnavailable"
 const ErrInternalError = "InternalError"
 
 // Error wraps lower level errors with code, message and an original error.  This is
-// modelled after the awserr with the intention of standardizing the output.
+// modelled after the awserr with the intention of standardizing the output.  The details
+// are json behind a pointer, so errors stay comparable.
 type Error struct {
 	Code    string
 	Message string
+	Details *json.RawMessage
 	OrigErr error
 }
 
@@ -42,6 +45,21 @@ func New(code, message string, err error) Error {
 	}
 }
 
+// NewWithDetails constructs an Error with json details for the client, ie. the invalid fields of a request
+func NewWithDetails(code, message string, details json.RawMessage, err error) Error {
+	out := Error{
+		Code:    code,
+		Message: message,
+		OrigErr: err,
+	}
+
+	if len(details) > 0 {
+		out.Details = &details
+	}
+
+	return out
+}
+
 // Error Satisfies the Error interface
 func (e Error) Error() string {
 	return e.String()
@@ -1,6 +1,7 @@
 package apierror
 
 import (
+	"encoding/json"
 	"errors"
 	"reflect"
 	"testing"
@@ -13,6 +14,32 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewWithDetails(t *testing.T) {
+	details := json.RawMessage(`{"name":"required"}`)
+	out := NewWithDetails(ErrBadRequest, "bad request", details, nil)
+	if out.Details == nil || !reflect.DeepEqual(*out.Details, details) {
+		t.Errorf("expected details %s, got %v", details, out.Details)
+	}
+
+	if expect := "BadRequest: bad request"; out.String() != expect {
+		t.Errorf("expected '%s', got '%s'", expect, out)
+	}
+
+	if out = NewWithDetails(ErrBadRequest, "bad request", nil, nil); out.Details != nil {
+		t.Errorf("expected nil details, got %s", *out.Details)
+	}
+
+	// errors with details can be compared without panicking
+	var err error = NewWithDetails(ErrBadRequest, "bad request", details, nil)
+	if err == error(NewWithDetails(ErrBadRequest, "bad request", details, nil)) {
+		t.Error("expected errors with different details not to be equal")
+	}
+
+	if !errors.Is(err, err) {
+		t.Error("expected error to be itself")
+	}
+}
+
 func TestError(t *testing.T) {
 	out := New(ErrBadRequest, "bad request", errors.New("fail"))
 	if out.Error() != out.String() {
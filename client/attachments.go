@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// ListAttachments lists the attachments of a dataset, with presigned urls to download them
+func (c *Client) ListAttachments(ctx context.Context, account, group, id string) ([]dataset.Attachment, error) {
+	output := []dataset.Attachment{}
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id, "attachments"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// CreateAttachment uploads an attachment for a dataset.  The attachment is read into memory, so the request
+// can be retried.
+func (c *Client) CreateAttachment(ctx context.Context, account, group, id, name string, attachment io.Reader) error {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	if err := form.WriteField("name", name); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to write attachment name", err)
+	}
+
+	part, err := form.CreateFormFile("attachment", name)
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to create attachment form file", err)
+	}
+
+	if _, err = io.Copy(part, attachment); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to read attachment", err)
+	}
+
+	if err = form.Close(); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to write attachment form", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, datasetPath(account, group, id, "attachments"), form.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	output := []string{}
+	if err := json.Unmarshal(resp, &output); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to decode response body", err)
+	}
+
+	return nil
+}
+
+// DeleteAttachment deletes an attachment from a dataset
+func (c *Client) DeleteAttachment(ctx context.Context, account, group, id, name string) error {
+	input := struct {
+		AttachmentName string `json:"attachment_name"`
+	}{name}
+
+	return c.doJSON(ctx, http.MethodDelete, datasetPath(account, group, id, "attachments"), &input, nil)
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// batch actions
+const (
+	BatchActionTag          = "tag"
+	BatchActionLock         = "lock"
+	BatchActionRevokeAccess = "revoke_access"
+	BatchActionRotateKeys   = "rotate_keys"
+)
+
+// BatchDatasetsInput is the input to run an action on a list of datasets.  Tags are required for the tag action.
+type BatchDatasetsInput struct {
+	IDs    []string       `json:"ids"`
+	Action string         `json:"action"`
+	Tags   []*dataset.Tag `json:"tags,omitempty"`
+}
+
+// BatchResult is the result of a batch action for one dataset, failed results have the code and message of the error
+type BatchResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BatchDatasetsOutput is the output of a batch action, with the results in the order of the ids
+type BatchDatasetsOutput struct {
+	Action    string         `json:"action"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []*BatchResult `json:"results"`
+}
+
+// BatchDatasets runs an action on a list of datasets in the account and group.  The request succeeds even if the
+// action fails for some of the datasets, check the results.
+func (c *Client) BatchDatasets(ctx context.Context, account, group string, input *BatchDatasetsInput) (*BatchDatasetsOutput, error) {
+	output := &BatchDatasetsOutput{}
+	if err := c.doJSON(ctx, http.MethodPost, datasetPath(account, group, "", "batch"), input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,283 @@
+// Package client is a Go client for the ds-api.  It wraps the HTTP api with typed methods for datasets,
+// attachments, instances, users, audit logs and webhooks, and returns errors from the api as apierror.Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// DefaultRetries is the default number of times a failed request is retried
+const DefaultRetries = 3
+
+// DefaultRetryWait is the default time to wait before the first retry, it's doubled for every following retry
+const DefaultRetryWait = 500 * time.Millisecond
+
+// Client is a ds-api client
+type Client struct {
+	endpoint   string
+	token      string
+	client     string
+	bearer     string
+	user       string
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+}
+
+// Option is a function to set client options
+type Option func(*Client)
+
+// New creates a new client for the api at the given endpoint, ie. https://ds.example.edu/v1/ds, with the provided
+// Option functions
+func New(endpoint string, opts ...Option) *Client {
+	c := Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		retries:    DefaultRetries,
+		retryWait:  DefaultRetryWait,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return &c
+}
+
+// WithToken sets the X-Auth-Token header sent with every request, ie. the bcrypt hash of the shared pre-shared key
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithClient authenticates as a named API client, the name is sent in the X-Auth-Client header and the secret in
+// the X-Auth-Token header
+func WithClient(name, secret string) Option {
+	return func(c *Client) {
+		c.client = name
+		c.token = secret
+	}
+}
+
+// WithBearerToken sets the bearer token sent in the Authorization header of every request, instead of the
+// X-Auth-Token and X-Auth-Client headers.  The user of a bearer token is taken from the token.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.bearer = token
+	}
+}
+
+// WithUser sets the X-Forwarded-User header sent with every request, it's required to promote, update and
+// delete datasets
+func WithUser(user string) Option {
+	return func(c *Client) {
+		c.user = user
+	}
+}
+
+// WithHTTPClient sets the http client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets the number of times a failed request is retried and the time to wait before the first retry
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// errorResponse is the body of api error responses
+type errorResponse struct {
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	RequestID string          `json:"request_id"`
+	Details   json.RawMessage `json:"details"`
+}
+
+// datasetPath returns the escaped path of a dataset, followed by the optional sub resource elements
+func datasetPath(account, group, id string, elem ...string) string {
+	parts := []string{url.PathEscape(account), "datasets", url.PathEscape(group)}
+	if id != "" {
+		parts = append(parts, url.PathEscape(id))
+	}
+
+	for _, e := range elem {
+		parts = append(parts, url.PathEscape(e))
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// doJSON sends a request with the json encoding of the input as body, if it's not nil, and decodes the json response
+// into the output, if it's not nil
+func (c *Client) doJSON(ctx context.Context, method, path string, input, output interface{}) error {
+	var body []byte
+	if input != nil {
+		var err error
+		if body, err = json.Marshal(input); err != nil {
+			return apierror.New(apierror.ErrBadRequest, "failed to encode request body", err)
+		}
+	}
+
+	resp, err := c.do(ctx, method, path, "application/json", body)
+	if err != nil {
+		return err
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(resp, output); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to decode response body", err)
+	}
+
+	return nil
+}
+
+// do sends a request and returns the response body.  Requests are retried after network errors and responses that
+// indicate a temporary problem, error responses are returned as apierror.Error.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	var err error
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		var resp []byte
+		var retry bool
+		resp, retry, err = c.send(ctx, method, path, contentType, body)
+		if err == nil || !retry || attempt >= c.retries {
+			return resp, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, apierror.New(apierror.ErrServiceUnavailable, "request cancelled while waiting to retry", err)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// send sends a single request and returns the response body and whether a failed request can be retried
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, apierror.New(apierror.ErrBadRequest, "failed to create request", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	switch {
+	case c.bearer != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	case c.token != "":
+		req.Header.Set("X-Auth-Token", c.token)
+		if c.client != "" {
+			req.Header.Set("X-Auth-Client", c.client)
+		}
+	}
+
+	if c.user != "" {
+		req.Header.Set("X-Forwarded-User", c.user)
+	}
+
+	if requestID := dataset.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		// requests that never got a response are only retried if they're safe to repeat
+		return nil, idempotent(method) && ctx.Err() == nil, apierror.New(apierror.ErrServiceUnavailable, fmt.Sprintf("%s %s failed", method, path), err)
+	}
+	defer res.Body.Close()
+
+	resp, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, idempotent(method), apierror.New(apierror.ErrServiceUnavailable, fmt.Sprintf("failed to read response of %s %s", method, path), err)
+	}
+
+	if res.StatusCode < 400 {
+		return resp, false, nil
+	}
+
+	return nil, retryable(method, res.StatusCode), responseError(method, path, res, resp)
+}
+
+// responseError decodes an error response into an apierror.Error.  Responses without a json error body get the code
+// of their status.
+func responseError(method, path string, res *http.Response, body []byte) error {
+	out := errorResponse{}
+	if err := json.Unmarshal(body, &out); err != nil || out.Code == "" {
+		out.Code = statusCode(res.StatusCode)
+		out.Message = strings.TrimSpace(string(body))
+		if out.Message == "" {
+			out.Message = http.StatusText(res.StatusCode)
+		}
+	}
+
+	if out.RequestID == "" {
+		out.RequestID = res.Header.Get("X-Request-ID")
+	}
+
+	return apierror.NewWithDetails(out.Code, out.Message, out.Details, fmt.Errorf("%s %s returned %d (request id %s)", method, path, res.StatusCode, out.RequestID))
+}
+
+// statusCode returns the api error code for an http status code
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return apierror.ErrBadRequest
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return apierror.ErrForbidden
+	case http.StatusNotFound:
+		return apierror.ErrNotFound
+	case http.StatusConflict:
+		return apierror.ErrConflict
+	case http.StatusTooManyRequests:
+		return apierror.ErrLimitExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return apierror.ErrServiceUnavailable
+	default:
+		return apierror.ErrInternalError
+	}
+}
+
+// idempotent returns true for request methods that can be repeated without side effects
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryable returns true if a request that failed with the given status can be retried.  Rate limited requests are
+// always retried, requests that failed because the api or a proxy is unavailable only if they're idempotent.
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
@@ -0,0 +1,598 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/api"
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testToken is the pre-shared key of the test api, clients pass its bcrypt hash
+var testToken = "s3cr3t"
+
+// mockMetadataRepository is an in-memory metadata repository
+type mockMetadataRepository struct {
+	sync.Mutex
+	metadata map[string]*dataset.Metadata
+}
+
+func (m *mockMetadataRepository) Create(ctx context.Context, account, id string, metadata *dataset.Metadata) (*dataset.Metadata, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	metadata.CreatedAt = &now
+	m.metadata[id] = metadata
+	return metadata, nil
+}
+
+func (m *mockMetadataRepository) Get(ctx context.Context, account, id string) (*dataset.Metadata, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	metadata, ok := m.metadata[id]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	out := *metadata
+	return &out, nil
+}
+
+func (m *mockMetadataRepository) List(ctx context.Context, account string) ([]*dataset.Metadata, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	out := []*dataset.Metadata{}
+	for _, metadata := range m.metadata {
+		out = append(out, metadata)
+	}
+	return out, nil
+}
+
+func (m *mockMetadataRepository) Promote(ctx context.Context, account, id, user string) (*dataset.Metadata, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	metadata, ok := m.metadata[id]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, "metadata not found", nil)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	metadata.Derivative = false
+	metadata.FinalizedAt = &now
+	metadata.FinalizedBy = user
+	return metadata, nil
+}
+
+func (m *mockMetadataRepository) Update(ctx context.Context, account, id string, metadata *dataset.Metadata) (*dataset.Metadata, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.metadata[id] = metadata
+	return metadata, nil
+}
+
+func (m *mockMetadataRepository) Delete(ctx context.Context, account, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.metadata, id)
+	return nil
+}
+
+// mockDataRepository is an in-memory data repository, methods that aren't used by the client tests panic
+type mockDataRepository struct {
+	dataset.DataRepository
+	mu     sync.Mutex
+	access map[string]dataset.Access
+	users  map[string]int
+}
+
+func (m *mockDataRepository) Provision(ctx context.Context, id string, tags []*dataset.Tag, encryption string) (string, error) {
+	return "dataset-" + id, nil
+}
+
+func (m *mockDataRepository) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *mockDataRepository) Describe(ctx context.Context, id string) (*dataset.Repository, error) {
+	return &dataset.Repository{Name: "dataset-" + id, Empty: true}, nil
+}
+
+func (m *mockDataRepository) SetPolicy(ctx context.Context, id string, derivative bool) error {
+	return nil
+}
+
+func (m *mockDataRepository) GrantAccess(ctx context.Context, id, instanceID, permission string) (dataset.Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.access[id] == nil {
+		m.access[id] = dataset.Access{}
+	}
+	m.access[id][instanceID] = "dataset-" + id + "-" + permission
+	return dataset.Access{instanceID: m.access[id][instanceID]}, nil
+}
+
+func (m *mockDataRepository) ListAccess(ctx context.Context, id string) (dataset.Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := dataset.Access{}
+	for k, v := range m.access[id] {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (m *mockDataRepository) RevokeAccess(ctx context.Context, id, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.access[id][instanceID]; !ok {
+		return apierror.New(apierror.ErrNotFound, "instance doesn't have access", nil)
+	}
+	delete(m.access[id], instanceID)
+	return nil
+}
+
+func (m *mockDataRepository) CreateUser(ctx context.Context, id string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users[id]++
+	return map[string]interface{}{"UserName": "dataset-" + id, "AccessKeyId": fmt.Sprintf("AKIA%d", m.users[id])}, nil
+}
+
+func (m *mockDataRepository) DeleteUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, id)
+	return nil
+}
+
+func (m *mockDataRepository) ListUsers(ctx context.Context, id string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return map[string]interface{}{}, nil
+	}
+	return map[string]interface{}{"dataset-" + id: []string{fmt.Sprintf("AKIA%d", m.users[id])}}, nil
+}
+
+func (m *mockDataRepository) UpdateUser(ctx context.Context, id string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users[id]++
+	return map[string]interface{}{"AccessKeyId": fmt.Sprintf("AKIA%d", m.users[id])}, nil
+}
+
+func (m *mockDataRepository) CreateManifest(ctx context.Context, id string) (*dataset.ManifestReference, error) {
+	return &dataset.ManifestReference{Location: "_manifest.json", SHA256: "abc123"}, nil
+}
+
+func (m *mockDataRepository) Lock(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *mockDataRepository) Retention(ctx context.Context, id string) (time.Duration, error) {
+	return 365 * 24 * time.Hour, nil
+}
+
+func (m *mockDataRepository) Unlock(ctx context.Context, id string) error {
+	return nil
+}
+
+// mockAttachmentRepository is an in-memory attachment repository
+type mockAttachmentRepository struct {
+	sync.Mutex
+	attachments map[string]map[string][]byte
+}
+
+func (m *mockAttachmentRepository) CreateAttachment(ctx context.Context, id, attachmentName string, attachmentBody multipart.File) error {
+	body, err := io.ReadAll(attachmentBody)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.attachments[id] == nil {
+		m.attachments[id] = make(map[string][]byte)
+	}
+	m.attachments[id][attachmentName] = body
+	return nil
+}
+
+func (m *mockAttachmentRepository) DeleteAttachment(ctx context.Context, id, attachmentName string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.attachments[id][attachmentName]; !ok {
+		return apierror.New(apierror.ErrNotFound, "attachment not found", nil)
+	}
+	delete(m.attachments[id], attachmentName)
+	return nil
+}
+
+func (m *mockAttachmentRepository) ListAttachments(ctx context.Context, id string, showURL bool) ([]dataset.Attachment, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	out := []dataset.Attachment{}
+	for name, body := range m.attachments[id] {
+		out = append(out, dataset.Attachment{Name: name, Size: int64(len(body))})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// mockAuditLogRepository keeps the audit log messages of each dataset in memory
+type mockAuditLogRepository struct {
+	sync.Mutex
+	logs map[string][]string
+}
+
+func (m *mockAuditLogRepository) CreateLog(ctx context.Context, group, stream string, retention int64, tags []*dataset.Tag) error {
+	return nil
+}
+
+func (m *mockAuditLogRepository) GetLog(ctx context.Context, group, stream string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return append([]string{}, m.logs[group+"/"+stream]...), nil
+}
+
+func (m *mockAuditLogRepository) Log(ctx context.Context, group, stream string) chan string {
+	stream = group + "/" + stream
+	ch := make(chan string)
+	go func() {
+		for msg := range ch {
+			m.Lock()
+			m.logs[stream] = append(m.logs[stream], msg)
+			m.Unlock()
+		}
+	}()
+
+	return ch
+}
+
+// mockEventPublisher sends the published events to a channel
+type mockEventPublisher struct {
+	events chan *dataset.Event
+}
+
+func (m *mockEventPublisher) Publish(ctx context.Context, event *dataset.Event) error {
+	m.events <- event
+	return nil
+}
+
+// mockWebhookRepository keeps webhooks and dead letters in memory
+type mockWebhookRepository struct {
+	sync.Mutex
+	webhooks    map[string]*dataset.Webhook
+	deadLetters map[string]*dataset.DeadLetter
+}
+
+func (m *mockWebhookRepository) PutWebhook(ctx context.Context, account string, webhook *dataset.Webhook) error {
+	m.Lock()
+	defer m.Unlock()
+
+	w := *webhook
+	m.webhooks[webhook.ID] = &w
+	return nil
+}
+
+func (m *mockWebhookRepository) GetWebhook(ctx context.Context, account, group, id string) (*dataset.Webhook, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	w, ok := m.webhooks[id]
+	if !ok || w.Group != group {
+		return nil, apierror.New(apierror.ErrNotFound, "webhook not found", nil)
+	}
+
+	out := *w
+	return &out, nil
+}
+
+func (m *mockWebhookRepository) ListWebhooks(ctx context.Context, account, group string) ([]*dataset.Webhook, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	out := []*dataset.Webhook{}
+	for _, w := range m.webhooks {
+		if w.Group == group {
+			c := *w
+			out = append(out, &c)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookRepository) DeleteWebhook(ctx context.Context, account, group, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *mockWebhookRepository) PutDeadLetter(ctx context.Context, account string, deadLetter *dataset.DeadLetter) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.deadLetters[deadLetter.ID] = deadLetter
+	return nil
+}
+
+func (m *mockWebhookRepository) GetDeadLetter(ctx context.Context, account, group, webhookID, id string) (*dataset.DeadLetter, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	d, ok := m.deadLetters[id]
+	if !ok || d.WebhookID != webhookID {
+		return nil, apierror.New(apierror.ErrNotFound, "dead letter not found", nil)
+	}
+	return d, nil
+}
+
+func (m *mockWebhookRepository) ListDeadLetters(ctx context.Context, account, group, webhookID string) ([]*dataset.DeadLetter, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	out := []*dataset.DeadLetter{}
+	for _, d := range m.deadLetters {
+		if d.WebhookID == webhookID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookRepository) DeleteDeadLetter(ctx context.Context, account, group, webhookID, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.deadLetters, id)
+	return nil
+}
+
+// newTestAPI starts the api with in-memory repositories for the account spintst, and returns a client for it
+func newTestAPI(t *testing.T, opts ...Option) (*Client, *mockMetadataRepository) {
+	service, metadataRepo := newTestService()
+	return serveTestAPI(t, service, opts...), metadataRepo
+}
+
+// newTestService returns a dataset service backed by in-memory repositories
+func newTestService() (*dataset.Service, *mockMetadataRepository) {
+	metadataRepo := &mockMetadataRepository{metadata: make(map[string]*dataset.Metadata)}
+
+	service := dataset.NewService(
+		dataset.WithMetadataRepository(metadataRepo),
+		dataset.WithAuditLogRepository(&mockAuditLogRepository{logs: make(map[string][]string)}),
+		dataset.WithDataRepository(map[string]dataset.DataRepository{
+			"s3": &mockDataRepository{access: make(map[string]dataset.Access), users: make(map[string]int)},
+		}),
+		dataset.WithAttachmentRepository(map[string]dataset.AttachmentRepository{
+			"s3": &mockAttachmentRepository{attachments: make(map[string]map[string][]byte)},
+		}),
+		dataset.WithWebhookRepository(&mockWebhookRepository{webhooks: make(map[string]*dataset.Webhook), deadLetters: make(map[string]*dataset.DeadLetter)}),
+	)
+
+	return service, metadataRepo
+}
+
+// serveTestAPI serves the api for the service in the spintst account and returns a client for it
+func serveTestAPI(t *testing.T, service *dataset.Service, opts ...Option) *Client {
+	handler, stop, err := api.NewHandler(common.Config{Token: testToken, TokenRoles: []string{"admin"}}, map[string]*dataset.Service{"spintst": service})
+	if err != nil {
+		t.Fatalf("expected nil error creating api handler, got %s", err)
+	}
+
+	// cleanups run in reverse order, the workers are stopped once the test server is closed
+	t.Cleanup(stop)
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testToken), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append([]Option{WithToken(string(hash)), WithUser("tester"), WithRetries(0, 0)}, opts...)
+	return New(ts.URL+"/v1/ds", opts...)
+}
+
+func TestNew(t *testing.T) {
+	c := New("https://ds.example.edu/v1/ds/", WithToken("token"), WithUser("someone"), WithRetries(5, time.Second))
+
+	if c.endpoint != "https://ds.example.edu/v1/ds" {
+		t.Errorf("expected endpoint without trailing slash, got %s", c.endpoint)
+	}
+
+	if c.token != "token" || c.user != "someone" || c.retries != 5 || c.retryWait != time.Second {
+		t.Errorf("expected client options to be set, got %+v", c)
+	}
+
+	if c = New("https://ds.example.edu/v1/ds"); c.retries != DefaultRetries || c.retryWait != DefaultRetryWait || c.httpClient == nil {
+		t.Errorf("expected default client options, got %+v", c)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`{"id":"123"}`))
+	}))
+	defer ts.Close()
+
+	type test struct {
+		opts    []Option
+		headers map[string]string
+	}
+
+	tests := []test{
+		{[]Option{WithToken("hash")}, map[string]string{"X-Auth-Token": "hash", "X-Auth-Client": "", "Authorization": ""}},
+		{[]Option{WithClient("portal", "s3cr3t")}, map[string]string{"X-Auth-Token": "s3cr3t", "X-Auth-Client": "portal", "Authorization": ""}},
+		{[]Option{WithToken("hash"), WithBearerToken("jwt")}, map[string]string{"X-Auth-Token": "", "X-Auth-Client": "", "Authorization": "Bearer jwt"}},
+	}
+
+	for _, tst := range tests {
+		c := New(ts.URL, tst.opts...)
+		if _, err := c.GetDataset(context.TODO(), "spintst", "dsgroup", "123"); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+
+		for k, v := range tst.headers {
+			if header.Get(k) != v {
+				t.Errorf("expected %s header '%s', got '%s'", k, v, header.Get(k))
+			}
+		}
+	}
+
+	// named api clients are authenticated by the api
+	secret, err := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, _ := newTestService()
+	handler, stop, err := api.NewHandler(common.Config{
+		Token: testToken,
+		Clients: map[string]common.Client{
+			"portal": {Secret: string(secret), Accounts: []string{"*"}, Groups: []string{"*"}, Verbs: []string{"*"}, Roles: []string{"viewer"}},
+		},
+	}, map[string]*dataset.Service{"spintst": service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	apiServer := httptest.NewServer(handler)
+	defer apiServer.Close()
+
+	var aerr apierror.Error
+	c := New(apiServer.URL+"/v1/ds", WithClient("portal", "s3cr3t"), WithRetries(0, 0))
+	if _, err = c.GetDataset(context.TODO(), "spintst", "dsgroup", "123"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound error for a missing dataset as api client, got %v", err)
+	}
+
+	c = New(apiServer.URL+"/v1/ds", WithClient("portal", "wrong"), WithRetries(0, 0))
+	if _, err = c.GetDataset(context.TODO(), "spintst", "dsgroup", "123"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrForbidden {
+		t.Errorf("expected Forbidden error with the wrong client secret, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := newTestAPI(t)
+
+	_, err := c.GetDataset(context.TODO(), "missing", "dsgroup", "123")
+	var aerr apierror.Error
+	if !errors.As(err, &aerr) {
+		t.Fatalf("expected apierror.Error, got %T %v", err, err)
+	}
+
+	if aerr.Code != apierror.ErrNotFound || aerr.Message != "account not found: missing" {
+		t.Errorf("expected NotFound account not found error, got %s", aerr)
+	}
+
+	_, err = c.CreateDataset(context.TODO(), "spintst", "dsgroup", &CreateDatasetInput{Name: "foo"})
+	if !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest || aerr.Message != "dataset type is required" {
+		t.Errorf("expected BadRequest dataset type is required error, got %v", err)
+	}
+
+	// validation errors have details
+	_, err = c.UpdateDataset(context.TODO(), "spintst", "dsgroup", "123", nil)
+	if !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Fatalf("expected BadRequest error, got %v", err)
+	}
+
+	var details []string
+	if aerr.Details == nil || json.Unmarshal(*aerr.Details, &details) != nil || len(details) != 1 || details[0] != "body.metadata: must not be null" {
+		t.Errorf("expected details of the invalid request, got %+v", aerr.Details)
+	}
+
+	// requests with the wrong token are forbidden
+	c = New(c.endpoint, WithToken("wrong"), WithRetries(0, 0))
+	if _, err = c.GetDataset(context.TODO(), "spintst", "dsgroup", "123"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrForbidden {
+		t.Errorf("expected Forbidden error, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests int
+	var requestID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		requestID = r.Header.Get("X-Request-ID")
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`["audit log message"]`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, WithRetries(3, time.Millisecond))
+
+	ctx := dataset.NewRequestIDContext(context.TODO(), "abc123")
+	logs, err := c.ListLogs(ctx, "spintst", "dsgroup", "123")
+	if err != nil {
+		t.Fatalf("expected nil error after retries, got %s", err)
+	}
+
+	if requests != 3 || len(logs) != 1 || logs[0] != "audit log message" {
+		t.Errorf("expected 3 requests and the audit log, got %d requests and %v", requests, logs)
+	}
+
+	if requestID != "abc123" {
+		t.Errorf("expected request id from the context, got %s", requestID)
+	}
+
+	// posts aren't retried if the api is unavailable
+	requests = 0
+	var aerr apierror.Error
+	if _, err = c.CreateUser(context.TODO(), "spintst", "dsgroup", "123"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected ServiceUnavailable error, got %v", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+
+	// the retries give up eventually
+	requests = -10
+	if _, err = c.ListLogs(context.TODO(), "spintst", "dsgroup", "123"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected ServiceUnavailable error, got %v", err)
+	}
+
+	if requests != -6 {
+		t.Errorf("expected 4 requests, got %d", requests+10)
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// CreateDatasetInput is the input to create a dataset
+type CreateDatasetInput struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Derivative bool              `json:"derivative"`
+	Tags       []*dataset.Tag    `json:"tags,omitempty"`
+	Metadata   *dataset.Metadata `json:"metadata,omitempty"`
+}
+
+// CreateDatasetOutput is the output of creating a dataset, with the name of the data repository
+type CreateDatasetOutput struct {
+	ID         string            `json:"id"`
+	Repository string            `json:"repository"`
+	Metadata   *dataset.Metadata `json:"metadata"`
+}
+
+// Dataset is the metadata and data repository of a dataset
+type Dataset struct {
+	ID         string              `json:"id"`
+	Metadata   *dataset.Metadata   `json:"metadata"`
+	Repository *dataset.Repository `json:"repository"`
+}
+
+// DatasetMetadata is the metadata of a dataset, returned when it's promoted or updated.  Promoting a dataset
+// returns the task that records the content manifest.
+type DatasetMetadata struct {
+	ID       string            `json:"id"`
+	Metadata *dataset.Metadata `json:"metadata"`
+	Task     *dataset.Task     `json:"task,omitempty"`
+}
+
+// CreateDataset creates a dataset in the account and group
+func (c *Client) CreateDataset(ctx context.Context, account, group string, input *CreateDatasetInput) (*CreateDatasetOutput, error) {
+	output := &CreateDatasetOutput{}
+	if err := c.doJSON(ctx, http.MethodPost, datasetPath(account, group, ""), input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// GetDataset gets the metadata and data repository of a dataset
+func (c *Client) GetDataset(ctx context.Context, account, group, id string) (*Dataset, error) {
+	output := &Dataset{}
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id), nil, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// PromoteDataset finalizes a dataset, promoting it to an original first if it's a derivative
+func (c *Client) PromoteDataset(ctx context.Context, account, group, id string) (*DatasetMetadata, error) {
+	output := &DatasetMetadata{}
+	if err := c.doJSON(ctx, http.MethodPatch, datasetPath(account, group, id), nil, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// UpdateDataset updates the metadata of a dataset
+func (c *Client) UpdateDataset(ctx context.Context, account, group, id string, metadata *dataset.Metadata) (*DatasetMetadata, error) {
+	input := struct {
+		Metadata *dataset.Metadata `json:"metadata"`
+	}{metadata}
+
+	output := &DatasetMetadata{}
+	if err := c.doJSON(ctx, http.MethodPut, datasetPath(account, group, id), &input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// DeleteDataset deletes a dataset
+func (c *Client) DeleteDataset(ctx context.Context, account, group, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, datasetPath(account, group, id), nil, nil)
+}
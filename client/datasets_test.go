@@ -0,0 +1,433 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestDatasets(t *testing.T) {
+	service, metadataRepo := newTestService()
+	publisher := &mockEventPublisher{events: make(chan *dataset.Event, 10)}
+	service.EventPublisher = publisher
+
+	c := serveTestAPI(t, service)
+	ctx := context.TODO()
+
+	created, err := c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{
+		Name:       "foo",
+		Type:       "s3",
+		Derivative: true,
+		Tags:       []*dataset.Tag{{Key: aws.String("Project"), Value: aws.String("bar")}},
+		Metadata:   &dataset.Metadata{Description: "some dataset", CreatedBy: "tester"},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error creating dataset, got %s", err)
+	}
+
+	if created.ID == "" || created.Repository != "dataset-"+created.ID {
+		t.Errorf("expected dataset id and repository, got %+v", created)
+	}
+
+	if created.Metadata == nil || created.Metadata.Name != "foo" || !created.Metadata.Derivative || created.Metadata.Description != "some dataset" {
+		t.Errorf("expected dataset metadata, got %+v", created.Metadata)
+	}
+
+	id := created.ID
+	out, err := c.GetDataset(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error getting dataset, got %s", err)
+	}
+
+	if out.ID != id || out.Metadata.Name != "foo" || out.Repository == nil || out.Repository.Name != "dataset-"+id {
+		t.Errorf("expected dataset %s with repository, got %+v", id, out)
+	}
+
+	updated, err := c.UpdateDataset(ctx, "spintst", "dsgroup", id, &dataset.Metadata{Description: "updated dataset"})
+	if err != nil {
+		t.Fatalf("expected nil error updating dataset, got %s", err)
+	}
+
+	if updated.Metadata.Description != "updated dataset" || updated.Metadata.ModifiedBy != "tester" {
+		t.Errorf("expected updated metadata, got %+v", updated.Metadata)
+	}
+
+	promoted, err := c.PromoteDataset(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error promoting dataset, got %s", err)
+	}
+
+	if promoted.Metadata.FinalizedAt == nil || promoted.Metadata.Derivative {
+		t.Errorf("expected finalized metadata, got %+v", promoted.Metadata)
+	}
+
+	if promoted.Task == nil || promoted.Task.Type != "manifest" {
+		t.Errorf("expected manifest task, got %+v", promoted.Task)
+	}
+
+	// the finalized event is published right away, the manifest created event once the content manifest is recorded
+	for finalized, manifest := false, false; !finalized || !manifest; {
+		select {
+		case event := <-publisher.events:
+			if event.DatasetID == id {
+				finalized = finalized || event.Type == dataset.EventDatasetFinalized
+				manifest = manifest || event.Type == dataset.EventManifestCreated
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the finalized and manifest created events")
+		}
+	}
+
+	if out, err = c.GetDataset(ctx, "spintst", "dsgroup", id); err != nil || out.Metadata.Manifest == nil {
+		t.Errorf("expected finalized metadata with manifest, got %+v (%v)", out, err)
+	}
+
+	var aerr apierror.Error
+	if _, err = c.PromoteDataset(ctx, "spintst", "dsgroup", id); !errors.As(err, &aerr) || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected Conflict error promoting finalized dataset, got %v", err)
+	}
+
+	if err = c.DeleteDataset(ctx, "spintst", "dsgroup", id); !errors.As(err, &aerr) || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected Conflict error deleting finalized dataset in its retention period, got %v", err)
+	}
+
+	created, err = c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{Name: "bar", Type: "s3"})
+	if err != nil {
+		t.Fatalf("expected nil error creating dataset, got %s", err)
+	}
+	id = created.ID
+
+	if err = c.DeleteDataset(ctx, "spintst", "dsgroup", id); err != nil {
+		t.Fatalf("expected nil error deleting dataset, got %s", err)
+	}
+
+	if _, ok := metadataRepo.metadata[id]; ok {
+		t.Errorf("expected metadata of dataset %s to be deleted", id)
+	}
+
+	if _, err = c.GetDataset(ctx, "spintst", "dsgroup", id); !errors.As(err, &aerr) || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound error for deleted dataset, got %v", err)
+	}
+
+	// the user is required to update datasets
+	c = New(c.endpoint, WithToken(c.token), WithRetries(0, 0))
+	if _, err = c.UpdateDataset(ctx, "spintst", "dsgroup", id, &dataset.Metadata{}); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error without user, got %v", err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	service, _ := newTestService()
+	publisher := &mockEventPublisher{events: make(chan *dataset.Event, 10)}
+	service.EventPublisher = publisher
+
+	c := serveTestAPI(t, service)
+	ctx := context.TODO()
+
+	created, err := c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{Name: "foo", Type: "s3"})
+	if err != nil {
+		t.Fatalf("expected nil error creating dataset, got %s", err)
+	}
+	id := created.ID
+
+	if err = c.CreateAttachment(ctx, "spintst", "dsgroup", id, "readme.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("expected nil error creating attachment, got %s", err)
+	}
+
+	attachments, err := c.ListAttachments(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error listing attachments, got %s", err)
+	}
+
+	if len(attachments) != 1 || attachments[0].Name != "readme.txt" || attachments[0].Size != 5 {
+		t.Errorf("expected readme.txt attachment, got %+v", attachments)
+	}
+
+	if err = c.DeleteAttachment(ctx, "spintst", "dsgroup", id, "readme.txt"); err != nil {
+		t.Fatalf("expected nil error deleting attachment, got %s", err)
+	}
+
+	if attachments, err = c.ListAttachments(ctx, "spintst", "dsgroup", id); err != nil || len(attachments) != 0 {
+		t.Errorf("expected no attachments, got %+v (%v)", attachments, err)
+	}
+
+	// the creation of the dataset and the attachment are published to the event publisher, in no particular order
+	events := map[string]*dataset.Event{}
+	for len(events) < 2 {
+		select {
+		case event := <-publisher.events:
+			events[event.Type] = event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, got %+v", events)
+		}
+	}
+
+	for _, e := range []string{dataset.EventDatasetCreated, dataset.EventAttachmentAdded} {
+		if event, ok := events[e]; !ok || event.DatasetID != id || event.Group != "dsgroup" || event.Account != "spintst" {
+			t.Errorf("expected %s event for dataset %s, got %+v", e, id, event)
+		}
+	}
+
+	if event := events[dataset.EventAttachmentAdded]; event == nil || event.Data["name"] != "readme.txt" || event.User != "tester" {
+		t.Errorf("expected readme.txt attachment added by tester, got %+v", event)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	c, _ := newTestAPI(t)
+	ctx := context.TODO()
+
+	created, err := c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{Name: "foo", Type: "s3", Derivative: true})
+	if err != nil {
+		t.Fatalf("expected nil error creating dataset, got %s", err)
+	}
+	id := created.ID
+
+	out, err := c.GrantInstanceAccess(ctx, "spintst", "dsgroup", id, &GrantInstanceAccessInput{InstanceID: "i-0123456789abcdef0", Permission: dataset.PermissionRead})
+	if err != nil {
+		t.Fatalf("expected nil error granting access, got %s", err)
+	}
+
+	if out.InstanceID != "i-0123456789abcdef0" || out.Permission != dataset.PermissionRead || out.Access["i-0123456789abcdef0"] == "" {
+		t.Errorf("expected read access for the instance, got %+v", out)
+	}
+
+	access, err := c.ListInstances(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error listing instances, got %s", err)
+	}
+
+	if len(access) != 1 || access["i-0123456789abcdef0"] != out.Access["i-0123456789abcdef0"] {
+		t.Errorf("expected access of the instance, got %+v", access)
+	}
+
+	if err = c.RevokeInstanceAccess(ctx, "spintst", "dsgroup", id, "i-0123456789abcdef0"); err != nil {
+		t.Fatalf("expected nil error revoking access, got %s", err)
+	}
+
+	var aerr apierror.Error
+	if err = c.RevokeInstanceAccess(ctx, "spintst", "dsgroup", id, "i-0123456789abcdef0"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error revoking access again, got %v", err)
+	}
+}
+
+func TestUsersAndLogs(t *testing.T) {
+	c, _ := newTestAPI(t)
+	ctx := context.TODO()
+
+	created, err := c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{Name: "foo", Type: "s3"})
+	if err != nil {
+		t.Fatalf("expected nil error creating dataset, got %s", err)
+	}
+	id := created.ID
+
+	user, err := c.CreateUser(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error creating user, got %s", err)
+	}
+
+	if user["UserName"] != "dataset-"+id || user["AccessKeyId"] != "AKIA1" {
+		t.Errorf("expected user credentials, got %+v", user)
+	}
+
+	updated, err := c.UpdateUser(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error updating user, got %s", err)
+	}
+
+	if updated["AccessKeyId"] != "AKIA2" {
+		t.Errorf("expected new access key, got %+v", updated)
+	}
+
+	users, err := c.ListUsers(ctx, "spintst", "dsgroup", id)
+	if err != nil {
+		t.Fatalf("expected nil error listing users, got %s", err)
+	}
+
+	if _, ok := users["dataset-"+id]; !ok || len(users) != 1 {
+		t.Errorf("expected dataset user, got %+v", users)
+	}
+
+	if err = c.DeleteUser(ctx, "spintst", "dsgroup", id); err != nil {
+		t.Fatalf("expected nil error deleting user, got %s", err)
+	}
+
+	// audit log messages are written in the background
+	var logs []string
+	for i := 0; i < 50; i++ {
+		if logs, err = c.ListLogs(ctx, "spintst", "dsgroup", id); err != nil {
+			t.Fatalf("expected nil error listing logs, got %s", err)
+		}
+
+		if len(logs) >= 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(logs) < 4 || !strings.HasPrefix(logs[0], "Created dataset "+id) {
+		t.Errorf("expected audit log messages of the dataset, got %v", logs)
+	}
+}
+
+func TestBatchDatasets(t *testing.T) {
+	c, _ := newTestAPI(t)
+	ctx := context.TODO()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, err := c.CreateDataset(ctx, "spintst", "dsgroup", &CreateDatasetInput{Name: "foo", Type: "s3", Derivative: true})
+		if err != nil {
+			t.Fatalf("expected nil error creating dataset, got %s", err)
+		}
+		ids = append(ids, created.ID)
+
+		if _, err = c.GrantInstanceAccess(ctx, "spintst", "dsgroup", created.ID, &GrantInstanceAccessInput{InstanceID: "i-0123456789abcdef0"}); err != nil {
+			t.Fatalf("expected nil error granting access, got %s", err)
+		}
+	}
+
+	if _, err := c.CreateUser(ctx, "spintst", "dsgroup", ids[0]); err != nil {
+		t.Fatalf("expected nil error creating user, got %s", err)
+	}
+
+	out, err := c.BatchDatasets(ctx, "spintst", "dsgroup", &BatchDatasetsInput{IDs: append(ids, "missing"), Action: BatchActionRevokeAccess})
+	if err != nil {
+		t.Fatalf("expected nil error revoking access, got %s", err)
+	}
+
+	if out.Action != BatchActionRevokeAccess || out.Succeeded != 3 || out.Failed != 1 || len(out.Results) != 4 {
+		t.Fatalf("expected 3 succeeded and 1 failed result, got %+v", out)
+	}
+
+	for i, id := range ids {
+		if out.Results[i].ID != id || out.Results[i].Status != "succeeded" {
+			t.Errorf("expected succeeded result for %s, got %+v", id, out.Results[i])
+		}
+
+		if access, err := c.ListInstances(ctx, "spintst", "dsgroup", id); err != nil || len(access) != 0 {
+			t.Errorf("expected no access to dataset %s, got %+v (%v)", id, access, err)
+		}
+	}
+
+	if r := out.Results[3]; r.ID != "missing" || r.Status != "failed" || r.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound result for missing dataset, got %+v", r)
+	}
+
+	// datasets without users are skipped
+	if out, err = c.BatchDatasets(ctx, "spintst", "dsgroup", &BatchDatasetsInput{IDs: ids, Action: BatchActionRotateKeys}); err != nil || out.Succeeded != 3 {
+		t.Fatalf("expected 3 succeeded results rotating keys, got %+v (%v)", out, err)
+	}
+
+	if users, err := c.ListUsers(ctx, "spintst", "dsgroup", ids[0]); err != nil || !reflect.DeepEqual(users["dataset-"+ids[0]], []interface{}{"AKIA2"}) {
+		t.Errorf("expected rotated access key, got %+v (%v)", users, err)
+	}
+
+	// the test data repository can't be tagged
+	out, err = c.BatchDatasets(ctx, "spintst", "dsgroup", &BatchDatasetsInput{
+		IDs:    ids[:1],
+		Action: BatchActionTag,
+		Tags:   []*dataset.Tag{{Key: aws.String("Project"), Value: aws.String("bar")}},
+	})
+	if err != nil || out.Failed != 1 || out.Results[0].Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest result tagging dataset, got %+v (%v)", out, err)
+	}
+
+	var aerr apierror.Error
+	if _, err = c.BatchDatasets(ctx, "spintst", "dsgroup", &BatchDatasetsInput{IDs: ids, Action: "explode"}); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error for invalid action, got %v", err)
+	}
+
+	if _, err = c.BatchDatasets(ctx, "spintst", "dsgroup", &BatchDatasetsInput{IDs: ids, Action: BatchActionTag}); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error tagging without tags, got %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	service, _ := newTestService()
+	repo := service.WebhookRepository.(*mockWebhookRepository)
+
+	c := serveTestAPI(t, service)
+	ctx := context.TODO()
+
+	// a local receiver, events can't be delivered to loopback addresses
+	received := make(chan struct{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	var aerr apierror.Error
+	if _, err := c.CreateWebhook(ctx, "spintst", "dsgroup", &CreateWebhookInput{URL: strings.Replace(receiver.URL, "http://", "https://", 1)}); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error for loopback url, got %v", err)
+	}
+
+	created, err := c.CreateWebhook(ctx, "spintst", "dsgroup", &CreateWebhookInput{URL: "https://93.184.216.34/hooks", Events: []string{dataset.EventDatasetCreated, dataset.EventDatasetDeleted}})
+	if err != nil {
+		t.Fatalf("expected nil error creating webhook, got %s", err)
+	}
+
+	if created.ID == "" || created.Secret == "" || created.CreatedBy != "tester" {
+		t.Errorf("expected webhook with generated secret, got %+v", created)
+	}
+
+	list, err := c.ListWebhooks(ctx, "spintst", "dsgroup")
+	if err != nil || len(list) != 1 || list[0].ID != created.ID || list[0].Secret != "" {
+		t.Errorf("expected webhook without secret, got %+v (%v)", list, err)
+	}
+
+	// a webhook whose host resolves to a loopback address after it was registered, its dead letters can be
+	// listed, but redelivering them is refused before connecting
+	local := &dataset.Webhook{ID: "local", Group: "dsgroup", URL: receiver.URL, Secret: "s3cr3t"}
+	if err = repo.PutWebhook(ctx, "spintst", local); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	event := dataset.NewEvent(ctx, dataset.EventDatasetDeleted, "spintst", "dsgroup", "abc", "tester", nil)
+	if err = repo.PutDeadLetter(ctx, "spintst", &dataset.DeadLetter{ID: "dl1", WebhookID: local.ID, Group: "dsgroup", Event: event, Attempts: 1, Error: "boom", FailedAt: &now}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters, err := c.ListDeadLetters(ctx, "spintst", "dsgroup", local.ID)
+	if err != nil || len(deadLetters) != 1 || deadLetters[0].Event.ID != event.ID || deadLetters[0].Attempts != 1 {
+		t.Fatalf("expected dead letter of dataset.deleted event, got %+v (%v)", deadLetters, err)
+	}
+
+	if err = c.RedeliverDeadLetter(ctx, "spintst", "dsgroup", local.ID, "dl1"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected ServiceUnavailable error redelivering to loopback address, got %v", err)
+	}
+
+	if len(received) != 0 {
+		t.Error("expected no deliveries to the loopback receiver")
+	}
+
+	if deadLetters, err = c.ListDeadLetters(ctx, "spintst", "dsgroup", local.ID); err != nil || len(deadLetters) != 1 {
+		t.Errorf("expected dead letter to be kept after failed redelivery, got %+v (%v)", deadLetters, err)
+	}
+
+	if err = c.RedeliverDeadLetter(ctx, "spintst", "dsgroup", local.ID, "dl2"); !errors.As(err, &aerr) || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound error redelivering missing dead letter, got %v", err)
+	}
+
+	if _, err = c.CreateWebhook(ctx, "spintst", "dsgroup", &CreateWebhookInput{URL: "ftp://example.com"}); !errors.As(err, &aerr) || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected BadRequest error for invalid url, got %v", err)
+	}
+
+	if err = c.DeleteWebhook(ctx, "spintst", "dsgroup", created.ID); err != nil {
+		t.Fatalf("expected nil error deleting webhook, got %s", err)
+	}
+
+	if err = c.DeleteWebhook(ctx, "spintst", "dsgroup", created.ID); !errors.As(err, &aerr) || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound error deleting missing webhook, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// GrantInstanceAccessInput is the input to grant an instance access to a dataset.  The permission defaults to
+// write for derivatives that aren't finalized and read otherwise, grants without a duration don't expire.
+type GrantInstanceAccessInput struct {
+	InstanceID string `json:"instance_id"`
+	Permission string `json:"permission,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+}
+
+// InstanceAccess is the access of an instance to a dataset
+type InstanceAccess struct {
+	InstanceID string         `json:"instance_id"`
+	Access     dataset.Access `json:"access"`
+	Permission string         `json:"permission"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+}
+
+// ListInstances lists the instances that have access to a dataset
+func (c *Client) ListInstances(ctx context.Context, account, group, id string) (dataset.Access, error) {
+	output := struct {
+		ID     string         `json:"id"`
+		Access dataset.Access `json:"access"`
+	}{}
+
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id, "instances"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output.Access, nil
+}
+
+// GrantInstanceAccess grants an instance access to a dataset
+func (c *Client) GrantInstanceAccess(ctx context.Context, account, group, id string, input *GrantInstanceAccessInput) (*InstanceAccess, error) {
+	output := &InstanceAccess{}
+	if err := c.doJSON(ctx, http.MethodPost, datasetPath(account, group, id, "instances"), input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// RevokeInstanceAccess revokes the access of an instance to a dataset
+func (c *Client) RevokeInstanceAccess(ctx context.Context, account, group, id, instanceID string) error {
+	return c.doJSON(ctx, http.MethodDelete, datasetPath(account, group, id, "instances", instanceID), nil, nil)
+}
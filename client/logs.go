@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// ListLogs lists the audit log messages of a dataset
+func (c *Client) ListLogs(ctx context.Context, account, group, id string) ([]string, error) {
+	output := []string{}
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id, "logs"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// GetAccessReport gets who accessed the data of a dataset, from the access logs ingested so far
+func (c *Client) GetAccessReport(ctx context.Context, account, group, id string) (*dataset.AccessReport, error) {
+	output := &dataset.AccessReport{}
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id, "accessreport"), nil, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
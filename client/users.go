@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListUsers lists the users of a dataset
+func (c *Client) ListUsers(ctx context.Context, account, group, id string) (map[string]interface{}, error) {
+	output := map[string]interface{}{}
+	if err := c.doJSON(ctx, http.MethodGet, datasetPath(account, group, id, "users"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// CreateUser creates a user for a dataset and returns its credentials
+func (c *Client) CreateUser(ctx context.Context, account, group, id string) (map[string]interface{}, error) {
+	output := map[string]interface{}{}
+	if err := c.doJSON(ctx, http.MethodPost, datasetPath(account, group, id, "users"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// UpdateUser rotates the access keys of the users of a dataset and returns the new credentials
+func (c *Client) UpdateUser(ctx context.Context, account, group, id string) (map[string]interface{}, error) {
+	output := map[string]interface{}{}
+	if err := c.doJSON(ctx, http.MethodPut, datasetPath(account, group, id, "users"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// DeleteUser deletes the users of a dataset
+func (c *Client) DeleteUser(ctx context.Context, account, group, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, datasetPath(account, group, id, "users"), nil, nil)
+}
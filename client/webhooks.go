@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// CreateWebhookInput is the input to subscribe a webhook to the dataset events of a group.  Without events, the
+// webhook receives all events.  A secret is generated if none is given.
+type CreateWebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// webhookPath returns the escaped path of the webhooks of a group, followed by the optional sub resource elements
+func webhookPath(account, group string, elem ...string) string {
+	parts := []string{url.PathEscape(account), "webhooks", url.PathEscape(group)}
+	for _, e := range elem {
+		parts = append(parts, url.PathEscape(e))
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
+
+// ListWebhooks lists the webhooks subscribed to the events of a group, without their secrets
+func (c *Client) ListWebhooks(ctx context.Context, account, group string) ([]*dataset.Webhook, error) {
+	output := struct {
+		Group    string             `json:"group"`
+		Webhooks []*dataset.Webhook `json:"webhooks"`
+	}{}
+
+	if err := c.doJSON(ctx, http.MethodGet, webhookPath(account, group), nil, &output); err != nil {
+		return nil, err
+	}
+	return output.Webhooks, nil
+}
+
+// CreateWebhook subscribes a webhook to the dataset events of a group.  The secret of the webhook is only returned
+// by this call.
+func (c *Client) CreateWebhook(ctx context.Context, account, group string, input *CreateWebhookInput) (*dataset.Webhook, error) {
+	output := &dataset.Webhook{}
+	if err := c.doJSON(ctx, http.MethodPost, webhookPath(account, group), input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// DeleteWebhook deletes a webhook and its dead letters
+func (c *Client) DeleteWebhook(ctx context.Context, account, group, webhookID string) error {
+	return c.doJSON(ctx, http.MethodDelete, webhookPath(account, group, webhookID), nil, nil)
+}
+
+// ListDeadLetters lists the events that couldn't be delivered to a webhook
+func (c *Client) ListDeadLetters(ctx context.Context, account, group, webhookID string) ([]*dataset.DeadLetter, error) {
+	output := struct {
+		WebhookID   string                `json:"webhook_id"`
+		DeadLetters []*dataset.DeadLetter `json:"dead_letters"`
+	}{}
+
+	if err := c.doJSON(ctx, http.MethodGet, webhookPath(account, group, webhookID, "deadletters"), nil, &output); err != nil {
+		return nil, err
+	}
+	return output.DeadLetters, nil
+}
+
+// RedeliverDeadLetter makes another attempt to deliver an event to a webhook, the dead letter is deleted once the
+// event is delivered
+func (c *Client) RedeliverDeadLetter(ctx context.Context, account, group, webhookID, deadLetterID string) error {
+	return c.doJSON(ctx, http.MethodPost, webhookPath(account, group, webhookID, "deadletters", deadLetterID), nil, nil)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -43,6 +44,7 @@ func NewSession(region, akid, secret string) CloudWatchLogs {
 		Credentials: credentials.NewStaticCredentials(akid, secret, ""),
 		Region:      aws.String(region),
 	}))
+	sess.Handlers.Build.PushBackNamed(dataset.RequestIDHandler)
 	c.Service = cloudwatchlogs.New(sess)
 	return c
 }
@@ -59,12 +61,12 @@ func (c *CloudWatchLogs) GetLogEvents(ctx context.Context, group, stream string)
 	})
 	if err != nil {
 		msg := fmt.Sprintf("failed to get log events for %s/%s", group, stream)
-		log.Error(msg, err)
+		log.WithContext(ctx).Error(msg, err)
 		return nil, ErrCode(msg, err)
 	}
 
 	l := len(output.Events)
-	log.Debugf("got %d event(s)", l)
+	log.WithContext(ctx).Debugf("got %d event(s)", l)
 
 	logEvents := make([]*Event, l)
 	for i, e := range output.Events {
@@ -155,7 +157,7 @@ func (c *CloudWatchLogs) CreateLogGroup(ctx context.Context, group string, tags
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case cloudwatchlogs.ErrCodeResourceAlreadyExistsException:
-				log.Warnf("cloudwatch log group (%s) already exists, continuing: (%s)", group, err)
+				log.WithContext(ctx).Warnf("cloudwatch log group (%s) already exists, continuing: (%s)", group, err)
 			default:
 				msg := fmt.Sprintf("failed to create log group (%s)", group)
 				return ErrCode(msg, err)
@@ -213,7 +215,7 @@ func (c *CloudWatchLogs) CreateLogStream(ctx context.Context, group, stream stri
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case cloudwatchlogs.ErrCodeResourceAlreadyExistsException:
-				log.Warnf("cloudwatch log stream (%s/%s) already exists, continuing: (%s)", group, stream, err)
+				log.WithContext(ctx).Warnf("cloudwatch log stream (%s/%s) already exists, continuing: (%s)", group, stream, err)
 			default:
 				msg := fmt.Sprintf("failed to create log stream (%s/%s)", group, stream)
 				return ErrCode(msg, err)
@@ -268,7 +270,7 @@ func (c *CloudWatchLogs) LogEvent(ctx context.Context, group, stream string, eve
 		return ErrCode("failed to put log events", err)
 	}
 
-	log.Debugf("output for put log events: %+v", out)
+	log.WithContext(ctx).Debugf("output for put log events: %+v", out)
 
 	return nil
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func attachmentList(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("attachments list"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.ListAttachments(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED")
+		for _, a := range out {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", a.Name, a.Size, a.Modified.Format(time.RFC3339))
+		}
+	})
+}
+
+func attachmentUpload(ctx context.Context, c *cli, args []string) error {
+	flags := c.newFlags("attachments upload")
+	name := flags.String("name", "", "name of the attachment, defaults to the file name")
+
+	args, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = filepath.Base(args[1])
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := c.client.CreateAttachment(ctx, c.account, c.group, args[0], *name, f); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "uploaded attachment %s to dataset %s\n", *name, args[0])
+	return nil
+}
+
+func attachmentDelete(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("attachments delete"), args, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteAttachment(ctx, c.account, c.group, args[0], args[1]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "deleted attachment %s from dataset %s\n", args[1], args[0])
+	return nil
+}
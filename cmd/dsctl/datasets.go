@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/client"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// tagsFlag collects repeated -tag key=value flags
+type tagsFlag []*dataset.Tag
+
+func (t *tagsFlag) String() string {
+	tags := make([]string, len(*t))
+	for i, tag := range *t {
+		tags[i] = aws.StringValue(tag.Key) + "=" + aws.StringValue(tag.Value)
+	}
+	return strings.Join(tags, ",")
+}
+
+func (t *tagsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid tag '%s', must be KEY=VALUE", value)
+	}
+
+	*t = append(*t, &dataset.Tag{Key: aws.String(parts[0]), Value: aws.String(parts[1])})
+	return nil
+}
+
+func datasetCreate(ctx context.Context, c *cli, args []string) error {
+	var tags tagsFlag
+	flags := c.newFlags("datasets create")
+	name := flags.String("name", "", "name of the dataset")
+	dataType := flags.String("type", "s3", "type of the data repository")
+	derivative := flags.Bool("derivative", false, "create a derivative dataset")
+	description := flags.String("description", "", "description of the dataset")
+	flags.Var(&tags, "tag", "tag of the data repository as KEY=VALUE, can be repeated")
+
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+
+	out, err := c.client.CreateDataset(ctx, c.account, c.group, &client.CreateDatasetInput{
+		Name:       *name,
+		Type:       *dataType,
+		Derivative: *derivative,
+		Tags:       tags,
+		Metadata:   &dataset.Metadata{Description: *description},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) {
+		fmt.Fprintf(w, "Repository\t%s\n", out.Repository)
+		printMetadata(w, out.Metadata)
+	})
+}
+
+func datasetShow(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("datasets show"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.GetDataset(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) {
+		printMetadata(w, out.Metadata)
+		if out.Repository != nil {
+			fmt.Fprintf(w, "Repository\t%s\n", out.Repository.Name)
+			fmt.Fprintf(w, "Empty\t%t\n", out.Repository.Empty)
+			for _, t := range out.Repository.Tags {
+				fmt.Fprintf(w, "Tag\t%s=%s\n", aws.StringValue(t.Key), aws.StringValue(t.Value))
+			}
+		}
+	})
+}
+
+func datasetUpdate(ctx context.Context, c *cli, args []string) error {
+	flags := c.newFlags("datasets update")
+	description := flags.String("description", "", "new description of the dataset")
+
+	args, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if *description == "" {
+		return fmt.Errorf("-description is required")
+	}
+
+	out, err := c.client.UpdateDataset(ctx, c.account, c.group, args[0], &dataset.Metadata{Description: *description})
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printMetadata(w, out.Metadata) })
+}
+
+func datasetPromote(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("datasets promote"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.PromoteDataset(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printMetadata(w, out.Metadata) })
+}
+
+func datasetDelete(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("datasets delete"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteDataset(ctx, c.account, c.group, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "deleted dataset %s\n", args[0])
+	return nil
+}
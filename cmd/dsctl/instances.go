@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/client"
+)
+
+func instanceList(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("instances list"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.ListInstances(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printAccess(w, out) })
+}
+
+func instanceGrant(ctx context.Context, c *cli, args []string) error {
+	flags := c.newFlags("instances grant")
+	permission := flags.String("permission", "", "read or write, defaults to write for derivatives that aren't finalized and read otherwise")
+	duration := flags.String("duration", "", "duration of the grant, ie. 24h, grants without a duration don't expire")
+
+	args, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.GrantInstanceAccess(ctx, c.account, c.group, args[0], &client.GrantInstanceAccessInput{
+		InstanceID: args[1],
+		Permission: *permission,
+		Duration:   *duration,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) {
+		fmt.Fprintf(w, "Instance\t%s\n", out.InstanceID)
+		fmt.Fprintf(w, "Permission\t%s\n", out.Permission)
+		if out.ExpiresAt != nil {
+			fmt.Fprintf(w, "Expires\t%s\n", out.ExpiresAt.Format(time.RFC3339))
+		}
+		for _, role := range out.Access {
+			fmt.Fprintf(w, "Access\t%s\n", role)
+		}
+	})
+}
+
+func instanceRevoke(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("instances revoke"), args, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.RevokeInstanceAccess(ctx, c.account, c.group, args[0], args[1]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "revoked access of instance %s to dataset %s\n", args[1], args[0])
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// logTail prints the audit log of a dataset.  When following, the log is polled and new messages are printed until
+// the command is interrupted.
+func logTail(ctx context.Context, c *cli, args []string) error {
+	flags := c.newFlags("logs tail")
+	follow := flags.Bool("f", false, "keep following new audit log messages")
+	interval := flags.Duration("interval", 10*time.Second, "how often the audit log is polled when following")
+
+	args, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if *interval <= 0 {
+		return fmt.Errorf("-interval must be positive")
+	}
+
+	printed := 0
+	for {
+		logs, err := c.client.ListLogs(ctx, c.account, c.group, args[0])
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		// the audit log only grows, so everything past the printed messages is new
+		if printed > len(logs) {
+			printed = 0
+		}
+
+		for _, msg := range logs[printed:] {
+			if c.output == "json" {
+				j, _ := json.Marshal(msg)
+				fmt.Fprintln(c.stdout, string(j))
+			} else {
+				fmt.Fprintln(c.stdout, msg)
+			}
+		}
+		printed = len(logs)
+
+		if !*follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// logAccess prints the access report of a dataset, a row for each principal that accessed its data
+func logAccess(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("logs access"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.GetAccessReport(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) {
+		fmt.Fprintln(w, "PRINCIPAL\tTYPE\tREADS\tWRITES\tDELETES\tDENIED\tBYTES READ\tLAST ACCESS")
+		for _, p := range out.Principals {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", p.Principal, p.PrincipalType, p.Reads, p.Writes, p.Deletes, p.Denied, p.BytesRead, byline(p.LastAccess, ""))
+		}
+	})
+}
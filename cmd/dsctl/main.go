@@ -0,0 +1,244 @@
+// dsctl is a command line tool for operators of the ds-api.  It wraps the api routes with commands to manage
+// datasets, attachments, instance access and users, and to read audit logs and access reports.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/client"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// Version is the main version number
+	Version = "0.0.0"
+
+	// VersionPrerelease is a prerelease marker
+	VersionPrerelease = ""
+)
+
+// errUsage is returned for invalid command lines, after the usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// cli is the state shared by the commands
+type cli struct {
+	client  *client.Client
+	account string
+	group   string
+	output  string
+	usage   string
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// command is a dsctl sub command
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, c *cli, args []string) error
+}
+
+// commands are the sub commands, keyed by resource and action
+var commands = map[string]map[string]command{
+	"datasets": {
+		"create":  {"-name NAME [-type s3] [-derivative] [-description TEXT] [-tag KEY=VALUE]...", "create a dataset", datasetCreate},
+		"show":    {"ID", "show the metadata and data repository of a dataset", datasetShow},
+		"update":  {"ID -description TEXT", "update the description of a dataset", datasetUpdate},
+		"promote": {"ID", "finalize a dataset, promoting it to an original if it's a derivative", datasetPromote},
+		"delete":  {"ID", "delete an empty dataset", datasetDelete},
+	},
+	"attachments": {
+		"list":   {"ID", "list the attachments of a dataset", attachmentList},
+		"upload": {"ID FILE [-name NAME]", "upload an attachment for a dataset", attachmentUpload},
+		"delete": {"ID NAME", "delete an attachment from a dataset", attachmentDelete},
+	},
+	"instances": {
+		"list":   {"ID", "list the instances that have access to a dataset", instanceList},
+		"grant":  {"ID INSTANCE_ID [-permission read|write] [-duration DURATION]", "grant an instance access to a dataset", instanceGrant},
+		"revoke": {"ID INSTANCE_ID", "revoke the access of an instance to a dataset", instanceRevoke},
+	},
+	"users": {
+		"list":   {"ID", "list the users of a dataset", userList},
+		"create": {"ID", "create a user for a dataset", userCreate},
+		"rotate": {"ID", "rotate the access keys of the users of a dataset", userRotate},
+		"delete": {"ID", "delete the users of a dataset", userDelete},
+	},
+	"logs": {
+		"tail":   {"ID [-f] [-interval DURATION]", "print the audit log of a dataset, -f keeps following new messages", logTail},
+		"access": {"ID", "print who accessed the data of a dataset, from its access logs", logAccess},
+	},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "dsctl: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and runs the sub command
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("dsctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { usage(flags, stderr) }
+
+	endpoint := flags.String("endpoint", os.Getenv("DSCTL_ENDPOINT"), "url of the api, ie. https://ds.example.edu/v1/ds (DSCTL_ENDPOINT)")
+	token := flags.String("token", os.Getenv("DSCTL_TOKEN"), "pre-shared api token, it's hashed before it's sent (DSCTL_TOKEN)")
+	clientName := flags.String("client", os.Getenv("DSCTL_CLIENT"), "name of the api client to authenticate as, instead of the token (DSCTL_CLIENT)")
+	secret := flags.String("secret", os.Getenv("DSCTL_CLIENT_SECRET"), "secret of the api client (DSCTL_CLIENT_SECRET)")
+	bearer := flags.String("bearer-token", os.Getenv("DSCTL_BEARER_TOKEN"), "bearer token to authenticate with, instead of the token (DSCTL_BEARER_TOKEN)")
+	user := flags.String("user", env("DSCTL_USER", os.Getenv("USER")), "user recorded as the modifier of datasets (DSCTL_USER)")
+	account := flags.String("account", os.Getenv("DSCTL_ACCOUNT"), "account of the datasets (DSCTL_ACCOUNT)")
+	group := flags.String("group", os.Getenv("DSCTL_GROUP"), "group of the datasets (DSCTL_GROUP)")
+	output := flags.String("o", "table", "output format, table or json")
+	version := flags.Bool("version", false, "display version information and exit")
+
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if *version {
+		fmt.Fprintf(stdout, "dsctl version %s%s\n", Version, VersionPrerelease)
+		return nil
+	}
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "invalid output format '%s', must be table or json\n", *output)
+		return errUsage
+	}
+
+	args = flags.Args()
+	if len(args) < 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command '%s'\n\n", strings.Join(args[:2], " "))
+		flags.Usage()
+		return errUsage
+	}
+
+	required := map[string]string{"endpoint": *endpoint, "account": *account, "group": *group}
+	switch {
+	case *bearer != "":
+	case *clientName != "":
+		required["secret"] = *secret
+	default:
+		required["token"] = *token
+	}
+
+	var missing []string
+	for name, value := range required {
+		if value == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s required", strings.Join(missing, ", "))
+	}
+
+	opts := []client.Option{client.WithUser(*user)}
+	switch {
+	case *bearer != "":
+		opts = append(opts, client.WithBearerToken(*bearer))
+	case *clientName != "":
+		opts = append(opts, client.WithClient(*clientName, *secret))
+	default:
+		// the api compares the bcrypt hash of the token with its pre-shared key
+		hash, err := bcrypt.GenerateFromPassword([]byte(*token), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash token: %s", err)
+		}
+		opts = append(opts, client.WithToken(string(hash)))
+	}
+
+	c := &cli{
+		client:  client.New(*endpoint, opts...),
+		account: *account,
+		group:   *group,
+		output:  *output,
+		usage:   cmd.usage,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	return cmd.run(ctx, c, args[2:])
+}
+
+// usage prints the global flags and the sub commands
+func usage(flags *flag.FlagSet, w io.Writer) {
+	fmt.Fprintf(w, "Usage: dsctl [flags] RESOURCE ACTION [ARGS]\n\nFlags:\n")
+	flags.PrintDefaults()
+	fmt.Fprintf(w, "\nCommands:\n")
+
+	resources := make([]string, 0, len(commands))
+	for r := range commands {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+
+	for _, r := range resources {
+		actions := make([]string, 0, len(commands[r]))
+		for a := range commands[r] {
+			actions = append(actions, a)
+		}
+		sort.Strings(actions)
+
+		for _, a := range actions {
+			cmd := commands[r][a]
+			fmt.Fprintf(w, "  %s %s %s\n    \t%s\n", r, a, cmd.usage, cmd.description)
+		}
+	}
+}
+
+// parseArgs parses the flags of a sub command, which can be mixed with its arguments, and returns the arguments.
+// The usage of the sub command is printed unless there are exactly n arguments.
+func parseArgs(flags *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != n {
+		fmt.Fprintf(flags.Output(), "expected %d arguments, got %d\n", n, len(positional))
+		flags.Usage()
+		return nil, errUsage
+	}
+
+	return positional, nil
+}
+
+// env returns the value of the environment variable, or the default if it's empty
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testAPI is a fake api that records the requests and responds with canned json
+type testAPI struct {
+	mu        sync.Mutex
+	requests  []*http.Request
+	bodies    []string
+	responses map[string]string
+}
+
+func (a *testAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, r)
+	a.bodies = append(a.bodies, string(body))
+
+	resp, ok := a.responses[r.Method+" "+r.URL.Path]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"NotFound","message":"dataset not found","request_id":"abc123"}`))
+		return
+	}
+
+	if resp == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(resp))
+}
+
+func (a *testAPI) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.requests)
+}
+
+func runTest(t *testing.T, api *testAPI, args ...string) (string, string, error) {
+	ts := httptest.NewServer(api)
+	t.Cleanup(ts.Close)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	args = append([]string{"-endpoint", ts.URL + "/v1/ds", "-token", "s3cr3t", "-user", "tester", "-account", "spintst", "-group", "dsgroup"}, args...)
+	err := run(context.TODO(), args, stdout, stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestRunUsage(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	if err := run(context.TODO(), []string{}, stdout, stderr); err != errUsage || !strings.Contains(stderr.String(), "Commands:") {
+		t.Errorf("expected usage error and commands, got %v and %s", err, stderr)
+	}
+
+	stderr.Reset()
+	if err := run(context.TODO(), []string{"datasets", "explode"}, stdout, stderr); err != errUsage || !strings.Contains(stderr.String(), "unknown command 'datasets explode'") {
+		t.Errorf("expected unknown command error, got %v and %s", err, stderr)
+	}
+
+	stderr.Reset()
+	if err := run(context.TODO(), []string{"-o", "yaml", "datasets", "show", "123"}, stdout, stderr); err != errUsage {
+		t.Errorf("expected usage error for invalid output format, got %v", err)
+	}
+
+	err := run(context.TODO(), []string{"-endpoint", "http://localhost", "-token", "", "-account", "", "-group", "g", "datasets", "show", "123"}, stdout, stderr)
+	if err == nil || err.Error() != "-account, -token required" {
+		t.Errorf("expected missing flags error, got %v", err)
+	}
+
+	err = run(context.TODO(), []string{"-endpoint", "http://localhost", "-client", "portal", "-account", "a", "-group", "g", "datasets", "show", "123"}, stdout, stderr)
+	if err == nil || err.Error() != "-secret required" {
+		t.Errorf("expected missing secret error, got %v", err)
+	}
+
+	_, stderr2, err := runTest(t, &testAPI{}, "instances", "grant", "123")
+	if err != errUsage || !strings.Contains(stderr2, "Usage: dsctl instances grant ID INSTANCE_ID") {
+		t.Errorf("expected usage of instances grant, got %v and %s", err, stderr2)
+	}
+}
+
+func TestDatasetShow(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"GET /v1/ds/spintst/datasets/dsgroup/123": `{"id":"123","metadata":{"id":"123","name":"foo","description":"some dataset","created_at":"2023-01-02T03:04:05Z","created_by":"tester","data_storage":"s3","derivative":true},"repository":{"name":"dataset-123","empty":false,"tags":[{"key":"Name","value":"foo"}]}}`,
+	}}
+
+	stdout, _, err := runTest(t, api, "datasets", "show", "123")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	for _, line := range []string{"Name             foo", "Created          2023-01-02T03:04:05Z by tester", "Repository       dataset-123", "Tag              Name=foo"} {
+		if !strings.Contains(stdout, line+"\n") {
+			t.Errorf("expected table output to contain '%s', got\n%s", line, stdout)
+		}
+	}
+
+	r := api.requests[0]
+	if err := bcrypt.CompareHashAndPassword([]byte(r.Header.Get("X-Auth-Token")), []byte("s3cr3t")); err != nil {
+		t.Errorf("expected X-Auth-Token to be the bcrypt hash of the token, got %s", r.Header.Get("X-Auth-Token"))
+	}
+
+	if r.Header.Get("X-Forwarded-User") != "tester" {
+		t.Errorf("expected X-Forwarded-User tester, got %s", r.Header.Get("X-Forwarded-User"))
+	}
+
+	stdout, _, err = runTest(t, api, "-o", "json", "datasets", "show", "123")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	out := struct {
+		ID         string `json:"id"`
+		Repository struct {
+			Name string `json:"name"`
+		} `json:"repository"`
+	}{}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out.ID != "123" || out.Repository.Name != "dataset-123" {
+		t.Errorf("expected json output of the dataset, got %s (%v)", stdout, err)
+	}
+
+	if _, _, err = runTest(t, api, "datasets", "show", "456"); err == nil || !strings.HasPrefix(err.Error(), "NotFound: dataset not found") {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"GET /v1/ds/spintst/datasets/dsgroup/123": `{"id":"123","metadata":{"id":"123","name":"foo"}}`,
+	}}
+
+	if _, _, err := runTest(t, api, "-client", "portal", "-secret", "clientsecret", "datasets", "show", "123"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	r := api.requests[0]
+	if r.Header.Get("X-Auth-Client") != "portal" || r.Header.Get("X-Auth-Token") != "clientsecret" {
+		t.Errorf("expected api client headers, got X-Auth-Client %s and X-Auth-Token %s", r.Header.Get("X-Auth-Client"), r.Header.Get("X-Auth-Token"))
+	}
+
+	if _, _, err := runTest(t, api, "-bearer-token", "jwt", "datasets", "show", "123"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	r = api.requests[1]
+	if r.Header.Get("Authorization") != "Bearer jwt" || r.Header.Get("X-Auth-Token") != "" {
+		t.Errorf("expected only the bearer token, got Authorization %s and X-Auth-Token %s", r.Header.Get("Authorization"), r.Header.Get("X-Auth-Token"))
+	}
+}
+
+func TestDatasetCreate(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"POST /v1/ds/spintst/datasets/dsgroup": `{"id":"123","repository":"dataset-123","metadata":{"id":"123","name":"foo","data_storage":"s3","derivative":true}}`,
+	}}
+
+	stdout, _, err := runTest(t, api, "datasets", "create", "-name", "foo", "-derivative", "-tag", "Project=bar")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !strings.Contains(stdout, "Repository       dataset-123\n") {
+		t.Errorf("expected repository in output, got\n%s", stdout)
+	}
+
+	input := struct {
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		Derivative bool   `json:"derivative"`
+		Tags       []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"tags"`
+	}{}
+	if err := json.Unmarshal([]byte(api.bodies[0]), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	if input.Name != "foo" || input.Type != "s3" || !input.Derivative || len(input.Tags) != 1 || input.Tags[0].Key != "Project" || input.Tags[0].Value != "bar" {
+		t.Errorf("expected create dataset input, got %s", api.bodies[0])
+	}
+
+	if _, _, err = runTest(t, api, "datasets", "create", "-tag", "novalue"); err != errUsage {
+		t.Errorf("expected usage error for invalid tag, got %v", err)
+	}
+}
+
+func TestInstanceGrant(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"POST /v1/ds/spintst/datasets/dsgroup/123/instances":                       `{"instance_id":"i-0123456789abcdef0","access":{"i-0123456789abcdef0":"dataset-123-ro"},"permission":"read","expires_at":"2023-01-03T03:04:05Z"}`,
+		"DELETE /v1/ds/spintst/datasets/dsgroup/123/instances/i-0123456789abcdef0": "",
+	}}
+
+	// flags can follow the arguments
+	stdout, _, err := runTest(t, api, "instances", "grant", "123", "i-0123456789abcdef0", "-permission", "read", "-duration", "24h")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if api.bodies[0] != `{"instance_id":"i-0123456789abcdef0","permission":"read","duration":"24h"}` {
+		t.Errorf("expected grant input, got %s", api.bodies[0])
+	}
+
+	for _, line := range []string{"Permission  read", "Expires     2023-01-03T03:04:05Z", "Access      dataset-123-ro"} {
+		if !strings.Contains(stdout, line+"\n") {
+			t.Errorf("expected table output to contain '%s', got\n%s", line, stdout)
+		}
+	}
+
+	_, stderr, err := runTest(t, api, "instances", "revoke", "123", "i-0123456789abcdef0")
+	if err != nil || !strings.Contains(stderr, "revoked access of instance i-0123456789abcdef0 to dataset 123") {
+		t.Errorf("expected revoked message, got %v and %s", err, stderr)
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"GET /v1/ds/spintst/datasets/dsgroup/123/logs": `["Created dataset 123 (CreatedBy: tester)","Locked data repository for dataset 123"]`,
+	}}
+
+	stdout, _, err := runTest(t, api, "logs", "tail", "123")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if stdout != "Created dataset 123 (CreatedBy: tester)\nLocked data repository for dataset 123\n" {
+		t.Errorf("expected audit log messages, got\n%s", stdout)
+	}
+
+	// following stops when the context is cancelled
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	stdout2 := &bytes.Buffer{}
+	go func() {
+		for api.count() < 3 {
+			<-time.After(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	err = run(ctx, []string{"-endpoint", ts.URL + "/v1/ds", "-token", "s3cr3t", "-account", "spintst", "-group", "dsgroup", "logs", "tail", "-f", "-interval", "1ms", "123"}, stdout2, io.Discard)
+	if err != nil {
+		t.Errorf("expected nil error after cancelling, got %s", err)
+	}
+
+	if stdout2.String() != stdout {
+		t.Errorf("expected messages to be printed once, got\n%s", stdout2)
+	}
+}
+
+func TestLogAccess(t *testing.T) {
+	api := &testAPI{responses: map[string]string{
+		"GET /v1/ds/spintst/datasets/dsgroup/123/accessreport": `{"dataset_id":"123","group":"dsgroup","principals":[{"principal":"i-0123456789abcdef0","principal_type":"instance","requester":"arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0","reads":2,"writes":0,"deletes":0,"denied":1,"bytes_read":150,"first_access":"2020-02-06T00:00:38Z","last_access":"2020-02-06T00:02:00Z"}],"updated_at":"2020-02-06T00:15:00Z"}`,
+	}}
+
+	stdout, _, err := runTest(t, api, "logs", "access", "123")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !strings.Contains(stdout, "i-0123456789abcdef0") || !strings.Contains(stdout, "instance") || !strings.Contains(stdout, "2020-02-06T00:02:00Z") {
+		t.Errorf("expected access report table, got\n%s", stdout)
+	}
+
+	if _, _, err := runTest(t, api, "logs", "access", "456"); err == nil {
+		t.Error("expected error for unknown dataset, got nil")
+	}
+}
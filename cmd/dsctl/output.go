@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// newFlags returns a flag set for a sub command
+func (c *cli) newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: dsctl %s %s\n", name, c.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// print writes the value as indented json, or as a table written by the table function
+func (c *cli) print(v interface{}, table func(w io.Writer)) error {
+	if c.output == "json" {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// printMetadata writes the fields of dataset metadata as table rows
+func printMetadata(w io.Writer, m *dataset.Metadata) {
+	if m == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "ID\t%s\n", m.ID)
+	fmt.Fprintf(w, "Name\t%s\n", m.Name)
+	fmt.Fprintf(w, "Description\t%s\n", m.Description)
+	fmt.Fprintf(w, "Storage\t%s\n", m.DataStorage)
+	fmt.Fprintf(w, "Derivative\t%t\n", m.Derivative)
+	fmt.Fprintf(w, "Classifications\t%s\n", strings.Join(m.DataClassifications, ", "))
+	fmt.Fprintf(w, "Sources\t%s\n", strings.Join(m.SourceIDs, ", "))
+	fmt.Fprintf(w, "Created\t%s\n", byline(m.CreatedAt, m.CreatedBy))
+	fmt.Fprintf(w, "Modified\t%s\n", byline(m.ModifiedAt, m.ModifiedBy))
+	fmt.Fprintf(w, "Finalized\t%s\n", byline(m.FinalizedAt, m.FinalizedBy))
+	if m.Manifest != nil {
+		fmt.Fprintf(w, "Manifest\t%s (%d objects, %d bytes, sha256 %s)\n", m.Manifest.Location, m.Manifest.ObjectCount, m.Manifest.TotalBytes, m.Manifest.SHA256)
+	}
+}
+
+// printAccess writes the access of instances as table rows, sorted by instance
+func printAccess(w io.Writer, access map[string]string) {
+	fmt.Fprintln(w, "INSTANCE\tACCESS")
+
+	instances := make([]string, 0, len(access))
+	for i := range access {
+		instances = append(instances, i)
+	}
+	sort.Strings(instances)
+
+	for _, i := range instances {
+		fmt.Fprintf(w, "%s\t%s\n", i, access[i])
+	}
+}
+
+// printObject writes the keys and json values of an object as table rows, sorted by key
+func printObject(w io.Writer, header string, object map[string]interface{}) {
+	fmt.Fprintln(w, header)
+
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value, ok := object[k].(string)
+		if !ok {
+			j, _ := json.Marshal(object[k])
+			value = string(j)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", k, value)
+	}
+}
+
+// byline formats a timestamp and the user responsible for it
+func byline(at *time.Time, by string) string {
+	if at == nil {
+		return by
+	}
+
+	if by == "" {
+		return at.Format(time.RFC3339)
+	}
+
+	return fmt.Sprintf("%s by %s", at.Format(time.RFC3339), by)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+func userList(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("users list"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.ListUsers(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printObject(w, "USER\tKEYS", out) })
+}
+
+func userCreate(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("users create"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.CreateUser(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printObject(w, "FIELD\tVALUE", out) })
+}
+
+func userRotate(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("users rotate"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.client.UpdateUser(ctx, c.account, c.group, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.print(out, func(w io.Writer) { printObject(w, "FIELD\tVALUE", out) })
+}
+
+func userDelete(ctx context.Context, c *cli, args []string) error {
+	args, err := parseArgs(c.newFlags("users delete"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteUser(ctx, c.account, c.group, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "deleted users of dataset %s\n", args[0])
+	return nil
+}
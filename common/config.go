@@ -14,6 +14,12 @@ type Config struct {
 	Accounts           map[string]Account
 	MetadataRepository MetadataRepository
 	Token              string
+	Clients            map[string]Client
+	Issuers            []Issuer
+	Roles              map[string][]string
+	TokenRoles         []string
+	AllowHTTPWebhooks  bool
+	Classifications    map[string]Classification
 	LogLevel           string
 	Version            Version
 	Org                string
@@ -25,6 +31,51 @@ type Account struct {
 	Config           map[string]interface{}
 }
 
+// Client is the configuration for a named API client.  The secret is a bcrypt hash of the
+// client secret.  Accounts and Groups can contain "*" to allow all accounts or groups, and
+// Verbs are "resource:action" scopes (ie. "datasets:read", "attachments:*", "*:read").
+// Roles are the authorization roles of the client.
+type Client struct {
+	Secret   string
+	Accounts []string
+	Groups   []string
+	Verbs    []string
+	Roles    []string
+}
+
+// Issuer is the configuration for a trusted issuer of bearer tokens.  Signing keys are read from a local
+// JWKS file or fetched from a JWKS URL.  UserClaim (default "sub") is mapped to the acting user,
+// GroupsClaim (default "groups") to the groups the user is allowed to access and RolesClaim
+// (default "roles") to the authorization roles of the user.
+type Issuer struct {
+	Issuer      string
+	Audience    string
+	JWKSFile    string
+	JWKSURL     string
+	UserClaim   string
+	GroupsClaim string
+	RolesClaim  string
+}
+
+// Classification is the policy for datasets with a data classification (ie. "hipaa").  RequiredTags must be
+// set when the dataset is created, RequireDUA requires a DUA URL, AllowDerivatives, AllowTemporaryUsers and
+// AllowSharing allow derivatives, temporary IAM users and sharing with other AWS accounts, MaxGrantDuration
+// (ie. "72h") limits how long instances can be granted access and Encryption is the required encryption mode
+// of the data repository ("AES256" or "aws:kms").  AllowedVPCEndpoints and AllowedSourceCIDRs restrict access
+// to the data repository by network, overriding the account network restriction.
+type Classification struct {
+	RequiredTags        []string
+	RequireDUA          bool
+	AllowDerivatives    bool
+	AllowTemporaryUsers bool
+	AllowSharing        bool
+	MaxGrantDuration    string
+	Encryption          string
+	AllowedVPCEndpoints []string
+	AllowedSourceCIDRs  []string
+	FinalizeRoles       []string
+}
+
 // MetadataRepository is the configuration for the metadata respository
 type MetadataRepository struct {
 	Type   string
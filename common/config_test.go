@@ -41,6 +41,14 @@ var testConfig = []byte(
 		  }
 		},
 		"token": "SEKRET",
+		"clients": {
+			"auditor": {
+				"secret": "$2a$10$hashedsecret",
+				"accounts": ["provider1"],
+				"groups": ["*"],
+				"verbs": ["*:read"]
+			}
+		},
 		"logLevel": "info",
 		"org": "test"
 	}`)
@@ -81,7 +89,15 @@ func TestReadConfig(t *testing.T) {
 				"awesome":  true,
 			},
 		},
-		Token:    "SEKRET",
+		Token: "SEKRET",
+		Clients: map[string]Client{
+			"auditor": Client{
+				Secret:   "$2a$10$hashedsecret",
+				Accounts: []string{"provider1"},
+				Groups:   []string{"*"},
+				Verbs:    []string{"*:read"},
+			},
+		},
 		LogLevel: "info",
 		Org:      "test",
 	}
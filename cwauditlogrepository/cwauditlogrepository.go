@@ -3,6 +3,7 @@ package cwauditlogrepository
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/YaleSpinup/ds-api/cloudwatchlogs"
@@ -111,11 +112,22 @@ func (l *CWAuditLogRepository) Log(ctx context.Context, group, stream string) ch
 		stream = l.StreamPrefix + stream
 	}
 
+	// annotate messages with the identity of the caller, if it's known
+	var annotation string
+	if identity, ok := dataset.IdentityFromContext(ctx); ok {
+		annotation = identity.AuditAnnotation()
+	}
+
+	// and the request id, to tie them to the api logs
+	if requestID := dataset.RequestIDFromContext(ctx); requestID != "" {
+		annotation = annotation + " (RequestID: " + requestID + ")"
+	}
+
 	// TODO: this will fail if there are more than 10,000 entries batched.  Initially, I
 	// handled this case, but I don't think we'll ever need it (and we can add the complexity
 	// then if we do).  Removing the logic, makes this much simpler.
 	go func() {
-		log.Debugf("starting log batching go routine")
+		log.WithContext(ctx).Debugf("starting log batching go routine")
 
 		// default to 10 minutes
 		timeout := 10 * time.Minute
@@ -126,37 +138,43 @@ func (l *CWAuditLogRepository) Log(ctx context.Context, group, stream string) ch
 		messages := []*cloudwatchlogs.Event{}
 
 		defer func() {
-			log.Debug("finalizing log batch")
+			log.WithContext(ctx).Debug("finalizing log batch")
 
 			logctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
 			if len(messages) > 0 {
 				for _, m := range messages {
-					log.Debugf("sending log event to %s/%s: %d %s", group, stream, m.Timestamp, m.Message)
+					log.WithContext(ctx).Debugf("sending log event to %s/%s: %d %s", group, stream, m.Timestamp, m.Message)
 				}
 
 				if err := l.CW.LogEvent(logctx, group, stream, messages); err != nil {
-					log.Errorf("failed to log events: %s", err)
+					log.WithContext(ctx).Errorf("failed to log events: %s", err)
 				}
 			}
 		}()
 
 		for {
-			log.Debug("starting log batch collection loop")
+			log.WithContext(ctx).Debug("starting log batch collection loop")
 			select {
 			case message := <-messageStream:
 				timestamp := time.Now().UnixNano() / int64(time.Millisecond)
-				log.Debugf("%d received message %s", timestamp, message)
+				log.WithContext(ctx).Debugf("%d received message %s", timestamp, message)
+
+				// json documents are logged as is, so they can still be parsed
+				if annotation != "" && !strings.HasPrefix(message, "{") {
+					message = message + annotation
+				}
+
 				messages = append(messages, &cloudwatchlogs.Event{
 					Message:   message,
 					Timestamp: timestamp,
 				})
 			case <-time.After(timeout):
-				log.Warnf("timed out waiting for more log messages to write to %s/%s", group, stream)
+				log.WithContext(ctx).Warnf("timed out waiting for more log messages to write to %s/%s", group, stream)
 				return
 			case <-ctx.Done():
-				log.Debug("context closed")
+				log.WithContext(ctx).Debug("context closed")
 				return
 			}
 		}
@@ -177,7 +195,7 @@ func (l *CWAuditLogRepository) CreateLog(ctx context.Context, group, stream stri
 		stream = l.StreamPrefix + stream
 	}
 
-	log.Infof("creating cloudwatch log %s/%s (%d day retention)", logGroup, stream, retention)
+	log.WithContext(ctx).Infof("creating cloudwatch log %s/%s (%d day retention)", logGroup, stream, retention)
 
 	// prepare tags
 	tagsMap := make(map[string]*string, len(tags))
@@ -190,7 +208,7 @@ func (l *CWAuditLogRepository) CreateLog(ctx context.Context, group, stream stri
 	var rollBackTasks []func() error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error creating log: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error creating log: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
@@ -231,7 +249,7 @@ func (l *CWAuditLogRepository) GetLog(ctx context.Context, group, stream string)
 		stream = l.StreamPrefix + stream
 	}
 
-	log.Infof("getting cloudwatch log %s/%s", logGroup, stream)
+	log.WithContext(ctx).Infof("getting cloudwatch log %s/%s", logGroup, stream)
 
 	logEvents, err := l.CW.GetLogEvents(ctx, logGroup, stream)
 	if err != nil {
@@ -295,5 +295,26 @@ func TestLog(t *testing.T) {
 	if !reflect.DeepEqual(testMessages, resultMessages) {
 		t.Errorf("expected: %+v, got %+v", testMessages, resultMessages)
 	}
+
+	// test messages are annotated with the client identity and request id, except json documents
+	testLogGroup.streams["test-stream"] = []*cloudwatchlogs.Event{}
+	ctx, cancel = context.WithCancel(dataset.NewRequestIDContext(dataset.NewIdentityContext(context.Background(), &dataset.Identity{Client: "auditor"}), "abc123"))
+	messageStream = newMockCWAuditLogRepository("", 5*time.Second, &mockCWLclient{t: t}).Log(ctx, "test-group", "test-stream")
+	messageStream <- "some random message"
+	messageStream <- `{"some": "json"}`
+	cancel()
+
+	// attempt to lock so we know the messages were written to the map
+	logGroupsMux.Lock()
+
+	resultMessages = []string{}
+	for _, m := range testLogGroup.streams["test-stream"] {
+		resultMessages = append(resultMessages, m.Message)
+	}
+
+	expected := []string{"some random message (Client: auditor) (RequestID: abc123)", `{"some": "json"}`}
+	if !reflect.DeepEqual(expected, resultMessages) {
+		t.Errorf("expected: %+v, got %+v", expected, resultMessages)
+	}
 	logGroupsMux.Unlock()
 }
@@ -0,0 +1,127 @@
+package dataset
+
+import (
+	"sort"
+	"time"
+)
+
+// Access log actions
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessDelete = "delete"
+)
+
+// Types of the principals in access logs
+const (
+	AccessPrincipalInstance = "instance"
+	AccessPrincipalRole     = "role"
+	AccessPrincipalUser     = "user"
+	AccessPrincipalShare    = "share"
+	AccessPrincipalOther    = "other"
+)
+
+// AccessLogRecord is a request to read, write or delete an object in a data repository, ie. from an S3 server
+// access log.  Requester is the ARN of the caller, which is attributed to a Principal of PrincipalType, ie. the
+// instance id of an instance role session or the name of a temporary user.
+type AccessLogRecord struct {
+	Repository    string    `json:"repository"`
+	Key           string    `json:"key"`
+	Action        string    `json:"action"`
+	Operation     string    `json:"operation"`
+	Requester     string    `json:"requester"`
+	PrincipalType string    `json:"principal_type"`
+	Principal     string    `json:"principal"`
+	Status        int       `json:"status"`
+	Bytes         int64     `json:"bytes"`
+	SourceIP      string    `json:"source_ip"`
+	RequestID     string    `json:"request_id"`
+	Time          time.Time `json:"time"`
+}
+
+// Succeeded returns true if the request was successful
+func (r *AccessLogRecord) Succeeded() bool {
+	return r.Status >= 200 && r.Status < 300
+}
+
+// Denied returns true if the request was denied access
+func (r *AccessLogRecord) Denied() bool {
+	return r.Status == 403
+}
+
+// AccessReport summarizes who accessed the data of a dataset, from the access logs ingested so far.  LogCursor is
+// the position in the access logs up to which they were ingested, it's only used by the ingestion.
+type AccessReport struct {
+	DatasetID  string             `json:"dataset_id"`
+	Group      string             `json:"group,omitempty"`
+	Principals []*PrincipalAccess `json:"principals"`
+	UpdatedAt  *time.Time         `json:"updated_at"`
+	LogCursor  string             `json:"log_cursor,omitempty"`
+}
+
+// PrincipalAccess is the access of one principal to the data of a dataset.  Successful requests are counted by
+// action, and denied requests are counted separately.  Other failed requests, ie. for missing keys, aren't counted.
+type PrincipalAccess struct {
+	Principal     string     `json:"principal"`
+	PrincipalType string     `json:"principal_type"`
+	Requester     string     `json:"requester"`
+	Reads         int64      `json:"reads"`
+	Writes        int64      `json:"writes"`
+	Deletes       int64      `json:"deletes"`
+	Denied        int64      `json:"denied"`
+	BytesRead     int64      `json:"bytes_read"`
+	FirstAccess   *time.Time `json:"first_access"`
+	LastAccess    *time.Time `json:"last_access"`
+}
+
+// Add counts an access log record in the report
+func (r *AccessReport) Add(record *AccessLogRecord) {
+	if !record.Succeeded() && !record.Denied() {
+		return
+	}
+
+	var p *PrincipalAccess
+	for _, a := range r.Principals {
+		if a.PrincipalType == record.PrincipalType && a.Principal == record.Principal {
+			p = a
+			break
+		}
+	}
+
+	if p == nil {
+		p = &PrincipalAccess{Principal: record.Principal, PrincipalType: record.PrincipalType}
+		r.Principals = append(r.Principals, p)
+	}
+
+	t := record.Time.UTC().Truncate(time.Second)
+	if p.FirstAccess == nil || t.Before(*p.FirstAccess) {
+		p.FirstAccess = &t
+	}
+
+	if p.LastAccess == nil || !t.Before(*p.LastAccess) {
+		p.LastAccess = &t
+		p.Requester = record.Requester
+	}
+
+	if record.Denied() {
+		p.Denied++
+		return
+	}
+
+	switch record.Action {
+	case AccessRead:
+		p.Reads++
+		p.BytesRead += record.Bytes
+	case AccessWrite:
+		p.Writes++
+	case AccessDelete:
+		p.Deletes++
+	}
+}
+
+// Sort sorts the principals by their last access, the latest first
+func (r *AccessReport) Sort() {
+	sort.SliceStable(r.Principals, func(i, j int) bool {
+		return r.Principals[i].LastAccess.After(*r.Principals[j].LastAccess)
+	})
+}
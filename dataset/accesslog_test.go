@@ -0,0 +1,44 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAccessReportAdd(t *testing.T) {
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T01:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-02-02T02:00:00Z")
+	time3, _ := time.Parse(time.RFC3339, "2020-03-03T03:00:00Z")
+
+	instanceRole := "arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0"
+	user := "arn:aws:iam::012345678901:user/spinup/dataset/dataset-localdev-abc-DsTmpUsr"
+
+	report := &AccessReport{DatasetID: "abc"}
+	for _, r := range []*AccessLogRecord{
+		{Key: "raw/a.csv", Action: AccessRead, Requester: instanceRole, PrincipalType: AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 200, Bytes: 100, Time: time2},
+		{Key: "raw/b.csv", Action: AccessRead, Requester: instanceRole, PrincipalType: AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 206, Bytes: 50, Time: time1},
+		{Key: "raw/c.csv", Action: AccessRead, Requester: instanceRole, PrincipalType: AccessPrincipalInstance, Principal: "i-0123456789abcdef0", Status: 404, Time: time3},
+		{Key: "raw/a.csv", Action: AccessWrite, Requester: user, PrincipalType: AccessPrincipalUser, Principal: "dataset-localdev-abc-DsTmpUsr", Status: 200, Bytes: 0, Time: time1},
+		{Key: "raw/a.csv", Action: AccessDelete, Requester: user, PrincipalType: AccessPrincipalUser, Principal: "dataset-localdev-abc-DsTmpUsr", Status: 204, Time: time2},
+		{Key: "raw/a.csv", Action: AccessDelete, Requester: user, PrincipalType: AccessPrincipalUser, Principal: "dataset-localdev-abc-DsTmpUsr", Status: 403, Time: time3},
+	} {
+		report.Add(r)
+	}
+	report.Sort()
+
+	expected := &AccessReport{
+		DatasetID: "abc",
+		Principals: []*PrincipalAccess{
+			{Principal: "dataset-localdev-abc-DsTmpUsr", PrincipalType: AccessPrincipalUser, Requester: user, Writes: 1, Deletes: 1, Denied: 1, FirstAccess: &time1, LastAccess: &time3},
+			{Principal: "i-0123456789abcdef0", PrincipalType: AccessPrincipalInstance, Requester: instanceRole, Reads: 2, BytesRead: 150, FirstAccess: &time1, LastAccess: &time2},
+		},
+	}
+
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, report)
+		for _, p := range report.Principals {
+			t.Logf("%+v", p)
+		}
+	}
+}
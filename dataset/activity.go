@@ -0,0 +1,29 @@
+package dataset
+
+import "time"
+
+// Object activity actions
+const (
+	ObjectCreated = "created"
+	ObjectDeleted = "deleted"
+)
+
+// ObjectActivity is a change to an object in a data repository, ie. reported by an S3 event notification
+type ObjectActivity struct {
+	Repository string    `json:"repository"`
+	Key        string    `json:"key"`
+	Action     string    `json:"action"`
+	EventName  string    `json:"event_name"`
+	Size       int64     `json:"size,omitempty"`
+	Principal  string    `json:"principal,omitempty"`
+	SourceIP   string    `json:"source_ip,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// ActivityMessage is a message received from an activity queue, with the object activity it reports.  Messages
+// without activity, ie. test notifications, can just be deleted.
+type ActivityMessage struct {
+	ID            string
+	ReceiptHandle string
+	Activity      []*ObjectActivity
+}
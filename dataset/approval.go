@@ -0,0 +1,52 @@
+package dataset
+
+import "time"
+
+// Actions that can be requested for approval
+const (
+	ApprovalActionPromote = "promote"
+	ApprovalActionDelete  = "delete"
+	ApprovalActionGrant   = "grant"
+)
+
+// Approval statuses
+const (
+	ApprovalStatusPending   = "pending"
+	ApprovalStatusApproved  = "approved"
+	ApprovalStatusRejected  = "rejected"
+	ApprovalStatusExpired   = "expired"
+	ApprovalStatusCompleted = "completed"
+	ApprovalStatusFailed    = "failed"
+)
+
+// Approval is a request for an action on a dataset that has to be approved by a different user before it runs.
+// Approved requests are approved while the action runs, and end up completed or failed.  RequestedByClient is the
+// API client that opened the request, if any, and Duration the requested duration of a grant.
+type Approval struct {
+	ID                string     `json:"id"`
+	DatasetID         string     `json:"dataset_id"`
+	Action            string     `json:"action"`
+	InstanceID        string     `json:"instance_id,omitempty"`
+	RoleArn           string     `json:"role_arn,omitempty"`
+	Permission        string     `json:"permission,omitempty"`
+	Duration          string     `json:"duration,omitempty"`
+	Status            string     `json:"status"`
+	Comment           string     `json:"comment,omitempty"`
+	RequestedAt       *time.Time `json:"requested_at"`
+	RequestedBy       string     `json:"requested_by"`
+	RequestedByClient string     `json:"requested_by_client,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	DecidedAt         *time.Time `json:"decided_at,omitempty"`
+	DecidedBy         string     `json:"decided_by,omitempty"`
+	Decision          string     `json:"decision,omitempty"`
+	Error             string     `json:"error,omitempty"`
+}
+
+// Expire marks a pending approval as expired if it's past its expiration time, and returns true if it's expired
+func (a *Approval) Expire(now time.Time) bool {
+	if a.Status == ApprovalStatusPending && a.ExpiresAt != nil && now.After(*a.ExpiresAt) {
+		a.Status = ApprovalStatusExpired
+	}
+
+	return a.Status == ApprovalStatusExpired
+}
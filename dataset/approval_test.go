@@ -0,0 +1,36 @@
+package dataset
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApprovalExpire(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-1 * time.Hour)
+	future := now.Add(1 * time.Hour)
+
+	type test struct {
+		approval *Approval
+		expired  bool
+		status   string
+	}
+
+	tests := []test{
+		{&Approval{Status: ApprovalStatusPending, ExpiresAt: &future}, false, ApprovalStatusPending},
+		{&Approval{Status: ApprovalStatusPending, ExpiresAt: &past}, true, ApprovalStatusExpired},
+		{&Approval{Status: ApprovalStatusCompleted, ExpiresAt: &past}, false, ApprovalStatusCompleted},
+		{&Approval{Status: ApprovalStatusExpired, ExpiresAt: &past}, true, ApprovalStatusExpired},
+		{&Approval{Status: ApprovalStatusPending}, false, ApprovalStatusPending},
+	}
+
+	for _, tst := range tests {
+		if expired := tst.approval.Expire(now); expired != tst.expired {
+			t.Errorf("expected expired %t, got %t", tst.expired, expired)
+		}
+
+		if tst.approval.Status != tst.status {
+			t.Errorf("expected status %s, got %s", tst.status, tst.approval.Status)
+		}
+	}
+}
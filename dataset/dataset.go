@@ -13,22 +13,96 @@ import (
 // - an Audit Log Repository for storing audit logs
 // - one or more Data Repositories for storing datasets
 // - one or more Attachment Repositories for storing attachments
+// - an Approval Repository for storing approval requests
+// - a Grant Repository for storing expiring access grants
+// - a Share Repository for storing cross-account shares
+// - a Webhook Repository for storing webhook subscriptions and undelivered events
+// - an Event Publisher for publishing dataset lifecycle events to an event bus
+// - an Activity Queue for receiving object activity in the data repositories
+// - an Access Report Repository for storing who accessed the data of each dataset
 type Service struct {
-	MetadataRepository   MetadataRepository
-	AuditLogRepository   AuditLogRepository
-	DataRepository       map[string]DataRepository
-	AttachmentRepository map[string]AttachmentRepository
+	MetadataRepository     MetadataRepository
+	AuditLogRepository     AuditLogRepository
+	DataRepository         map[string]DataRepository
+	AttachmentRepository   map[string]AttachmentRepository
+	ApprovalRepository     ApprovalRepository
+	GrantRepository        GrantRepository
+	ShareRepository        ShareRepository
+	WebhookRepository      WebhookRepository
+	EventPublisher         EventPublisher
+	ActivityQueue          ActivityQueue
+	AccessReportRepository AccessReportRepository
 }
 
 // MetadataRepository is an interface for metadata repository
 type MetadataRepository interface {
 	Create(ctx context.Context, account, id string, metadata *Metadata) (*Metadata, error)
 	Get(ctx context.Context, account, id string) (*Metadata, error)
+	List(ctx context.Context, account string) ([]*Metadata, error)
 	Promote(ctx context.Context, account, id, user string) (*Metadata, error)
 	Update(ctx context.Context, account, id string, metadata *Metadata) (*Metadata, error)
 	Delete(ctx context.Context, account, id string) error
 }
 
+// ApprovalRepository is an interface for approval request repository.  DecideApproval only replaces an approval
+// request that is still pending, so concurrent decisions on the same request fail with a conflict.
+type ApprovalRepository interface {
+	CreateApproval(ctx context.Context, account string, approval *Approval) (*Approval, error)
+	GetApproval(ctx context.Context, account, datasetID, id string) (*Approval, error)
+	ListApprovals(ctx context.Context, account, datasetID string) ([]*Approval, error)
+	UpdateApproval(ctx context.Context, account string, approval *Approval) (*Approval, error)
+	DecideApproval(ctx context.Context, account string, approval *Approval) (*Approval, error)
+}
+
+// GrantRepository is an interface for expiring access grant repository
+type GrantRepository interface {
+	PutGrant(ctx context.Context, account string, grant *Grant) error
+	ListGrants(ctx context.Context, account string) ([]*Grant, error)
+	DeleteGrant(ctx context.Context, account, datasetID, instanceID string) error
+}
+
+// ShareRepository is an interface for cross-account share repository.  ListShares lists the shares of all
+// datasets in the account if datasetID is empty.
+type ShareRepository interface {
+	PutShare(ctx context.Context, account string, share *Share) error
+	GetShare(ctx context.Context, account, datasetID, id string) (*Share, error)
+	ListShares(ctx context.Context, account, datasetID string) ([]*Share, error)
+	DeleteShare(ctx context.Context, account, datasetID, id string) error
+}
+
+// WebhookRepository is an interface for webhook subscription repository.  Events that couldn't be delivered to a
+// webhook are stored as dead letters of the webhook.
+type WebhookRepository interface {
+	PutWebhook(ctx context.Context, account string, webhook *Webhook) error
+	GetWebhook(ctx context.Context, account, group, id string) (*Webhook, error)
+	ListWebhooks(ctx context.Context, account, group string) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, account, group, id string) error
+	PutDeadLetter(ctx context.Context, account string, deadLetter *DeadLetter) error
+	GetDeadLetter(ctx context.Context, account, group, webhookID, id string) (*DeadLetter, error)
+	ListDeadLetters(ctx context.Context, account, group, webhookID string) ([]*DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, account, group, webhookID, id string) error
+}
+
+// EventPublisher is an interface for publishing dataset lifecycle events, ie. to an event bus
+type EventPublisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// ActivityQueue is an interface for receiving the object activity in data repositories.  Receive waits for messages
+// until the context is cancelled, and messages are received again unless they're deleted.
+type ActivityQueue interface {
+	Receive(ctx context.Context) ([]*ActivityMessage, error)
+	Delete(ctx context.Context, message *ActivityMessage) error
+}
+
+// AccessReportRepository is an interface for access report repository.  Each dataset has (at most) one report,
+// which is updated as the access logs of its data repository are ingested.
+type AccessReportRepository interface {
+	PutAccessReport(ctx context.Context, account string, report *AccessReport) error
+	GetAccessReport(ctx context.Context, account, datasetID string) (*AccessReport, error)
+	DeleteAccessReport(ctx context.Context, account, datasetID string) error
+}
+
 // AuditLogRepository is an interface for audit log repository
 type AuditLogRepository interface {
 	CreateLog(ctx context.Context, group, stream string, retention int64, tags []*Tag) error
@@ -36,20 +110,27 @@ type AuditLogRepository interface {
 	Log(ctx context.Context, account, id string) chan string
 }
 
-// DataRepository is an interface for data repository
+// DataRepository is an interface for data repository.  Provision encrypts the new data repository with the given
+// server side encryption mode (ie. required by the classifications of the dataset), or the default of the data
+// repository if it's empty.
 type DataRepository interface {
-	Provision(ctx context.Context, id string, tags []*Tag) (string, error)
+	Provision(ctx context.Context, id string, tags []*Tag, encryption string) (string, error)
 	Deprovision(ctx context.Context, id string) error
 	Delete(ctx context.Context, id string) error
 	Describe(ctx context.Context, id string) (*Repository, error)
 	SetPolicy(ctx context.Context, id string, derivative bool) error
-	GrantAccess(ctx context.Context, id, instanceID string) (Access, error)
+	GrantAccess(ctx context.Context, id, instanceID, permission string) (Access, error)
 	ListAccess(ctx context.Context, id string) (Access, error)
 	RevokeAccess(ctx context.Context, id, instanceID string) error
 	CreateUser(ctx context.Context, id string) (interface{}, error)
 	DeleteUser(ctx context.Context, id string) error
 	ListUsers(ctx context.Context, id string) (map[string]interface{}, error)
 	UpdateUser(ctx context.Context, id string) (map[string]interface{}, error)
+	CreateManifest(ctx context.Context, id string) (*ManifestReference, error)
+	VerifyManifest(ctx context.Context, id string, manifest *ManifestReference, checksums bool) (*ManifestVerification, error)
+	Lock(ctx context.Context, id string) error
+	Unlock(ctx context.Context, id string) error
+	CopyObjects(ctx context.Context, sourceID, id string, input *CopyInput, progress func(CopyProgress)) error
 }
 
 // AttachmentRepository is an interface for attachment repository
@@ -112,6 +193,55 @@ func WithAttachmentRepository(repos map[string]AttachmentRepository) ServiceOpti
 	}
 }
 
+// WithApprovalRepository sets the ApprovalRepository for the service
+func WithApprovalRepository(repo ApprovalRepository) ServiceOption {
+	return func(s *Service) {
+		s.ApprovalRepository = repo
+	}
+}
+
+// WithGrantRepository sets the GrantRepository for the service
+func WithGrantRepository(repo GrantRepository) ServiceOption {
+	return func(s *Service) {
+		s.GrantRepository = repo
+	}
+}
+
+// WithShareRepository sets the ShareRepository for the service
+func WithShareRepository(repo ShareRepository) ServiceOption {
+	return func(s *Service) {
+		s.ShareRepository = repo
+	}
+}
+
+// WithWebhookRepository sets the WebhookRepository for the service
+func WithWebhookRepository(repo WebhookRepository) ServiceOption {
+	return func(s *Service) {
+		s.WebhookRepository = repo
+	}
+}
+
+// WithEventPublisher sets the EventPublisher for the service
+func WithEventPublisher(publisher EventPublisher) ServiceOption {
+	return func(s *Service) {
+		s.EventPublisher = publisher
+	}
+}
+
+// WithActivityQueue sets the ActivityQueue for the service
+func WithActivityQueue(queue ActivityQueue) ServiceOption {
+	return func(s *Service) {
+		s.ActivityQueue = queue
+	}
+}
+
+// WithAccessReportRepository sets the AccessReportRepository for the service
+func WithAccessReportRepository(repo AccessReportRepository) ServiceOption {
+	return func(s *Service) {
+		s.AccessReportRepository = repo
+	}
+}
+
 // NewID generates a new dataset id
 func (s *Service) NewID() string {
 	return uuid.New().String()
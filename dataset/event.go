@@ -0,0 +1,72 @@
+package dataset
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	EventDatasetCreated   = "dataset.created"
+	EventDatasetFinalized = "dataset.finalized"
+	EventDatasetDeleted   = "dataset.deleted"
+	EventAccessGranted    = "access.granted"
+	EventAccessRevoked    = "access.revoked"
+	EventAttachmentAdded  = "attachment.added"
+	EventPolicyViolation  = "policy.violation"
+	EventManifestCreated  = "manifest.created"
+	EventManifestFailed   = "manifest.failed"
+)
+
+// EventTypes are all of the event types
+var EventTypes = []string{
+	EventDatasetCreated,
+	EventDatasetFinalized,
+	EventDatasetDeleted,
+	EventAccessGranted,
+	EventAccessRevoked,
+	EventAttachmentAdded,
+	EventPolicyViolation,
+	EventManifestCreated,
+	EventManifestFailed,
+}
+
+// Event is a change in the lifecycle of a dataset.  Data has the details of the change, depending on the type.
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Account   string                 `json:"account"`
+	Group     string                 `json:"group"`
+	DatasetID string                 `json:"dataset_id"`
+	Time      time.Time              `json:"time"`
+	User      string                 `json:"user,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewEvent returns a new event of a dataset, with the request id of the context
+func NewEvent(ctx context.Context, eventType, account, group, datasetID, user string, data map[string]interface{}) *Event {
+	return &Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Account:   account,
+		Group:     group,
+		DatasetID: datasetID,
+		Time:      time.Now().UTC().Truncate(time.Millisecond),
+		User:      user,
+		RequestID: RequestIDFromContext(ctx),
+		Data:      data,
+	}
+}
+
+// ValidEventType returns true if the event type is known
+func ValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package dataset
+
+import "time"
+
+// permission levels of access grants
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+// Grant is an access grant that expires.  InstanceID is the grantee, an instance id or an IAM role ARN.
+type Grant struct {
+	DatasetID  string     `json:"dataset_id"`
+	Group      string     `json:"group"`
+	InstanceID string     `json:"instance_id"`
+	GrantedAt  *time.Time `json:"granted_at"`
+	GrantedBy  string     `json:"granted_by,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// Expired returns true if the grant is past its expiration time
+func (g *Grant) Expired(now time.Time) bool {
+	return g.ExpiresAt != nil && now.After(*g.ExpiresAt)
+}
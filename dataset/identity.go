@@ -0,0 +1,60 @@
+package dataset
+
+import (
+	"context"
+	"strings"
+)
+
+type identityContextKey struct{}
+
+// Identity is the authenticated caller of the API
+type Identity struct {
+	// Client is the name of the API client, it's empty for the shared legacy token
+	Client string
+
+	// User is the validated user from a bearer token
+	User string
+
+	// Groups are the groups the caller is allowed to access, nil if the caller isn't scoped to groups
+	Groups []string
+
+	// Roles are the authorization roles of the caller
+	Roles []string
+}
+
+// NewIdentityContext returns a copy of the context carrying the identity
+func NewIdentityContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by the context, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	identity, ok := ctx.Value(identityContextKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// AuditAnnotation returns the suffix appended to audit log messages to record who made the request
+func (i *Identity) AuditAnnotation() string {
+	if i == nil {
+		return ""
+	}
+
+	parts := []string{}
+	if i.Client != "" {
+		parts = append(parts, "Client: "+i.Client)
+	}
+
+	if i.User != "" {
+		parts = append(parts, "User: "+i.User)
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return " (" + strings.Join(parts, ", ") + ")"
+}
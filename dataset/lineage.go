@@ -0,0 +1,210 @@
+package dataset
+
+import (
+	"sort"
+	"time"
+)
+
+// Lineage directions, relative to the dataset the lineage was built for
+const (
+	LineageSelf       = "self"
+	LineageUpstream   = "upstream"
+	LineageDownstream = "downstream"
+)
+
+// Lineage is the graph of upstream sources and downstream derivatives of a dataset
+type Lineage struct {
+	ID        string         `json:"id"`
+	MaxDepth  int            `json:"max_depth"`
+	Truncated bool           `json:"truncated"`
+	Nodes     []*LineageNode `json:"nodes"`
+	Edges     []*LineageEdge `json:"edges"`
+	Cycles    [][]string     `json:"cycles"`
+}
+
+// LineageNode is a dataset in the lineage graph
+type LineageNode struct {
+	ID                  string     `json:"id"`
+	Name                string     `json:"name,omitempty"`
+	Direction           string     `json:"direction"`
+	Depth               int        `json:"depth"`
+	Derivative          bool       `json:"derivative"`
+	DataClassifications []string   `json:"data_classifications"`
+	FinalizedAt         *time.Time `json:"finalized_at,omitempty"`
+	Missing             bool       `json:"missing,omitempty"`
+}
+
+// LineageEdge connects a source dataset to a dataset derived from it
+type LineageEdge struct {
+	Source     string `json:"source"`
+	Derivative string `json:"derivative"`
+}
+
+// NewLineage builds the lineage graph for the dataset id from the metadata of all datasets in an account.
+// The graph is followed upstream (through source ids) and downstream (through datasets listing this one as a source)
+// up to maxDepth hops in each direction.  Cycles are reported and not followed.  Source ids that don't exist are
+// included as missing nodes.
+func NewLineage(id string, datasets []*Metadata, maxDepth int) *Lineage {
+	byID := make(map[string]*Metadata, len(datasets))
+	derivatives := map[string][]string{}
+	for _, m := range datasets {
+		byID[m.ID] = m
+	}
+
+	for _, m := range datasets {
+		for _, sid := range uniqueStrings(m.SourceIDs) {
+			derivatives[sid] = append(derivatives[sid], m.ID)
+		}
+	}
+
+	for _, d := range derivatives {
+		sort.Strings(d)
+	}
+
+	l := &Lineage{
+		ID:       id,
+		MaxDepth: maxDepth,
+		Nodes:    []*LineageNode{},
+		Edges:    []*LineageEdge{},
+		Cycles:   [][]string{},
+	}
+
+	nodes := map[string]*LineageNode{}
+	edges := map[LineageEdge]bool{}
+
+	addNode := func(id, direction string, depth int) {
+		n := &LineageNode{
+			ID:                  id,
+			Direction:           direction,
+			Depth:               depth,
+			DataClassifications: []string{},
+		}
+
+		if m, ok := byID[id]; ok {
+			n.Name = m.Name
+			n.Derivative = m.Derivative
+			n.FinalizedAt = m.FinalizedAt
+			if m.DataClassifications != nil {
+				n.DataClassifications = m.DataClassifications
+			}
+		} else {
+			n.Missing = true
+		}
+
+		nodes[id] = n
+	}
+
+	addEdge := func(source, derivative string) {
+		e := LineageEdge{Source: source, Derivative: derivative}
+		if !edges[e] {
+			edges[e] = true
+			l.Edges = append(l.Edges, &e)
+		}
+	}
+
+	addNode(id, LineageSelf, 0)
+
+	walk := func(direction string, neighbors func(string) []string) {
+		var visit func(current string, path []string)
+		visit = func(current string, path []string) {
+			depth := len(path) - 1
+
+			for _, n := range neighbors(current) {
+				if onPath(path, n) {
+					cycle := append([]string{}, path[indexOf(path, n):]...)
+					l.Cycles = append(l.Cycles, append(cycle, n))
+					if direction == LineageUpstream {
+						addEdge(n, current)
+					} else {
+						addEdge(current, n)
+					}
+					continue
+				}
+
+				if depth+1 > maxDepth {
+					l.Truncated = true
+					continue
+				}
+
+				if direction == LineageUpstream {
+					addEdge(n, current)
+				} else {
+					addEdge(current, n)
+				}
+
+				// already reached in the other direction, or at the same or a lower depth, no need to follow it again
+				if existing, ok := nodes[n]; ok && (existing.Direction != direction || existing.Depth <= depth+1) {
+					continue
+				}
+
+				addNode(n, direction, depth+1)
+				visit(n, append(path, n))
+			}
+		}
+
+		visit(id, []string{id})
+	}
+
+	walk(LineageUpstream, func(current string) []string {
+		if m, ok := byID[current]; ok {
+			return uniqueStrings(m.SourceIDs)
+		}
+		return nil
+	})
+
+	walk(LineageDownstream, func(current string) []string {
+		return derivatives[current]
+	})
+
+	for _, n := range nodes {
+		l.Nodes = append(l.Nodes, n)
+	}
+
+	directionOrder := map[string]int{LineageSelf: 0, LineageUpstream: 1, LineageDownstream: 2}
+	sort.Slice(l.Nodes, func(i, j int) bool {
+		a, b := l.Nodes[i], l.Nodes[j]
+		if a.Direction != b.Direction {
+			return directionOrder[a.Direction] < directionOrder[b.Direction]
+		}
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		return a.ID < b.ID
+	})
+
+	sort.Slice(l.Edges, func(i, j int) bool {
+		if l.Edges[i].Source != l.Edges[j].Source {
+			return l.Edges[i].Source < l.Edges[j].Source
+		}
+		return l.Edges[i].Derivative < l.Edges[j].Derivative
+	})
+
+	return l
+}
+
+// uniqueStrings returns the sorted, unique, non-empty strings in the list
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range list {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func onPath(path []string, id string) bool {
+	return indexOf(path, id) >= 0
+}
+
+func indexOf(path []string, id string) int {
+	for i, p := range path {
+		if p == id {
+			return i
+		}
+	}
+	return -1
+}
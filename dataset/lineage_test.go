@@ -0,0 +1,103 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLineage(t *testing.T) {
+	// a -> b -> c -> d, a -> e, x -> c, c lists missing source m
+	datasets := []*Metadata{
+		&Metadata{ID: "a", Name: "original", DataClassifications: []string{"hipaa"}},
+		&Metadata{ID: "b", Name: "b", Derivative: true, SourceIDs: []string{"a"}},
+		&Metadata{ID: "c", Name: "c", Derivative: true, SourceIDs: []string{"b", "x", "m"}},
+		&Metadata{ID: "d", Name: "d", Derivative: true, SourceIDs: []string{"c"}},
+		&Metadata{ID: "e", Name: "e", Derivative: true, SourceIDs: []string{"a", "a"}},
+		&Metadata{ID: "x", Name: "x"},
+	}
+
+	l := NewLineage("a", datasets, 10)
+	if l.Truncated {
+		t.Error("expected lineage not to be truncated")
+	}
+
+	if len(l.Cycles) != 0 {
+		t.Errorf("expected no cycles, got %v", l.Cycles)
+	}
+
+	ids := []string{}
+	for _, n := range l.Nodes {
+		ids = append(ids, n.Direction+":"+n.ID)
+	}
+
+	expected := []string{"self:a", "downstream:b", "downstream:e", "downstream:c", "downstream:d"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected nodes %v, got %v", expected, ids)
+	}
+
+	if !reflect.DeepEqual(l.Nodes[0].DataClassifications, []string{"hipaa"}) {
+		t.Errorf("expected classifications for self node, got %v", l.Nodes[0].DataClassifications)
+	}
+
+	expectedEdges := []*LineageEdge{
+		&LineageEdge{Source: "a", Derivative: "b"},
+		&LineageEdge{Source: "a", Derivative: "e"},
+		&LineageEdge{Source: "b", Derivative: "c"},
+		&LineageEdge{Source: "c", Derivative: "d"},
+	}
+	if !reflect.DeepEqual(l.Edges, expectedEdges) {
+		t.Errorf("expected edges %+v, got %+v", expectedEdges, l.Edges)
+	}
+
+	// test upstream, including a missing source
+	l = NewLineage("c", datasets, 10)
+
+	ids = []string{}
+	for _, n := range l.Nodes {
+		ids = append(ids, n.Direction+":"+n.ID)
+		if n.ID == "m" && !n.Missing {
+			t.Error("expected source m to be missing")
+		}
+	}
+
+	expected = []string{"self:c", "upstream:b", "upstream:m", "upstream:x", "upstream:a", "downstream:d"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected nodes %v, got %v", expected, ids)
+	}
+
+	// test depth limit
+	l = NewLineage("a", datasets, 1)
+	if !l.Truncated {
+		t.Error("expected lineage to be truncated")
+	}
+
+	if len(l.Nodes) != 3 {
+		t.Errorf("expected 3 nodes, got %d", len(l.Nodes))
+	}
+
+	// test cycle detection
+	datasets = []*Metadata{
+		&Metadata{ID: "a", SourceIDs: []string{"c"}},
+		&Metadata{ID: "b", SourceIDs: []string{"a"}},
+		&Metadata{ID: "c", SourceIDs: []string{"b"}},
+	}
+
+	l = NewLineage("a", datasets, 10)
+	if len(l.Cycles) != 1 {
+		t.Fatalf("expected 1 cycle, got %v", l.Cycles)
+	}
+
+	if !reflect.DeepEqual(l.Cycles[0], []string{"a", "c", "b", "a"}) {
+		t.Errorf("expected upstream cycle [a c b a], got %v", l.Cycles[0])
+	}
+
+	if len(l.Nodes) != 3 {
+		t.Errorf("expected 3 nodes, got %d: %+v", len(l.Nodes), l.Nodes)
+	}
+
+	// test unknown dataset
+	l = NewLineage("nope", datasets, 10)
+	if len(l.Nodes) != 1 || !l.Nodes[0].Missing {
+		t.Errorf("expected a single missing node, got %+v", l.Nodes)
+	}
+}
@@ -0,0 +1,112 @@
+package dataset
+
+import (
+	"sort"
+	"time"
+)
+
+// Manifest is a record of every object in a data repository at the time it was finalized
+type Manifest struct {
+	ID          string            `json:"id"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ObjectCount int64             `json:"object_count"`
+	TotalBytes  int64             `json:"total_bytes"`
+	Objects     []*ManifestObject `json:"objects"`
+}
+
+// ManifestObject is an individual object in a manifest
+type ManifestObject struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ManifestReference points to the stored manifest for a dataset, along with the checksum of the manifest itself
+type ManifestReference struct {
+	Location    string     `json:"location"`
+	SHA256      string     `json:"sha256"`
+	ObjectCount int64      `json:"object_count"`
+	TotalBytes  int64      `json:"total_bytes"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// ManifestVerification is the result of comparing the current contents of a data repository against its manifest
+type ManifestVerification struct {
+	Verified          bool      `json:"verified"`
+	VerifiedAt        time.Time `json:"verified_at"`
+	ChecksumsVerified bool      `json:"checksums_verified"`
+	ObjectCount       int64     `json:"object_count"`
+	Missing           []string  `json:"missing"`
+	Added             []string  `json:"added"`
+	Modified          []string  `json:"modified"`
+}
+
+// NewManifest creates a new manifest from the list of objects, sorted by key
+func NewManifest(id string, createdAt time.Time, objects []*ManifestObject) *Manifest {
+	m := &Manifest{
+		ID:        id,
+		CreatedAt: createdAt,
+		Objects:   objects,
+	}
+
+	if m.Objects == nil {
+		m.Objects = []*ManifestObject{}
+	}
+
+	sort.Slice(m.Objects, func(i, j int) bool { return m.Objects[i].Key < m.Objects[j].Key })
+
+	for _, o := range m.Objects {
+		m.ObjectCount++
+		m.TotalBytes += o.Size
+	}
+
+	return m
+}
+
+// Verify compares the given list of current objects against the manifest.  An object is considered
+// modified if its size or ETag changed, or if both sides have a SHA-256 checksum and they differ.
+func (m *Manifest) Verify(current []*ManifestObject, checksums bool) *ManifestVerification {
+	v := &ManifestVerification{
+		ChecksumsVerified: checksums,
+		ObjectCount:       int64(len(current)),
+		Missing:           []string{},
+		Added:             []string{},
+		Modified:          []string{},
+	}
+
+	expected := make(map[string]*ManifestObject, len(m.Objects))
+	for _, o := range m.Objects {
+		expected[o.Key] = o
+	}
+
+	for _, o := range current {
+		e, ok := expected[o.Key]
+		if !ok {
+			v.Added = append(v.Added, o.Key)
+			continue
+		}
+		delete(expected, o.Key)
+
+		if e.Size != o.Size || e.ETag != o.ETag {
+			v.Modified = append(v.Modified, o.Key)
+			continue
+		}
+
+		if checksums && e.SHA256 != "" && o.SHA256 != "" && e.SHA256 != o.SHA256 {
+			v.Modified = append(v.Modified, o.Key)
+		}
+	}
+
+	for k := range expected {
+		v.Missing = append(v.Missing, k)
+	}
+
+	sort.Strings(v.Missing)
+	sort.Strings(v.Added)
+	sort.Strings(v.Modified)
+
+	v.Verified = len(v.Missing) == 0 && len(v.Added) == 0 && len(v.Modified) == 0
+
+	return v
+}
@@ -0,0 +1,87 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewManifest(t *testing.T) {
+	createdAt := time.Now().UTC().Truncate(time.Second)
+
+	m := NewManifest("abc", createdAt, []*ManifestObject{
+		&ManifestObject{Key: "b.csv", Size: 20, ETag: "\"bbb\""},
+		&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\""},
+	})
+
+	expected := &Manifest{
+		ID:          "abc",
+		CreatedAt:   createdAt,
+		ObjectCount: 2,
+		TotalBytes:  30,
+		Objects: []*ManifestObject{
+			&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\""},
+			&ManifestObject{Key: "b.csv", Size: 20, ETag: "\"bbb\""},
+		},
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %+v, got %+v", expected, m)
+	}
+
+	m = NewManifest("empty", createdAt, nil)
+	if m.Objects == nil || m.ObjectCount != 0 {
+		t.Errorf("expected empty manifest, got %+v", m)
+	}
+}
+
+func TestManifestVerify(t *testing.T) {
+	m := NewManifest("abc", time.Now(), []*ManifestObject{
+		&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\"", SHA256: "a1"},
+		&ManifestObject{Key: "b.csv", Size: 20, ETag: "\"bbb\"", SHA256: "b1"},
+		&ManifestObject{Key: "c.csv", Size: 30, ETag: "\"ccc\"", SHA256: "c1"},
+	})
+
+	// test unchanged
+	current := []*ManifestObject{
+		&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\"", SHA256: "a1"},
+		&ManifestObject{Key: "b.csv", Size: 20, ETag: "\"bbb\"", SHA256: "b1"},
+		&ManifestObject{Key: "c.csv", Size: 30, ETag: "\"ccc\"", SHA256: "c1"},
+	}
+
+	v := m.Verify(current, true)
+	if !v.Verified {
+		t.Errorf("expected verified, got %+v", v)
+	}
+
+	// test changes
+	current = []*ManifestObject{
+		&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\"", SHA256: "a2"},
+		&ManifestObject{Key: "b.csv", Size: 21, ETag: "\"bbb\""},
+		&ManifestObject{Key: "d.csv", Size: 40, ETag: "\"ddd\""},
+	}
+
+	v = m.Verify(current, true)
+	expected := &ManifestVerification{
+		Verified:          false,
+		ChecksumsVerified: true,
+		ObjectCount:       3,
+		Missing:           []string{"c.csv"},
+		Added:             []string{"d.csv"},
+		Modified:          []string{"a.csv", "b.csv"},
+	}
+
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected %+v, got %+v", expected, v)
+	}
+
+	// test checksum mismatch is ignored when not verifying checksums
+	v = m.Verify([]*ManifestObject{
+		&ManifestObject{Key: "a.csv", Size: 10, ETag: "\"aaa\"", SHA256: "a2"},
+		&ManifestObject{Key: "b.csv", Size: 20, ETag: "\"bbb\""},
+		&ManifestObject{Key: "c.csv", Size: 30, ETag: "\"ccc\""},
+	}, false)
+	if !v.Verified {
+		t.Errorf("expected verified, got %+v", v)
+	}
+}
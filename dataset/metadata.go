@@ -12,22 +12,25 @@ import (
 
 // Metadata is the structure of dataset metadata
 type Metadata struct {
-	ID                  string     `json:"id"`
-	Name                string     `json:"name"`
-	Description         string     `json:"description"`
-	CreatedAt           *time.Time `json:"created_at"`
-	CreatedBy           string     `json:"created_by"`
-	DataClassifications []string   `json:"data_classifications"`
-	DataFormat          string     `json:"data_format"`
-	DataStorage         string     `json:"data_storage"`
-	Derivative          bool       `json:"derivative"`
-	DuaURL              *url.URL   `json:"dua_url"`
-	FinalizedAt         *time.Time `json:"finalized_at"`
-	FinalizedBy         string     `json:"finalized_by"`
-	ModifiedAt          *time.Time `json:"modified_at"`
-	ModifiedBy          string     `json:"modified_by"`
-	ProctorResponseURL  *url.URL   `json:"proctor_response_url"`
-	SourceIDs           []string   `json:"source_ids"`
+	ID                  string             `json:"id"`
+	Name                string             `json:"name"`
+	Description         string             `json:"description"`
+	CreatedAt           *time.Time         `json:"created_at"`
+	CreatedBy           string             `json:"created_by"`
+	DataClassifications []string           `json:"data_classifications"`
+	DataFormat          string             `json:"data_format"`
+	DataStorage         string             `json:"data_storage"`
+	Derivative          bool               `json:"derivative"`
+	DuaURL              *url.URL           `json:"dua_url"`
+	FinalizedAt         *time.Time         `json:"finalized_at"`
+	FinalizedBy         string             `json:"finalized_by"`
+	Group               string             `json:"group"`
+	LastDataChange      *time.Time         `json:"last_data_change"`
+	Manifest            *ManifestReference `json:"manifest"`
+	ModifiedAt          *time.Time         `json:"modified_at"`
+	ModifiedBy          string             `json:"modified_by"`
+	ProctorResponseURL  *url.URL           `json:"proctor_response_url"`
+	SourceIDs           []string           `json:"source_ids"`
 }
 
 // UnmarshalJSON is a custom JSON unmarshaller for metadata
@@ -95,7 +98,7 @@ func (m *Metadata) UnmarshalJSON(j []byte) error {
 		m.CreatedBy = s
 	}
 
-	if dataClassifications, ok := rawStrings["data_classifications"]; ok {
+	if dataClassifications, ok := rawStrings["data_classifications"]; ok && dataClassifications != nil {
 		dcs, ok := dataClassifications.([]interface{})
 		if !ok {
 			msg := fmt.Sprintf("data_classification at is not a []interface{}: %+v", rawStrings["data_classifications"])
@@ -178,6 +181,51 @@ func (m *Metadata) UnmarshalJSON(j []byte) error {
 		m.FinalizedBy = s
 	}
 
+	if group, ok := rawStrings["group"]; ok {
+		s, ok := group.(string)
+		if !ok {
+			msg := fmt.Sprintf("group is not a string: %+v", rawStrings["group"])
+			return errors.New(msg)
+		}
+		m.Group = s
+	}
+
+	if lastDataChange, ok := rawStrings["last_data_change"]; ok && lastDataChange != nil {
+		ldc, ok := lastDataChange.(string)
+		if !ok {
+			msg := fmt.Sprintf("last_data_change is not a string: %+v", rawStrings["last_data_change"])
+			return errors.New(msg)
+		}
+		if ldc != "" {
+			t, err := time.Parse(time.RFC3339, ldc)
+			if err != nil {
+				msg := fmt.Sprintf("failed to parse last_data_change as time: %+v", t)
+				return errors.New(msg)
+			}
+			m.LastDataChange = &t
+		}
+	}
+
+	if manifest, ok := rawStrings["manifest"]; ok && manifest != nil {
+		if _, ok := manifest.(map[string]interface{}); !ok {
+			msg := fmt.Sprintf("manifest is not an object: %+v", rawStrings["manifest"])
+			return errors.New(msg)
+		}
+
+		// re-marshal the manifest reference so it can be decoded into its own type
+		mj, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+
+		ref := &ManifestReference{}
+		if err := json.Unmarshal(mj, ref); err != nil {
+			msg := fmt.Sprintf("failed to parse manifest: %s", err)
+			return errors.New(msg)
+		}
+		m.Manifest = ref
+	}
+
 	if modifiedAt, ok := rawStrings["modified_at"]; ok {
 		ma, ok := modifiedAt.(string)
 		if !ok {
@@ -258,6 +306,11 @@ func (m Metadata) MarshalJSON() ([]byte, error) {
 		finalizedAt = m.FinalizedAt.Format(time.RFC3339)
 	}
 
+	lastDataChange := ""
+	if m.LastDataChange != nil {
+		lastDataChange = m.LastDataChange.Format(time.RFC3339)
+	}
+
 	modifiedAt := ""
 	if m.ModifiedAt != nil {
 		modifiedAt = m.ModifiedAt.Format(time.RFC3339)
@@ -269,22 +322,25 @@ func (m Metadata) MarshalJSON() ([]byte, error) {
 	}
 
 	metadata := struct {
-		ID                  string   `json:"id"`
-		Name                string   `json:"name"`
-		Description         string   `json:"description"`
-		CreatedAt           string   `json:"created_at"`
-		CreatedBy           string   `json:"created_by"`
-		DataClassifications []string `json:"data_classifications"`
-		DataFormat          string   `json:"data_format"`
-		DataStorage         string   `json:"data_storage"`
-		Derivative          bool     `json:"derivative"`
-		DuaURL              string   `json:"dua_url"`
-		FinalizedAt         string   `json:"finalized_at"`
-		FinalizedBy         string   `json:"finalized_by"`
-		ModifiedAt          string   `json:"modified_at"`
-		ModifiedBy          string   `json:"modified_by"`
-		ProctorResponseURL  string   `json:"proctor_response_url"`
-		SourceIDs           []string `json:"source_ids"`
+		ID                  string             `json:"id"`
+		Name                string             `json:"name"`
+		Description         string             `json:"description"`
+		CreatedAt           string             `json:"created_at"`
+		CreatedBy           string             `json:"created_by"`
+		DataClassifications []string           `json:"data_classifications"`
+		DataFormat          string             `json:"data_format"`
+		DataStorage         string             `json:"data_storage"`
+		Derivative          bool               `json:"derivative"`
+		DuaURL              string             `json:"dua_url"`
+		FinalizedAt         string             `json:"finalized_at"`
+		FinalizedBy         string             `json:"finalized_by"`
+		Group               string             `json:"group,omitempty"`
+		LastDataChange      string             `json:"last_data_change,omitempty"`
+		Manifest            *ManifestReference `json:"manifest,omitempty"`
+		ModifiedAt          string             `json:"modified_at"`
+		ModifiedBy          string             `json:"modified_by"`
+		ProctorResponseURL  string             `json:"proctor_response_url"`
+		SourceIDs           []string           `json:"source_ids"`
 	}{
 		ID:                  m.ID,
 		Name:                m.Name,
@@ -298,6 +354,9 @@ func (m Metadata) MarshalJSON() ([]byte, error) {
 		DuaURL:              duaURL,
 		FinalizedAt:         finalizedAt,
 		FinalizedBy:         m.FinalizedBy,
+		Group:               m.Group,
+		LastDataChange:      lastDataChange,
+		Manifest:            m.Manifest,
 		ModifiedAt:          modifiedAt,
 		ModifiedBy:          m.ModifiedBy,
 		ProctorResponseURL:  proctorResponseURL,
@@ -23,6 +23,7 @@ func TestMetadataUnmarshalJSON(t *testing.T) {
 		"dua_url": "https://allmydata.s3.amazonaws.com/duas/alien_dua.pdf",
 		"finalized_at": "2013-06-21T10:10:01.123Z",
 		"finalized_by": "zbrannigan",
+		"group": "dsgroup",
 		"modified_at": "2015-11-21T04:19:01.123Z",
 		"modified_by": "kkroker",
 		"proctor_response_url": "https://allmydata.s3.amazonaws.com/proctor/alien_study.json",
@@ -51,6 +52,7 @@ func TestMetadataUnmarshalJSON(t *testing.T) {
 		DuaURL:              duaURL,
 		FinalizedAt:         &finalizedAt,
 		FinalizedBy:         "zbrannigan",
+		Group:               "dsgroup",
 		ModifiedAt:          &modifiedAt,
 		ModifiedBy:          "kkroker",
 		ProctorResponseURL:  procURL,
@@ -146,6 +148,53 @@ func TestMetadataUnmarshalJSON(t *testing.T) {
 		t.Error("expected error for bad finalized_by, got nil")
 	}
 
+	// manifest type
+	if err := out.UnmarshalJSON([]byte(`{"manifest":false}`)); err == nil {
+		t.Error("expected error for bad manifest, got nil")
+	}
+
+	// manifest field type
+	if err := out.UnmarshalJSON([]byte(`{"manifest":{"object_count":"many"}}`)); err == nil {
+		t.Error("expected error for bad manifest object_count, got nil")
+	}
+
+	// manifest
+	manifestCreatedAt, _ := time.Parse(time.RFC3339, "2013-06-21T10:10:01Z")
+	out = &Metadata{}
+	if err := out.UnmarshalJSON([]byte(`{"manifest":{"location":"s3://bucket/_manifest/manifest.json","sha256":"abc","object_count":2,"total_bytes":30,"created_at":"2013-06-21T10:10:01Z"}}`)); err != nil {
+		t.Errorf("expected nil error for manifest, got %s", err)
+	}
+	expectedManifest := &ManifestReference{
+		Location:    "s3://bucket/_manifest/manifest.json",
+		SHA256:      "abc",
+		ObjectCount: 2,
+		TotalBytes:  30,
+		CreatedAt:   &manifestCreatedAt,
+	}
+	if !reflect.DeepEqual(out.Manifest, expectedManifest) {
+		t.Errorf("expected manifest %+v, got %+v", expectedManifest, out.Manifest)
+	}
+
+	// last_data_change type
+	if err := out.UnmarshalJSON([]byte(`{"last_data_change":false}`)); err == nil {
+		t.Error("expected error for bad last_data_change, got nil")
+	}
+
+	// last_data_change date type
+	if err := out.UnmarshalJSON([]byte(`{"last_data_change":"12345"}`)); err == nil {
+		t.Error("expected error for bad last_data_change, got nil")
+	}
+
+	// last_data_change
+	lastDataChange, _ := time.Parse(time.RFC3339, "2013-06-22T08:00:00Z")
+	out = &Metadata{}
+	if err := out.UnmarshalJSON([]byte(`{"last_data_change":"2013-06-22T08:00:00Z"}`)); err != nil {
+		t.Errorf("expected nil error for last_data_change, got %s", err)
+	}
+	if out.LastDataChange == nil || !out.LastDataChange.Equal(lastDataChange) {
+		t.Errorf("expected last_data_change %s, got %v", lastDataChange, out.LastDataChange)
+	}
+
 	// modified_at type
 	if err := out.UnmarshalJSON([]byte(`{"modified_at":false}`)); err == nil {
 		t.Error("expected error for bad modified_at, got nil")
@@ -176,6 +225,11 @@ func TestMetadataUnmarshalJSON(t *testing.T) {
 		t.Error("expected error for bad source_ids array, got nil")
 	}
 
+	// null arrays, as marshalled for metadata without classifications or sources
+	if err := out.UnmarshalJSON([]byte(`{"data_classifications":null,"source_ids":null}`)); err != nil {
+		t.Errorf("expected nil error for null arrays, got %s", err)
+	}
+
 }
 
 func TestMetadataMarshalJSON(t *testing.T) {
@@ -188,6 +242,7 @@ func TestMetadataMarshalJSON(t *testing.T) {
 	createdAt, _ := time.Parse(time.RFC3339, "2013-06-19T19:14:01.123Z")
 	finalizedAt, _ := time.Parse(time.RFC3339, "2013-06-21T10:10:01.123Z")
 	modifiedAt, _ := time.Parse(time.RFC3339, "2015-11-21T04:19:01.123Z")
+	lastDataChange, _ := time.Parse(time.RFC3339, "2013-06-22T08:00:00Z")
 	duaURL, _ := url.Parse("https://allmydata.s3.amazonaws.com/duas/alien_dua.pdf")
 	procURL, _ := url.Parse("https://allmydata.s3.amazonaws.com/proctor/alien_study.json")
 
@@ -223,6 +278,16 @@ func TestMetadataMarshalJSON(t *testing.T) {
 			[]byte(`{"id":"08d754ba-8540-4fdc-92f3-47950c1cdb1c","name":"alien-sightings-dataset","description":"Alien sightings","created_at":"2013-06-19T19:14:01Z","created_by":"zbrannigan","data_classifications":["extremelyclassified"],"data_format":"file","data_storage":"s3","derivative":false,"dua_url":"https://allmydata.s3.amazonaws.com/duas/alien_dua.pdf","finalized_at":"2013-06-21T10:10:01Z","finalized_by":"zbrannigan","modified_at":"2015-11-21T04:19:01Z","modified_by":"kkroker","proctor_response_url":"https://allmydata.s3.amazonaws.com/proctor/alien_study.json","source_ids":["ea19d935-6ca3-4711-8e3e-24713cc3ac00","801e1c4f-58ff-4f14-af1f-0fd6a09cdaef","c00925d6-2eef-4fb6-aef1-87152613222c"]}`),
 			nil,
 		},
+		test{
+			Metadata{
+				ID:             "08d754ba-8540-4fdc-92f3-47950c1cdb1c",
+				FinalizedAt:    &finalizedAt,
+				Group:          "dsgroup",
+				LastDataChange: &lastDataChange,
+			},
+			[]byte(`{"id":"08d754ba-8540-4fdc-92f3-47950c1cdb1c","name":"","description":"","created_at":"","created_by":"","data_classifications":null,"data_format":"","data_storage":"","derivative":false,"dua_url":"","finalized_at":"2013-06-21T10:10:01Z","finalized_by":"","group":"dsgroup","last_data_change":"2013-06-22T08:00:00Z","modified_at":"","modified_by":"","proctor_response_url":"","source_ids":null}`),
+			nil,
+		},
 	}
 
 	for _, tst := range tests {
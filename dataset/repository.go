@@ -1,10 +1,16 @@
 package dataset
 
+import (
+	"strings"
+	"time"
+)
+
 // Repository is information about a data repository
 type Repository struct {
-	Name  string `json:"name"`
-	Empty bool   `json:"empty"`
-	Tags  []*Tag `json:"tags"`
+	Name      string     `json:"name"`
+	Empty     bool       `json:"empty"`
+	Tags      []*Tag     `json:"tags"`
+	Inventory *Inventory `json:"inventory,omitempty"`
 }
 
 // Tag is the structure of a data repository tag
@@ -12,3 +18,76 @@ type Tag struct {
 	Key   *string `json:"key"`
 	Value *string `json:"value"`
 }
+
+// Inventory summarizes the contents of a data repository
+// Source is either "scan" (listing of the repository) or "inventory" (a scheduled inventory report)
+type Inventory struct {
+	ObjectCount    int64                      `json:"object_count"`
+	TotalBytes     int64                      `json:"total_bytes"`
+	StorageClasses map[string]*InventoryUsage `json:"storage_classes"`
+	Prefixes       map[string]*InventoryUsage `json:"prefixes"`
+	LastWrite      *time.Time                 `json:"last_write"`
+	Source         string                     `json:"source"`
+	GeneratedAt    time.Time                  `json:"generated_at"`
+}
+
+// InventoryUsage is the object count and total size for a subset of a data repository
+type InventoryUsage struct {
+	ObjectCount int64 `json:"object_count"`
+	TotalBytes  int64 `json:"total_bytes"`
+}
+
+// NewInventory returns an empty inventory from the given source
+func NewInventory(source string, generatedAt time.Time) *Inventory {
+	return &Inventory{
+		StorageClasses: map[string]*InventoryUsage{},
+		Prefixes:       map[string]*InventoryUsage{},
+		Source:         source,
+		GeneratedAt:    generatedAt,
+	}
+}
+
+// Add counts an object in the inventory.  Objects are grouped by their top-level prefix
+// (everything up to and including the first "/"), objects at the root are grouped under "/"
+func (i *Inventory) Add(key, storageClass string, size int64, modified time.Time) {
+	i.ObjectCount++
+	i.TotalBytes += size
+
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+
+	if _, ok := i.StorageClasses[storageClass]; !ok {
+		i.StorageClasses[storageClass] = &InventoryUsage{}
+	}
+	i.StorageClasses[storageClass].ObjectCount++
+	i.StorageClasses[storageClass].TotalBytes += size
+
+	prefix := "/"
+	if n := strings.Index(key, "/"); n >= 0 {
+		prefix = key[:n+1]
+	}
+
+	if _, ok := i.Prefixes[prefix]; !ok {
+		i.Prefixes[prefix] = &InventoryUsage{}
+	}
+	i.Prefixes[prefix].ObjectCount++
+	i.Prefixes[prefix].TotalBytes += size
+
+	if !modified.IsZero() && (i.LastWrite == nil || modified.After(*i.LastWrite)) {
+		m := modified
+		i.LastWrite = &m
+	}
+}
+
+// NetworkRestriction limits access to a data repository to requests through the given VPC endpoints
+// (ie. "vpce-0123456789abcdef0") or from the given source CIDRs.  An empty restriction allows access from anywhere.
+type NetworkRestriction struct {
+	VPCEndpoints []string `json:"vpc_endpoints,omitempty"`
+	SourceCIDRs  []string `json:"source_cidrs,omitempty"`
+}
+
+// Empty returns true if the restriction doesn't limit access
+func (n *NetworkRestriction) Empty() bool {
+	return n == nil || (len(n.VPCEndpoints) == 0 && len(n.SourceCIDRs) == 0)
+}
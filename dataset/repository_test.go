@@ -0,0 +1,46 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInventoryAdd(t *testing.T) {
+	generatedAt := time.Now().UTC().Truncate(time.Second)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T01:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-02-02T02:00:00Z")
+
+	inventory := NewInventory("scan", generatedAt)
+	inventory.Add("raw/file1.csv", "STANDARD", 100, time1)
+	inventory.Add("raw/nested/file2.csv", "GLACIER", 200, time2)
+	inventory.Add("readme.txt", "", 10, time1)
+	inventory.Add("_attachments/dua.pdf", "STANDARD", 1000, time.Time{})
+
+	expected := &Inventory{
+		ObjectCount: 4,
+		TotalBytes:  1310,
+		StorageClasses: map[string]*InventoryUsage{
+			"STANDARD": &InventoryUsage{ObjectCount: 3, TotalBytes: 1110},
+			"GLACIER":  &InventoryUsage{ObjectCount: 1, TotalBytes: 200},
+		},
+		Prefixes: map[string]*InventoryUsage{
+			"raw/":          &InventoryUsage{ObjectCount: 2, TotalBytes: 300},
+			"/":             &InventoryUsage{ObjectCount: 1, TotalBytes: 10},
+			"_attachments/": &InventoryUsage{ObjectCount: 1, TotalBytes: 1000},
+		},
+		LastWrite:   &time2,
+		Source:      "scan",
+		GeneratedAt: generatedAt,
+	}
+
+	if !reflect.DeepEqual(inventory, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, inventory)
+	}
+
+	// empty inventory
+	inventory = NewInventory("inventory", generatedAt)
+	if inventory.ObjectCount != 0 || inventory.TotalBytes != 0 || inventory.LastWrite != nil {
+		t.Errorf("expected empty inventory, got: %+v", inventory)
+	}
+}
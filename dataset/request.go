@@ -0,0 +1,53 @@
+package dataset
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	log "github.com/sirupsen/logrus"
+)
+
+type requestIDContextKey struct{}
+
+// NewRequestIDContext returns a copy of the context carrying the request id
+func NewRequestIDContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id carried by the context, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// RequestIDHook is a logrus hook that adds the request id of the entry context as the request_id field, so log
+// entries created with log.WithContext(ctx) can be tied to the request
+type RequestIDHook struct{}
+
+// Levels returns the log levels the hook fires for
+func (RequestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire adds the request id to the entry
+func (RequestIDHook) Fire(entry *log.Entry) error {
+	if requestID := RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data["request_id"] = requestID
+	}
+	return nil
+}
+
+// RequestIDHandler is an AWS SDK request handler that appends the request id of the request context to the user
+// agent, so CloudTrail events can be tied to the request
+var RequestIDHandler = request.NamedHandler{
+	Name: "dataset.RequestIDHandler",
+	Fn: func(r *request.Request) {
+		if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+			request.AddToUserAgent(r, "request-id/"+requestID)
+		}
+	},
+}
@@ -0,0 +1,39 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRequestIDContext(t *testing.T) {
+	if id := RequestIDFromContext(context.TODO()); id != "" {
+		t.Errorf("expected empty request id, got %s", id)
+	}
+
+	ctx := NewRequestIDContext(context.TODO(), "abc123")
+	if id := RequestIDFromContext(ctx); id != "abc123" {
+		t.Errorf("expected request id abc123, got %s", id)
+	}
+}
+
+func TestRequestIDHook(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(out)
+	logger.AddHook(RequestIDHook{})
+
+	logger.WithContext(NewRequestIDContext(context.TODO(), "abc123")).Info("with request")
+	if !strings.Contains(out.String(), "request_id=abc123") {
+		t.Errorf("expected request id in log entry, got %s", out.String())
+	}
+
+	out.Reset()
+	logger.WithContext(context.TODO()).Info("without request")
+	if strings.Contains(out.String(), "request_id") {
+		t.Errorf("expected no request id in log entry, got %s", out.String())
+	}
+}
@@ -0,0 +1,29 @@
+package dataset
+
+import "time"
+
+// share access levels
+const (
+	ShareAccessRead  = "read"
+	ShareAccessWrite = "write"
+)
+
+// Share is access to a dataset from another AWS account.  The other account is granted access in the bucket
+// policy and, if ExternalID is set, can also assume the cross-account role RoleArn with that external id.
+type Share struct {
+	ID         string     `json:"id"`
+	DatasetID  string     `json:"dataset_id"`
+	Group      string     `json:"group"`
+	AccountID  string     `json:"account_id"`
+	Access     string     `json:"access"`
+	RoleArn    string     `json:"role_arn,omitempty"`
+	ExternalID string     `json:"external_id,omitempty"`
+	SharedAt   *time.Time `json:"shared_at"`
+	SharedBy   string     `json:"shared_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired returns true if the share is past its expiration time
+func (s *Share) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && now.After(*s.ExpiresAt)
+}
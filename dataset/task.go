@@ -0,0 +1,37 @@
+package dataset
+
+import "time"
+
+// Task statuses
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusCompleted = "completed"
+	TaskStatusFailed    = "failed"
+)
+
+// Task is a long running, asynchronous operation on a dataset
+type Task struct {
+	ID          string        `json:"id"`
+	DatasetID   string        `json:"dataset_id"`
+	Type        string        `json:"type"`
+	Status      string        `json:"status"`
+	Progress    *CopyProgress `json:"progress,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+}
+
+// CopyInput selects the objects to copy from a source dataset, either by prefix or by key
+type CopyInput struct {
+	Prefixes []string `json:"prefixes"`
+	Keys     []string `json:"keys"`
+}
+
+// CopyProgress reports the progress of copying objects between datasets
+type CopyProgress struct {
+	ObjectsTotal  int64 `json:"objects_total"`
+	ObjectsCopied int64 `json:"objects_copied"`
+	BytesTotal    int64 `json:"bytes_total"`
+	BytesCopied   int64 `json:"bytes_copied"`
+}
@@ -0,0 +1,40 @@
+package dataset
+
+import "time"
+
+// Webhook is a subscription of an HTTP endpoint to the events of the datasets in a group.  Events are delivered
+// as JSON, signed with the Secret.  A webhook without Events is subscribed to all events.
+type Webhook struct {
+	ID        string     `json:"id"`
+	Group     string     `json:"group"`
+	URL       string     `json:"url"`
+	Events    []string   `json:"events,omitempty"`
+	Secret    string     `json:"secret,omitempty"`
+	CreatedAt *time.Time `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+}
+
+// Subscribed returns true if the webhook is subscribed to the event type
+func (w *Webhook) Subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetter is an event that couldn't be delivered to a webhook, after all of the attempts failed
+type DeadLetter struct {
+	ID        string     `json:"id"`
+	WebhookID string     `json:"webhook_id"`
+	Group     string     `json:"group"`
+	Event     *Event     `json:"event"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error"`
+	FailedAt  *time.Time `json:"failed_at"`
+}
@@ -0,0 +1,63 @@
+package eventbridgepublisher
+
+import (
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+func ErrCode(msg string, err error) error {
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		switch aerr.Code() {
+		case
+			"AccessDeniedException",
+
+			// The most likely cause is an invalid AWS access key ID or secret key.
+			"UnrecognizedClientException":
+
+			return apierror.New(apierror.ErrForbidden, msg, aerr)
+		case
+
+			// ErrCodeResourceNotFoundException for service response error code
+			// "ResourceNotFoundException".
+			//
+			// An entity that you specified does not exist.
+			eventbridge.ErrCodeResourceNotFoundException:
+
+			return apierror.New(apierror.ErrNotFound, msg, aerr)
+		case
+
+			// ErrCodeLimitExceededException for service response error code
+			// "LimitExceededException".
+			//
+			// The request failed because it attempted to create resource beyond the allowed
+			// service quota.
+			eventbridge.ErrCodeLimitExceededException,
+
+			"ThrottlingException":
+
+			return apierror.New(apierror.ErrLimitExceeded, msg, aerr)
+		case
+
+			// ErrCodeInternalException for service response error code
+			// "InternalException".
+			//
+			// This exception occurs due to unexpected causes.
+			eventbridge.ErrCodeInternalException,
+
+			// ErrCodeOperationDisabledException for service response error code
+			// "OperationDisabledException".
+			//
+			// The operation you are attempting is not available in this region.
+			eventbridge.ErrCodeOperationDisabledException:
+
+			return apierror.New(apierror.ErrServiceUnavailable, msg, aerr)
+		default:
+			m := msg + ": " + aerr.Message()
+			return apierror.New(apierror.ErrBadRequest, m, aerr)
+		}
+	}
+
+	return apierror.New(apierror.ErrInternalError, msg, err)
+}
@@ -0,0 +1,45 @@
+package eventbridgepublisher
+
+import (
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/pkg/errors"
+)
+
+func TestErrCode(t *testing.T) {
+	apiErrorTestCases := map[string]string{
+		"": apierror.ErrBadRequest,
+
+		"AccessDeniedException":       apierror.ErrForbidden,
+		"UnrecognizedClientException": apierror.ErrForbidden,
+
+		eventbridge.ErrCodeResourceNotFoundException: apierror.ErrNotFound,
+
+		eventbridge.ErrCodeLimitExceededException: apierror.ErrLimitExceeded,
+		"ThrottlingException":                     apierror.ErrLimitExceeded,
+
+		eventbridge.ErrCodeInternalException:          apierror.ErrServiceUnavailable,
+		eventbridge.ErrCodeOperationDisabledException: apierror.ErrServiceUnavailable,
+
+		"ValidationException": apierror.ErrBadRequest,
+	}
+
+	for awsErr, apiErr := range apiErrorTestCases {
+		err := ErrCode("test error", awserr.New(awsErr, awsErr, nil))
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+			if aerr.Code != apiErr {
+				t.Errorf("expected eventbridge error %s to be an apierror.Error %s, got %s", awsErr, apiErr, aerr.Code)
+			}
+		} else {
+			t.Errorf("expected eventbridge error %s to be an apierror.Error %s, got %s", awsErr, apiErr, err)
+		}
+	}
+
+	err := ErrCode("test error", errors.New("Unknown"))
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrInternalError {
+		t.Errorf("expected unknown error to be an apierror.ErrInternalError, got %s", err)
+	}
+}
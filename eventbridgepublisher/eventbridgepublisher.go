@@ -0,0 +1,190 @@
+// Package eventbridgepublisher publishes dataset lifecycle events to an Amazon EventBridge event bus.  Each event
+// is put with the event type as detail type and the JSON encoded event as detail, so rules can match on
+// "detail-type" and on any field of the event, ie. "detail.group".
+package eventbridgepublisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSource is the default source of the events put on the event bus
+const DefaultSource = "edu.yale.spinup.ds-api"
+
+// EventBridgePublisherOption is a function to set publisher options
+type EventBridgePublisherOption func(*EventBridgePublisher)
+
+// EventBridgePublisher is an implementation of an event publisher in EventBridge
+type EventBridgePublisher struct {
+	EventBus    string
+	Source      string
+	EventBridge eventbridgeiface.EventBridgeAPI
+	config      *aws.Config
+}
+
+// NewDefaultPublisher creates a new publisher from the default config data.  The event bus is the name or
+// ARN of the bus in the account config eventBus, and the source can be overridden with eventSource.
+func NewDefaultPublisher(config map[string]interface{}) (*EventBridgePublisher, error) {
+	var akid, secret, token, region, endpoint, eventBus, eventSource string
+	if v, ok := config["akid"].(string); ok {
+		akid = v
+	}
+
+	if v, ok := config["secret"].(string); ok {
+		secret = v
+	}
+
+	if v, ok := config["token"].(string); ok {
+		token = v
+	}
+
+	if v, ok := config["region"].(string); ok {
+		region = v
+	}
+
+	if v, ok := config["endpoint"].(string); ok {
+		endpoint = v
+	}
+
+	if v, ok := config["eventBus"].(string); ok {
+		eventBus = v
+	}
+
+	if v, ok := config["eventSource"].(string); ok {
+		eventSource = v
+	}
+
+	if eventBus == "" {
+		return nil, fmt.Errorf("eventBus is required for the eventbridge publisher")
+	}
+
+	opts := []EventBridgePublisherOption{
+		WithStaticCredentials(akid, secret, token),
+		WithEventBus(eventBus),
+		WithSource(DefaultSource),
+	}
+
+	if region != "" {
+		opts = append(opts, WithRegion(region))
+	}
+
+	if endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint))
+	}
+
+	if eventSource != "" {
+		opts = append(opts, WithSource(eventSource))
+	}
+
+	return New(opts...)
+}
+
+// New creates an EventBridgePublisher from a list of EventBridgePublisherOption functions
+func New(opts ...EventBridgePublisherOption) (*EventBridgePublisher, error) {
+	log.Info("creating new eventbridge event publisher")
+
+	p := EventBridgePublisher{}
+	p.config = aws.NewConfig()
+
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	sess := session.Must(session.NewSession(p.config))
+	sess.Handlers.Build.PushBackNamed(dataset.RequestIDHandler)
+
+	p.EventBridge = eventbridge.New(sess)
+
+	return &p, nil
+}
+
+// WithStaticCredentials authenticates with AWS static credentials (key, secret, token)
+func WithStaticCredentials(akid, secret, token string) EventBridgePublisherOption {
+	return func(p *EventBridgePublisher) {
+		log.Debugf("setting static credentials with akid %s", akid)
+		p.config.WithCredentials(credentials.NewStaticCredentials(akid, secret, token))
+	}
+}
+
+// WithRegion sets the region for the EventBridgePublisher
+func WithRegion(region string) EventBridgePublisherOption {
+	return func(p *EventBridgePublisher) {
+		log.Debugf("setting region %s", region)
+		p.config.WithRegion(region)
+	}
+}
+
+// WithEndpoint sets the endpoint for the EventBridgePublisher
+func WithEndpoint(endpoint string) EventBridgePublisherOption {
+	return func(p *EventBridgePublisher) {
+		log.Debugf("setting endpoint %s", endpoint)
+		p.config.WithEndpoint(endpoint)
+	}
+}
+
+// WithEventBus sets the name or ARN of the event bus the events are put on
+func WithEventBus(eventBus string) EventBridgePublisherOption {
+	return func(p *EventBridgePublisher) {
+		log.Debugf("setting event bus %s", eventBus)
+		p.EventBus = eventBus
+	}
+}
+
+// WithSource sets the source of the events
+func WithSource(source string) EventBridgePublisherOption {
+	return func(p *EventBridgePublisher) {
+		p.Source = source
+	}
+}
+
+// Publish puts a dataset event on the event bus
+func (p *EventBridgePublisher) Publish(ctx context.Context, event *dataset.Event) error {
+	if event == nil || event.Type == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", fmt.Errorf("empty event or event type"))
+	}
+
+	detail, err := json.Marshal(event)
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to encode event", err)
+	}
+
+	log.WithContext(ctx).Debugf("putting %s event %s on event bus %s", event.Type, event.ID, p.EventBus)
+
+	out, err := p.EventBridge.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{
+			{
+				Detail:       aws.String(string(detail)),
+				DetailType:   aws.String(event.Type),
+				EventBusName: aws.String(p.EventBus),
+				Source:       aws.String(p.Source),
+				Time:         aws.Time(event.Time),
+			},
+		},
+	})
+	if err != nil {
+		return ErrCode("failed to put event on event bus "+p.EventBus, err)
+	}
+
+	// PutEvents succeeds even if entries are rejected, ie. when they're throttled
+	if aws.Int64Value(out.FailedEntryCount) > 0 {
+		msg := fmt.Sprintf("failed to put event %s on event bus %s", event.ID, p.EventBus)
+		for _, e := range out.Entries {
+			if e.ErrorCode != nil {
+				return apierror.New(apierror.ErrServiceUnavailable, msg, fmt.Errorf("%s: %s", aws.StringValue(e.ErrorCode), aws.StringValue(e.ErrorMessage)))
+			}
+		}
+		return apierror.New(apierror.ErrServiceUnavailable, msg, nil)
+	}
+
+	return nil
+}
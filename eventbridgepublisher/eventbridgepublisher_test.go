@@ -0,0 +1,174 @@
+package eventbridgepublisher
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/pkg/errors"
+)
+
+type mockEventBridgeClient struct {
+	eventbridgeiface.EventBridgeAPI
+	t       *testing.T
+	err     error
+	failed  bool
+	entries []*eventbridge.PutEventsRequestEntry
+}
+
+func (m *mockEventBridgeClient) PutEventsWithContext(ctx context.Context, input *eventbridge.PutEventsInput, opts ...request.Option) (*eventbridge.PutEventsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	m.t.Logf("putting %d events", len(input.Entries))
+	m.entries = append(m.entries, input.Entries...)
+
+	if m.failed {
+		return &eventbridge.PutEventsOutput{
+			FailedEntryCount: aws.Int64(1),
+			Entries: []*eventbridge.PutEventsResultEntry{
+				{
+					ErrorCode:    aws.String("ThrottlingException"),
+					ErrorMessage: aws.String("Rate exceeded"),
+				},
+			},
+		}, nil
+	}
+
+	return &eventbridge.PutEventsOutput{
+		FailedEntryCount: aws.Int64(0),
+		Entries: []*eventbridge.PutEventsResultEntry{
+			{EventId: aws.String("11111111-2222-3333-4444-555555555555")},
+		},
+	}, nil
+}
+
+func TestNewDefaultPublisher(t *testing.T) {
+	testConfig := map[string]interface{}{
+		"region":   "us-east-1",
+		"akid":     "xxxxx",
+		"secret":   "yyyyy",
+		"endpoint": "https://under.mydesk.amazonaws.com",
+		"eventBus": "dsapi-test-bus",
+	}
+
+	p, err := NewDefaultPublisher(testConfig)
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
+	to := reflect.TypeOf(p).String()
+	if to != "*eventbridgepublisher.EventBridgePublisher" {
+		t.Errorf("expected type to be '*eventbridgepublisher.EventBridgePublisher', got %s", to)
+	}
+
+	if p.config.Credentials == nil {
+		t.Error("expected config Credentials to be set, got nil")
+	}
+
+	if aws.StringValue(p.config.Region) != "us-east-1" {
+		t.Errorf("expected region to be us-east-1, got %s", aws.StringValue(p.config.Region))
+	}
+
+	if p.EventBus != "dsapi-test-bus" {
+		t.Errorf("expected event bus to be dsapi-test-bus, got %s", p.EventBus)
+	}
+
+	if p.Source != DefaultSource {
+		t.Errorf("expected source to be %s, got %s", DefaultSource, p.Source)
+	}
+
+	testConfig["eventSource"] = "edu.example.datasets"
+	if p, err = NewDefaultPublisher(testConfig); err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	} else if p.Source != "edu.example.datasets" {
+		t.Errorf("expected source to be edu.example.datasets, got %s", p.Source)
+	}
+
+	delete(testConfig, "eventBus")
+	if _, err = NewDefaultPublisher(testConfig); err == nil {
+		t.Error("expected error for missing eventBus, got nil")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	client := &mockEventBridgeClient{t: t}
+	p := EventBridgePublisher{
+		EventBus:    "dsapi-test-bus",
+		Source:      DefaultSource,
+		EventBridge: client,
+	}
+
+	event := &dataset.Event{
+		ID:        "event-1",
+		Type:      dataset.EventDatasetCreated,
+		Time:      time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC),
+		Account:   "acct1",
+		Group:     "group1",
+		DatasetID: "dataset-1",
+		User:      "tester",
+	}
+
+	if err := p.Publish(context.TODO(), event); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if len(client.entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(client.entries))
+	}
+
+	entry := client.entries[0]
+	if aws.StringValue(entry.EventBusName) != "dsapi-test-bus" {
+		t.Errorf("expected event bus dsapi-test-bus, got %s", aws.StringValue(entry.EventBusName))
+	}
+
+	if aws.StringValue(entry.Source) != DefaultSource {
+		t.Errorf("expected source %s, got %s", DefaultSource, aws.StringValue(entry.Source))
+	}
+
+	if aws.StringValue(entry.DetailType) != dataset.EventDatasetCreated {
+		t.Errorf("expected detail type %s, got %s", dataset.EventDatasetCreated, aws.StringValue(entry.DetailType))
+	}
+
+	if !aws.TimeValue(entry.Time).Equal(event.Time) {
+		t.Errorf("expected time %s, got %s", event.Time, aws.TimeValue(entry.Time))
+	}
+
+	detail := &dataset.Event{}
+	if err := json.Unmarshal([]byte(aws.StringValue(entry.Detail)), detail); err != nil {
+		t.Fatalf("expected detail to be a json encoded event, got error: %s", err)
+	}
+
+	if !reflect.DeepEqual(detail, event) {
+		t.Errorf("expected detail %+v, got %+v", event, detail)
+	}
+
+	// test empty event
+	if err := p.Publish(context.TODO(), nil); err == nil {
+		t.Error("expected error for nil event, got nil")
+	}
+
+	// test failed entries
+	client.failed = true
+	err := p.Publish(context.TODO(), event)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected %s error for failed entry, got %v", apierror.ErrServiceUnavailable, err)
+	}
+
+	// test api error
+	client.err = awserr.New(eventbridge.ErrCodeResourceNotFoundException, "Event bus dsapi-test-bus does not exist.", nil)
+	err = p.Publish(context.TODO(), event)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected %s error for missing event bus, got %v", apierror.ErrNotFound, err)
+	}
+}
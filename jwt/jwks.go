@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// jwk is a single JSON Web Key, only the members needed for RSA and EC public keys are decoded
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet is a set of public keys, loaded from a local JWKS file or a JWKS URL.  Keys from a URL are
+// cached and refreshed when they expire, or when a token is signed with an unknown key id.
+type keySet struct {
+	file string
+	url  string
+
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+
+	// fetching is closed when the running fetch of the JWKS URL is done, it's nil if no fetch is running
+	fetching chan struct{}
+}
+
+// defaultJWKSCacheTTL is how long keys fetched from a JWKS URL are cached
+const defaultJWKSCacheTTL = 1 * time.Hour
+
+// minJWKSRefreshInterval limits how often the JWKS URL is fetched because of an unknown key id
+const minJWKSRefreshInterval = 1 * time.Minute
+
+func newKeySet(file, url string) (*keySet, error) {
+	if (file == "") == (url == "") {
+		return nil, errors.New("exactly one of jwksFile or jwksUrl is required")
+	}
+
+	ks := &keySet{
+		file:       file,
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		ttl:        defaultJWKSCacheTTL,
+		minRefresh: minJWKSRefreshInterval,
+	}
+
+	// local key sets are loaded once, up front
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open jwks file %s", file)
+		}
+		defer f.Close()
+
+		keys, err := parseKeySet(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse jwks file %s", file)
+		}
+		ks.keys = keys
+	}
+
+	return ks, nil
+}
+
+// key returns the public key with the given key id.  If there's no key id, and the set has only one key, that key is used.
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if ks.url != "" {
+		if err := ks.refresh(ctx, kid); err != nil {
+			return nil, err
+		}
+	}
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, nil
+		}
+	}
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id '%s'", kid)
+	}
+
+	return k, nil
+}
+
+// refresh fetches the key set from the JWKS URL when the cached keys expired, or the key id is unknown.  The URL
+// is fetched without holding the lock, so a slow issuer doesn't block validating tokens with the cached keys, only
+// callers without any cached keys wait for the running fetch.
+func (ks *keySet) refresh(ctx context.Context, kid string) error {
+	ks.Lock()
+
+	expired := time.Since(ks.fetchedAt) > ks.ttl
+	_, known := ks.keys[kid]
+	if ks.fetching != nil || !(expired || (!known && time.Since(ks.fetchedAt) > ks.minRefresh)) {
+		fetching, cached := ks.fetching, ks.keys != nil
+		ks.Unlock()
+
+		if fetching != nil && !cached {
+			select {
+			case <-fetching:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		return nil
+	}
+
+	// set the fetch time first, so failures are also rate limited
+	ks.fetchedAt = time.Now()
+	fetching := make(chan struct{})
+	ks.fetching = fetching
+	ks.Unlock()
+
+	keys, err := ks.fetch(ctx)
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	ks.fetching = nil
+	close(fetching)
+
+	if err != nil {
+		// keep using the cached keys if the refresh fails
+		if ks.keys == nil {
+			return err
+		}
+		log.Warnf("failed to refresh jwks from %s, using cached keys: %s", ks.url, err)
+		return nil
+	}
+
+	ks.keys = keys
+	return nil
+}
+
+// fetch gets the key set from the JWKS URL
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	log.Debugf("fetching jwks from %s", ks.url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create jwks request for %s", ks.url)
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch jwks from %s", ks.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status fetching jwks from %s: %d", ks.url, resp.StatusCode)
+	}
+
+	keys, err := parseKeySet(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse jwks from %s", ks.url)
+	}
+
+	return keys, nil
+}
+
+// parseKeySet decodes a JWKS document into public keys by key id.  Keys that aren't RSA or EC signing
+// keys are skipped.
+func parseKeySet(r io.Reader) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key '%s'", k.Kid)
+		}
+
+		if pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the RSA or EC public key, or nil for unsupported key types
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return pub, nil
+	default:
+		log.Debugf("skipping unsupported jwk key type '%s' (%s)", k.Kty, k.Kid)
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
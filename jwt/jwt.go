@@ -0,0 +1,269 @@
+// Package jwt validates RS256 and ES256 signed JSON Web Tokens against the JSON Web Key Sets of trusted issuers
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLeeway is the allowed clock skew when checking token times
+const defaultLeeway = 1 * time.Minute
+
+// Claims are the validated claims of a token that are mapped to the caller
+type Claims struct {
+	Issuer  string
+	Subject string
+	User    string
+	Groups  []string
+	Roles   []string
+}
+
+// Validator validates tokens for a set of trusted issuers
+type Validator struct {
+	issuers map[string]*issuer
+	leeway  time.Duration
+	now     func() time.Time
+}
+
+type issuer struct {
+	name        string
+	audience    string
+	userClaim   string
+	groupsClaim string
+	rolesClaim  string
+	keys        *keySet
+}
+
+// NewValidator creates a token validator for the configured issuers.  Each issuer needs an audience, so tokens
+// the issuer signed for other applications aren't accepted, and either a local JWKS file or a JWKS URL.
+func NewValidator(config []common.Issuer) (*Validator, error) {
+	v := &Validator{
+		issuers: make(map[string]*issuer, len(config)),
+		leeway:  defaultLeeway,
+		now:     time.Now,
+	}
+
+	for _, c := range config {
+		if c.Issuer == "" {
+			return nil, errors.New("issuer cannot be empty")
+		}
+
+		if c.Audience == "" {
+			return nil, fmt.Errorf("audience cannot be empty for issuer %s", c.Issuer)
+		}
+
+		keys, err := newKeySet(c.JWKSFile, c.JWKSURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to configure keys for issuer %s", c.Issuer)
+		}
+
+		i := &issuer{
+			name:        c.Issuer,
+			audience:    c.Audience,
+			userClaim:   c.UserClaim,
+			groupsClaim: c.GroupsClaim,
+			rolesClaim:  c.RolesClaim,
+			keys:        keys,
+		}
+
+		if i.userClaim == "" {
+			i.userClaim = "sub"
+		}
+
+		if i.groupsClaim == "" {
+			i.groupsClaim = "groups"
+		}
+
+		if i.rolesClaim == "" {
+			i.rolesClaim = "roles"
+		}
+
+		v.issuers[c.Issuer] = i
+	}
+
+	return v, nil
+}
+
+// Validate checks the token signature, issuer, audience and times, and returns the mapped claims
+func (v *Validator) Validate(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, "invalid token header")
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "invalid token claims")
+	}
+
+	iss, _ := claims["iss"].(string)
+	i, ok := v.issuers[iss]
+	if !ok {
+		return nil, fmt.Errorf("untrusted issuer '%s'", iss)
+	}
+
+	key, err := i.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get signing key for issuer %s", iss)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token signature")
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkTimes(claims); err != nil {
+		return nil, err
+	}
+
+	if !hasAudience(claims["aud"], i.audience) {
+		return nil, fmt.Errorf("token audience doesn't include '%s'", i.audience)
+	}
+
+	c := &Claims{
+		Issuer:  iss,
+		Groups:  stringsClaim(claims, i.groupsClaim),
+		Roles:   stringsClaim(claims, i.rolesClaim),
+		Subject: stringClaim(claims, "sub"),
+		User:    stringClaim(claims, i.userClaim),
+	}
+
+	if c.User == "" {
+		return nil, fmt.Errorf("token is missing user claim '%s'", i.userClaim)
+	}
+
+	log.Debugf("validated token for user %s from issuer %s", c.User, c.Issuer)
+
+	return c, nil
+}
+
+// checkTimes validates the required expiration, and the optional not before and issued at claims
+func (v *Validator) checkTimes(claims map[string]interface{}) error {
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token is missing exp claim")
+	}
+
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return errors.New("token is expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	if iat, ok := claims["iat"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(iat), 0)) {
+		return errors.New("token was issued in the future")
+	}
+
+	return nil
+}
+
+// verifySignature verifies an RS256 or ES256 signature over the signing input
+func verifySignature(alg string, key crypto.PublicKey, input string, sig []byte) error {
+	digest := sha256.Sum256([]byte(input))
+
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signing key is not an rsa key")
+		}
+
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("signing key is not an ecdsa key")
+		}
+
+		if len(sig) != 64 {
+			return errors.New("invalid token signature")
+		}
+
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported token algorithm '%s'", alg)
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// stringsClaim returns a claim that can be a single string or a list of strings
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	list := []string{}
+	switch v := claims[name].(type) {
+	case string:
+		list = append(list, v)
+	case []interface{}:
+		for _, i := range v {
+			if s, ok := i.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
@@ -0,0 +1,305 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/common"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   b64(key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return input + "." + b64(sig)
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	j, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, j, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestValidate(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	v, err := NewValidator([]common.Issuer{
+		{
+			Issuer:      "https://idp.example.edu",
+			Audience:    "ds-api",
+			JWKSFile:    writeJWKS(t, rsaJWK("rsa1", rsaKey), ecJWK("ec1", ecKey)),
+			UserClaim:   "netid",
+			GroupsClaim: "memberOf",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":      "https://idp.example.edu",
+			"aud":      []string{"ds-api", "other"},
+			"sub":      "abc123",
+			"netid":    "awong",
+			"memberOf": []string{"group1", "group2"},
+			"roles":    "data-steward",
+			"exp":      now.Add(5 * time.Minute).Unix(),
+			"iat":      now.Unix(),
+		}
+	}
+
+	expected := &Claims{
+		Issuer:  "https://idp.example.edu",
+		Subject: "abc123",
+		User:    "awong",
+		Groups:  []string{"group1", "group2"},
+		Roles:   []string{"data-steward"},
+	}
+
+	// test valid rsa and ec tokens
+	for _, token := range []string{
+		sign(t, "RS256", "rsa1", rsaKey, claims()),
+		sign(t, "ES256", "ec1", ecKey, claims()),
+	} {
+		c, err := v.Validate(context.TODO(), token)
+		if err != nil {
+			t.Errorf("expected nil error, got %s", err)
+			continue
+		}
+
+		if !reflect.DeepEqual(c, expected) {
+			t.Errorf("expected %+v, got %+v", expected, c)
+		}
+	}
+
+	// test invalid tokens
+	expired := claims()
+	expired["exp"] = now.Add(-5 * time.Minute).Unix()
+
+	notYet := claims()
+	notYet["nbf"] = now.Add(5 * time.Minute).Unix()
+
+	wrongAudience := claims()
+	wrongAudience["aud"] = "something-else"
+
+	wrongIssuer := claims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+
+	noUser := claims()
+	delete(noUser, "netid")
+
+	noExp := claims()
+	delete(noExp, "exp")
+
+	tampered := sign(t, "RS256", "rsa1", rsaKey, claims())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	invalid := map[string]string{
+		"expired":        sign(t, "RS256", "rsa1", rsaKey, expired),
+		"not yet valid":  sign(t, "RS256", "rsa1", rsaKey, notYet),
+		"wrong audience": sign(t, "RS256", "rsa1", rsaKey, wrongAudience),
+		"wrong issuer":   sign(t, "RS256", "rsa1", rsaKey, wrongIssuer),
+		"no user":        sign(t, "RS256", "rsa1", rsaKey, noUser),
+		"no exp":         sign(t, "RS256", "rsa1", rsaKey, noExp),
+		"wrong key":      sign(t, "RS256", "rsa1", otherKey, claims()),
+		"unknown kid":    sign(t, "RS256", "rsa2", rsaKey, claims()),
+		"wrong alg":      sign(t, "ES256", "rsa1", ecKey, claims()),
+		"alg none":       sign(t, "none", "rsa1", rsaKey, claims()),
+		"tampered":       tampered,
+		"malformed":      "not.a.token.at.all",
+	}
+
+	for name, token := range invalid {
+		if _, err := v.Validate(context.TODO(), token); err == nil {
+			t.Errorf("expected error for %s token, got nil", name)
+		}
+	}
+}
+
+func TestValidateJWKSURL(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	j, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{rsaJWK("rsa1", rsaKey)}})
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(j)
+	}))
+	defer server.Close()
+
+	v, err := NewValidator([]common.Issuer{{Issuer: "https://idp.example.edu", Audience: "ds-api", JWKSURL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, "RS256", "rsa1", rsaKey, map[string]interface{}{
+		"iss": "https://idp.example.edu",
+		"aud": "ds-api",
+		"sub": "awong",
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	for i := 0; i < 3; i++ {
+		c, err := v.Validate(context.TODO(), token)
+		if err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+
+		if c.User != "awong" {
+			t.Errorf("expected user awong, got %s", c.User)
+		}
+	}
+
+	// an unknown key id shouldn't refetch the keys more often than the minimum refresh interval
+	token = sign(t, "RS256", "rsa2", rsaKey, map[string]interface{}{
+		"iss": "https://idp.example.edu",
+		"aud": "ds-api",
+		"sub": "awong",
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	})
+	if _, err := v.Validate(context.TODO(), token); err == nil {
+		t.Error("expected error for unknown key id, got nil")
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected jwks to be fetched once, got %d", n)
+	}
+}
+
+func TestValidateJWKSURLSlowRefresh(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	j, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{rsaJWK("rsa1", rsaKey)}})
+
+	var fetches int32
+	refreshing, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch returns right away, refreshes hang until they're released
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			close(refreshing)
+			<-release
+		}
+		w.Write(j)
+	}))
+	defer server.Close()
+
+	v, err := NewValidator([]common.Issuer{{Issuer: "https://idp.example.edu", Audience: "ds-api", JWKSURL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, "RS256", "rsa1", rsaKey, map[string]interface{}{
+		"iss": "https://idp.example.edu",
+		"aud": "ds-api",
+		"sub": "awong",
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	if _, err := v.Validate(context.TODO(), token); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	// expire the cached keys, so the next token refreshes them
+	ks := v.issuers["https://idp.example.edu"].keys
+	ks.Lock()
+	ks.ttl = 0
+	ks.Unlock()
+
+	done := make(chan error)
+	go func() {
+		_, err := v.Validate(context.TODO(), token)
+		done <- err
+	}()
+	<-refreshing
+
+	// other tokens are validated with the cached keys while the refresh hangs
+	if _, err := v.Validate(context.TODO(), token); err != nil {
+		t.Errorf("expected nil error during refresh, got %s", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected nil error after refresh, got %s", err)
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	if _, err := NewValidator([]common.Issuer{{Issuer: "https://idp.example.edu", Audience: "ds-api"}}); err == nil {
+		t.Error("expected error for issuer without keys, got nil")
+	}
+
+	if _, err := NewValidator([]common.Issuer{{Issuer: "https://idp.example.edu", Audience: "ds-api", JWKSFile: "/nonexistent/jwks.json"}}); err == nil {
+		t.Error("expected error for missing jwks file, got nil")
+	}
+
+	if _, err := NewValidator([]common.Issuer{{Audience: "ds-api", JWKSFile: "jwks.json"}}); err == nil {
+		t.Error("expected error for empty issuer, got nil")
+	}
+
+	if _, err := NewValidator([]common.Issuer{{Issuer: "https://idp.example.edu", JWKSURL: "https://idp.example.edu/jwks"}}); err == nil {
+		t.Error("expected error for issuer without audience, got nil")
+	}
+}
@@ -0,0 +1,281 @@
+package s3datarepository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// accessLogTimeFormat is the format of the time of a request in the server access logs
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogKeyTimeFormat is the format of the delivery time at the start of the name of each access log object
+const accessLogKeyTimeFormat = "2006-01-02-15-04-05"
+
+// accessLogSettleTime is how old access log objects have to be before they're read.  Log objects delivered in the
+// same second aren't in order, so reading them only once that second is over means none are skipped.
+const accessLogSettleTime = time.Minute
+
+// maxAccessLogObjects is the maximum number of access log objects read by one call to AccessLogs
+const maxAccessLogObjects = 100
+
+// accessLogActions maps the operations in the server access logs to the access log actions, other operations
+// (ie. HEAD and list requests, or bucket operations) aren't returned.  Multi-object deletes are logged once for the
+// request and once for every deleted object (BATCH.DELETE.OBJECT), only the latter are counted.
+var accessLogActions = map[string]string{
+	"REST.GET.OBJECT":      dataset.AccessRead,
+	"REST.COPY.OBJECT_GET": dataset.AccessRead,
+	"REST.PUT.OBJECT":      dataset.AccessWrite,
+	"REST.COPY.OBJECT":     dataset.AccessWrite,
+	"REST.POST.UPLOAD":     dataset.AccessWrite,
+	"REST.DELETE.OBJECT":   dataset.AccessDelete,
+	"BATCH.DELETE.OBJECT":  dataset.AccessDelete,
+}
+
+// accessLogPrefix returns the prefix in the LoggingBucket under which the access logs of a dataset are delivered
+func (s *S3Repository) accessLogPrefix(id string) string {
+	return s.LoggingBucketPrefix + id + "/"
+}
+
+// AccessLogs reads the server access logs of the data repository of a dataset, starting after the log object
+// given by the cursor (from the start if it's empty).  It returns the requests to read, write or delete objects,
+// and the cursor to continue from, which is the same cursor if there were no new log objects.  Up to
+// maxAccessLogObjects are read at once, so it should be called again until the cursor doesn't change.
+func (s *S3Repository) AccessLogs(ctx context.Context, id, cursor string) ([]*dataset.AccessLogRecord, string, error) {
+	if id == "" {
+		return nil, cursor, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if s.LoggingBucket == "" {
+		log.WithContext(ctx).Debugf("not reading access logs for dataset %s, no logging bucket configured", id)
+		return []*dataset.AccessLogRecord{}, cursor, nil
+	}
+
+	prefix := s.accessLogPrefix(id)
+
+	log.WithContext(ctx).Debugf("listing access logs for dataset %s in s3://%s/%s after '%s'", id, s.LoggingBucket, prefix, cursor)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.LoggingBucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(maxAccessLogObjects),
+	}
+
+	if cursor != "" {
+		input.StartAfter = aws.String(cursor)
+	}
+
+	out, err := s.S3.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, cursor, ErrCode("failed to list access logs for dataset "+id, err)
+	}
+
+	settled := time.Now().UTC().Add(-accessLogSettleTime)
+
+	records := []*dataset.AccessLogRecord{}
+	for _, o := range out.Contents {
+		key := aws.StringValue(o.Key)
+
+		// log objects are named by their delivery time, so the following ones aren't settled either
+		name := strings.TrimPrefix(key, prefix)
+		if len(name) >= len(accessLogKeyTimeFormat) {
+			if t, err := time.Parse(accessLogKeyTimeFormat, name[:len(accessLogKeyTimeFormat)]); err == nil && t.After(settled) {
+				break
+			}
+		}
+
+		r, err := s.readAccessLog(ctx, key)
+		if err != nil {
+			return nil, cursor, err
+		}
+
+		records = append(records, r...)
+		cursor = key
+	}
+
+	return records, cursor, nil
+}
+
+// readAccessLog reads the requests to read, write or delete objects from an access log object.  Lines that can't
+// be parsed are logged and skipped.
+func (s *S3Repository) readAccessLog(ctx context.Context, key string) ([]*dataset.AccessLogRecord, error) {
+	log.WithContext(ctx).Debugf("reading access log s3://%s/%s", s.LoggingBucket, key)
+
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.LoggingBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get access log "+key, err)
+	}
+	defer out.Body.Close()
+
+	records := []*dataset.AccessLogRecord{}
+
+	scanner := bufio.NewScanner(out.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		r, err := parseAccessLogLine(line)
+		if err != nil {
+			log.WithContext(ctx).Warnf("skipping invalid line in access log %s: %s", key, err)
+			continue
+		}
+
+		if r.Action == "" {
+			continue
+		}
+
+		r.PrincipalType, r.Principal = accessPrincipal(r.Requester)
+		records = append(records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to read access log "+key, err)
+	}
+
+	return records, nil
+}
+
+// parseAccessLogLine parses a line of an S3 server access log.  Only the fields up to the object size are required,
+// since fields are added to the end of the format over time.  The action is empty for operations we don't track.
+func parseAccessLogLine(line string) (*dataset.AccessLogRecord, error) {
+	fields, err := accessLogFields(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("expected at least 13 fields, got %d", len(fields))
+	}
+
+	t, err := time.Parse(accessLogTimeFormat, fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time '%s': %s", fields[2], err)
+	}
+
+	status, err := strconv.Atoi(fields[9])
+	if err != nil {
+		return nil, fmt.Errorf("invalid status '%s': %s", fields[9], err)
+	}
+
+	var bytes int64
+	if fields[11] != "-" {
+		if bytes, err = strconv.ParseInt(fields[11], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid bytes sent '%s': %s", fields[11], err)
+		}
+	}
+
+	// keys are url encoded in the access logs
+	key := accessLogValue(fields[7])
+	if k, err := url.PathUnescape(key); err == nil {
+		key = k
+	}
+
+	return &dataset.AccessLogRecord{
+		Repository: fields[1],
+		Key:        key,
+		Action:     accessLogActions[fields[6]],
+		Operation:  fields[6],
+		Requester:  accessLogValue(fields[4]),
+		Status:     status,
+		Bytes:      bytes,
+		SourceIP:   accessLogValue(fields[3]),
+		RequestID:  accessLogValue(fields[5]),
+		Time:       t.UTC(),
+	}, nil
+}
+
+// accessLogFields splits a line of an access log into its fields.  Fields are separated by spaces, except for the
+// time, which is in square brackets, and the fields in double quotes.
+func accessLogFields(line string) ([]string, error) {
+	fields := []string{}
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		end := " "
+		switch line[0] {
+		case '[':
+			end = "]"
+		case '"':
+			end = "\""
+		}
+
+		if end == " " {
+			n := strings.Index(line, end)
+			if n < 0 {
+				n = len(line)
+			}
+			fields = append(fields, line[:n])
+			line = line[n:]
+			continue
+		}
+
+		n := strings.Index(line[1:], end)
+		if n < 0 {
+			return nil, fmt.Errorf("missing closing %s", end)
+		}
+		fields = append(fields, line[1:n+1])
+		line = line[n+2:]
+	}
+
+	return fields, nil
+}
+
+// accessLogValue returns the value of an access log field, which is "-" when it's empty
+func accessLogValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// accessPrincipal attributes the requester of an access log record to the principal it was granted to:
+// * instance role sessions to the instance id
+// * cross-account share role sessions to the share id
+// * other role sessions to the role ARN (without the path, which isn't part of the session ARN)
+// * temporary users to the user name
+// Other requesters, ie. other IAM users, accounts or AWS services, are returned as is.
+func accessPrincipal(requester string) (string, string) {
+	if requester == "" {
+		return dataset.AccessPrincipalOther, "anonymous"
+	}
+
+	a, err := arn.Parse(requester)
+	if err != nil {
+		return dataset.AccessPrincipalOther, requester
+	}
+
+	resource := strings.Split(a.Resource, "/")
+	switch {
+	case a.Service == "sts" && resource[0] == "assumed-role" && len(resource) >= 2:
+		roleName := resource[1]
+		if strings.HasPrefix(roleName, "instanceRole_") {
+			return dataset.AccessPrincipalInstance, strings.TrimPrefix(roleName, "instanceRole_")
+		}
+
+		if strings.HasPrefix(roleName, shareRoleName("")) {
+			return dataset.AccessPrincipalShare, strings.TrimPrefix(roleName, shareRoleName(""))
+		}
+
+		return dataset.AccessPrincipalRole, arn.ARN{Partition: a.Partition, Service: "iam", AccountID: a.AccountID, Resource: "role/" + roleName}.String()
+	case a.Service == "iam" && resource[0] == "user" && strings.HasSuffix(a.Resource, "-DsTmpUsr"):
+		return dataset.AccessPrincipalUser, resource[len(resource)-1]
+	}
+
+	return dataset.AccessPrincipalOther, requester
+}
@@ -0,0 +1,197 @@
+package s3datarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var testAccessLog = `79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:00:38 +0000] 192.0.2.3 arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0 3E57427F3EXAMPLE REST.GET.OBJECT raw/my%20file.csv "GET /raw/my%20file.csv HTTP/1.1" 200 - 113 113 7 6 "-" "aws-cli/2.0.0 Python/3.7.4" - s9lzHYrFp76ZVxRcpX9+5cjAnEH2ROuNkd2BHfIa6UkFVdtjf5mKR3/eTPFvsiP/XV/VLi31234= SigV4 ECDHE-RSA-AES128-GCM-SHA256 AuthHeader dataset-localdev-abc.s3.us-east-1.amazonaws.com TLSV1.2 - -
+79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:00:39 +0000] 192.0.2.3 arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0 891CE47D2EXAMPLE REST.HEAD.OBJECT raw/my%20file.csv "HEAD /raw/my%20file.csv HTTP/1.1" 200 - - 113 7 - "-" "aws-cli/2.0.0 Python/3.7.4" - -
+79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:01:00 +0000] 198.51.100.7 arn:aws:iam::012345678901:user/spinup/dataset/dataset-localdev-abc-DsTmpUsr A1206F460EXAMPLE REST.PUT.OBJECT raw/new.csv "PUT /raw/new.csv HTTP/1.1" 200 - - 2048 10 9 "-" "Boto3/1.12.0" - -
+not a valid access log line
+79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:02:00 +0000] 198.51.100.8 arn:aws:sts::012345678901:assumed-role/research-app/session A1206F461EXAMPLE REST.DELETE.OBJECT raw/old.csv "DELETE /raw/old.csv HTTP/1.1" 403 AccessDenied 243 - 5 - "-" "Boto3/1.12.0" - -
+`
+
+func TestParseAccessLogLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected *dataset.AccessLogRecord
+	}{
+		{
+			name: "quoted fields with spaces",
+			line: `79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:00:38 -0500] 192.0.2.3 arn:aws:iam::012345678901:user/someone 3E57427F3EXAMPLE REST.GET.OBJECT a%2Bb/c.csv "GET /a%2Bb/c.csv HTTP/1.1" 200 - 113 113 7 6 "https://example.edu/a page" "Mozilla/5.0 (X11; Linux x86_64)" -`,
+			expected: &dataset.AccessLogRecord{
+				Repository: "dataset-localdev-abc",
+				Key:        "a+b/c.csv",
+				Action:     dataset.AccessRead,
+				Operation:  "REST.GET.OBJECT",
+				Requester:  "arn:aws:iam::012345678901:user/someone",
+				Status:     200,
+				Bytes:      113,
+				SourceIP:   "192.0.2.3",
+				RequestID:  "3E57427F3EXAMPLE",
+				Time:       time.Date(2020, 2, 6, 5, 0, 38, 0, time.UTC),
+			},
+		},
+		{
+			name: "dash values",
+			line: `79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:01:00 +0000] - - - REST.PUT.OBJECT raw/new.csv "PUT /raw/new.csv HTTP/1.1" 403 AccessDenied - 2048 10 - "-" "-" - -`,
+			expected: &dataset.AccessLogRecord{
+				Repository: "dataset-localdev-abc",
+				Key:        "raw/new.csv",
+				Action:     dataset.AccessWrite,
+				Operation:  "REST.PUT.OBJECT",
+				Status:     403,
+				Time:       time.Date(2020, 2, 6, 0, 1, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "untracked operation",
+			line: `79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be dataset-localdev-abc [06/Feb/2020:00:02:00 +0000] 192.0.2.3 - 891CE47D2EXAMPLE REST.GET.BUCKET - "GET /?list-type=2 HTTP/1.1" 200 - 512 -`,
+			expected: &dataset.AccessLogRecord{
+				Repository: "dataset-localdev-abc",
+				Operation:  "REST.GET.BUCKET",
+				Status:     200,
+				Bytes:      512,
+				SourceIP:   "192.0.2.3",
+				RequestID:  "891CE47D2EXAMPLE",
+				Time:       time.Date(2020, 2, 6, 0, 2, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "empty line",
+			line: "",
+		},
+		{
+			name: "missing fields",
+			line: "owner bucket [06/Feb/2020:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key",
+		},
+		{
+			name: "unclosed time",
+			line: `owner bucket [06/Feb/2020:00:00:38 +0000 192.0.2.3 - id REST.GET.OBJECT key "GET / HTTP/1.1" 200 - 113`,
+		},
+		{
+			name: "unclosed quote",
+			line: `owner bucket [06/Feb/2020:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET / HTTP/1.1 200 - 113`,
+		},
+		{
+			name: "invalid time",
+			line: `owner bucket [yesterday] 192.0.2.3 - id REST.GET.OBJECT key "GET / HTTP/1.1" 200 - 113`,
+		},
+		{
+			name: "invalid status",
+			line: `owner bucket [06/Feb/2020:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET / HTTP/1.1" OK - 113`,
+		},
+		{
+			name: "invalid bytes sent",
+			line: `owner bucket [06/Feb/2020:00:00:38 +0000] 192.0.2.3 - id REST.GET.OBJECT key "GET / HTTP/1.1" 200 - lots`,
+		},
+	}
+
+	for _, test := range tests {
+		record, err := parseAccessLogLine(test.line)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected error for invalid line '%s', got %+v", test.name, test.line, record)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected nil error, got %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(record, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, record)
+		}
+	}
+}
+
+func TestAccessPrincipal(t *testing.T) {
+	tests := map[string][2]string{
+		"": {dataset.AccessPrincipalOther, "anonymous"},
+		"arn:aws:sts::012345678901:assumed-role/instanceRole_i-0123456789abcdef0/i-0123456789abcdef0": {dataset.AccessPrincipalInstance, "i-0123456789abcdef0"},
+		"arn:aws:sts::012345678901:assumed-role/shareRole_0b1c2d3e/collaborator":                      {dataset.AccessPrincipalShare, "0b1c2d3e"},
+		"arn:aws:sts::012345678901:assumed-role/research-app/session":                                 {dataset.AccessPrincipalRole, "arn:aws:iam::012345678901:role/research-app"},
+		"arn:aws:iam::012345678901:user/spinup/dataset/dataset-localdev-abc-DsTmpUsr":                 {dataset.AccessPrincipalUser, "dataset-localdev-abc-DsTmpUsr"},
+		"arn:aws:iam::012345678901:user/someone":                                                      {dataset.AccessPrincipalOther, "arn:aws:iam::012345678901:user/someone"},
+		"svc:s3.amazonaws.com":                                                                        {dataset.AccessPrincipalOther, "svc:s3.amazonaws.com"},
+	}
+
+	for requester, expected := range tests {
+		if principalType, principal := accessPrincipal(requester); principalType != expected[0] || principal != expected[1] {
+			t.Errorf("expected %s %s for requester '%s', got %s %s", expected[0], expected[1], requester, principalType, principal)
+		}
+	}
+}
+
+func TestAccessLogs(t *testing.T) {
+	s := S3Repository{
+		LoggingBucket:       "dataset-test-logs",
+		LoggingBucketPrefix: "dataset/localdev/",
+		S3:                  newMockS3Client(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	// no logging bucket
+	records, cursor, err := (&S3Repository{S3: m}).AccessLogs(context.TODO(), "abc", "")
+	if err != nil || len(records) != 0 || cursor != "" {
+		t.Errorf("expected no records without a logging bucket, got %v, '%s', %v", records, cursor, err)
+	}
+
+	first := "dataset/localdev/abc/2020-02-06-00-05-00-5A1B2C3D4E5F6A7B"
+	unsettled := "dataset/localdev/abc/" + time.Now().UTC().Format(accessLogKeyTimeFormat) + "-0A1B2C3D4E5F6A7B"
+	m.objects["dataset-test-logs/"+first] = []byte(testAccessLog)
+	m.objects["dataset-test-logs/"+unsettled] = []byte(testAccessLog)
+	m.objects["dataset-test-logs/dataset/localdev/xyz/2020-02-06-00-05-00-5A1B2C3D4E5F6A7B"] = []byte(testAccessLog)
+
+	records, cursor, err = s.AccessLogs(context.TODO(), "abc", "")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if cursor != first {
+		t.Errorf("expected cursor %s, got %s", first, cursor)
+	}
+
+	expected := []*dataset.AccessLogRecord{
+		{Key: "raw/my file.csv", Action: dataset.AccessRead, Operation: "REST.GET.OBJECT", Status: 200, Bytes: 113, PrincipalType: dataset.AccessPrincipalInstance, Principal: "i-0123456789abcdef0"},
+		{Key: "raw/new.csv", Action: dataset.AccessWrite, Operation: "REST.PUT.OBJECT", Status: 200, PrincipalType: dataset.AccessPrincipalUser, Principal: "dataset-localdev-abc-DsTmpUsr"},
+		{Key: "raw/old.csv", Action: dataset.AccessDelete, Operation: "REST.DELETE.OBJECT", Status: 403, Bytes: 243, PrincipalType: dataset.AccessPrincipalRole, Principal: "arn:aws:iam::012345678901:role/research-app"},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %+v", len(expected), len(records), records)
+	}
+
+	for i, e := range expected {
+		r := records[i]
+		if r.Key != e.Key || r.Action != e.Action || r.Operation != e.Operation || r.Status != e.Status || r.Bytes != e.Bytes || r.PrincipalType != e.PrincipalType || r.Principal != e.Principal {
+			t.Errorf("expected record %+v, got %+v", e, r)
+		}
+	}
+
+	// the unsettled log object is read once it's old enough
+	records, cursor, err = s.AccessLogs(context.TODO(), "abc", cursor)
+	if err != nil || len(records) != 0 || cursor != first {
+		t.Errorf("expected no new records before the log object is settled, got %v, '%s', %v", records, cursor, err)
+	}
+
+	// errors
+	m.err["ListObjectsV2WithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "no such bucket", nil)
+	if _, c, err := s.AccessLogs(context.TODO(), "abc", first); err == nil || c != first {
+		t.Errorf("expected error and unchanged cursor, got %v, '%s'", err, c)
+	}
+
+	if _, _, err := s.AccessLogs(context.TODO(), "", ""); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+}
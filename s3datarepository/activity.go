@@ -0,0 +1,82 @@
+package s3datarepository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// activityNotificationID is the id of the S3 event notification configuration we manage for each data repository
+const activityNotificationID = "dataset-activity"
+
+// putActivityNotification configures the bucket to send a notification to the ActivityQueueArn when objects are
+// created or deleted.  S3 sends a test message to the queue to validate that it's allowed to send messages.
+func (s *S3Repository) putActivityNotification(ctx context.Context, bucket string) error {
+	log.WithContext(ctx).Debugf("configuring activity notifications for bucket %s to %s", bucket, s.ActivityQueueArn)
+
+	if _, err := s.S3.PutBucketNotificationConfigurationWithContext(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket: aws.String(bucket),
+		NotificationConfiguration: &s3.NotificationConfiguration{
+			QueueConfigurations: []*s3.QueueConfiguration{
+				{
+					Id:       aws.String(activityNotificationID),
+					QueueArn: aws.String(s.ActivityQueueArn),
+					Events: aws.StringSlice([]string{
+						s3.EventS3ObjectCreated,
+						s3.EventS3ObjectRemoved,
+					}),
+				},
+			},
+		},
+	}); err != nil {
+		return ErrCode("failed to configure activity notifications for s3 bucket "+bucket, err)
+	}
+
+	return nil
+}
+
+// RepositoryDataset returns the id of the dataset of the data repository with the given name, and the tags of the
+// data repository.  NotFound is returned if the name doesn't match the data repositories of this repository.
+func (s *S3Repository) RepositoryDataset(ctx context.Context, name string) (string, []*dataset.Tag, error) {
+	if name == "" {
+		return "", nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty name"))
+	}
+
+	id := name
+	if s.NamePrefix != "" {
+		if !strings.HasPrefix(name, s.NamePrefix+"-") {
+			return "", nil, apierror.New(apierror.ErrNotFound, "not a data repository: "+name, nil)
+		}
+		id = strings.TrimPrefix(name, s.NamePrefix+"-")
+	}
+
+	log.WithContext(ctx).Debugf("getting tags of s3 bucket %s for dataset %s", name, id)
+
+	out, err := s.S3.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchTagSet" {
+			return id, []*dataset.Tag{}, nil
+		}
+		return "", nil, ErrCode("failed to get tags for s3 bucket "+name, err)
+	}
+
+	tags := make([]*dataset.Tag, len(out.TagSet))
+	for i, t := range out.TagSet {
+		tags[i] = &dataset.Tag{Key: t.Key, Value: t.Value}
+	}
+
+	return id, tags, nil
+}
+
+// DataObject returns false for the keys of the attachments and the manifest, which are managed by the api and
+// aren't part of the data
+func (s *S3Repository) DataObject(key string) bool {
+	return !strings.HasPrefix(key, attachmentsPrefix) && !strings.HasPrefix(key, manifestPrefix)
+}
@@ -0,0 +1,132 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+func (m *mockS3Client) PutBucketNotificationConfigurationWithContext(ctx aws.Context, input *s3.PutBucketNotificationConfigurationInput, opts ...request.Option) (*s3.PutBucketNotificationConfigurationOutput, error) {
+	if err, ok := m.err["PutBucketNotificationConfigurationWithContext"]; ok {
+		return nil, err
+	}
+
+	j, err := json.Marshal(input.NotificationConfiguration)
+	if err != nil {
+		return nil, err
+	}
+	m.objects["notification:"+aws.StringValue(input.Bucket)] = j
+
+	return &s3.PutBucketNotificationConfigurationOutput{}, nil
+}
+
+func TestPutActivityNotification(t *testing.T) {
+	s := S3Repository{
+		ActivityQueueArn: "arn:aws:sqs:us-east-1:12345678901:dsapi-activity",
+		S3:               newMockS3Client(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	if err := s.putActivityNotification(context.TODO(), "dataset-test"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	config := &s3.NotificationConfiguration{}
+	if err := json.Unmarshal(m.objects["notification:dataset-test"], config); err != nil {
+		t.Fatalf("expected notification configuration for dataset-test, got %s", err)
+	}
+
+	if len(config.QueueConfigurations) != 1 {
+		t.Fatalf("expected 1 queue configuration, got %+v", config)
+	}
+
+	q := config.QueueConfigurations[0]
+	if aws.StringValue(q.Id) != activityNotificationID || aws.StringValue(q.QueueArn) != s.ActivityQueueArn {
+		t.Errorf("expected %s queue configuration to %s, got %+v", activityNotificationID, s.ActivityQueueArn, q)
+	}
+
+	if events := aws.StringValueSlice(q.Events); !reflect.DeepEqual(events, []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}) {
+		t.Errorf("expected object created and removed events, got %v", events)
+	}
+
+	// test error configuring the notification
+	m.err["PutBucketNotificationConfigurationWithContext"] = awserr.New("InvalidArgument", "Unable to validate the following destination configurations", nil)
+	err := s.putActivityNotification(context.TODO(), "dataset-test")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected %s error, got %v", apierror.ErrBadRequest, err)
+	}
+}
+
+func TestRepositoryDataset(t *testing.T) {
+	s := S3Repository{
+		NamePrefix: "dataset-org",
+		S3:         newMockS3Client(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	tagging, _ := json.Marshal([]*s3.Tag{
+		{Key: aws.String("ID"), Value: aws.String("abc")},
+		{Key: aws.String("spinup:group"), Value: aws.String("dsgroup")},
+	})
+	m.objects["tagging:dataset-org-abc"] = tagging
+
+	id, tags, err := s.RepositoryDataset(context.TODO(), "dataset-org-abc")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if id != "abc" {
+		t.Errorf("expected id abc, got %s", id)
+	}
+
+	expected := []*dataset.Tag{
+		{Key: aws.String("ID"), Value: aws.String("abc")},
+		{Key: aws.String("spinup:group"), Value: aws.String("dsgroup")},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %+v, got %+v", expected, tags)
+	}
+
+	// bucket without tags
+	if id, tags, err = s.RepositoryDataset(context.TODO(), "dataset-org-def"); err != nil || id != "def" || len(tags) != 0 {
+		t.Errorf("expected id def without tags, got %s %+v (%v)", id, tags, err)
+	}
+
+	// bucket of another org
+	_, _, err = s.RepositoryDataset(context.TODO(), "dataset-other-abc")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected %s error, got %v", apierror.ErrNotFound, err)
+	}
+
+	// empty name
+	if _, _, err = s.RepositoryDataset(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty name, got nil")
+	}
+}
+
+func TestDataObject(t *testing.T) {
+	s := S3Repository{}
+
+	tests := map[string]bool{
+		"data/file.csv":               true,
+		"file.csv":                    true,
+		"_attachments/readme.txt":     false,
+		"_manifest/manifest.json":     false,
+		"raw/_attachments/readme.txt": true,
+	}
+
+	for key, expected := range tests {
+		if got := s.DataObject(key); got != expected {
+			t.Errorf("expected DataObject(%s) to be %t, got %t", key, expected, got)
+		}
+	}
+}
@@ -19,7 +19,7 @@ const attachmentsPrefix = "_attachments/"
 
 // CreateAttachment uploads a new attachment to the data repository
 func (s *S3Repository) CreateAttachment(ctx context.Context, id, attachmentName string, attachmentBody multipart.File) error {
-	log.Infof("creating attachment for data set '%s': %s", id, attachmentName)
+	log.WithContext(ctx).Infof("creating attachment for data set '%s': %s", id, attachmentName)
 
 	if id == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
@@ -36,7 +36,7 @@ func (s *S3Repository) CreateAttachment(ctx context.Context, id, attachmentName
 
 	attachmentName = attachmentsPrefix + attachmentName
 
-	log.Infof("uploading attachment '%s' to s3datarepository: %s", attachmentName, name)
+	log.WithContext(ctx).Infof("uploading attachment '%s' to s3datarepository: %s", attachmentName, name)
 
 	if _, err := s.S3Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(name),
@@ -51,7 +51,7 @@ func (s *S3Repository) CreateAttachment(ctx context.Context, id, attachmentName
 
 // DeleteAttachment deletes an attachment from the data repository
 func (s *S3Repository) DeleteAttachment(ctx context.Context, id, attachmentName string) error {
-	log.Infof("deleting attachment from data set '%s': %s", id, attachmentName)
+	log.WithContext(ctx).Infof("deleting attachment from data set '%s': %s", id, attachmentName)
 
 	if id == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
@@ -72,7 +72,7 @@ func (s *S3Repository) DeleteAttachment(ctx context.Context, id, attachmentName
 }
 
 func (s *S3Repository) deleteObject(ctx context.Context, bucket, key string) error {
-	log.Infof("deleting object with key '%s' from bucket %s", key, bucket)
+	log.WithContext(ctx).Infof("deleting object with key '%s' from bucket %s", key, bucket)
 
 	if _, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucket),
@@ -95,7 +95,7 @@ func (s *S3Repository) ListAttachments(ctx context.Context, id string, showURL b
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Debugf("getting list of attachments for s3datarepository: %s (showURL: %t)", name, showURL)
+	log.WithContext(ctx).Debugf("getting list of attachments for s3datarepository: %s (showURL: %t)", name, showURL)
 
 	return s.listAttachmentObjects(ctx, name, attachmentsPrefix, showURL)
 }
@@ -129,7 +129,7 @@ func (s *S3Repository) listAttachmentObjects(ctx context.Context, bucket, prefix
 					// generate pre-signed URL for accessing the attachment
 					urlStr, err := s.presignURL(bucket, aws.StringValue(object.Key))
 					if err != nil {
-						log.Errorf("failed to presign request for %s: %s", aws.StringValue(object.Key), err)
+						log.WithContext(ctx).Errorf("failed to presign request for %s: %s", aws.StringValue(object.Key), err)
 					} else {
 						attachment.URL = urlStr
 					}
@@ -143,7 +143,7 @@ func (s *S3Repository) listAttachmentObjects(ctx context.Context, bucket, prefix
 		input.ContinuationToken = output.NextContinuationToken
 	}
 
-	log.Debug(attachments)
+	log.WithContext(ctx).Debug(attachments)
 
 	return attachments, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"mime/multipart"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,6 +53,11 @@ func (m *mockS3Client) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListO
 		return nil, err
 	}
 
+	// objects put in the mock client
+	if strings.HasPrefix(aws.StringValue(input.Bucket), "dataset-test") {
+		return m.listObjects(input), nil
+	}
+
 	if aws.StringValue(input.Bucket) == "testBucketEmpty" {
 		return &s3.ListObjectsV2Output{KeyCount: aws.Int64(int64(0))}, nil
 	}
@@ -63,6 +69,59 @@ func (m *mockS3Client) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListO
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T01:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-02-02T02:00:00Z")
 
+	// inventory bucket, returns the list of report folders
+	if aws.StringValue(input.Bucket) == "ds-test-inventory" {
+		prefix := aws.StringValue(input.Prefix)
+		if strings.Contains(prefix, "testBucketNoReports") {
+			return &s3.ListObjectsV2Output{KeyCount: aws.Int64(int64(0))}, nil
+		}
+		return &s3.ListObjectsV2Output{
+			CommonPrefixes: []*s3.CommonPrefix{
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2020-02-01T00-00Z/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2020-02-03T00-00Z/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2020-02-02T00-00Z/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "hive/")},
+			},
+		}, nil
+	}
+
+	// two pages of objects
+	if aws.StringValue(input.Bucket) == "testBucketInventory" || aws.StringValue(input.Bucket) == "testBucketNoReports" {
+		if input.ContinuationToken == nil {
+			return &s3.ListObjectsV2Output{
+				Contents: []*s3.Object{
+					&s3.Object{
+						Key:          aws.String("raw/data1.csv"),
+						LastModified: aws.Time(time1),
+						Size:         aws.Int64(100),
+						StorageClass: aws.String("STANDARD"),
+					},
+					&s3.Object{
+						Key:          aws.String("raw/data2.csv"),
+						LastModified: aws.Time(time2),
+						Size:         aws.Int64(200),
+						StorageClass: aws.String("GLACIER"),
+					},
+				},
+				IsTruncated:           aws.Bool(true),
+				KeyCount:              aws.Int64(int64(2)),
+				NextContinuationToken: aws.String("page2"),
+			}, nil
+		}
+		return &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				&s3.Object{
+					Key:          aws.String("readme.txt"),
+					LastModified: aws.Time(time1),
+					Size:         aws.Int64(10),
+					StorageClass: aws.String("STANDARD"),
+				},
+			},
+			IsTruncated: aws.Bool(false),
+			KeyCount:    aws.Int64(int64(1)),
+		}, nil
+	}
+
 	if aws.StringValue(input.Prefix) == "_attachments/" {
 		contents := []*s3.Object{
 			&s3.Object{
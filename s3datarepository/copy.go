@@ -0,0 +1,213 @@
+package s3datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxCopyObjectSize is the largest object that can be copied with a single CopyObject request (5GB)
+const maxCopyObjectSize = int64(5 * 1024 * 1024 * 1024)
+
+// copyPartSize is the part size used for multipart copies of objects larger than maxCopyObjectSize
+const copyPartSize = int64(1024 * 1024 * 1024)
+
+// CopyObjects copies the selected objects from the source data repository to the data repository with a server-side copy.
+// Objects are selected by prefix and/or by key, attachments and the content manifest are never copied.  The progress
+// function, if given, is called once the objects to copy are determined, and after each object is copied.
+func (s *S3Repository) CopyObjects(ctx context.Context, sourceID, id string, input *dataset.CopyInput, progress func(dataset.CopyProgress)) error {
+	if sourceID == "" || id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if input == nil || (len(input.Prefixes) == 0 && len(input.Keys) == 0) {
+		return apierror.New(apierror.ErrBadRequest, "at least one prefix or key is required to copy objects", nil)
+	}
+
+	source := sourceID
+	name := id
+	if s.NamePrefix != "" {
+		source = s.NamePrefix + "-" + source
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("copying objects from s3datarepository %s to %s", source, name)
+
+	objects, err := s.copyObjectList(ctx, source, input)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+	p := dataset.CopyProgress{}
+	for k, size := range objects {
+		keys = append(keys, k)
+		p.ObjectsTotal++
+		p.BytesTotal += size
+	}
+	sort.Strings(keys)
+
+	if progress != nil {
+		progress(p)
+	}
+
+	for _, k := range keys {
+		if err := s.copyObject(ctx, source, name, k, objects[k]); err != nil {
+			return err
+		}
+
+		p.ObjectsCopied++
+		p.BytesCopied += objects[k]
+
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	log.WithContext(ctx).Infof("copied %d objects (%d bytes) from s3datarepository %s to %s", p.ObjectsCopied, p.BytesCopied, source, name)
+
+	return nil
+}
+
+// copyObjectList returns the keys and sizes of the objects in the bucket selected by the copy input
+func (s *S3Repository) copyObjectList(ctx context.Context, bucket string, input *dataset.CopyInput) (map[string]int64, error) {
+	objects := map[string]int64{}
+
+	for _, prefix := range input.Prefixes {
+		log.WithContext(ctx).Debugf("listing objects with prefix '%s' in bucket %s", prefix, bucket)
+
+		listInput := s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}
+
+		truncated := true
+		for truncated {
+			output, err := s.S3.ListObjectsV2WithContext(ctx, &listInput)
+			if err != nil {
+				return nil, ErrCode("failed to list objects in s3 bucket "+bucket, err)
+			}
+
+			for _, object := range output.Contents {
+				key := aws.StringValue(object.Key)
+				if strings.HasPrefix(key, attachmentsPrefix) || strings.HasPrefix(key, manifestPrefix) {
+					continue
+				}
+				objects[key] = aws.Int64Value(object.Size)
+			}
+
+			truncated = aws.BoolValue(output.IsTruncated)
+			listInput.ContinuationToken = output.NextContinuationToken
+		}
+	}
+
+	for _, key := range input.Keys {
+		if key == "" || strings.HasPrefix(key, attachmentsPrefix) || strings.HasPrefix(key, manifestPrefix) {
+			msg := fmt.Sprintf("invalid key to copy: '%s'", key)
+			return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+
+		out, err := s.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+				return nil, apierror.New(apierror.ErrNotFound, "object not found in source dataset: "+key, err)
+			}
+			return nil, ErrCode("failed to get object "+key+" from s3 bucket "+bucket, err)
+		}
+
+		objects[key] = aws.Int64Value(out.ContentLength)
+	}
+
+	return objects, nil
+}
+
+// copyObject copies an object between buckets, using a multipart copy for objects larger than 5GB
+func (s *S3Repository) copyObject(ctx context.Context, source, destination, key string, size int64) error {
+	copySource := url.PathEscape(source + "/" + key)
+
+	if size <= maxCopyObjectSize {
+		log.WithContext(ctx).Debugf("copying s3://%s/%s to bucket %s", source, key, destination)
+
+		if _, err := s.S3.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(destination),
+			CopySource: aws.String(copySource),
+			Key:        aws.String(key),
+		}); err != nil {
+			return ErrCode("failed to copy object "+key+" to s3 bucket "+destination, err)
+		}
+
+		return nil
+	}
+
+	log.WithContext(ctx).Debugf("copying s3://%s/%s (%d bytes) to bucket %s with multipart copy", source, key, size, destination)
+
+	upload, err := s.S3.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(destination),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ErrCode("failed to start multipart copy of object "+key+" to s3 bucket "+destination, err)
+	}
+
+	parts := []*s3.CompletedPart{}
+	for partNumber, start := int64(1), int64(0); start < size; partNumber, start = partNumber+1, start+copyPartSize {
+		end := start + copyPartSize - 1
+		if end > size-1 {
+			end = size - 1
+		}
+
+		out, err := s.S3.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(destination),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			Key:             aws.String(key),
+			PartNumber:      aws.Int64(partNumber),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			s.abortMultipartUpload(ctx, destination, key, upload.UploadId)
+			return ErrCode("failed to copy part of object "+key+" to s3 bucket "+destination, err)
+		}
+
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       out.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+	}
+
+	if _, err := s.S3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(destination),
+		Key:             aws.String(key),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		UploadId:        upload.UploadId,
+	}); err != nil {
+		s.abortMultipartUpload(ctx, destination, key, upload.UploadId)
+		return ErrCode("failed to complete multipart copy of object "+key+" to s3 bucket "+destination, err)
+	}
+
+	return nil
+}
+
+// abortMultipartUpload aborts a failed multipart upload, so the uploaded parts don't linger
+func (s *S3Repository) abortMultipartUpload(ctx context.Context, bucket, key string, uploadID *string) {
+	if _, err := s.S3.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	}); err != nil {
+		log.WithContext(ctx).Warnf("failed to abort multipart upload for %s in bucket %s: %s", key, bucket, err)
+	}
+}
@@ -0,0 +1,179 @@
+package s3datarepository
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// testHugeObjectSize is the size of the huge.bin test object, which requires a multipart copy
+const testHugeObjectSize = int64(6*1024*1024*1024 + 1)
+
+func (m *mockS3Client) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if err, ok := m.err["HeadObjectWithContext"]; ok {
+		return nil, err
+	}
+
+	if aws.StringValue(input.Key) == "huge.bin" {
+		return &s3.HeadObjectOutput{ContentLength: aws.Int64(testHugeObjectSize)}, nil
+	}
+
+	if b, ok := m.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)]; ok {
+		return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(b)))}, nil
+	}
+
+	return nil, awserr.New("NotFound", "Not Found", nil)
+}
+
+func (m *mockS3Client) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	if err, ok := m.err["CopyObjectWithContext"]; ok {
+		return nil, err
+	}
+
+	source, err := url.PathUnescape(aws.StringValue(input.CopySource))
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := m.objects[source]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	m.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = b
+
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *mockS3Client) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	if err, ok := m.err["CreateMultipartUploadWithContext"]; ok {
+		return nil, err
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload1")}, nil
+}
+
+func (m *mockS3Client) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	if err, ok := m.err["UploadPartCopyWithContext"]; ok {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(aws.StringValue(input.CopySourceRange), "bytes=") {
+		m.t.Errorf("unexpected copy source range %s", aws.StringValue(input.CopySourceRange))
+	}
+
+	return &s3.UploadPartCopyOutput{
+		CopyPartResult: &s3.CopyPartResult{ETag: aws.String(strconv.FormatInt(aws.Int64Value(input.PartNumber), 10))},
+	}, nil
+}
+
+func (m *mockS3Client) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	if err, ok := m.err["CompleteMultipartUploadWithContext"]; ok {
+		return nil, err
+	}
+
+	m.objects["multipart:"+aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = []byte(strconv.Itoa(len(input.MultipartUpload.Parts)))
+
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3Client) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	m.objects["aborted:"+aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = []byte(aws.StringValue(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestCopyObjects(t *testing.T) {
+	s := S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t)}
+	m := s.S3.(*mockS3Client)
+	m.objects["dataset-testSource/raw/1.csv"] = []byte("1,2,3")
+	m.objects["dataset-testSource/raw/2.csv"] = []byte("4,5,6,7")
+	m.objects["dataset-testSource/clean/1.csv"] = []byte("1,2")
+	m.objects["dataset-testSource/readme.txt"] = []byte("hello")
+	m.objects["dataset-testSource/_attachments/dua.pdf"] = []byte("dua")
+	m.objects["dataset-testSource/_manifest/manifest.json"] = []byte("{}")
+
+	updates := []dataset.CopyProgress{}
+	err := s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{
+		Prefixes: []string{"raw/", "_"},
+		Keys:     []string{"readme.txt", "raw/1.csv"},
+	}, func(p dataset.CopyProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	for _, k := range []string{"raw/1.csv", "raw/2.csv", "readme.txt"} {
+		if string(m.objects["dataset-testDerivative/"+k]) != string(m.objects["dataset-testSource/"+k]) {
+			t.Errorf("expected %s to be copied", k)
+		}
+	}
+
+	for _, k := range []string{"clean/1.csv", "_attachments/dua.pdf", "_manifest/manifest.json"} {
+		if _, ok := m.objects["dataset-testDerivative/"+k]; ok {
+			t.Errorf("expected %s not to be copied", k)
+		}
+	}
+
+	expected := []dataset.CopyProgress{
+		{ObjectsTotal: 3, BytesTotal: 17},
+		{ObjectsTotal: 3, BytesTotal: 17, ObjectsCopied: 1, BytesCopied: 5},
+		{ObjectsTotal: 3, BytesTotal: 17, ObjectsCopied: 2, BytesCopied: 12},
+		{ObjectsTotal: 3, BytesTotal: 17, ObjectsCopied: 3, BytesCopied: 17},
+	}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected progress %+v, got %+v", expected, updates)
+	}
+
+	// test multipart copy for large objects
+	if err := s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{Keys: []string{"huge.bin"}}, nil); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if string(m.objects["multipart:dataset-testDerivative/huge.bin"]) != "7" {
+		t.Errorf("expected multipart copy with 7 parts, got %s", string(m.objects["multipart:dataset-testDerivative/huge.bin"]))
+	}
+
+	// test multipart copy failure is aborted
+	m.err["UploadPartCopyWithContext"] = awserr.New("InternalError", "boom", nil)
+	if err := s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{Keys: []string{"huge.bin"}}, nil); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if string(m.objects["aborted:dataset-testDerivative/huge.bin"]) != "upload1" {
+		t.Error("expected multipart upload to be aborted")
+	}
+	delete(m.err, "UploadPartCopyWithContext")
+
+	// test missing key
+	err = s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{Keys: []string{"missing.csv"}}, nil)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error, got: %s", err)
+	}
+
+	// test reserved key
+	err = s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{Keys: []string{"_manifest/manifest.json"}}, nil)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+
+	// test empty input
+	err = s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{}, nil)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+
+	// test copy failure
+	m.err["CopyObjectWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	err = s.CopyObjects(context.TODO(), "testSource", "testDerivative", &dataset.CopyInput{Prefixes: []string{"raw/"}}, nil)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrForbidden {
+		t.Errorf("expected forbidden error, got: %s", err)
+	}
+}
@@ -20,10 +20,13 @@ import (
 
 // PolicyStatement is an individual IAM Policy statement
 type PolicyStatement struct {
-	Effect    string
-	Action    []string
-	Resource  []string            `json:",omitempty"`
-	Principal map[string][]string `json:",omitempty"`
+	Sid         string `json:",omitempty"`
+	Effect      string
+	Action      []string
+	Resource    []string                       `json:",omitempty"`
+	NotResource []string                       `json:",omitempty"`
+	Principal   map[string][]string            `json:",omitempty"`
+	Condition   map[string]map[string][]string `json:",omitempty"`
 }
 
 // PolicyDoc collects the policy statements
@@ -32,38 +35,65 @@ type PolicyDoc struct {
 	Statement []PolicyStatement
 }
 
-// createPolicy creates the appropriate access policy for the data repository, depending if it's a derivative or not
-func (s *S3Repository) createPolicy(ctx context.Context, id string, derivative bool) error {
-	if id == "" {
-		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
-	}
+// access policy name suffixes for the permission levels of grants
+const (
+	readOnlyPolicySuffix  = "-ro"
+	readWritePolicySuffix = "-rw"
+)
 
-	name := id
-	if s.NamePrefix != "" {
-		name = s.NamePrefix + "-" + name
+// accessPolicyName returns the name of the access policy for a permission level of grants to the bucket
+func accessPolicyName(bucket, permission string) string {
+	if permission == dataset.PermissionWrite {
+		return bucket + readWritePolicySuffix
 	}
+	return bucket + readOnlyPolicySuffix
+}
 
-	policyName := name
+// accessPolicyNames returns the names of all access policies of the bucket.  Datasets created before grants had
+// permission levels have a single access policy named after the bucket, it's listed first.
+func accessPolicyNames(bucket string) []string {
+	return []string{bucket, bucket + readOnlyPolicySuffix, bucket + readWritePolicySuffix}
+}
 
-	var policyDoc []byte
-	var err error
+// accessPolicies generates the access policy documents for the data repository by policy name.  The read-only
+// policy only allows reads, the read-write policy also allows writes if it's a derivative.
+func (s *S3Repository) accessPolicies(ctx context.Context, bucket string, derivative bool) (map[string][]byte, error) {
+	log.WithContext(ctx).Debugf("generating access policies for bucket '%s'", bucket)
 
-	log.Debugf("generating access policy for bucket '%s'", name)
+	keyArn, err := s.kmsKeyArn(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
 
+	readOnly, err := s.originalAccessPolicy(bucket, keyArn)
+	if err != nil {
+		return nil, ErrCode("failed to generate IAM policy for bucket "+bucket, err)
+	}
+
+	readWrite := readOnly
 	if derivative {
-		policyDoc, err = s.derivativeAccessPolicy(name)
-	} else {
-		policyDoc, err = s.originalAccessPolicy(name)
+		if readWrite, err = s.derivativeAccessPolicy(bucket, keyArn); err != nil {
+			return nil, ErrCode("failed to generate IAM policy for bucket "+bucket, err)
+		}
 	}
-	if err != nil {
-		return ErrCode("failed to generate IAM policy for bucket "+name, err)
+
+	return map[string][]byte{
+		accessPolicyName(bucket, dataset.PermissionRead):  readOnly,
+		accessPolicyName(bucket, dataset.PermissionWrite): readWrite,
+	}, nil
+}
+
+// createPolicy creates an access policy for the data repository
+func (s *S3Repository) createPolicy(ctx context.Context, bucket, policyName string, policyDoc []byte) error {
+	if policyName == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty policy name"))
 	}
 
-	log.Debugf("creating access policy for bucket '%s'", name)
+	log.WithContext(ctx).Debugf("creating access policy %s for bucket '%s'", policyName, bucket)
 
 	// create policy
 	policyOutput, err := s.IAM.CreatePolicyWithContext(ctx, &iam.CreatePolicyInput{
-		Description:    aws.String(fmt.Sprintf("Access policy for dataset bucket %s", name)),
+		Description:    aws.String(fmt.Sprintf("Access policy for dataset bucket %s", bucket)),
 		Path:           aws.String(s.IAMPathPrefix),
 		PolicyDocument: aws.String(string(policyDoc)),
 		PolicyName:     aws.String(policyName),
@@ -72,7 +102,7 @@ func (s *S3Repository) createPolicy(ctx context.Context, id string, derivative b
 		return ErrCode("failed to create IAM policy", err)
 	}
 
-	log.Debugf("created policy: %s", *policyOutput.Policy.Arn)
+	log.WithContext(ctx).Debugf("created policy: %s", *policyOutput.Policy.Arn)
 
 	return nil
 }
@@ -82,7 +112,7 @@ func (s *S3Repository) createPolicy(ctx context.Context, id string, derivative b
 func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID string) ([]func() error, error) {
 	var rollBackTasks []func() error
 
-	log.Debugf("creating role %s", roleName)
+	log.WithContext(ctx).Debugf("creating role %s", roleName)
 
 	roleDoc, err := s.assumeRolePolicy()
 	if err != nil {
@@ -102,7 +132,7 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 	// append role delete to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			log.Debug("DeleteRoleWithContext")
+			log.WithContext(ctx).Debug("DeleteRoleWithContext")
 			if _, err := s.IAM.DeleteRoleWithContext(ctx, &iam.DeleteRoleInput{RoleName: roleOutput.Role.RoleName}); err != nil {
 				return err
 			}
@@ -110,7 +140,7 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 		}()
 	})
 
-	log.Debugf("creating instance profile %s", roleName)
+	log.WithContext(ctx).Debugf("creating instance profile %s", roleName)
 
 	var instanceProfileOutput *iam.CreateInstanceProfileOutput
 	if instanceProfileOutput, err = s.IAM.CreateInstanceProfileWithContext(ctx, &iam.CreateInstanceProfileInput{
@@ -123,7 +153,7 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 	// append instance profile delete to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			log.Debug("DeleteInstanceProfileWithContext")
+			log.WithContext(ctx).Debug("DeleteInstanceProfileWithContext")
 			if _, err := s.IAM.DeleteInstanceProfileWithContext(ctx, &iam.DeleteInstanceProfileInput{InstanceProfileName: aws.String(roleName)}); err != nil {
 				return err
 			}
@@ -131,7 +161,7 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 		}()
 	})
 
-	log.Debugf("adding role to instance profile %s", roleName)
+	log.WithContext(ctx).Debugf("adding role to instance profile %s", roleName)
 
 	if _, err = s.IAM.AddRoleToInstanceProfileWithContext(ctx, &iam.AddRoleToInstanceProfileInput{
 		InstanceProfileName: aws.String(roleName),
@@ -143,7 +173,7 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 	// append role removal from instance profile to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			log.Debug("RemoveRoleFromInstanceProfileWithContext")
+			log.WithContext(ctx).Debug("RemoveRoleFromInstanceProfileWithContext")
 			if _, err := s.IAM.RemoveRoleFromInstanceProfileWithContext(ctx, &iam.RemoveRoleFromInstanceProfileInput{
 				InstanceProfileName: aws.String(roleName),
 				RoleName:            aws.String(roleName),
@@ -154,12 +184,12 @@ func (s *S3Repository) createRole(ctx context.Context, roleName, instanceID stri
 		}()
 	})
 
-	log.Debugf("created instance profile: %s", aws.StringValue(instanceProfileOutput.InstanceProfile.Arn))
+	log.WithContext(ctx).Debugf("created instance profile: %s", aws.StringValue(instanceProfileOutput.InstanceProfile.Arn))
 
 	return rollBackTasks, nil
 }
 
-// deletePolicy deletes the access policy for the given data repository
+// deletePolicy deletes the access policies for the given data repository
 func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 	if id == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
@@ -170,8 +200,31 @@ func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 		name = s.NamePrefix + "-" + name
 	}
 
-	policyName := name
+	var deleteErr error
+	for _, policyName := range accessPolicyNames(name) {
+		exists, err := s.policyExists(ctx, policyName)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		// keep deleting the other policies
+		if err := s.deleteAccessPolicy(ctx, policyName); err != nil {
+			log.WithContext(ctx).Warnf("failed to delete access policy %s: %s", policyName, err)
+			if deleteErr == nil {
+				deleteErr = err
+			}
+		}
+	}
+
+	return deleteErr
+}
 
+// deleteAccessPolicy detaches an access policy from all roles and deletes it
+func (s *S3Repository) deleteAccessPolicy(ctx context.Context, policyName string) error {
 	policyArn, err := s.getPolicyArn(ctx, policyName)
 	if err != nil {
 		return ErrCode("failed to get ARN for policy "+policyName, err)
@@ -179,7 +232,7 @@ func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 
 	// check if this policy is used anywhere and detach it before deleting
 
-	log.Debugf("listing roles with policy %s", policyArn)
+	log.WithContext(ctx).Debugf("listing roles with policy %s", policyArn)
 
 	// find out what entities the policy is attached to
 	// TODO: right now we only check roles, but may need to handle groups/users eventually
@@ -190,19 +243,22 @@ func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 		PolicyUsageFilter: aws.String("PermissionsPolicy"),
 	})
 	if err != nil {
-		log.Warnf("failed to list entities for policy "+policyArn, err)
+		log.WithContext(ctx).Warnf("failed to list entities for policy "+policyArn, err)
 	}
 
 	if entitiesOut != nil {
-		log.Debugf("policy %s is attached to %d roles", policyName, len(entitiesOut.PolicyRoles))
+		// roles granted access directly are outside of the IAMPathPrefix
+		entitiesOut.PolicyRoles = append(entitiesOut.PolicyRoles, s.grantRolesForPolicy(ctx, policyArn)...)
+
+		log.WithContext(ctx).Debugf("policy %s is attached to %d roles", policyName, len(entitiesOut.PolicyRoles))
 
 		for _, r := range entitiesOut.PolicyRoles {
-			log.Debugf("detaching dataset access policy %s from role %s", policyArn, aws.StringValue(r.RoleName))
+			log.WithContext(ctx).Debugf("detaching dataset access policy %s from role %s", policyArn, aws.StringValue(r.RoleName))
 			if _, err = s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
 				PolicyArn: aws.String(policyArn),
 				RoleName:  r.RoleName,
 			}); err != nil {
-				log.Warnf("failed to detach policy "+policyArn+" from role "+aws.StringValue(r.RoleName), err)
+				log.WithContext(ctx).Warnf("failed to detach policy "+policyArn+" from role "+aws.StringValue(r.RoleName), err)
 			}
 		}
 	}
@@ -212,22 +268,22 @@ func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 		PolicyArn: aws.String(policyArn),
 	})
 	if err != nil {
-		log.Warnf("failed to list policy versions for "+policyArn, err)
+		log.WithContext(ctx).Warnf("failed to list policy versions for "+policyArn, err)
 	}
 
 	if policyVersions != nil {
-		log.Debugf("policy %s has %d versions", policyName, len(policyVersions.Versions))
+		log.WithContext(ctx).Debugf("policy %s has %d versions", policyName, len(policyVersions.Versions))
 
 		for _, v := range policyVersions.Versions {
 			if *v.IsDefaultVersion {
 				continue
 			}
-			log.Debugf("deleting policy %s version %s", policyName, aws.StringValue(v.VersionId))
+			log.WithContext(ctx).Debugf("deleting policy %s version %s", policyName, aws.StringValue(v.VersionId))
 			if _, err = s.IAM.DeletePolicyVersionWithContext(ctx, &iam.DeletePolicyVersionInput{
 				PolicyArn: aws.String(policyArn),
 				VersionId: v.VersionId,
 			}); err != nil {
-				log.Warnf("failed to delete policy "+policyName+" version "+aws.StringValue(v.VersionId), err)
+				log.WithContext(ctx).Warnf("failed to delete policy "+policyName+" version "+aws.StringValue(v.VersionId), err)
 			}
 		}
 	}
@@ -237,7 +293,7 @@ func (s *S3Repository) deletePolicy(ctx context.Context, id string) error {
 		return ErrCode("failed to delete policy "+policyArn, err)
 	}
 
-	log.Debugf("deleted policy: %s", policyArn)
+	log.WithContext(ctx).Debugf("deleted policy: %s", policyArn)
 
 	return nil
 }
@@ -255,7 +311,7 @@ func (s *S3Repository) getPolicyArn(ctx context.Context, name string) (string, e
 		name = s.IAMPathPrefix + name
 	}
 
-	log.Debugf("constructing ARN for policy %s", name)
+	log.WithContext(ctx).Debugf("constructing ARN for policy %s", name)
 
 	callerID, err := s.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
@@ -264,41 +320,23 @@ func (s *S3Repository) getPolicyArn(ctx context.Context, name string) (string, e
 
 	policyArn := fmt.Sprintf("arn:aws:iam::%s:policy%s", *callerID.Account, name)
 
-	log.Debugf("policy ARN: %s", policyArn)
+	log.WithContext(ctx).Debugf("policy ARN: %s", policyArn)
 
 	return policyArn, nil
 }
 
-// modifyPolicy modifies the existing access policy for the data repository, depending if it's a derivative or not
-func (s *S3Repository) modifyPolicy(ctx context.Context, id string, derivative bool) error {
-	if id == "" {
-		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+// modifyPolicy creates a new default version of an existing access policy for the data repository
+func (s *S3Repository) modifyPolicy(ctx context.Context, policyName string, policyDoc []byte) error {
+	if policyName == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty policy name"))
 	}
 
-	name := id
-	if s.NamePrefix != "" {
-		name = s.NamePrefix + "-" + name
-	}
-
-	policyName := name
-
 	policyArn, err := s.getPolicyArn(ctx, policyName)
 	if err != nil {
 		return ErrCode("failed to get ARN for policy "+policyName, err)
 	}
 
-	var policyDoc []byte
-
-	if derivative {
-		policyDoc, err = s.derivativeAccessPolicy(name)
-	} else {
-		policyDoc, err = s.originalAccessPolicy(name)
-	}
-	if err != nil {
-		return ErrCode("failed to generate IAM policy for bucket "+name, err)
-	}
-
-	log.Debugf("creating new policy version for bucket '%s'", name)
+	log.WithContext(ctx).Debugf("creating new version of policy '%s'", policyName)
 
 	// create a new default policy version
 	policyOutput, err := s.IAM.CreatePolicyVersionWithContext(ctx, &iam.CreatePolicyVersionInput{
@@ -310,25 +348,18 @@ func (s *S3Repository) modifyPolicy(ctx context.Context, id string, derivative b
 		return ErrCode("failed to create new IAM policy version", err)
 	}
 
-	log.Debugf("created policy version %s for policy: %s", *policyOutput.PolicyVersion.VersionId, policyArn)
+	log.WithContext(ctx).Debugf("created policy version %s for policy: %s", *policyOutput.PolicyVersion.VersionId, policyArn)
 
 	return nil
 }
 
-// policyExists returns true if there is an IAM access policy for this data repository
-func (s *S3Repository) policyExists(ctx context.Context, id string) (bool, error) {
-	if id == "" {
-		return false, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
-	}
-
-	name := id
-	if s.NamePrefix != "" {
-		name = s.NamePrefix + "-" + name
+// policyExists returns true if there is an IAM access policy with the given name
+func (s *S3Repository) policyExists(ctx context.Context, policyName string) (bool, error) {
+	if policyName == "" {
+		return false, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty policy name"))
 	}
 
-	policyName := name
-
-	log.Debugf("checking if access policy exists for bucket '%s'", name)
+	log.WithContext(ctx).Debugf("checking if access policy '%s' exists", policyName)
 
 	policyArn, err := s.getPolicyArn(ctx, policyName)
 	if err != nil {
@@ -351,12 +382,91 @@ func (s *S3Repository) policyExists(ctx context.Context, id string) (bool, error
 	return policyExists, nil
 }
 
-// ListAccess lists all instances that have access to the data repository
-// Returns a map with the instance id's and their assigned instance profile,
-// e.g. { "instance_id": "instance_profile_name" }
+// grantPolicyArn returns the ARN of the access policy for a grant with the permission level.  Datasets created
+// before grants had permission levels only have the single access policy, which is used for write grants, and
+// their read-only policy is created when it's first granted.
+func (s *S3Repository) grantPolicyArn(ctx context.Context, bucket, permission string) (string, error) {
+	policyName := accessPolicyName(bucket, permission)
+
+	exists, err := s.policyExists(ctx, policyName)
+	if err != nil {
+		return "", err
+	}
+
+	if !exists {
+		legacy, err := s.policyExists(ctx, bucket)
+		if err != nil {
+			return "", err
+		}
+
+		if !legacy {
+			return "", apierror.New(apierror.ErrNotFound, "access policy "+policyName+" not found", nil)
+		}
+
+		if permission == dataset.PermissionWrite {
+			policyName = bucket
+		} else {
+			policies, err := s.accessPolicies(ctx, bucket, false)
+			if err != nil {
+				return "", err
+			}
+
+			if err = s.createPolicy(ctx, bucket, policyName, policies[policyName]); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	policyArn, err := s.getPolicyArn(ctx, policyName)
+	if err != nil {
+		return "", ErrCode("failed to get ARN for policy "+policyName, err)
+	}
+
+	return policyArn, nil
+}
+
+// detachOtherAccessPolicies detaches the access policies of the bucket, other than the one just attached, from a
+// role so a new grant replaces the permission level of an earlier grant
+func (s *S3Repository) detachOtherAccessPolicies(ctx context.Context, bucket, roleName, policyArn string) error {
+	for _, policyName := range accessPolicyNames(bucket) {
+		otherArn, err := s.getPolicyArn(ctx, policyName)
+		if err != nil {
+			return ErrCode("failed to get ARN for policy "+policyName, err)
+		}
+
+		if otherArn == policyArn {
+			continue
+		}
+
+		if _, err = s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(otherArn),
+			RoleName:  aws.String(roleName),
+		}); err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iam.ErrCodeNoSuchEntityException {
+				continue
+			}
+			return ErrCode("failed to detach policy "+otherArn+" from role "+roleName, err)
+		}
+
+		log.WithContext(ctx).Debugf("detached policy %s from role %s", otherArn, roleName)
+	}
+
+	return nil
+}
+
+// ListAccess lists all instances and roles that have access to the data repository
+// Returns a map with the instance id's and their assigned instance profile, and the role arn's and their name
+// e.g. { "instance_id": "instance_profile_name", "role_arn": "role_name" }
 func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Access, error) {
+	output, _, err := s.ListAccessPermissions(ctx, id)
+	return output, err
+}
+
+// ListAccessPermissions lists all instances and roles that have access to the data repository, like ListAccess,
+// and the permission level of each of them, e.g. { "instance_id": "read", "role_arn": "write" }
+func (s *S3Repository) ListAccessPermissions(ctx context.Context, id string) (dataset.Access, map[string]string, error) {
 	if id == "" {
-		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
 	name := id
@@ -364,16 +474,46 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("listing instances with access to s3datarepository %s", name)
+	log.WithContext(ctx).Infof("listing instances with access to s3datarepository %s", name)
 
-	policyName := name
+	output := dataset.Access{}
+	permissions := map[string]string{}
 
-	policyArn, err := s.getPolicyArn(ctx, policyName)
-	if err != nil {
-		return nil, ErrCode("failed to get ARN for policy "+policyName, err)
+	// the legacy access policy (named after the bucket) allows the same as the read-write policy
+	for _, policyName := range accessPolicyNames(name) {
+		permission := dataset.PermissionWrite
+		if policyName == accessPolicyName(name, dataset.PermissionRead) {
+			permission = dataset.PermissionRead
+		}
+
+		policyArn, err := s.getPolicyArn(ctx, policyName)
+		if err != nil {
+			return nil, nil, ErrCode("failed to get ARN for policy "+policyName, err)
+		}
+
+		policyOutput := dataset.Access{}
+		if err := s.listPolicyAccess(ctx, policyArn, policyOutput); err != nil {
+			if aerr, ok := err.(apierror.Error); ok && aerr.Code == apierror.ErrNotFound {
+				log.WithContext(ctx).Debugf("access policy %s not found", policyName)
+				continue
+			}
+			return nil, nil, err
+		}
+
+		for k, v := range policyOutput {
+			output[k] = v
+			if permissions[k] != dataset.PermissionWrite {
+				permissions[k] = permission
+			}
+		}
 	}
 
-	log.Debugf("listing roles with policy %s", policyArn)
+	return output, permissions, nil
+}
+
+// listPolicyAccess adds the instances and roles that the access policy is attached to
+func (s *S3Repository) listPolicyAccess(ctx context.Context, policyArn string, output dataset.Access) error {
+	log.WithContext(ctx).Debugf("listing roles with policy %s", policyArn)
 
 	// find out what roles the policy is attached to
 	entitiesOut, err := s.IAM.ListEntitiesForPolicyWithContext(ctx, &iam.ListEntitiesForPolicyInput{
@@ -383,17 +523,15 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 		PolicyUsageFilter: aws.String("PermissionsPolicy"),
 	})
 	if err != nil {
-		return nil, ErrCode("failed to list entities for policy "+policyArn, err)
+		return ErrCode("failed to list entities for policy "+policyArn, err)
 	}
 
-	log.Debug(entitiesOut.PolicyRoles)
+	log.WithContext(ctx).Debug(entitiesOut.PolicyRoles)
 
 	if len(entitiesOut.PolicyRoles) == 0 {
-		log.Infof("policy %s is not attached to any roles", policyName)
+		log.WithContext(ctx).Infof("policy %s is not attached to any roles", policyArn)
 	}
 
-	output := dataset.Access{}
-
 	// find out what instances each role is assigned to
 	for _, r := range entitiesOut.PolicyRoles {
 		roleName := aws.StringValue(r.RoleName)
@@ -402,11 +540,11 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 			RoleName: r.RoleName,
 		})
 		if err != nil {
-			return nil, ErrCode("failed to list instance profiles for role "+roleName, err)
+			return ErrCode("failed to list instance profiles for role "+roleName, err)
 		}
 
 		if len(ipOut.InstanceProfiles) == 0 {
-			log.Warnf("role is not associated with any instance profiles: %s", roleName)
+			log.WithContext(ctx).Warnf("role is not associated with any instance profiles: %s", roleName)
 			continue
 		}
 
@@ -417,7 +555,7 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 			instanceProfileName = append(instanceProfileName, aws.StringValue(ip.InstanceProfileName))
 		}
 
-		log.Debugf("listing instances with instance profile: %s", strings.Join(instanceProfileName, ","))
+		log.WithContext(ctx).Debugf("listing instances with instance profile: %s", strings.Join(instanceProfileName, ","))
 
 		instancesOut, err := s.EC2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
 			Filters: []*ec2.Filter{
@@ -428,17 +566,17 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 			},
 		})
 		if err != nil {
-			return nil, ErrCode("failed to list instances with instance profile "+strings.Join(instanceProfileName, ","), err)
+			return ErrCode("failed to list instances with instance profile "+strings.Join(instanceProfileName, ","), err)
 		}
 
 		if len(instancesOut.Reservations) == 0 {
-			log.Warnf("instance profile is not assigned to any instances: %s", strings.Join(instanceProfileName, ","))
+			log.WithContext(ctx).Warnf("instance profile is not assigned to any instances: %s", strings.Join(instanceProfileName, ","))
 			continue
 		}
 
 		for _, reservation := range instancesOut.Reservations {
 			for _, instance := range reservation.Instances {
-				log.Debugf("found instance %v", aws.StringValue(instance.InstanceId))
+				log.WithContext(ctx).Debugf("found instance %v", aws.StringValue(instance.InstanceId))
 
 				// we only have the instance profile arn, so let's extract the name
 				ipArns := strings.Split(aws.StringValue(instance.IamInstanceProfile.Arn), "/")
@@ -449,14 +587,21 @@ func (s *S3Repository) ListAccess(ctx context.Context, id string) (dataset.Acces
 		}
 	}
 
-	return output, nil
+	// roles outside of the IAMPathPrefix that were granted access directly
+	if err := s.listRoleAccess(ctx, policyArn, output); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 // GrantAccess gives an instance access to the data repository by setting up a role (instance profile)
 // If the instance already has an associated instance profile, it will copy all of its policies to
 // the new instance profile and swap out the profiles
-// Returns the instance id and the arn of the instance profile
-func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (dataset.Access, error) {
+// If the principal is a role ARN, the access policy is attached to that (existing) role instead
+// The access policy for the permission level is attached, replacing the policy of any earlier grant
+// Returns the instance id and the arn of the instance profile, or the role arn and the role name
+func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID, permission string) (dataset.Access, error) {
 	if id == "" {
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
@@ -465,21 +610,27 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty instanceID"))
 	}
 
+	if permission != dataset.PermissionRead && permission != dataset.PermissionWrite {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid permission "+permission, nil)
+	}
+
+	if isRoleArn(instanceID) {
+		return s.grantRoleAccess(ctx, id, instanceID, permission)
+	}
+
 	name := id
 	if s.NamePrefix != "" {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("granting instance %s access to s3datarepository %s", instanceID, name)
+	log.WithContext(ctx).Infof("granting instance %s %s access to s3datarepository %s", instanceID, permission, name)
 
-	policyName := name
-
-	policyArn, err := s.getPolicyArn(ctx, policyName)
+	policyArn, err := s.grantPolicyArn(ctx, name, permission)
 	if err != nil {
-		return nil, ErrCode("failed to get ARN for policy "+policyName, err)
+		return nil, err
 	}
 
-	log.Debugf("getting information about instance %s", instanceID)
+	log.WithContext(ctx).Debugf("getting information about instance %s", instanceID)
 
 	// we describe the given instance so we can
 	// 1) make sure it exists, and 2) see if it already has an instance profile association
@@ -504,7 +655,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 	var rollBackTasks []func() error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error granting access to s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error granting access to s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
@@ -518,7 +669,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 		if aerr, ok := err.(awserr.Error); ok {
 			if aerr.Code() == iam.ErrCodeNoSuchEntityException {
 				roleExists = false
-				log.Debugf("role %s does not exist", roleName)
+				log.WithContext(ctx).Debugf("role %s does not exist", roleName)
 			} else {
 				return nil, ErrCode("failed to get IAM role "+roleName, err)
 			}
@@ -526,7 +677,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 			return nil, ErrCode("failed to get IAM role "+roleName, err)
 		}
 	} else {
-		log.Debugf("role %s already exists", roleName)
+		log.WithContext(ctx).Debugf("role %s already exists", roleName)
 	}
 
 	// if there's no existing role for this instance we'll create one and associate it with an
@@ -541,7 +692,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 		}
 	}
 
-	log.Debugf("attaching policy %s to role %s", policyArn, roleName)
+	log.WithContext(ctx).Debugf("attaching policy %s to role %s", policyArn, roleName)
 
 	_, err = s.IAM.AttachRolePolicyWithContext(ctx, &iam.AttachRolePolicyInput{
 		PolicyArn: aws.String(policyArn),
@@ -551,10 +702,14 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 		return nil, ErrCode("failed to attach policy "+policyArn+" to role "+roleName, err)
 	}
 
+	if err = s.detachOtherAccessPolicies(ctx, name, roleName, policyArn); err != nil {
+		return nil, err
+	}
+
 	// append policy detach from role to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			log.Debug("DetachRolePolicyWithContext")
+			log.WithContext(ctx).Debug("DetachRolePolicyWithContext")
 			if _, err := s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
 				PolicyArn: aws.String(policyArn),
 				RoleName:  aws.String(roleName),
@@ -578,7 +733,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 		}
 
 		if !instanceRoleAssociated {
-			log.Infof("instance %s already has instance profile %s, will try to migrate existing policies", instanceID, currentInstanceProfileName)
+			log.WithContext(ctx).Infof("instance %s already has instance profile %s, will try to migrate existing policies", instanceID, currentInstanceProfileName)
 
 			// find out what role(s) correspond to this instance profile and what policies are attached to them
 			var ipOut *iam.GetInstanceProfileOutput
@@ -591,7 +746,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 			// TODO: we are _not_ considering role inline policies at this point, should we?
 			var currentPoliciesArn []string
 			for _, r := range ipOut.InstanceProfile.Roles {
-				log.Debugf("listing attached policies for role %s", aws.StringValue(r.RoleName))
+				log.WithContext(ctx).Debugf("listing attached policies for role %s", aws.StringValue(r.RoleName))
 
 				var attachedRolePoliciesOut *iam.ListAttachedRolePoliciesOutput
 				if attachedRolePoliciesOut, err = s.IAM.ListAttachedRolePoliciesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{
@@ -601,7 +756,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 				}
 
 				if attachedRolePoliciesOut.AttachedPolicies == nil {
-					log.Warnf("no attached policies found for current role %s, there may be inline policies", aws.StringValue(r.RoleName))
+					log.WithContext(ctx).Warnf("no attached policies found for current role %s, there may be inline policies", aws.StringValue(r.RoleName))
 				}
 
 				for _, p := range attachedRolePoliciesOut.AttachedPolicies {
@@ -609,11 +764,11 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 				}
 			}
 
-			log.Infof("policies attached to the current instance profile: %s", currentPoliciesArn)
+			log.WithContext(ctx).Infof("policies attached to the current instance profile: %s", currentPoliciesArn)
 
 			// attach current policies to our new role
 			for _, p := range currentPoliciesArn {
-				log.Debugf("attaching pre-existing policy %s to role %s", p, roleName)
+				log.WithContext(ctx).Debugf("attaching pre-existing policy %s to role %s", p, roleName)
 
 				_, err = s.IAM.AttachRolePolicyWithContext(ctx, &iam.AttachRolePolicyInput{
 					PolicyArn: aws.String(p),
@@ -628,20 +783,20 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 			rollBackTasks = append(rollBackTasks, func() error {
 				return func() error {
 					for _, p := range currentPoliciesArn {
-						log.Debugf("DetachRolePolicyWithContext: %s (%s)", p, roleName)
+						log.WithContext(ctx).Debugf("DetachRolePolicyWithContext: %s (%s)", p, roleName)
 						err = retry(3, 3*time.Second, func() error {
 							_, err = s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
 								PolicyArn: aws.String(p),
 								RoleName:  aws.String(roleName),
 							})
 							if err != nil {
-								log.Debugf("retrying, got error: %s", err)
+								log.WithContext(ctx).Debugf("retrying, got error: %s", err)
 								return err
 							}
 							return nil
 						})
 						if err != nil {
-							log.Warnf("failed to detach policy "+p+" from role "+roleName, err)
+							log.WithContext(ctx).Warnf("failed to detach policy "+p+" from role "+roleName, err)
 							continue
 						}
 					}
@@ -666,13 +821,13 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 				return nil, ErrCode("failed to describe instance profile associations for instance "+instanceID, err)
 			}
 
-			log.Debugf("got associations: %+v", ipAssociationsOut.IamInstanceProfileAssociations)
+			log.WithContext(ctx).Debugf("got associations: %+v", ipAssociationsOut.IamInstanceProfileAssociations)
 
 			if len(ipAssociationsOut.IamInstanceProfileAssociations) != 1 {
 				return nil, ErrCode("did not find exactly 1 instance profile association for instance "+instanceID, nil)
 			}
 
-			log.Debugf("disassociating association id %s", aws.StringValue(ipAssociationsOut.IamInstanceProfileAssociations[0].AssociationId))
+			log.WithContext(ctx).Debugf("disassociating association id %s", aws.StringValue(ipAssociationsOut.IamInstanceProfileAssociations[0].AssociationId))
 
 			// retry the instance profile disassociation
 			err = retry(5, 3*time.Second, func() error {
@@ -680,7 +835,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 					AssociationId: ipAssociationsOut.IamInstanceProfileAssociations[0].AssociationId,
 				})
 				if err != nil {
-					log.Debugf("retrying, got error: %s", err)
+					log.WithContext(ctx).Debugf("retrying, got error: %s", err)
 					return err
 				}
 				return nil
@@ -692,7 +847,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 			// append original instance profile association to rollback tasks
 			rollBackTasks = append(rollBackTasks, func() error {
 				return func() error {
-					log.Debug("AssociateIamInstanceProfileWithContext")
+					log.WithContext(ctx).Debug("AssociateIamInstanceProfileWithContext")
 					err = retry(5, 3*time.Second, func() error {
 						_, err = s.EC2.AssociateIamInstanceProfileWithContext(ctx, &ec2.AssociateIamInstanceProfileInput{
 							IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
@@ -701,7 +856,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 							InstanceId: aws.String(instanceID),
 						})
 						if err != nil {
-							log.Debugf("retrying, got error: %s", err)
+							log.WithContext(ctx).Debugf("retrying, got error: %s", err)
 							return err
 						}
 						return nil
@@ -717,7 +872,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 
 	// we associate the new instance profile with the instance, unless it's already associated
 	if !instanceRoleAssociated {
-		log.Infof("associating instance profile %s with instance %s", roleName, instanceID)
+		log.WithContext(ctx).Infof("associating instance profile %s with instance %s", roleName, instanceID)
 
 		// retry the instance profile association as it takes a while to show up
 		err = retry(5, 3*time.Second, func() error {
@@ -728,7 +883,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 				InstanceId: aws.String(instanceID),
 			})
 			if err != nil {
-				log.Debugf("retrying, got error: %s", err)
+				log.WithContext(ctx).Debugf("retrying, got error: %s", err)
 				return err
 			}
 			return nil
@@ -737,7 +892,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 			return nil, ErrCode("failed to associate instance profile with instance "+instanceID, err)
 		}
 
-		log.Debugf("associated instance profile %s with instance %s", roleName, instanceID)
+		log.WithContext(ctx).Debugf("associated instance profile %s with instance %s", roleName, instanceID)
 	}
 
 	output := dataset.Access{
@@ -750,6 +905,7 @@ func (s *S3Repository) GrantAccess(ctx context.Context, id, instanceID string) (
 // RevokeAccess revokes instance access from the data repository by
 // removing the dataset access policy from the instance profile (role)
 // Note this will leave the instance role in place, since it may contain other policies
+// If the principal is a role ARN, the access policy is detached from that role
 func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string) error {
 	if id == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
@@ -759,21 +915,27 @@ func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string)
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty instanceID"))
 	}
 
+	if isRoleArn(instanceID) {
+		return s.revokeRoleAccess(ctx, id, instanceID)
+	}
+
 	name := id
 	if s.NamePrefix != "" {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("revoking instance %s access from s3datarepository %s", instanceID, name)
+	log.WithContext(ctx).Infof("revoking instance %s access from s3datarepository %s", instanceID, name)
 
-	policyName := name
-
-	policyArn, err := s.getPolicyArn(ctx, policyName)
-	if err != nil {
-		return ErrCode("failed to get ARN for policy "+policyName, err)
+	policyArns := map[string]bool{}
+	for _, policyName := range accessPolicyNames(name) {
+		policyArn, err := s.getPolicyArn(ctx, policyName)
+		if err != nil {
+			return ErrCode("failed to get ARN for policy "+policyName, err)
+		}
+		policyArns[policyArn] = true
 	}
 
-	log.Debugf("getting information about instance %s", instanceID)
+	log.WithContext(ctx).Debugf("getting information about instance %s", instanceID)
 
 	// we describe the given instance so we can
 	// 1) make sure it exists, and 2) see if it already has an instance profile association
@@ -795,11 +957,11 @@ func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string)
 	instanceInfo := instancesOut.Reservations[0].Instances[0]
 
 	if instanceInfo.IamInstanceProfile == nil {
-		log.Warnf("instance %s does not have an associated instance profile", instanceID)
+		log.WithContext(ctx).Warnf("instance %s does not have an associated instance profile", instanceID)
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("instance "+instanceID+" does not have access to dataset"))
 	}
 
-	log.Debugf("instance %s has instance profile %s", instanceID, aws.StringValue(instanceInfo.IamInstanceProfile.Arn))
+	log.WithContext(ctx).Debugf("instance %s has instance profile %s", instanceID, aws.StringValue(instanceInfo.IamInstanceProfile.Arn))
 
 	// we only have the instance profile arn, so let's extract the name
 	ipArns := strings.Split(aws.StringValue(instanceInfo.IamInstanceProfile.Arn), "/")
@@ -815,9 +977,9 @@ func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string)
 
 	var policyFound bool
 
-	// find the dataset access policy and detach it from the role
+	// find the dataset access policies and detach them from the role
 	for _, r := range ipOut.InstanceProfile.Roles {
-		log.Debugf("listing attached policies for role %s", aws.StringValue(r.RoleName))
+		log.WithContext(ctx).Debugf("listing attached policies for role %s", aws.StringValue(r.RoleName))
 
 		var attachedRolePoliciesOut *iam.ListAttachedRolePoliciesOutput
 		if attachedRolePoliciesOut, err = s.IAM.ListAttachedRolePoliciesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{
@@ -827,9 +989,9 @@ func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string)
 		}
 
 		for _, p := range attachedRolePoliciesOut.AttachedPolicies {
-			if aws.StringValue(p.PolicyArn) == policyArn {
+			if policyArns[aws.StringValue(p.PolicyArn)] {
 				policyFound = true
-				log.Debugf("detaching dataset access policy %s from role %s", policyArn, aws.StringValue(r.RoleName))
+				log.WithContext(ctx).Debugf("detaching dataset access policy %s from role %s", aws.StringValue(p.PolicyArn), aws.StringValue(r.RoleName))
 
 				_, err = s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
 					PolicyArn: p.PolicyArn,
@@ -838,14 +1000,12 @@ func (s *S3Repository) RevokeAccess(ctx context.Context, id, instanceID string)
 				if err != nil {
 					return ErrCode("failed to detach policy "+aws.StringValue(p.PolicyArn)+" from role "+aws.StringValue(r.RoleName), err)
 				}
-
-				break
 			}
 		}
 	}
 
 	if !policyFound {
-		log.Warnf("did not find dataset access policy %s in any of the roles associated with this instance %s", policyArn, instanceID)
+		log.WithContext(ctx).Warnf("did not find dataset access policies for %s in any of the roles associated with this instance %s", name, instanceID)
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("instance "+instanceID+" does not have access to dataset"))
 	}
 
@@ -876,35 +1036,50 @@ func (s *S3Repository) assumeRolePolicy() ([]byte, error) {
 }
 
 // derivativeAccessPolicy defines the IAM policy for access to a derivative dataset (RW)
-func (s *S3Repository) derivativeAccessPolicy(bucket string) ([]byte, error) {
+func (s *S3Repository) derivativeAccessPolicy(bucket, keyArn string) ([]byte, error) {
 	log.Debugf("generating derivative bucket access policy for %s", bucket)
 
-	policyDoc, err := json.Marshal(PolicyDoc{
-		Version: "2012-10-17",
-		Statement: []PolicyStatement{
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
-				Effect:   "Allow",
-				Action:   []string{"s3:ListBucket"},
+	statements := []PolicyStatement{
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
+			Effect:   "Allow",
+			Action:   []string{"s3:ListBucket"},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
+			Effect:   "Allow",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:GetObject",
+				"s3:PutObject",
 			},
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
-				Effect:   "Allow",
-				Action: []string{
-					"s3:DeleteObject",
-					"s3:GetObject",
-					"s3:PutObject",
-				},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_attachments/*", bucket)},
+			Effect:   "Deny",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:PutObject",
 			},
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_attachments/*", bucket)},
-				Effect:   "Deny",
-				Action: []string{
-					"s3:DeleteObject",
-					"s3:PutObject",
-				},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_manifest/*", bucket)},
+			Effect:   "Deny",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:PutObject",
 			},
 		},
+	}
+
+	// allow using the customer managed key of the bucket
+	if keyArn != "" {
+		statements = append(statements, kmsPolicyStatement(keyArn, true))
+	}
+
+	policyDoc, err := json.Marshal(PolicyDoc{
+		Version:   "2012-10-17",
+		Statement: statements,
 	})
 
 	if err != nil {
@@ -918,23 +1093,38 @@ func (s *S3Repository) derivativeAccessPolicy(bucket string) ([]byte, error) {
 }
 
 // originalAccessPolicy defines the IAM policy for access to an original dataset (RO)
-func (s *S3Repository) originalAccessPolicy(bucket string) ([]byte, error) {
+func (s *S3Repository) originalAccessPolicy(bucket, keyArn string) ([]byte, error) {
 	log.Debugf("generating original bucket access policy for %s", bucket)
 
-	policyDoc, err := json.Marshal(PolicyDoc{
-		Version: "2012-10-17",
-		Statement: []PolicyStatement{
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
-				Effect:   "Allow",
-				Action:   []string{"s3:ListBucket"},
-			},
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
-				Effect:   "Allow",
-				Action:   []string{"s3:GetObject"},
+	statements := []PolicyStatement{
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
+			Effect:   "Allow",
+			Action:   []string{"s3:ListBucket"},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
+			Effect:   "Allow",
+			Action:   []string{"s3:GetObject"},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_manifest/*", bucket)},
+			Effect:   "Deny",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:PutObject",
 			},
 		},
+	}
+
+	// allow using the customer managed key of the bucket
+	if keyArn != "" {
+		statements = append(statements, kmsPolicyStatement(keyArn, false))
+	}
+
+	policyDoc, err := json.Marshal(PolicyDoc{
+		Version:   "2012-10-17",
+		Statement: statements,
 	})
 
 	if err != nil {
@@ -948,37 +1138,52 @@ func (s *S3Repository) originalAccessPolicy(bucket string) ([]byte, error) {
 }
 
 // temporaryAccessPolicy defines the IAM policy for temporary (user) access to upload data (RW)
-func (s *S3Repository) temporaryAccessPolicy(bucket string) ([]byte, error) {
+func (s *S3Repository) temporaryAccessPolicy(bucket, keyArn string) ([]byte, error) {
 	log.Debugf("generating temporary bucket access policy for %s", bucket)
 
-	policyDoc, err := json.Marshal(PolicyDoc{
-		Version: "2012-10-17",
-		Statement: []PolicyStatement{
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
-				Effect:   "Allow",
-				Action: []string{
-					"s3:ListBucket",
-				},
+	statements := []PolicyStatement{
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
+			Effect:   "Allow",
+			Action: []string{
+				"s3:ListBucket",
 			},
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
-				Effect:   "Allow",
-				Action: []string{
-					"s3:DeleteObject",
-					"s3:GetObject",
-					"s3:PutObject",
-				},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
+			Effect:   "Allow",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:GetObject",
+				"s3:PutObject",
 			},
-			PolicyStatement{
-				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_attachments/*", bucket)},
-				Effect:   "Deny",
-				Action: []string{
-					"s3:DeleteObject",
-					"s3:PutObject",
-				},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_attachments/*", bucket)},
+			Effect:   "Deny",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:PutObject",
+			},
+		},
+		PolicyStatement{
+			Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/_manifest/*", bucket)},
+			Effect:   "Deny",
+			Action: []string{
+				"s3:DeleteObject",
+				"s3:PutObject",
 			},
 		},
+	}
+
+	// allow using the customer managed key of the bucket
+	if keyArn != "" {
+		statements = append(statements, kmsPolicyStatement(keyArn, true))
+	}
+
+	policyDoc, err := json.Marshal(PolicyDoc{
+		Version:   "2012-10-17",
+		Statement: statements,
 	})
 
 	if err != nil {
@@ -355,6 +355,12 @@ func (i *mockIAMClient) GetPolicyWithContext(ctx context.Context, input *iam.Get
 		return nil, err
 	}
 
+	// datasets created before grants had permission levels only have the legacy access policy
+	policyArn := aws.StringValue(input.PolicyArn)
+	if strings.Contains(policyArn, "LEGACY-DATASET") && (strings.HasSuffix(policyArn, "-ro") || strings.HasSuffix(policyArn, "-rw")) {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "policy not found", nil)
+	}
+
 	output := &iam.GetPolicyOutput{Policy: &iam.Policy{
 		Arn:         input.PolicyArn,
 		CreateDate:  &testTime,
@@ -372,11 +378,17 @@ func (i *mockIAMClient) GetRoleWithContext(ctx context.Context, input *iam.GetRo
 		return nil, err
 	}
 
+	// roles that aren't managed by the api are in the /apps/ path
+	path := "/test/"
+	if strings.HasPrefix(aws.StringValue(input.RoleName), "app-") {
+		path = "/apps/"
+	}
+
 	output := &iam.GetRoleOutput{Role: &iam.Role{
-		Arn:         aws.String(fmt.Sprintf("arn:aws:iam::12345678901:role%s%s", "/test/", *input.RoleName)),
+		Arn:         aws.String(fmt.Sprintf("arn:aws:iam::12345678901:role%s%s", path, *input.RoleName)),
 		CreateDate:  &testTime,
 		Description: aws.String("Test role"),
-		Path:        aws.String("/test/"),
+		Path:        aws.String(path),
 		RoleId:      aws.String(strings.ToUpper(fmt.Sprintf("%sID123", *input.RoleName))),
 		RoleName:    input.RoleName,
 	}}
@@ -447,7 +459,17 @@ func (i *mockIAMClient) ListEntitiesForPolicyWithContext(ctx context.Context, in
 
 	var output *iam.ListEntitiesForPolicyOutput
 
-	if strings.Contains(aws.StringValue(input.PolicyArn), "DATASET-POLICY-NOT-USED") {
+	if aws.StringValue(input.PathPrefix) == "/apps/" {
+		output = &iam.ListEntitiesForPolicyOutput{
+			PolicyRoles: []*iam.PolicyRole{
+				&iam.PolicyRole{
+					RoleId:   aws.String("APP-ECSTASKID123"),
+					RoleName: aws.String("app-ecsTask"),
+				},
+			},
+		}
+	} else if strings.Contains(aws.StringValue(input.PolicyArn), "DATASET-POLICY-NOT-USED") ||
+		(strings.Contains(aws.StringValue(input.PolicyArn), "READ-ONLY-DATASET") && !strings.HasSuffix(aws.StringValue(input.PolicyArn), "-ro")) {
 		output = &iam.ListEntitiesForPolicyOutput{
 			PolicyRoles: []*iam.PolicyRole{},
 		}
@@ -505,7 +527,7 @@ func TestGrantAccess(t *testing.T) {
 	expected := dataset.Access{
 		instanceID: fmt.Sprintf("instanceRole_%s", instanceID),
 	}
-	got, err := s.GrantAccess(context.TODO(), id, instanceID)
+	got, err := s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -520,7 +542,7 @@ func TestGrantAccess(t *testing.T) {
 		instanceID: fmt.Sprintf("instanceRole_%s", instanceID),
 	}
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "ErrCodeNoSuchEntityException", nil)
-	got, err = s.GrantAccess(context.TODO(), id, instanceID)
+	got, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -534,7 +556,7 @@ func TestGrantAccess(t *testing.T) {
 	expected = dataset.Access{
 		instanceID: fmt.Sprintf("instanceRole_%s", instanceID),
 	}
-	got, err = s.GrantAccess(context.TODO(), id, instanceID)
+	got, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -549,7 +571,7 @@ func TestGrantAccess(t *testing.T) {
 		instanceID: fmt.Sprintf("instanceRole_%s", instanceID),
 	}
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "ErrCodeNoSuchEntityException", nil)
-	got, err = s.GrantAccess(context.TODO(), id, instanceID)
+	got, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -562,7 +584,7 @@ func TestGrantAccess(t *testing.T) {
 	// test empty id
 	s = newTestS3Repository(t)
 	instanceID = "i-0123456789abcdef1"
-	_, err = s.GrantAccess(context.TODO(), "", instanceID)
+	_, err = s.GrantAccess(context.TODO(), "", instanceID, dataset.PermissionWrite)
 	if aerr, ok := err.(apierror.Error); ok {
 		if aerr.Code != apierror.ErrBadRequest {
 			t.Errorf("expected error code %s, got: %s", apierror.ErrBadRequest, aerr.Code)
@@ -573,7 +595,7 @@ func TestGrantAccess(t *testing.T) {
 
 	// test empty instanceID
 	s = newTestS3Repository(t)
-	_, err = s.GrantAccess(context.TODO(), id, "")
+	_, err = s.GrantAccess(context.TODO(), id, "", dataset.PermissionWrite)
 	if aerr, ok := err.(apierror.Error); ok {
 		if aerr.Code != apierror.ErrBadRequest {
 			t.Errorf("expected error code %s, got: %s", apierror.ErrBadRequest, aerr.Code)
@@ -589,7 +611,7 @@ func TestGrantAccess(t *testing.T) {
 	expectedMessage = fmt.Sprintf("failed to get information about instance %s", instanceID)
 	s.EC2.(*mockEC2Client).err["DescribeInstancesWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -612,7 +634,7 @@ func TestGrantAccess(t *testing.T) {
 	expectedMessage = fmt.Sprintf("failed to get IAM role instanceRole_%s", instanceID)
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -636,7 +658,7 @@ func TestGrantAccess(t *testing.T) {
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "ErrCodeNoSuchEntityException", nil)
 	s.IAM.(*mockIAMClient).err["CreateRoleWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -660,7 +682,7 @@ func TestGrantAccess(t *testing.T) {
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "ErrCodeNoSuchEntityException", nil)
 	s.IAM.(*mockIAMClient).err["CreateInstanceProfileWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -684,7 +706,7 @@ func TestGrantAccess(t *testing.T) {
 	s.IAM.(*mockIAMClient).err["GetRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "ErrCodeNoSuchEntityException", nil)
 	s.IAM.(*mockIAMClient).err["AddRoleToInstanceProfileWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -704,10 +726,10 @@ func TestGrantAccess(t *testing.T) {
 	s = newTestS3Repository(t)
 	instanceID = "i-0123456789abcdef1"
 	expectedCode = apierror.ErrServiceUnavailable
-	expectedMessage = fmt.Sprintf("failed to attach policy arn:aws:iam::12345678901:policy/test/dataset-%s to role instanceRole_%s", id, instanceID)
+	expectedMessage = fmt.Sprintf("failed to attach policy arn:aws:iam::12345678901:policy/test/dataset-%s-rw to role instanceRole_%s", id, instanceID)
 	s.IAM.(*mockIAMClient).err["AttachRolePolicyWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -730,7 +752,7 @@ func TestGrantAccess(t *testing.T) {
 	expectedMessage = fmt.Sprintf("failed to get information about current instance profile theOtherRole")
 	s.IAM.(*mockIAMClient).err["GetInstanceProfileWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -753,7 +775,7 @@ func TestGrantAccess(t *testing.T) {
 	expectedMessage = fmt.Sprintf("failed to list attached policies for role theOtherRole")
 	s.IAM.(*mockIAMClient).err["ListAttachedRolePoliciesWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -773,10 +795,10 @@ func TestGrantAccess(t *testing.T) {
 	s = newTestS3Repository(t)
 	instanceID = "i-0123456789abcdef2"
 	expectedCode = apierror.ErrServiceUnavailable
-	expectedMessage = fmt.Sprintf("failed to attach policy arn:aws:iam::12345678901:policy/test/dataset-%s to role instanceRole_%s", id, instanceID)
+	expectedMessage = fmt.Sprintf("failed to attach policy arn:aws:iam::12345678901:policy/test/dataset-%s-rw to role instanceRole_%s", id, instanceID)
 	s.IAM.(*mockIAMClient).err["AttachRolePolicyWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -799,7 +821,7 @@ func TestGrantAccess(t *testing.T) {
 	expectedMessage = fmt.Sprintf("failed to describe instance profile associations for instance %s", instanceID)
 	s.EC2.(*mockEC2Client).err["DescribeIamInstanceProfileAssociationsWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.GrantAccess(context.TODO(), id, instanceID)
+	_, err = s.GrantAccess(context.TODO(), id, instanceID, dataset.PermissionWrite)
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -933,6 +955,81 @@ func TestListAccess(t *testing.T) {
 	}
 }
 
+func TestGrantPolicyArn(t *testing.T) {
+	s := newTestS3Repository(t)
+
+	tests := []struct {
+		bucket     string
+		permission string
+		expected   string
+	}{
+		{"dataset-test", dataset.PermissionRead, "arn:aws:iam::12345678901:policy/test/dataset-test-ro"},
+		{"dataset-test", dataset.PermissionWrite, "arn:aws:iam::12345678901:policy/test/dataset-test-rw"},
+		// legacy datasets use their single access policy for write grants, and get a read-only policy created
+		{"dataset-LEGACY-DATASET", dataset.PermissionRead, "arn:aws:iam::12345678901:policy/test/dataset-LEGACY-DATASET-ro"},
+		{"dataset-LEGACY-DATASET", dataset.PermissionWrite, "arn:aws:iam::12345678901:policy/test/dataset-LEGACY-DATASET"},
+	}
+
+	for _, tst := range tests {
+		got, err := s.grantPolicyArn(context.TODO(), tst.bucket, tst.permission)
+		if err != nil {
+			t.Errorf("expected nil error for %s %s, got: %s", tst.bucket, tst.permission, err)
+			continue
+		}
+
+		if got != tst.expected {
+			t.Errorf("expected policy arn %s, got %s", tst.expected, got)
+		}
+	}
+
+	// no access policies
+	s.IAM.(*mockIAMClient).err["GetPolicyWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "policy not found", nil)
+	_, err := s.grantPolicyArn(context.TODO(), "dataset-test", dataset.PermissionRead)
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+
+	// invalid permission
+	s = newTestS3Repository(t)
+	if _, err := s.GrantAccess(context.TODO(), "test", "i-0123456789abcdef0", "admin"); err == nil {
+		t.Error("expected error for invalid permission, got nil")
+	}
+}
+
+func TestListAccessPermissions(t *testing.T) {
+	s := newTestS3Repository(t)
+
+	// the instance has the read-write (and legacy) policy attached
+	expected := map[string]string{"i-0123456789abcdef3": dataset.PermissionWrite}
+	_, got, err := s.ListAccessPermissions(context.TODO(), "test")
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected permissions %+v, got %+v", expected, got)
+	}
+
+	// the instance only has the read-only policy attached
+	expected = map[string]string{"i-0123456789abcdef3": dataset.PermissionRead}
+	_, got, err = s.ListAccessPermissions(context.TODO(), "READ-ONLY-DATASET")
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected permissions %+v, got %+v", expected, got)
+	}
+
+	// missing access policies are skipped
+	s.IAM.(*mockIAMClient).err["ListEntitiesForPolicyWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "policy not found", nil)
+	access, got, err := s.ListAccessPermissions(context.TODO(), "test")
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+	if len(access) != 0 || len(got) != 0 {
+		t.Errorf("expected no access, got %+v %+v", access, got)
+	}
+}
+
 func TestRevokeAccess(t *testing.T) {
 	var expectedCode, expectedMessage, id, instanceID string
 	var s S3Repository
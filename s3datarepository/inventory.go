@@ -0,0 +1,369 @@
+package s3datarepository
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// inventoryConfigurationID is the id of the S3 Inventory configuration we manage for each data repository
+const inventoryConfigurationID = "dataset-inventory"
+
+// inventoryReportTimeFormat is the format of the date folder for each S3 Inventory report
+const inventoryReportTimeFormat = "2006-01-02T15-04Z"
+
+// defaultInventoryCacheTTL is how long a scanned inventory is cached if InventoryCacheTTL is not set
+const defaultInventoryCacheTTL = 15 * time.Minute
+
+// inventoryManifest is the manifest.json delivered with each S3 Inventory report
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	Files             []struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+// inventoryCache caches the inventory for data repositories by bucket name
+type inventoryCache struct {
+	sync.Mutex
+	entries map[string]inventoryCacheEntry
+}
+
+type inventoryCacheEntry struct {
+	inventory *dataset.Inventory
+	expires   time.Time
+}
+
+func newInventoryCache() *inventoryCache {
+	return &inventoryCache{entries: map[string]inventoryCacheEntry{}}
+}
+
+// get returns the cached inventory for the given bucket, if it hasn't expired
+func (c *inventoryCache) get(bucket string) (*dataset.Inventory, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[bucket]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(e.expires) {
+		delete(c.entries, bucket)
+		return nil, false
+	}
+
+	return e.inventory, true
+}
+
+// set caches the inventory for the given bucket for the ttl
+func (c *inventoryCache) set(bucket string, inventory *dataset.Inventory, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries[bucket] = inventoryCacheEntry{
+		inventory: inventory,
+		expires:   time.Now().Add(ttl),
+	}
+}
+
+// inventory returns the inventory of a bucket.  If an S3 Inventory bucket is configured the latest inventory report
+// is used, otherwise (or if there's no report yet) the bucket is scanned.  Results are cached for InventoryCacheTTL.
+func (s *S3Repository) inventory(ctx context.Context, bucket string) (*dataset.Inventory, error) {
+	if bucket == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty bucket"))
+	}
+
+	if inventory, ok := s.inventoryCache.get(bucket); ok {
+		log.WithContext(ctx).Debugf("using cached inventory for bucket %s", bucket)
+		return inventory, nil
+	}
+
+	ttl := s.InventoryCacheTTL
+	if ttl == 0 {
+		ttl = defaultInventoryCacheTTL
+	}
+
+	if s.InventoryBucket != "" {
+		inventory, err := s.inventoryFromReport(ctx, bucket)
+		if err != nil {
+			log.WithContext(ctx).Warnf("failed to get inventory report for bucket %s, falling back to scan: %s", bucket, err)
+		} else if inventory != nil {
+			s.inventoryCache.set(bucket, inventory, ttl)
+			return inventory, nil
+		}
+	}
+
+	inventory, err := s.inventoryFromScan(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	s.inventoryCache.set(bucket, inventory, ttl)
+
+	return inventory, nil
+}
+
+// inventoryFromScan lists all of the objects in a bucket and summarizes them
+func (s *S3Repository) inventoryFromScan(ctx context.Context, bucket string) (*dataset.Inventory, error) {
+	log.WithContext(ctx).Infof("scanning bucket %s for inventory", bucket)
+
+	inventory := dataset.NewInventory("scan", time.Now().UTC().Truncate(time.Second))
+
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+
+	truncated := true
+	for truncated {
+		output, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list objects in s3 bucket "+bucket, err)
+		}
+
+		for _, object := range output.Contents {
+			inventory.Add(aws.StringValue(object.Key), aws.StringValue(object.StorageClass), aws.Int64Value(object.Size), aws.TimeValue(object.LastModified))
+		}
+
+		truncated = aws.BoolValue(output.IsTruncated)
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	log.WithContext(ctx).Debugf("scanned %d objects (%d bytes) in bucket %s", inventory.ObjectCount, inventory.TotalBytes, bucket)
+
+	return inventory, nil
+}
+
+// inventoryReportPrefix returns the prefix in the InventoryBucket under which reports for the bucket are delivered
+func (s *S3Repository) inventoryReportPrefix(bucket string) string {
+	prefix := strings.TrimSuffix(s.InventoryPrefix, "/")
+	if prefix != "" {
+		prefix = prefix + "/"
+	}
+	return prefix + bucket + "/" + inventoryConfigurationID + "/"
+}
+
+// inventoryFromReport summarizes the latest S3 Inventory report for a bucket.  It returns nil if there are no reports.
+func (s *S3Repository) inventoryFromReport(ctx context.Context, bucket string) (*dataset.Inventory, error) {
+	prefix := s.inventoryReportPrefix(bucket)
+
+	log.WithContext(ctx).Debugf("looking for inventory reports for bucket %s in s3://%s/%s", bucket, s.InventoryBucket, prefix)
+
+	reports := []string{}
+	input := s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.InventoryBucket),
+		Delimiter: aws.String("/"),
+		Prefix:    aws.String(prefix),
+	}
+
+	truncated := true
+	for truncated {
+		output, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list inventory reports for bucket "+bucket, err)
+		}
+
+		for _, p := range output.CommonPrefixes {
+			report := strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(p.Prefix), prefix), "/")
+			if _, err := time.Parse(inventoryReportTimeFormat, report); err == nil {
+				reports = append(reports, report)
+			}
+		}
+
+		truncated = aws.BoolValue(output.IsTruncated)
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	if len(reports) == 0 {
+		log.WithContext(ctx).Infof("no inventory reports found for bucket %s", bucket)
+		return nil, nil
+	}
+
+	// the report folders are timestamps, so the last one is the latest
+	sort.Strings(reports)
+	manifestKey := prefix + reports[len(reports)-1] + "/manifest.json"
+
+	log.WithContext(ctx).Debugf("reading inventory manifest s3://%s/%s", s.InventoryBucket, manifestKey)
+
+	manifestOut, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.InventoryBucket),
+		Key:    aws.String(manifestKey),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get inventory manifest "+manifestKey, err)
+	}
+	defer manifestOut.Body.Close()
+
+	manifest := inventoryManifest{}
+	if err = json.NewDecoder(manifestOut.Body).Decode(&manifest); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to decode inventory manifest "+manifestKey, err)
+	}
+
+	if manifest.FileFormat != "CSV" {
+		msg := fmt.Sprintf("unsupported inventory report format %s", manifest.FileFormat)
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	columns := map[string]int{}
+	for i, c := range strings.Split(manifest.FileSchema, ",") {
+		columns[strings.TrimSpace(c)] = i
+	}
+
+	for _, c := range []string{"Key", "Size"} {
+		if _, ok := columns[c]; !ok {
+			msg := fmt.Sprintf("inventory report for bucket %s is missing required field %s", bucket, c)
+			return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+		}
+	}
+
+	generatedAt := time.Now().UTC().Truncate(time.Second)
+	if ms, err := strconv.ParseInt(manifest.CreationTimestamp, 10, 64); err == nil {
+		generatedAt = time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	}
+
+	inventory := dataset.NewInventory("inventory", generatedAt)
+	for _, f := range manifest.Files {
+		if err := s.readInventoryFile(ctx, f.Key, columns, inventory); err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithContext(ctx).Debugf("read %d objects (%d bytes) from inventory report for bucket %s", inventory.ObjectCount, inventory.TotalBytes, bucket)
+
+	return inventory, nil
+}
+
+// readInventoryFile reads a gzipped CSV S3 Inventory file and adds its objects to the inventory
+func (s *S3Repository) readInventoryFile(ctx context.Context, key string, columns map[string]int, inventory *dataset.Inventory) error {
+	log.WithContext(ctx).Debugf("reading inventory file s3://%s/%s", s.InventoryBucket, key)
+
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.InventoryBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ErrCode("failed to get inventory file "+key, err)
+	}
+	defer out.Body.Close()
+
+	gz, err := gzip.NewReader(out.Body)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to decompress inventory file "+key, err)
+	}
+	defer gz.Close()
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	r := csv.NewReader(gz)
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return apierror.New(apierror.ErrInternalError, "failed to read inventory file "+key, err)
+		}
+
+		// object keys in inventory reports are url encoded
+		objectKey, err := url.QueryUnescape(field(record, "Key"))
+		if err != nil {
+			objectKey = field(record, "Key")
+		}
+
+		// delete markers don't have a size
+		sizeStr := field(record, "Size")
+		if sizeStr == "" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			log.WithContext(ctx).Warnf("invalid size '%s' for object %s in inventory file %s", sizeStr, objectKey, key)
+			continue
+		}
+
+		var modified time.Time
+		if m := field(record, "LastModifiedDate"); m != "" {
+			if t, err := time.Parse(time.RFC3339, m); err == nil {
+				modified = t
+			}
+		}
+
+		inventory.Add(objectKey, field(record, "StorageClass"), size, modified)
+	}
+
+	return nil
+}
+
+// putInventoryConfiguration configures a daily S3 Inventory report for the bucket, delivered to the InventoryBucket
+func (s *S3Repository) putInventoryConfiguration(ctx context.Context, bucket string) error {
+	log.WithContext(ctx).Debugf("configuring inventory reports for bucket %s to %s", bucket, s.InventoryBucket)
+
+	destination := &s3.InventoryS3BucketDestination{
+		Bucket: aws.String("arn:aws:s3:::" + s.InventoryBucket),
+		Format: aws.String(s3.InventoryFormatCsv),
+	}
+
+	if prefix := strings.TrimSuffix(s.InventoryPrefix, "/"); prefix != "" {
+		destination.Prefix = aws.String(prefix)
+	}
+
+	if _, err := s.S3.PutBucketInventoryConfigurationWithContext(ctx, &s3.PutBucketInventoryConfigurationInput{
+		Bucket: aws.String(bucket),
+		Id:     aws.String(inventoryConfigurationID),
+		InventoryConfiguration: &s3.InventoryConfiguration{
+			Destination: &s3.InventoryDestination{
+				S3BucketDestination: destination,
+			},
+			Id:                     aws.String(inventoryConfigurationID),
+			IncludedObjectVersions: aws.String(s3.InventoryIncludedObjectVersionsCurrent),
+			IsEnabled:              aws.Bool(true),
+			OptionalFields: aws.StringSlice([]string{
+				s3.InventoryOptionalFieldSize,
+				s3.InventoryOptionalFieldLastModifiedDate,
+				s3.InventoryOptionalFieldStorageClass,
+			}),
+			Schedule: &s3.InventorySchedule{
+				Frequency: aws.String(s3.InventoryFrequencyDaily),
+			},
+		},
+	}); err != nil {
+		return ErrCode("failed to configure inventory for s3 bucket "+bucket, err)
+	}
+
+	return nil
+}
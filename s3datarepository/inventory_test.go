@@ -0,0 +1,200 @@
+package s3datarepository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var testInventoryManifest = []byte(`{
+	"sourceBucket": "testBucketInventory",
+	"destinationBucket": "arn:aws:s3:::ds-test-inventory",
+	"version": "2016-11-30",
+	"creationTimestamp": "1580688000000",
+	"fileFormat": "CSV",
+	"fileSchema": "Bucket, Key, Size, LastModifiedDate, StorageClass",
+	"files": [
+		{
+			"key": "inventory/testBucketInventory/dataset-inventory/data/1.csv.gz",
+			"size": 100,
+			"MD5checksum": "d41d8cd98f00b204e9800998ecf8427e"
+		}
+	]
+}`)
+
+var testInventoryFile = `"testBucketInventory","raw/data1.csv","100","2020-01-01T01:00:00.000Z","STANDARD"
+"testBucketInventory","raw/some%20data2.csv","200","2020-02-02T02:00:00.000Z","GLACIER"
+"testBucketInventory","readme.txt","10","2020-01-01T01:00:00.000Z","STANDARD"
+"testBucketInventory","deleted.txt","","",""
+`
+
+func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err, ok := m.err["GetObjectWithContext"]; ok {
+		return nil, err
+	}
+
+	key := aws.StringValue(input.Key)
+	if b, ok := m.objects[aws.StringValue(input.Bucket)+"/"+key]; ok {
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+	}
+
+	switch {
+	case strings.HasSuffix(key, "2020-02-03T00-00Z/manifest.json"):
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(testInventoryManifest))}, nil
+	case strings.HasSuffix(key, ".csv.gz"):
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		gz.Write([]byte(testInventoryFile))
+		gz.Close()
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(&b)}, nil
+	}
+
+	return nil, awserr.New(s3.ErrCodeNoSuchKey, key+" not found", nil)
+}
+
+func (m *mockS3Client) PutBucketInventoryConfigurationWithContext(ctx aws.Context, input *s3.PutBucketInventoryConfigurationInput, opts ...request.Option) (*s3.PutBucketInventoryConfigurationOutput, error) {
+	if err, ok := m.err["PutBucketInventoryConfigurationWithContext"]; ok {
+		return nil, err
+	}
+	return &s3.PutBucketInventoryConfigurationOutput{}, nil
+}
+
+func TestInventoryFromScan(t *testing.T) {
+	s := S3Repository{S3: newMockS3Client(t), inventoryCache: newInventoryCache()}
+
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T01:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-02-02T02:00:00Z")
+
+	got, err := s.inventory(context.TODO(), "testBucketInventory")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := &dataset.Inventory{
+		ObjectCount: 3,
+		TotalBytes:  310,
+		StorageClasses: map[string]*dataset.InventoryUsage{
+			"STANDARD": &dataset.InventoryUsage{ObjectCount: 2, TotalBytes: 110},
+			"GLACIER":  &dataset.InventoryUsage{ObjectCount: 1, TotalBytes: 200},
+		},
+		Prefixes: map[string]*dataset.InventoryUsage{
+			"raw/": &dataset.InventoryUsage{ObjectCount: 2, TotalBytes: 300},
+			"/":    &dataset.InventoryUsage{ObjectCount: 1, TotalBytes: 10},
+		},
+		LastWrite:   &time2,
+		Source:      "scan",
+		GeneratedAt: got.GeneratedAt,
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+
+	if !got.LastWrite.Equal(time2) || got.LastWrite.Equal(time1) {
+		t.Errorf("expected last write %s, got %s", time2, got.LastWrite)
+	}
+
+	// test cached result is returned, even if listing fails
+	s.S3.(*mockS3Client).err["ListObjectsV2WithContext"] = awserr.New("InternalError", "boom", nil)
+	cached, err := s.inventory(context.TODO(), "testBucketInventory")
+	if err != nil {
+		t.Errorf("expected nil error for cached inventory, got: %s", err)
+	}
+	if cached != got {
+		t.Error("expected cached inventory to be returned")
+	}
+
+	// test list failure without cache
+	s = S3Repository{S3: newMockS3Client(t)}
+	s.S3.(*mockS3Client).err["ListObjectsV2WithContext"] = awserr.New("InternalError", "boom", nil)
+	if _, err := s.inventory(context.TODO(), "testBucketInventory"); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	// test empty bucket name
+	if _, err := s.inventory(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty bucket, got nil")
+	}
+}
+
+func TestInventoryFromReport(t *testing.T) {
+	s := S3Repository{
+		S3:              newMockS3Client(t),
+		InventoryBucket: "ds-test-inventory",
+		InventoryPrefix: "inventory/",
+		inventoryCache:  newInventoryCache(),
+	}
+
+	time2, _ := time.Parse(time.RFC3339, "2020-02-02T02:00:00Z")
+
+	got, err := s.inventory(context.TODO(), "testBucketInventory")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := &dataset.Inventory{
+		ObjectCount: 3,
+		TotalBytes:  310,
+		StorageClasses: map[string]*dataset.InventoryUsage{
+			"STANDARD": &dataset.InventoryUsage{ObjectCount: 2, TotalBytes: 110},
+			"GLACIER":  &dataset.InventoryUsage{ObjectCount: 1, TotalBytes: 200},
+		},
+		Prefixes: map[string]*dataset.InventoryUsage{
+			"raw/": &dataset.InventoryUsage{ObjectCount: 2, TotalBytes: 300},
+			"/":    &dataset.InventoryUsage{ObjectCount: 1, TotalBytes: 10},
+		},
+		LastWrite:   &time2,
+		Source:      "inventory",
+		GeneratedAt: time.Unix(1580688000, 0).UTC(),
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+
+	// test fallback to scan when there are no reports
+	got, err = s.inventory(context.TODO(), "testBucketNoReports")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if got.Source != "scan" {
+		t.Errorf("expected inventory source scan, got %s", got.Source)
+	}
+
+	// test fallback to scan when the manifest can't be read
+	s = S3Repository{S3: newMockS3Client(t), InventoryBucket: "ds-test-inventory"}
+	s.S3.(*mockS3Client).err["GetObjectWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	got, err = s.inventory(context.TODO(), "testBucketInventory")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if got.Source != "scan" {
+		t.Errorf("expected inventory source scan, got %s", got.Source)
+	}
+}
+
+func TestInventoryReportPrefix(t *testing.T) {
+	tests := map[string]string{
+		"":           "testbucket/dataset-inventory/",
+		"inventory":  "inventory/testbucket/dataset-inventory/",
+		"inventory/": "inventory/testbucket/dataset-inventory/",
+	}
+
+	for prefix, expected := range tests {
+		s := S3Repository{InventoryPrefix: prefix}
+		if got := s.inventoryReportPrefix("testbucket"); got != expected {
+			t.Errorf("expected report prefix %s for '%s', got %s", expected, prefix, got)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package s3datarepository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultKMSKeyDeletionDays is the waiting period before a deleted dataset key is deleted
+const defaultKMSKeyDeletionDays = 30
+
+// errEncryptionNotFound is the error code of buckets without a default encryption configuration
+const errEncryptionNotFound = "ServerSideEncryptionConfigurationNotFoundError"
+
+// kmsEnabled returns true if new data repositories are encrypted with a customer managed KMS key by default
+func (s *S3Repository) kmsEnabled() bool {
+	return s.EncryptionMode == s3.ServerSideEncryptionAwsKms
+}
+
+// kmsKeyAlias returns the alias of the per-dataset key for a bucket
+func kmsKeyAlias(bucket string) string {
+	return "alias/" + bucket
+}
+
+// kmsKeyArn returns the ARN of the KMS key that encrypts the bucket, or an empty string if the
+// bucket isn't encrypted with a customer managed key.  The encryption is chosen per data repository
+// when it's provisioned, so it's read from the default encryption of the bucket.
+func (s *S3Repository) kmsKeyArn(ctx context.Context, bucket string) (string, error) {
+	out, err := s.S3.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errEncryptionNotFound {
+			return "", nil
+		}
+		return "", ErrCode("failed to get encryption of bucket "+bucket, err)
+	}
+
+	if out.ServerSideEncryptionConfiguration == nil {
+		return "", nil
+	}
+
+	for _, r := range out.ServerSideEncryptionConfiguration.Rules {
+		if d := r.ApplyServerSideEncryptionByDefault; d != nil && aws.StringValue(d.SSEAlgorithm) == s3.ServerSideEncryptionAwsKms {
+			return aws.StringValue(d.KMSMasterKeyID), nil
+		}
+	}
+
+	return "", nil
+}
+
+// createKMSKey creates a customer managed key (with an alias named after the bucket) for a new data repository,
+// unless an account key is configured.  Returns the key ARN and a slice of functions to perform rollback of its actions.
+func (s *S3Repository) createKMSKey(ctx context.Context, bucket string, datasetTags []*dataset.Tag) (string, []func() error, error) {
+	if s.KMSKeyArn != "" {
+		return s.KMSKeyArn, nil, nil
+	}
+
+	var rollBackTasks []func() error
+
+	tags := make([]*kms.Tag, len(datasetTags))
+	for i, tag := range datasetTags {
+		tags[i] = &kms.Tag{
+			TagKey:   tag.Key,
+			TagValue: tag.Value,
+		}
+	}
+
+	log.WithContext(ctx).Debugf("creating kms key for bucket: %s", bucket)
+	out, err := s.KMS.CreateKeyWithContext(ctx, &kms.CreateKeyInput{
+		Description: aws.String(fmt.Sprintf("Encryption key for dataset bucket %s", bucket)),
+		KeySpec:     aws.String(kms.KeySpecSymmetricDefault),
+		KeyUsage:    aws.String(kms.KeyUsageTypeEncryptDecrypt),
+		Tags:        tags,
+	})
+	if err != nil {
+		return "", rollBackTasks, ErrCode("failed to create kms key for bucket "+bucket, err)
+	}
+
+	keyID := aws.StringValue(out.KeyMetadata.KeyId)
+	keyArn := aws.StringValue(out.KeyMetadata.Arn)
+
+	// append key deletion to rollback tasks
+	rollBackTasks = append(rollBackTasks, func() error {
+		log.WithContext(ctx).Debugf("scheduling deletion of kms key: %s", keyID)
+		_, err := s.KMS.ScheduleKeyDeletionWithContext(ctx, &kms.ScheduleKeyDeletionInput{
+			KeyId:               aws.String(keyID),
+			PendingWindowInDays: aws.Int64(s.kmsKeyDeletionDays()),
+		})
+		return err
+	})
+
+	if _, err = s.KMS.CreateAliasWithContext(ctx, &kms.CreateAliasInput{
+		AliasName:   aws.String(kmsKeyAlias(bucket)),
+		TargetKeyId: aws.String(keyID),
+	}); err != nil {
+		return "", rollBackTasks, ErrCode("failed to create kms key alias for bucket "+bucket, err)
+	}
+
+	// append alias deletion to rollback tasks
+	rollBackTasks = append(rollBackTasks, func() error {
+		log.WithContext(ctx).Debugf("deleting kms key alias: %s", kmsKeyAlias(bucket))
+		_, err := s.KMS.DeleteAliasWithContext(ctx, &kms.DeleteAliasInput{
+			AliasName: aws.String(kmsKeyAlias(bucket)),
+		})
+		return err
+	})
+
+	log.WithContext(ctx).Infof("created kms key %s for bucket %s", keyArn, bucket)
+
+	return keyArn, rollBackTasks, nil
+}
+
+// deleteKMSKey schedules the deletion of the per-dataset key of a bucket and deletes its alias
+func (s *S3Repository) deleteKMSKey(ctx context.Context, bucket string) error {
+	out, err := s.KMS.DescribeKeyWithContext(ctx, &kms.DescribeKeyInput{
+		KeyId: aws.String(kmsKeyAlias(bucket)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kms.ErrCodeNotFoundException {
+			log.WithContext(ctx).Warnf("kms key for bucket %s not found, not scheduling deletion", bucket)
+			return nil
+		}
+		return ErrCode("failed to describe kms key for bucket "+bucket, err)
+	}
+	keyArn := aws.StringValue(out.KeyMetadata.Arn)
+
+	log.WithContext(ctx).Infof("scheduling deletion of kms key %s for bucket %s in %d days", keyArn, bucket, s.kmsKeyDeletionDays())
+
+	if _, err = s.KMS.ScheduleKeyDeletionWithContext(ctx, &kms.ScheduleKeyDeletionInput{
+		KeyId:               aws.String(keyArn),
+		PendingWindowInDays: aws.Int64(s.kmsKeyDeletionDays()),
+	}); err != nil {
+		return ErrCode("failed to schedule deletion of kms key for bucket "+bucket, err)
+	}
+
+	if _, err = s.KMS.DeleteAliasWithContext(ctx, &kms.DeleteAliasInput{
+		AliasName: aws.String(kmsKeyAlias(bucket)),
+	}); err != nil {
+		return ErrCode("failed to delete kms key alias for bucket "+bucket, err)
+	}
+
+	return nil
+}
+
+func (s *S3Repository) kmsKeyDeletionDays() int64 {
+	if s.KMSKeyDeletionDays > 0 {
+		return s.KMSKeyDeletionDays
+	}
+	return defaultKMSKeyDeletionDays
+}
+
+// kmsPolicyStatement returns the policy statement that allows using the key of a bucket, with write access
+// also allowing new data keys to be generated
+func kmsPolicyStatement(keyArn string, write bool) PolicyStatement {
+	actions := []string{"kms:Decrypt"}
+	if write {
+		actions = append(actions, "kms:GenerateDataKey")
+	}
+
+	return PolicyStatement{
+		Resource: []string{keyArn},
+		Effect:   "Allow",
+		Action:   actions,
+	}
+}
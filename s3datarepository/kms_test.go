@@ -0,0 +1,273 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// mockKMSClient is a fake KMS client
+type mockKMSClient struct {
+	kmsiface.KMSAPI
+	t         *testing.T
+	err       map[string]error
+	aliases   map[string]string
+	scheduled map[string]int64
+}
+
+func newMockKMSClient(t *testing.T) kmsiface.KMSAPI {
+	return &mockKMSClient{
+		t:         t,
+		err:       make(map[string]error),
+		aliases:   make(map[string]string),
+		scheduled: make(map[string]int64),
+	}
+}
+
+func (m *mockKMSClient) CreateKeyWithContext(ctx aws.Context, input *kms.CreateKeyInput, opts ...request.Option) (*kms.CreateKeyOutput, error) {
+	if err, ok := m.err["CreateKeyWithContext"]; ok {
+		return nil, err
+	}
+
+	return &kms.CreateKeyOutput{
+		KeyMetadata: &kms.KeyMetadata{
+			KeyId: aws.String("key-123"),
+			Arn:   aws.String("arn:aws:kms:us-east-1:123456789012:key/key-123"),
+		},
+	}, nil
+}
+
+func (m *mockKMSClient) CreateAliasWithContext(ctx aws.Context, input *kms.CreateAliasInput, opts ...request.Option) (*kms.CreateAliasOutput, error) {
+	if err, ok := m.err["CreateAliasWithContext"]; ok {
+		return nil, err
+	}
+
+	m.aliases[aws.StringValue(input.AliasName)] = "arn:aws:kms:us-east-1:123456789012:key/" + aws.StringValue(input.TargetKeyId)
+	return &kms.CreateAliasOutput{}, nil
+}
+
+func (m *mockKMSClient) DeleteAliasWithContext(ctx aws.Context, input *kms.DeleteAliasInput, opts ...request.Option) (*kms.DeleteAliasOutput, error) {
+	if err, ok := m.err["DeleteAliasWithContext"]; ok {
+		return nil, err
+	}
+
+	delete(m.aliases, aws.StringValue(input.AliasName))
+	return &kms.DeleteAliasOutput{}, nil
+}
+
+func (m *mockKMSClient) DescribeKeyWithContext(ctx aws.Context, input *kms.DescribeKeyInput, opts ...request.Option) (*kms.DescribeKeyOutput, error) {
+	if err, ok := m.err["DescribeKeyWithContext"]; ok {
+		return nil, err
+	}
+
+	arn, ok := m.aliases[aws.StringValue(input.KeyId)]
+	if !ok {
+		return nil, awserr.New(kms.ErrCodeNotFoundException, "key not found", nil)
+	}
+
+	return &kms.DescribeKeyOutput{KeyMetadata: &kms.KeyMetadata{Arn: aws.String(arn)}}, nil
+}
+
+func (m *mockKMSClient) ScheduleKeyDeletionWithContext(ctx aws.Context, input *kms.ScheduleKeyDeletionInput, opts ...request.Option) (*kms.ScheduleKeyDeletionOutput, error) {
+	if err, ok := m.err["ScheduleKeyDeletionWithContext"]; ok {
+		return nil, err
+	}
+
+	m.scheduled[aws.StringValue(input.KeyId)] = aws.Int64Value(input.PendingWindowInDays)
+	return &kms.ScheduleKeyDeletionOutput{}, nil
+}
+
+func TestProvisionKMS(t *testing.T) {
+	id := "68004EEC-6044-45C9-91E5-AF836DCD9234"
+	tags := []*dataset.Tag{{Key: aws.String("ID"), Value: aws.String(id)}}
+
+	// test per-dataset key
+	kmsClient := newMockKMSClient(t).(*mockKMSClient)
+	s := S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t), IAM: newMockIAMClient(t), STS: newMockSTSClient(t), KMS: kmsClient}
+	WithKMSEncryption("", 7)(&s)
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+
+	if _, err := s.Provision(context.TODO(), id, tags, ""); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if s.Encryption() != s3.ServerSideEncryptionAwsKms {
+		t.Errorf("expected encryption %s, got %s", s3.ServerSideEncryptionAwsKms, s.Encryption())
+	}
+
+	keyArn, err := s.kmsKeyArn(context.TODO(), "dataset-"+id)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if keyArn != "arn:aws:kms:us-east-1:123456789012:key/key-123" {
+		t.Errorf("expected key arn for per-dataset key, got %s", keyArn)
+	}
+
+	// test key deletion is scheduled on delete
+	if err := s.Delete(context.TODO(), id); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if days, ok := kmsClient.scheduled[keyArn]; !ok || days != 7 {
+		t.Errorf("expected key deletion scheduled in 7 days, got %v", kmsClient.scheduled)
+	}
+
+	if _, ok := kmsClient.aliases["alias/dataset-"+id]; ok {
+		t.Error("expected key alias to be deleted")
+	}
+
+	// test rollback when setting bucket encryption fails
+	kmsClient = newMockKMSClient(t).(*mockKMSClient)
+	s = S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t), IAM: newMockIAMClient(t), STS: newMockSTSClient(t), KMS: kmsClient}
+	WithKMSEncryption("", 0)(&s)
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+	s.S3.(*mockS3Client).err["PutBucketEncryptionWithContext"] = awserr.New("InternalError", "Internal Error", nil)
+
+	if _, err := s.Provision(context.TODO(), id, tags, ""); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if days, ok := kmsClient.scheduled["key-123"]; !ok || days != defaultKMSKeyDeletionDays {
+		t.Errorf("expected key deletion to be scheduled on rollback, got %v", kmsClient.scheduled)
+	}
+
+	// test account key
+	kmsClient = newMockKMSClient(t).(*mockKMSClient)
+	kmsClient.err["CreateKeyWithContext"] = awserr.New("InternalError", "should not create keys", nil)
+	s = S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t), IAM: newMockIAMClient(t), STS: newMockSTSClient(t), KMS: kmsClient}
+	WithKMSEncryption("arn:aws:kms:us-east-1:123456789012:key/account", 0)(&s)
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+
+	if _, err := s.Provision(context.TODO(), id, tags, ""); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if err := s.Delete(context.TODO(), id); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(kmsClient.scheduled) != 0 {
+		t.Errorf("expected account key not to be scheduled for deletion, got %v", kmsClient.scheduled)
+	}
+
+	// test kms encryption requested for a dataset when the default is AES256
+	kmsClient = newMockKMSClient(t).(*mockKMSClient)
+	s = S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t), IAM: newMockIAMClient(t), STS: newMockSTSClient(t), KMS: kmsClient}
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+
+	if _, err := s.Provision(context.TODO(), "default", tags, ""); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if keyArn, err := s.kmsKeyArn(context.TODO(), "dataset-default"); err != nil || keyArn != "" {
+		t.Errorf("expected no key for default encryption, got '%s' (%v)", keyArn, err)
+	}
+
+	if _, err := s.Provision(context.TODO(), id, tags, s3.ServerSideEncryptionAwsKms); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if keyArn, err := s.kmsKeyArn(context.TODO(), "dataset-"+id); err != nil || keyArn != "arn:aws:kms:us-east-1:123456789012:key/key-123" {
+		t.Errorf("expected per-dataset key for requested kms encryption, got '%s' (%v)", keyArn, err)
+	}
+
+	if err := s.Delete(context.TODO(), "default"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if err := s.Delete(context.TODO(), id); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(kmsClient.scheduled) != 1 {
+		t.Errorf("expected only the per-dataset key to be scheduled for deletion, got %v", kmsClient.scheduled)
+	}
+
+	if _, err := s.Provision(context.TODO(), id, tags, "rot13"); err == nil {
+		t.Error("expected error for invalid encryption, got nil")
+	}
+}
+
+func TestAccessPolicyKMS(t *testing.T) {
+	s := S3Repository{}
+	keyArn := "arn:aws:kms:us-east-1:123456789012:key/key-123"
+
+	type test struct {
+		policy   func(string, string) ([]byte, error)
+		expected []string
+	}
+
+	tests := []test{
+		{s.originalAccessPolicy, []string{"kms:Decrypt"}},
+		{s.derivativeAccessPolicy, []string{"kms:Decrypt", "kms:GenerateDataKey"}},
+		{s.temporaryAccessPolicy, []string{"kms:Decrypt", "kms:GenerateDataKey"}},
+	}
+
+	for _, tst := range tests {
+		j, err := tst.policy("dataset-abc", keyArn)
+		if err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+
+		doc := PolicyDoc{}
+		if err := json.Unmarshal(j, &doc); err != nil {
+			t.Fatal(err)
+		}
+
+		last := doc.Statement[len(doc.Statement)-1]
+		if !reflect.DeepEqual(last.Resource, []string{keyArn}) || !reflect.DeepEqual(last.Action, tst.expected) {
+			t.Errorf("expected kms statement with actions %v, got %+v", tst.expected, last)
+		}
+
+		// no kms statement without a key
+		j, _ = tst.policy("dataset-abc", "")
+		doc = PolicyDoc{}
+		json.Unmarshal(j, &doc)
+		for _, st := range doc.Statement {
+			if st.Action[0] == "kms:Decrypt" {
+				t.Errorf("expected no kms statement without key, got %+v", st)
+			}
+		}
+	}
+}
+
+func TestNewDefaultRepositoryEncryption(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"encryption": "rot13"},
+		{"encryption": "aws:kms", "kmsKeyDeletionDays": float64(90)},
+		{"kmsKeyDeletionDays": float64(3)},
+	} {
+		if _, err := NewDefaultRepository(config); err == nil {
+			t.Errorf("expected error for config %v, got nil", config)
+		}
+	}
+
+	s, err := NewDefaultRepository(map[string]interface{}{"encryption": "aws:kms", "region": "us-east-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if s.Encryption() != s3.ServerSideEncryptionAwsKms {
+		t.Errorf("expected encryption %s, got %s", s3.ServerSideEncryptionAwsKms, s.Encryption())
+	}
+
+	// the account key is also used for datasets that require kms when the default is AES256
+	s, err = NewDefaultRepository(map[string]interface{}{"kmsKeyArn": "arn:aws:kms:us-east-1:123456789012:key/account", "region": "us-east-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if s.Encryption() != s3.ServerSideEncryptionAes256 || s.KMSKeyArn != "arn:aws:kms:us-east-1:123456789012:key/account" {
+		t.Errorf("expected default encryption %s with account key, got %s and '%s'", s3.ServerSideEncryptionAes256, s.Encryption(), s.KMSKeyArn)
+	}
+}
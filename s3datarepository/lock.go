@@ -0,0 +1,358 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// finalizedPolicySid is the id of the bucket policy statement that protects finalized data repositories
+const finalizedPolicySid = "DatasetFinalizedDenyWrites"
+
+// finalizedManifestPolicySid is the id of the bucket policy statement that protects the content manifest
+// of finalized data repositories, the API is exempt so it can record the manifest after locking
+const finalizedManifestPolicySid = "DatasetFinalizedDenyManifestWrites"
+
+// finalizedActions are the actions denied on finalized data repositories
+var finalizedActions = []string{
+	"s3:BypassGovernanceRetention",
+	"s3:DeleteObject",
+	"s3:DeleteObjectVersion",
+	"s3:PutObject",
+	"s3:PutObjectLegalHold",
+	"s3:PutObjectRetention",
+}
+
+// defaultObjectLockRetentionDays is the governance retention period if ObjectLockRetentionDays is not set
+const defaultObjectLockRetentionDays = 365
+
+// Lock write protects a finalized data repository.  If S3 Object Lock was enabled when the repository was
+// provisioned, governance mode retention is applied to all existing objects (except attachments) and set as
+// the default for new objects.  A bucket policy is then applied that denies writes and deletes to everyone
+// except the BreakGlassRoleArn (if configured).  Attachments can still be managed, and the API itself can
+// still write the content manifest, so it can be recorded once nobody else can change the data.
+func (s *S3Repository) Lock(ctx context.Context, id string) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("locking s3datarepository: %s", name)
+
+	// retention needs to be applied before the bucket policy, since it denies s3:PutObjectRetention
+	enabled, err := s.objectLockEnabled(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		if err = s.applyRetention(ctx, name); err != nil {
+			return err
+		}
+	} else {
+		log.WithContext(ctx).Debugf("object lock is not enabled for bucket %s, not applying retention", name)
+	}
+
+	exempt, err := s.exemptPrincipals(ctx)
+	if err != nil {
+		return err
+	}
+
+	statement := PolicyStatement{
+		Sid:       finalizedPolicySid,
+		Effect:    "Deny",
+		Principal: map[string][]string{"AWS": {"*"}},
+		Action:    finalizedActions,
+		NotResource: []string{
+			fmt.Sprintf("arn:aws:s3:::%s/%s*", name, attachmentsPrefix),
+			fmt.Sprintf("arn:aws:s3:::%s/%s*", name, manifestPrefix),
+		},
+	}
+
+	if s.BreakGlassRoleArn != "" {
+		statement.Condition = map[string]map[string][]string{
+			"ArnNotLike": {
+				"aws:PrincipalArn": {s.BreakGlassRoleArn},
+			},
+		}
+	} else {
+		log.WithContext(ctx).Warnf("no break-glass role configured, denying writes to everyone for bucket %s", name)
+	}
+
+	manifestStatement := PolicyStatement{
+		Sid:       finalizedManifestPolicySid,
+		Effect:    "Deny",
+		Principal: map[string][]string{"AWS": {"*"}},
+		Action:    finalizedActions,
+		Resource:  []string{fmt.Sprintf("arn:aws:s3:::%s/%s*", name, manifestPrefix)},
+		Condition: map[string]map[string][]string{
+			"ArnNotLike": {
+				"aws:PrincipalArn": exempt,
+			},
+		},
+	}
+
+	if err = s.mergeBucketPolicy(ctx, name, []PolicyStatement{statement, manifestStatement}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unlock removes the write protection applied by Lock, ie. when finalizing a dataset fails after it was locked.
+// The bucket policy statements are removed and the default retention is cleared, retention that was already
+// applied to existing objects is left to expire.
+func (s *S3Repository) Unlock(ctx context.Context, id string) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("unlocking s3datarepository: %s", name)
+
+	if err := s.mergeBucketPolicy(ctx, name, nil, finalizedPolicySid, finalizedManifestPolicySid); err != nil {
+		return err
+	}
+
+	enabled, err := s.objectLockEnabled(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	log.WithContext(ctx).Debugf("clearing default retention for bucket %s", name)
+
+	if _, err := s.S3.PutObjectLockConfigurationWithContext(ctx, &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(name),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+		},
+	}); err != nil {
+		return ErrCode("failed to clear object lock configuration for s3 bucket "+name, err)
+	}
+
+	return nil
+}
+
+// Retention returns how long the data of a finalized data repository is retained, starting when it's locked.  It's
+// zero if S3 Object Lock isn't enabled for the bucket.
+func (s *S3Repository) Retention(ctx context.Context, id string) (time.Duration, error) {
+	if id == "" {
+		return 0, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	enabled, err := s.objectLockEnabled(ctx, name)
+	if err != nil || !enabled {
+		return 0, err
+	}
+
+	days := s.ObjectLockRetentionDays
+	if days <= 0 {
+		days = defaultObjectLockRetentionDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// objectLockEnabled returns true if S3 Object Lock is enabled for the bucket
+func (s *S3Repository) objectLockEnabled(ctx context.Context, bucket string) (bool, error) {
+	log.WithContext(ctx).Debugf("getting object lock configuration for bucket %s", bucket)
+
+	out, err := s.S3.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ObjectLockConfigurationNotFoundError" {
+			return false, nil
+		}
+		return false, ErrCode("failed to get object lock configuration for s3 bucket "+bucket, err)
+	}
+
+	if out.ObjectLockConfiguration == nil {
+		return false, nil
+	}
+
+	return aws.StringValue(out.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled, nil
+}
+
+// applyRetention sets governance mode default retention for the bucket, and applies the same retention
+// to all existing objects, except attachments
+func (s *S3Repository) applyRetention(ctx context.Context, bucket string) error {
+	days := s.ObjectLockRetentionDays
+	if days <= 0 {
+		days = defaultObjectLockRetentionDays
+	}
+
+	log.WithContext(ctx).Debugf("setting default governance retention of %d days for bucket %s", days, bucket)
+
+	if _, err := s.S3.PutObjectLockConfigurationWithContext(ctx, &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			Rule: &s3.ObjectLockRule{
+				DefaultRetention: &s3.DefaultRetention{
+					Days: aws.Int64(days),
+					Mode: aws.String(s3.ObjectLockRetentionModeGovernance),
+				},
+			},
+		},
+	}); err != nil {
+		return ErrCode("failed to set object lock configuration for s3 bucket "+bucket, err)
+	}
+
+	retainUntil := time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour)
+
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+
+	truncated := true
+	for truncated {
+		output, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return ErrCode("failed to list objects in s3 bucket "+bucket, err)
+		}
+
+		for _, object := range output.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasPrefix(key, attachmentsPrefix) {
+				continue
+			}
+
+			log.WithContext(ctx).Debugf("applying governance retention until %s for s3://%s/%s", retainUntil, bucket, key)
+
+			if _, err := s.S3.PutObjectRetentionWithContext(ctx, &s3.PutObjectRetentionInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+				Retention: &s3.ObjectLockRetention{
+					Mode:            aws.String(s3.ObjectLockRetentionModeGovernance),
+					RetainUntilDate: aws.Time(retainUntil),
+				},
+			}); err != nil {
+				return ErrCode("failed to apply retention to object "+key+" in s3 bucket "+bucket, err)
+			}
+		}
+
+		truncated = aws.BoolValue(output.IsTruncated)
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	return nil
+}
+
+// mergeBucketPolicy adds the given statements to the bucket policy, replacing any existing statements with the same Sid.
+// Statements with a Sid in remove are dropped.  Other existing statements are left untouched.  If the resulting
+// policy has no statements, the bucket policy is deleted.
+func (s *S3Repository) mergeBucketPolicy(ctx context.Context, bucket string, statements []PolicyStatement, remove ...string) error {
+	log.WithContext(ctx).Debugf("getting bucket policy for bucket %s", bucket)
+
+	// existing statements are kept as raw json, since the policy may contain elements we don't model
+	existing := struct {
+		Version   string
+		Statement []json.RawMessage
+	}{}
+
+	hasPolicy := false
+	out, err := s.S3.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NoSuchBucketPolicy" {
+			return ErrCode("failed to get bucket policy for s3 bucket "+bucket, err)
+		}
+	} else if policy := aws.StringValue(out.Policy); policy != "" {
+		hasPolicy = true
+		if err := json.Unmarshal([]byte(policy), &existing); err != nil {
+			return apierror.New(apierror.ErrInternalError, "failed to decode bucket policy for s3 bucket "+bucket, err)
+		}
+	}
+
+	drop := map[string]bool{}
+	for _, sid := range remove {
+		drop[sid] = true
+	}
+	for _, st := range statements {
+		drop[st.Sid] = true
+	}
+
+	merged := []interface{}{}
+	for _, raw := range existing.Statement {
+		st := struct{ Sid string }{}
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return apierror.New(apierror.ErrInternalError, "failed to decode bucket policy statement for s3 bucket "+bucket, err)
+		}
+
+		if st.Sid != "" && drop[st.Sid] {
+			continue
+		}
+
+		merged = append(merged, raw)
+	}
+
+	for _, st := range statements {
+		merged = append(merged, st)
+	}
+
+	if len(merged) == 0 {
+		if !hasPolicy {
+			return nil
+		}
+
+		log.WithContext(ctx).Debugf("deleting empty bucket policy for bucket %s", bucket)
+
+		if _, err := s.S3.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(bucket),
+		}); err != nil {
+			return ErrCode("failed to delete bucket policy for s3 bucket "+bucket, err)
+		}
+
+		return nil
+	}
+
+	policyDoc, err := json.Marshal(struct {
+		Version   string
+		Statement []interface{}
+	}{
+		Version:   "2012-10-17",
+		Statement: merged,
+	})
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to encode bucket policy for s3 bucket "+bucket, err)
+	}
+
+	log.WithContext(ctx).Debugf("putting bucket policy for bucket %s: %s", bucket, string(policyDoc))
+
+	if _, err := s.S3.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(string(policyDoc)),
+	}); err != nil {
+		return ErrCode("failed to put bucket policy for s3 bucket "+bucket, err)
+	}
+
+	return nil
+}
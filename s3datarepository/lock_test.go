@@ -0,0 +1,388 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+func (m *mockS3Client) GetObjectLockConfigurationWithContext(ctx aws.Context, input *s3.GetObjectLockConfigurationInput, opts ...request.Option) (*s3.GetObjectLockConfigurationOutput, error) {
+	if err, ok := m.err["GetObjectLockConfigurationWithContext"]; ok {
+		return nil, err
+	}
+
+	if aws.StringValue(input.Bucket) == "dataset-testLock" {
+		return &s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			},
+		}, nil
+	}
+
+	return nil, awserr.New("ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket", nil)
+}
+
+func (m *mockS3Client) PutObjectLockConfigurationWithContext(ctx aws.Context, input *s3.PutObjectLockConfigurationInput, opts ...request.Option) (*s3.PutObjectLockConfigurationOutput, error) {
+	if err, ok := m.err["PutObjectLockConfigurationWithContext"]; ok {
+		return nil, err
+	}
+
+	// clearing the default retention
+	if input.ObjectLockConfiguration.Rule == nil {
+		delete(m.objects, "defaultretention:"+aws.StringValue(input.Bucket))
+		return &s3.PutObjectLockConfigurationOutput{}, nil
+	}
+
+	if aws.StringValue(input.ObjectLockConfiguration.Rule.DefaultRetention.Mode) != s3.ObjectLockRetentionModeGovernance {
+		m.t.Errorf("expected governance mode default retention, got %s", input.ObjectLockConfiguration)
+	}
+
+	m.objects["defaultretention:"+aws.StringValue(input.Bucket)] = []byte(aws.StringValue(input.ObjectLockConfiguration.Rule.DefaultRetention.Mode))
+
+	return &s3.PutObjectLockConfigurationOutput{}, nil
+}
+
+func (m *mockS3Client) PutObjectRetentionWithContext(ctx aws.Context, input *s3.PutObjectRetentionInput, opts ...request.Option) (*s3.PutObjectRetentionOutput, error) {
+	if err, ok := m.err["PutObjectRetentionWithContext"]; ok {
+		return nil, err
+	}
+
+	m.objects["retention:"+aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = []byte(aws.StringValue(input.Retention.Mode))
+
+	return &s3.PutObjectRetentionOutput{}, nil
+}
+
+func (m *mockS3Client) GetBucketPolicyWithContext(ctx aws.Context, input *s3.GetBucketPolicyInput, opts ...request.Option) (*s3.GetBucketPolicyOutput, error) {
+	if err, ok := m.err["GetBucketPolicyWithContext"]; ok {
+		return nil, err
+	}
+
+	if p, ok := m.objects["policy:"+aws.StringValue(input.Bucket)]; ok {
+		return &s3.GetBucketPolicyOutput{Policy: aws.String(string(p))}, nil
+	}
+
+	return nil, awserr.New("NoSuchBucketPolicy", "The bucket policy does not exist", nil)
+}
+
+func (m *mockS3Client) PutBucketPolicyWithContext(ctx aws.Context, input *s3.PutBucketPolicyInput, opts ...request.Option) (*s3.PutBucketPolicyOutput, error) {
+	if err, ok := m.err["PutBucketPolicyWithContext"]; ok {
+		return nil, err
+	}
+
+	m.objects["policy:"+aws.StringValue(input.Bucket)] = []byte(aws.StringValue(input.Policy))
+
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteBucketPolicyWithContext(ctx aws.Context, input *s3.DeleteBucketPolicyInput, opts ...request.Option) (*s3.DeleteBucketPolicyOutput, error) {
+	if err, ok := m.err["DeleteBucketPolicyWithContext"]; ok {
+		return nil, err
+	}
+
+	delete(m.objects, "policy:"+aws.StringValue(input.Bucket))
+
+	return &s3.DeleteBucketPolicyOutput{}, nil
+}
+
+// testBucketPolicy decodes the bucket policy stored in the mock client
+func testBucketPolicy(t *testing.T, m *mockS3Client, bucket string) PolicyDoc {
+	policy := PolicyDoc{}
+	if err := json.Unmarshal(m.objects["policy:"+bucket], &policy); err != nil {
+		t.Fatalf("failed to decode bucket policy for %s: %s", bucket, err)
+	}
+	return policy
+}
+
+func TestLock(t *testing.T) {
+	s := S3Repository{
+		NamePrefix:        "dataset",
+		BreakGlassRoleArn: "arn:aws:iam::12345678901:role/BreakGlass",
+		S3:                newMockS3Client(t),
+		STS:               newMockSTSClient(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	// test without object lock, keeping existing statements
+	m.objects["policy:dataset-testNoLock"] = []byte(`{"Version":"2012-10-17","Statement":[{"Sid":"Existing","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::dataset-testNoLock/*","Condition":{"Bool":{"aws:SecureTransport":"true"}}}]}`)
+
+	if err := s.Lock(context.TODO(), "testNoLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	raw := struct{ Statement []map[string]interface{} }{}
+	if err := json.Unmarshal(m.objects["policy:dataset-testNoLock"], &raw); err != nil {
+		t.Fatalf("failed to decode bucket policy: %s", err)
+	}
+
+	if len(raw.Statement) != 3 || raw.Statement[0]["Sid"] != "Existing" || raw.Statement[1]["Sid"] != finalizedPolicySid || raw.Statement[2]["Sid"] != finalizedManifestPolicySid {
+		t.Errorf("expected existing, finalized and manifest statements, got %+v", raw.Statement)
+	}
+
+	actions := []string{
+		"s3:BypassGovernanceRetention",
+		"s3:DeleteObject",
+		"s3:DeleteObjectVersion",
+		"s3:PutObject",
+		"s3:PutObjectLegalHold",
+		"s3:PutObjectRetention",
+	}
+
+	expected := []PolicyStatement{
+		{
+			Sid:       finalizedPolicySid,
+			Effect:    "Deny",
+			Principal: map[string][]string{"AWS": {"*"}},
+			Action:    actions,
+			NotResource: []string{
+				"arn:aws:s3:::dataset-testNoLock/_attachments/*",
+				"arn:aws:s3:::dataset-testNoLock/_manifest/*",
+			},
+			Condition: map[string]map[string][]string{
+				"ArnNotLike": {"aws:PrincipalArn": {"arn:aws:iam::12345678901:role/BreakGlass"}},
+			},
+		},
+		{
+			Sid:       finalizedManifestPolicySid,
+			Effect:    "Deny",
+			Principal: map[string][]string{"AWS": {"*"}},
+			Action:    actions,
+			Resource:  []string{"arn:aws:s3:::dataset-testNoLock/_manifest/*"},
+			Condition: map[string]map[string][]string{
+				"ArnNotLike": {"aws:PrincipalArn": {"arn:aws:iam::12345678901:user/test", "arn:aws:iam::12345678901:role/BreakGlass"}},
+			},
+		},
+	}
+
+	for i, e := range expected {
+		st := PolicyStatement{}
+		j, _ := json.Marshal(raw.Statement[i+1])
+		if err := json.Unmarshal(j, &st); err != nil {
+			t.Fatalf("failed to decode finalized statement: %s", err)
+		}
+		if !reflect.DeepEqual(st, e) {
+			t.Errorf("expected statement %+v, got %+v", e, st)
+		}
+	}
+
+	// locking again replaces the statement instead of adding another one
+	if err := s.Lock(context.TODO(), "testNoLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if err := json.Unmarshal(m.objects["policy:dataset-testNoLock"], &raw); err != nil {
+		t.Fatalf("failed to decode bucket policy: %s", err)
+	}
+	if len(raw.Statement) != 3 {
+		t.Errorf("expected 3 statements, got %d", len(raw.Statement))
+	}
+
+	// test with object lock, without break glass role
+	s.BreakGlassRoleArn = ""
+	m.objects["dataset-testLock/data/1.csv"] = []byte("1,2,3")
+	m.objects["dataset-testLock/_manifest/manifest.json"] = []byte("{}")
+	m.objects["dataset-testLock/_attachments/dua.pdf"] = []byte("dua")
+
+	if err := s.Lock(context.TODO(), "testLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	for _, k := range []string{"data/1.csv", "_manifest/manifest.json"} {
+		if string(m.objects["retention:dataset-testLock/"+k]) != s3.ObjectLockRetentionModeGovernance {
+			t.Errorf("expected governance retention for %s", k)
+		}
+	}
+	if _, ok := m.objects["retention:dataset-testLock/_attachments/dua.pdf"]; ok {
+		t.Error("expected no retention for attachments")
+	}
+
+	policy := testBucketPolicy(t, m, "dataset-testLock")
+	if len(policy.Statement) != 2 || policy.Statement[0].Condition != nil {
+		t.Errorf("expected a finalized statement without condition, got %+v", policy.Statement)
+	}
+	if exempt := policy.Statement[1].Condition["ArnNotLike"]["aws:PrincipalArn"]; !reflect.DeepEqual(exempt, []string{"arn:aws:iam::12345678901:user/test"}) {
+		t.Errorf("expected only the api to be exempt from the manifest statement, got %v", exempt)
+	}
+
+	// test retention failure
+	m.err["PutObjectRetentionWithContext"] = awserr.New("InvalidRequest", "bad request", nil)
+	if err := s.Lock(context.TODO(), "testLock"); err == nil {
+		t.Error("expected error, got nil")
+	}
+	delete(m.err, "PutObjectRetentionWithContext")
+
+	// test bucket policy failure
+	m.err["PutBucketPolicyWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	err := s.Lock(context.TODO(), "testNoLock")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrForbidden {
+		t.Errorf("expected forbidden error, got: %s", err)
+	}
+	delete(m.err, "PutBucketPolicyWithContext")
+
+	// test object lock configuration failure
+	m.err["GetObjectLockConfigurationWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	if err := s.Lock(context.TODO(), "testNoLock"); err == nil {
+		t.Error("expected error, got nil")
+	}
+	delete(m.err, "GetObjectLockConfigurationWithContext")
+
+	// test empty id
+	err = s.Lock(context.TODO(), "")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	s := S3Repository{
+		NamePrefix: "dataset",
+		S3:         newMockS3Client(t),
+		STS:        newMockSTSClient(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	// unlocking keeps other statements and clears the default retention
+	m.objects["policy:dataset-testLock"] = []byte(`{"Version":"2012-10-17","Statement":[{"Sid":"Existing","Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::dataset-testLock/*"]}]}`)
+	if err := s.Lock(context.TODO(), "testLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if _, ok := m.objects["defaultretention:dataset-testLock"]; !ok {
+		t.Fatal("expected default retention for locked bucket")
+	}
+
+	if err := s.Unlock(context.TODO(), "testLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy := testBucketPolicy(t, m, "dataset-testLock")
+	if len(policy.Statement) != 1 || policy.Statement[0].Sid != "Existing" {
+		t.Errorf("expected only the existing statement, got %+v", policy.Statement)
+	}
+	if _, ok := m.objects["defaultretention:dataset-testLock"]; ok {
+		t.Error("expected default retention to be cleared")
+	}
+
+	// unlocking without object lock only removes the statements, and the empty policy
+	if err := s.Lock(context.TODO(), "testNoLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if err := s.Unlock(context.TODO(), "testNoLock"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if _, ok := m.objects["policy:dataset-testNoLock"]; ok {
+		t.Errorf("expected bucket policy to be deleted, got %s", m.objects["policy:dataset-testNoLock"])
+	}
+
+	// test object lock configuration failure
+	m.err["PutObjectLockConfigurationWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	err := s.Unlock(context.TODO(), "testLock")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrForbidden {
+		t.Errorf("expected forbidden error, got: %s", err)
+	}
+	delete(m.err, "PutObjectLockConfigurationWithContext")
+
+	// test empty id
+	err = s.Unlock(context.TODO(), "")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s := S3Repository{
+		NamePrefix: "dataset",
+		S3:         newMockS3Client(t),
+	}
+
+	type test struct {
+		id      string
+		days    int64
+		expires time.Duration
+	}
+
+	tests := []test{
+		{"testLock", 0, 365 * 24 * time.Hour},
+		{"testLock", 30, 30 * 24 * time.Hour},
+		{"testNoLock", 30, 0},
+	}
+
+	for _, tst := range tests {
+		s.ObjectLockRetentionDays = tst.days
+		retention, err := s.Retention(context.TODO(), tst.id)
+		if err != nil {
+			t.Errorf("expected nil error, got: %s", err)
+		}
+
+		if retention != tst.expires {
+			t.Errorf("expected retention %s for %s with %d days, got %s", tst.expires, tst.id, tst.days, retention)
+		}
+	}
+
+	// test empty id
+	_, err := s.Retention(context.TODO(), "")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+}
+
+func TestMergeBucketPolicy(t *testing.T) {
+	s := S3Repository{S3: newMockS3Client(t)}
+	m := s.S3.(*mockS3Client)
+
+	one := PolicyStatement{Sid: "One", Effect: "Deny", Principal: map[string][]string{"AWS": {"*"}}, Action: []string{"s3:PutObject"}, Resource: []string{"arn:aws:s3:::bucket/*"}}
+	two := PolicyStatement{Sid: "Two", Effect: "Deny", Principal: map[string][]string{"AWS": {"*"}}, Action: []string{"s3:DeleteObject"}, Resource: []string{"arn:aws:s3:::bucket/*"}}
+
+	// test removing from a bucket without a policy
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", nil, "One"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if _, ok := m.objects["policy:bucket"]; ok {
+		t.Error("expected no bucket policy")
+	}
+
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", []PolicyStatement{one, two}); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy := testBucketPolicy(t, m, "bucket")
+	if !reflect.DeepEqual(policy.Statement, []PolicyStatement{one, two}) {
+		t.Errorf("expected statements One and Two, got %+v", policy.Statement)
+	}
+
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", nil, "One"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy = testBucketPolicy(t, m, "bucket")
+	if !reflect.DeepEqual(policy.Statement, []PolicyStatement{two}) {
+		t.Errorf("expected statement Two, got %+v", policy.Statement)
+	}
+
+	// test removing the last statement deletes the policy
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", nil, "Two"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if _, ok := m.objects["policy:bucket"]; ok {
+		t.Error("expected bucket policy to be deleted")
+	}
+
+	// test get failure
+	m.err["GetBucketPolicyWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", []PolicyStatement{one}); err == nil {
+		t.Error("expected error, got nil")
+	}
+	delete(m.err, "GetBucketPolicyWithContext")
+
+	// test invalid existing policy
+	m.objects["policy:bucket"] = []byte("{")
+	if err := s.mergeBucketPolicy(context.TODO(), "bucket", []PolicyStatement{one}); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,198 @@
+package s3datarepository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// manifestPrefix is the protected prefix where the content manifest is stored
+const manifestPrefix = "_manifest/"
+
+// manifestKey is the key of the content manifest in the data repository
+const manifestKey = manifestPrefix + "manifest.json"
+
+// CreateManifest records every object in the data repository (except attachments) with its size,
+// ETag and SHA-256 checksum, and stores the manifest in the data repository
+func (s *S3Repository) CreateManifest(ctx context.Context, id string) (*dataset.ManifestReference, error) {
+	if id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("creating content manifest for s3datarepository: %s", name)
+
+	objects, err := s.manifestObjects(ctx, name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	manifest := dataset.NewManifest(id, now, objects)
+
+	j, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to encode manifest", err)
+	}
+
+	sum := sha256.Sum256(j)
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(name),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(manifestKey),
+	}); err != nil {
+		return nil, ErrCode("failed to put manifest in s3 bucket "+name, err)
+	}
+
+	log.WithContext(ctx).Debugf("created manifest with %d objects (%d bytes) for s3datarepository %s", manifest.ObjectCount, manifest.TotalBytes, name)
+
+	return &dataset.ManifestReference{
+		Location:    fmt.Sprintf("s3://%s/%s", name, manifestKey),
+		SHA256:      hex.EncodeToString(sum[:]),
+		ObjectCount: manifest.ObjectCount,
+		TotalBytes:  manifest.TotalBytes,
+		CreatedAt:   &now,
+	}, nil
+}
+
+// VerifyManifest compares the current contents of the data repository against the stored manifest.
+// The stored manifest must match the checksum in the reference.  If checksums is true, the SHA-256
+// of every object is recomputed, otherwise only the size and ETag are compared.
+func (s *S3Repository) VerifyManifest(ctx context.Context, id string, reference *dataset.ManifestReference, checksums bool) (*dataset.ManifestVerification, error) {
+	if id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if reference == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty manifest reference"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("verifying s3datarepository %s against content manifest (checksums: %t)", name, checksums)
+
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(name),
+		Key:    aws.String(manifestKey),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get manifest from s3 bucket "+name, err)
+	}
+	defer out.Body.Close()
+
+	j, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to read manifest from s3 bucket "+name, err)
+	}
+
+	sum := sha256.Sum256(j)
+	if hex.EncodeToString(sum[:]) != reference.SHA256 {
+		msg := fmt.Sprintf("manifest for s3datarepository %s doesn't match its recorded checksum", name)
+		return nil, apierror.New(apierror.ErrConflict, msg, nil)
+	}
+
+	manifest := &dataset.Manifest{}
+	if err = json.Unmarshal(j, manifest); err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to decode manifest from s3 bucket "+name, err)
+	}
+
+	objects, err := s.manifestObjects(ctx, name, checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := manifest.Verify(objects, checksums)
+	verification.VerifiedAt = time.Now().UTC().Truncate(time.Second)
+
+	log.WithContext(ctx).Debugf("verified s3datarepository %s: %+v", name, verification)
+
+	return verification, nil
+}
+
+// manifestObjects lists all objects in a bucket, excluding attachments and the manifest itself,
+// and optionally computes the SHA-256 checksum for each one
+func (s *S3Repository) manifestObjects(ctx context.Context, bucket string, checksums bool) ([]*dataset.ManifestObject, error) {
+	objects := []*dataset.ManifestObject{}
+
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+
+	truncated := true
+	for truncated {
+		output, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list objects in s3 bucket "+bucket, err)
+		}
+
+		for _, object := range output.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasPrefix(key, attachmentsPrefix) || strings.HasPrefix(key, manifestPrefix) {
+				continue
+			}
+
+			o := &dataset.ManifestObject{
+				Key:  key,
+				Size: aws.Int64Value(object.Size),
+				ETag: aws.StringValue(object.ETag),
+			}
+
+			if checksums {
+				if o.SHA256, err = s.objectSHA256(ctx, bucket, key); err != nil {
+					return nil, err
+				}
+			}
+
+			objects = append(objects, o)
+		}
+
+		truncated = aws.BoolValue(output.IsTruncated)
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+// objectSHA256 streams an object from S3 and returns its hex encoded SHA-256 checksum
+func (s *S3Repository) objectSHA256(ctx context.Context, bucket, key string) (string, error) {
+	log.WithContext(ctx).Debugf("computing sha256 for s3://%s/%s", bucket, key)
+
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", ErrCode("failed to get object "+key+" from s3 bucket "+bucket, err)
+	}
+	defer out.Body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, out.Body); err != nil {
+		return "", apierror.New(apierror.ErrInternalError, "failed to read object "+key+" from s3 bucket "+bucket, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
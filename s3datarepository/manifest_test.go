@@ -0,0 +1,178 @@
+package s3datarepository
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+func (m *mockS3Client) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err, ok := m.err["PutObjectWithContext"]; ok {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = b
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+// listObjects lists the objects that were put in the mock client for the given bucket
+func (m *mockS3Client) listObjects(input *s3.ListObjectsV2Input) *s3.ListObjectsV2Output {
+	prefix := aws.StringValue(input.Bucket) + "/"
+
+	keys := []string{}
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix+aws.StringValue(input.Prefix)) && k > prefix+aws.StringValue(input.StartAfter) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	contents := []*s3.Object{}
+	for _, k := range keys {
+		sum := md5.Sum(m.objects[k])
+		contents = append(contents, &s3.Object{
+			ETag: aws.String(fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:]))),
+			Key:  aws.String(strings.TrimPrefix(k, prefix)),
+			Size: aws.Int64(int64(len(m.objects[k]))),
+		})
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents: contents,
+		KeyCount: aws.Int64(int64(len(contents))),
+	}
+}
+
+func TestCreateManifest(t *testing.T) {
+	s := S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t)}
+	m := s.S3.(*mockS3Client)
+	m.objects["dataset-testManifest/data/1.csv"] = []byte("a,b,c\n1,2,3\n")
+	m.objects["dataset-testManifest/readme.txt"] = []byte("hello")
+	m.objects["dataset-testManifest/_attachments/dua.pdf"] = []byte("dua")
+
+	ref, err := s.CreateManifest(context.TODO(), "testManifest")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if ref.Location != "s3://dataset-testManifest/_manifest/manifest.json" {
+		t.Errorf("unexpected manifest location %s", ref.Location)
+	}
+
+	if ref.ObjectCount != 2 || ref.TotalBytes != 17 {
+		t.Errorf("expected 2 objects and 17 bytes, got %d objects and %d bytes", ref.ObjectCount, ref.TotalBytes)
+	}
+
+	if ref.SHA256 == "" || ref.CreatedAt == nil {
+		t.Errorf("expected manifest checksum and creation time, got %+v", ref)
+	}
+
+	if _, ok := m.objects["dataset-testManifest/_manifest/manifest.json"]; !ok {
+		t.Error("expected manifest to be stored in the data repository")
+	}
+
+	// test empty id
+	_, err = s.CreateManifest(context.TODO(), "")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+
+	// test list failure
+	m.err["ListObjectsV2WithContext"] = awserr.New("InternalError", "boom", nil)
+	if _, err = s.CreateManifest(context.TODO(), "testManifest"); err == nil {
+		t.Error("expected error, got nil")
+	}
+	delete(m.err, "ListObjectsV2WithContext")
+
+	// test put failure
+	m.err["PutObjectWithContext"] = awserr.New("AccessDenied", "denied", nil)
+	if _, err = s.CreateManifest(context.TODO(), "testManifest"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	s := S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t)}
+	m := s.S3.(*mockS3Client)
+	m.objects["dataset-testManifest/data/1.csv"] = []byte("a,b,c\n1,2,3\n")
+	m.objects["dataset-testManifest/data/2.csv"] = []byte("d,e,f\n4,5,6\n")
+	m.objects["dataset-testManifest/readme.txt"] = []byte("hello")
+
+	ref, err := s.CreateManifest(context.TODO(), "testManifest")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	// test unchanged dataset, adding an attachment doesn't count as a change
+	m.objects["dataset-testManifest/_attachments/dua.pdf"] = []byte("dua")
+	for _, checksums := range []bool{false, true} {
+		v, err := s.VerifyManifest(context.TODO(), "testManifest", ref, checksums)
+		if err != nil {
+			t.Fatalf("expected nil error, got: %s", err)
+		}
+		if !v.Verified || v.ChecksumsVerified != checksums || v.ObjectCount != 3 {
+			t.Errorf("expected verified dataset, got %+v", v)
+		}
+	}
+
+	// test changed dataset
+	m.objects["dataset-testManifest/readme.txt"] = []byte("HELLO")
+	m.objects["dataset-testManifest/data/3.csv"] = []byte("g,h,i\n")
+	delete(m.objects, "dataset-testManifest/data/2.csv")
+
+	v, err := s.VerifyManifest(context.TODO(), "testManifest", ref, true)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := &dataset.ManifestVerification{
+		Verified:          false,
+		VerifiedAt:        v.VerifiedAt,
+		ChecksumsVerified: true,
+		ObjectCount:       3,
+		Missing:           []string{"data/2.csv"},
+		Added:             []string{"data/3.csv"},
+		Modified:          []string{"readme.txt"},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, v)
+	}
+
+	// test tampered manifest
+	m.objects["dataset-testManifest/_manifest/manifest.json"] = []byte(`{"id":"testManifest","objects":[]}`)
+	_, err = s.VerifyManifest(context.TODO(), "testManifest", ref, false)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Errorf("expected conflict error, got: %s", err)
+	}
+
+	// test nil reference
+	_, err = s.VerifyManifest(context.TODO(), "testManifest", nil, false)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+
+	// test missing manifest
+	delete(m.objects, "dataset-testManifest/_manifest/manifest.json")
+	if _, err = s.VerifyManifest(context.TODO(), "testManifest", ref, false); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,160 @@
+package s3datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sts"
+	log "github.com/sirupsen/logrus"
+)
+
+// networkPolicySid is the id of the bucket policy statement that restricts access to a data repository by network
+const networkPolicySid = "DatasetNetworkRestriction"
+
+// SetNetworkRestriction sets the bucket policy statement that denies access to the data repository, unless the request
+// comes through one of the allowed VPC endpoints or source CIDRs.  The API itself (the caller of STS GetCallerIdentity)
+// and the BreakGlassRoleArn are exempt.  An empty restriction removes the statement.
+func (s *S3Repository) SetNetworkRestriction(ctx context.Context, id string, restriction *dataset.NetworkRestriction) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if err := validateNetworkRestriction(restriction); err != nil {
+		return apierror.New(apierror.ErrBadRequest, err.Error(), err)
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	if restriction.Empty() {
+		log.WithContext(ctx).Infof("removing network restriction for s3datarepository: %s", name)
+		return s.mergeBucketPolicy(ctx, name, nil, networkPolicySid)
+	}
+
+	log.WithContext(ctx).Infof("restricting network access for s3datarepository %s to vpc endpoints %v and source cidrs %v", name, restriction.VPCEndpoints, restriction.SourceCIDRs)
+
+	exempt, err := s.exemptPrincipals(ctx)
+	if err != nil {
+		return err
+	}
+
+	statement := networkPolicyStatement(name, restriction, exempt)
+
+	return s.mergeBucketPolicy(ctx, name, []PolicyStatement{statement})
+}
+
+// networkPolicyStatement returns the bucket policy statement that denies all access to the bucket that doesn't come
+// through the allowed VPC endpoints or source CIDRs.  Conditions in a statement must all match, so a request is only
+// denied if it matches neither.  Requests made by AWS services on behalf of a principal and the exempt principals
+// are not denied.
+func networkPolicyStatement(bucket string, restriction *dataset.NetworkRestriction, exempt []string) PolicyStatement {
+	condition := map[string]map[string][]string{
+		"Bool": {
+			"aws:ViaAWSService": {"false"},
+		},
+	}
+
+	if len(restriction.VPCEndpoints) > 0 {
+		condition["StringNotEquals"] = map[string][]string{
+			"aws:SourceVpce": restriction.VPCEndpoints,
+		}
+	}
+
+	if len(restriction.SourceCIDRs) > 0 {
+		condition["NotIpAddress"] = map[string][]string{
+			"aws:SourceIp": restriction.SourceCIDRs,
+		}
+	}
+
+	if len(exempt) > 0 {
+		condition["ArnNotLike"] = map[string][]string{
+			"aws:PrincipalArn": exempt,
+		}
+	}
+
+	return PolicyStatement{
+		Sid:       networkPolicySid,
+		Effect:    "Deny",
+		Principal: map[string][]string{"AWS": {"*"}},
+		Action:    []string{"s3:*"},
+		Resource: []string{
+			fmt.Sprintf("arn:aws:s3:::%s", bucket),
+			fmt.Sprintf("arn:aws:s3:::%s/*", bucket),
+		},
+		Condition: condition,
+	}
+}
+
+// exemptPrincipals returns the principal ARNs of the API and the BreakGlassRoleArn (if configured), which are not
+// subject to the network restriction or the finalized manifest protection, so the API can still manage the data repository
+func (s *S3Repository) exemptPrincipals(ctx context.Context) ([]string, error) {
+	out, err := s.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, ErrCode("failed to get caller identity", err)
+	}
+
+	exempt, err := principalArns(aws.StringValue(out.Arn))
+	if err != nil {
+		return nil, apierror.New(apierror.ErrInternalError, "failed to parse caller identity", err)
+	}
+
+	if s.BreakGlassRoleArn != "" {
+		exempt = append(exempt, s.BreakGlassRoleArn)
+	}
+
+	return exempt, nil
+}
+
+// principalArns returns the principal ARNs to match a caller identity in a policy condition.  For assumed roles,
+// aws:PrincipalArn is the ARN of the role, which may include a path we don't know from the session ARN.
+func principalArns(callerArn string) ([]string, error) {
+	a, err := arn.Parse(callerArn)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Service != "sts" || !strings.HasPrefix(a.Resource, "assumed-role/") {
+		return []string{callerArn}, nil
+	}
+
+	parts := strings.Split(a.Resource, "/")
+	if len(parts) < 2 || parts[1] == "" {
+		return nil, fmt.Errorf("unexpected assumed role arn %s", callerArn)
+	}
+
+	role := parts[1]
+	return []string{
+		fmt.Sprintf("arn:%s:iam::%s:role/%s", a.Partition, a.AccountID, role),
+		fmt.Sprintf("arn:%s:iam::%s:role/*/%s", a.Partition, a.AccountID, role),
+	}, nil
+}
+
+// validateNetworkRestriction checks the format of the VPC endpoint ids and source CIDRs
+func validateNetworkRestriction(restriction *dataset.NetworkRestriction) error {
+	if restriction == nil {
+		return nil
+	}
+
+	for _, v := range restriction.VPCEndpoints {
+		if !strings.HasPrefix(v, "vpce-") {
+			return fmt.Errorf("invalid vpc endpoint id '%s'", v)
+		}
+	}
+
+	for _, c := range restriction.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			return fmt.Errorf("invalid source cidr '%s'", c)
+		}
+	}
+
+	return nil
+}
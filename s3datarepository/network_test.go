@@ -0,0 +1,147 @@
+package s3datarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+func TestPrincipalArns(t *testing.T) {
+	tests := map[string][]string{
+		"arn:aws:iam::12345678901:user/test": {"arn:aws:iam::12345678901:user/test"},
+		"arn:aws:sts::12345678901:assumed-role/dsapi/session": {
+			"arn:aws:iam::12345678901:role/dsapi",
+			"arn:aws:iam::12345678901:role/*/dsapi",
+		},
+	}
+
+	for callerArn, expected := range tests {
+		out, err := principalArns(callerArn)
+		if err != nil {
+			t.Errorf("expected nil error for %s, got %s", callerArn, err)
+		}
+
+		if !reflect.DeepEqual(out, expected) {
+			t.Errorf("expected %v for %s, got %v", expected, callerArn, out)
+		}
+	}
+
+	if _, err := principalArns("dsapi"); err == nil {
+		t.Error("expected error for invalid arn, got nil")
+	}
+}
+
+func TestSetNetworkRestriction(t *testing.T) {
+	s := S3Repository{
+		NamePrefix:        "dataset",
+		BreakGlassRoleArn: "arn:aws:iam::12345678901:role/BreakGlass",
+		S3:                newMockS3Client(t),
+		STS:               newMockSTSClient(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	// keep the finalized statement when restricting
+	if err := s.Lock(context.TODO(), "test"); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	restriction := &dataset.NetworkRestriction{
+		VPCEndpoints: []string{"vpce-0123456789abcdef0"},
+		SourceCIDRs:  []string{"10.0.0.0/8"},
+	}
+
+	if err := s.SetNetworkRestriction(context.TODO(), "test", restriction); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := PolicyStatement{
+		Sid:       networkPolicySid,
+		Effect:    "Deny",
+		Principal: map[string][]string{"AWS": {"*"}},
+		Action:    []string{"s3:*"},
+		Resource:  []string{"arn:aws:s3:::dataset-test", "arn:aws:s3:::dataset-test/*"},
+		Condition: map[string]map[string][]string{
+			"Bool":            {"aws:ViaAWSService": {"false"}},
+			"StringNotEquals": {"aws:SourceVpce": {"vpce-0123456789abcdef0"}},
+			"NotIpAddress":    {"aws:SourceIp": {"10.0.0.0/8"}},
+			"ArnNotLike": {"aws:PrincipalArn": {
+				"arn:aws:iam::12345678901:user/test",
+				"arn:aws:iam::12345678901:role/BreakGlass",
+			}},
+		},
+	}
+
+	policy := testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 3 || policy.Statement[0].Sid != finalizedPolicySid || policy.Statement[1].Sid != finalizedManifestPolicySid {
+		t.Fatalf("expected finalized and network statements, got %+v", policy.Statement)
+	}
+
+	if !reflect.DeepEqual(policy.Statement[2], expected) {
+		t.Errorf("expected statement %+v, got %+v", expected, policy.Statement[2])
+	}
+
+	// only vpc endpoints
+	restriction.SourceCIDRs = nil
+	if err := s.SetNetworkRestriction(context.TODO(), "test", restriction); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy = testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(policy.Statement))
+	}
+	if _, ok := policy.Statement[2].Condition["NotIpAddress"]; ok {
+		t.Errorf("expected no source ip condition, got %+v", policy.Statement[2].Condition)
+	}
+
+	// empty restriction removes the statement
+	if err := s.SetNetworkRestriction(context.TODO(), "test", &dataset.NetworkRestriction{}); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy = testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 2 || policy.Statement[0].Sid != finalizedPolicySid {
+		t.Errorf("expected only the finalized statements, got %+v", policy.Statement)
+	}
+
+	// invalid input
+	if err := s.SetNetworkRestriction(context.TODO(), "", restriction); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	if err := s.SetNetworkRestriction(context.TODO(), "test", &dataset.NetworkRestriction{SourceCIDRs: []string{"10.0.0.1"}}); err == nil {
+		t.Error("expected error for invalid cidr, got nil")
+	}
+}
+
+func TestNewDefaultRepositoryNetworkRestriction(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"allowedVpcEndpoints": "vpce-0123456789abcdef0"},
+		{"allowedVpcEndpoints": []interface{}{"vpc-0123456789abcdef0"}},
+		{"allowedSourceCidrs": []interface{}{"10.0.0.1"}},
+		{"allowedSourceCidrs": []interface{}{float64(10)}},
+	} {
+		if _, err := NewDefaultRepository(config); err == nil {
+			t.Errorf("expected error for config %v, got nil", config)
+		}
+	}
+
+	s, err := NewDefaultRepository(map[string]interface{}{
+		"region":              "us-east-1",
+		"allowedVpcEndpoints": []interface{}{"vpce-0123456789abcdef0"},
+		"allowedSourceCidrs":  []interface{}{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	expected := &dataset.NetworkRestriction{
+		VPCEndpoints: []string{"vpce-0123456789abcdef0"},
+		SourceCIDRs:  []string{"10.0.0.0/8"},
+	}
+	if !reflect.DeepEqual(s.NetworkRestriction, expected) {
+		t.Errorf("expected network restriction %+v, got %+v", expected, s.NetworkRestriction)
+	}
+}
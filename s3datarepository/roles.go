@@ -0,0 +1,218 @@
+package s3datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	log "github.com/sirupsen/logrus"
+)
+
+// isRoleArn returns true if the principal of a grant is an IAM role ARN, instead of an instance id
+func isRoleArn(principal string) bool {
+	return strings.HasPrefix(principal, "arn:")
+}
+
+// grantRole validates that the role ARN can be granted access to data repositories and returns the role.
+// The role has to exist in the same account, and its path must start with one of the GrantRolePathPrefixes
+// and not with the IAMPathPrefix (those roles are managed by the API).
+func (s *S3Repository) grantRole(ctx context.Context, roleArn string) (*iam.Role, error) {
+	if len(s.GrantRolePathPrefixes) == 0 {
+		return nil, apierror.New(apierror.ErrBadRequest, "role grants are not enabled for this account", nil)
+	}
+
+	a, err := arn.Parse(roleArn)
+	if err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid role arn "+roleArn, err)
+	}
+
+	callerOut, err := s.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, ErrCode("failed to get caller identity", err)
+	}
+
+	if a.AccountID != aws.StringValue(callerOut.Account) {
+		return nil, apierror.New(apierror.ErrForbidden, "role "+roleArn+" is not in the same account as the data repository", nil)
+	}
+
+	resource := strings.TrimPrefix(a.Resource, "role")
+	roleName := resource[strings.LastIndex(resource, "/")+1:]
+	rolePath := resource[:strings.LastIndex(resource, "/")+1]
+
+	if s.IAMPathPrefix != "" && strings.HasPrefix(rolePath, s.IAMPathPrefix) {
+		return nil, apierror.New(apierror.ErrForbidden, "role "+roleArn+" is managed by the api and can't be granted access directly", nil)
+	}
+
+	allowed := false
+	for _, p := range s.GrantRolePathPrefixes {
+		if strings.HasPrefix(rolePath, p) {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		msg := fmt.Sprintf("role %s is not in an allowed path (%s)", roleArn, strings.Join(s.GrantRolePathPrefixes, ", "))
+		return nil, apierror.New(apierror.ErrForbidden, msg, nil)
+	}
+
+	roleOut, err := s.IAM.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, ErrCode("failed to get IAM role "+roleName, err)
+	}
+
+	// the path is not part of the role identity, make sure it's the role we checked
+	if aws.StringValue(roleOut.Role.Arn) != roleArn {
+		msg := fmt.Sprintf("role %s does not match existing role %s", roleArn, aws.StringValue(roleOut.Role.Arn))
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	return roleOut.Role, nil
+}
+
+// grantRoleAccess gives an existing role access to the data repository by attaching the access policy for the
+// permission level, and detaching the access policies of other levels
+// Returns the role arn and the role name
+func (s *S3Repository) grantRoleAccess(ctx context.Context, id, roleArn, permission string) (dataset.Access, error) {
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("granting role %s %s access to s3datarepository %s", roleArn, permission, name)
+
+	role, err := s.grantRole(ctx, roleArn)
+	if err != nil {
+		return nil, err
+	}
+
+	policyArn, err := s.grantPolicyArn(ctx, name, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithContext(ctx).Debugf("attaching policy %s to role %s", policyArn, aws.StringValue(role.RoleName))
+
+	if _, err = s.IAM.AttachRolePolicyWithContext(ctx, &iam.AttachRolePolicyInput{
+		PolicyArn: aws.String(policyArn),
+		RoleName:  role.RoleName,
+	}); err != nil {
+		return nil, ErrCode("failed to attach policy "+policyArn+" to role "+aws.StringValue(role.RoleName), err)
+	}
+
+	if err = s.detachOtherAccessPolicies(ctx, name, aws.StringValue(role.RoleName), policyArn); err != nil {
+		return nil, err
+	}
+
+	return dataset.Access{roleArn: aws.StringValue(role.RoleName)}, nil
+}
+
+// revokeRoleAccess revokes role access from the data repository by detaching the access policies from the role
+func (s *S3Repository) revokeRoleAccess(ctx context.Context, id, roleArn string) error {
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("revoking role %s access from s3datarepository %s", roleArn, name)
+
+	role, err := s.grantRole(ctx, roleArn)
+	if err != nil {
+		return err
+	}
+
+	// the role may have any of the access policies attached, it's not found if none of them were
+	var detachErr error
+	detached := false
+	for _, policyName := range accessPolicyNames(name) {
+		policyArn, err := s.getPolicyArn(ctx, policyName)
+		if err != nil {
+			return ErrCode("failed to get ARN for policy "+policyName, err)
+		}
+
+		log.WithContext(ctx).Debugf("detaching dataset access policy %s from role %s", policyArn, aws.StringValue(role.RoleName))
+
+		if _, err = s.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(policyArn),
+			RoleName:  role.RoleName,
+		}); err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iam.ErrCodeNoSuchEntityException {
+				detachErr = ErrCode("failed to detach policy "+policyArn+" from role "+aws.StringValue(role.RoleName), err)
+				continue
+			}
+			return ErrCode("failed to detach policy "+policyArn+" from role "+aws.StringValue(role.RoleName), err)
+		}
+
+		detached = true
+	}
+
+	if !detached {
+		return detachErr
+	}
+
+	return nil
+}
+
+// listRoleAccess adds the roles in the GrantRolePathPrefixes that the access policy is attached to
+func (s *S3Repository) listRoleAccess(ctx context.Context, policyArn string, output dataset.Access) error {
+	for _, r := range s.grantRolesForPolicy(ctx, policyArn) {
+		roleOut, err := s.IAM.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: r.RoleName})
+		if err != nil {
+			return ErrCode("failed to get IAM role "+aws.StringValue(r.RoleName), err)
+		}
+
+		output[aws.StringValue(roleOut.Role.Arn)] = aws.StringValue(r.RoleName)
+	}
+
+	return nil
+}
+
+// grantRolesForPolicy lists the roles in the GrantRolePathPrefixes that the access policy is attached to.  Errors
+// are logged, since this is also used when cleaning up.
+func (s *S3Repository) grantRolesForPolicy(ctx context.Context, policyArn string) []*iam.PolicyRole {
+	roles := []*iam.PolicyRole{}
+	seen := map[string]bool{}
+	for _, p := range s.GrantRolePathPrefixes {
+		log.WithContext(ctx).Debugf("listing roles in path %s with policy %s", p, policyArn)
+
+		entitiesOut, err := s.IAM.ListEntitiesForPolicyWithContext(ctx, &iam.ListEntitiesForPolicyInput{
+			EntityFilter:      aws.String("Role"),
+			PathPrefix:        aws.String(p),
+			PolicyArn:         aws.String(policyArn),
+			PolicyUsageFilter: aws.String("PermissionsPolicy"),
+		})
+		if err != nil {
+			log.WithContext(ctx).Warnf("failed to list entities in path %s for policy %s: %s", p, policyArn, err)
+			continue
+		}
+
+		for _, r := range entitiesOut.PolicyRoles {
+			// skip roles managed by the api, overlapping prefixes may list them
+			if strings.HasPrefix(aws.StringValue(r.RoleName), "instanceRole_") || seen[aws.StringValue(r.RoleId)] {
+				continue
+			}
+			seen[aws.StringValue(r.RoleId)] = true
+			roles = append(roles, r)
+		}
+	}
+
+	return roles
+}
+
+// validateGrantRolePathPrefixes checks that the path prefixes start and end with a "/"
+func validateGrantRolePathPrefixes(prefixes []string) error {
+	for _, p := range prefixes {
+		if !strings.HasPrefix(p, "/") || !strings.HasSuffix(p, "/") {
+			return errors.New("invalid role path prefix '" + p + "', must start and end with /")
+		}
+	}
+	return nil
+}
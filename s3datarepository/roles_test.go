@@ -0,0 +1,119 @@
+package s3datarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+)
+
+func TestGrantRoleAccess(t *testing.T) {
+	id := "595AEBB1-431A-4A9E-AE12-2E747F27097F"
+	roleArn := "arn:aws:iam::12345678901:role/apps/app-ecsTask"
+
+	s := newTestS3Repository(t)
+
+	// role grants are disabled without path prefixes
+	_, err := s.GrantAccess(context.TODO(), id, roleArn, dataset.PermissionWrite)
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %v", err)
+	}
+
+	s.GrantRolePathPrefixes = []string{"/apps/"}
+
+	got, err := s.GrantAccess(context.TODO(), id, roleArn, dataset.PermissionWrite)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := dataset.Access{roleArn: "app-ecsTask"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected output %+v, got %+v", expected, got)
+	}
+
+	type forbiddenTest struct {
+		roleArn string
+		code    string
+	}
+
+	for _, tst := range []forbiddenTest{
+		{"arn:aws:iam::12345678901:role/admin", apierror.ErrForbidden},
+		{"arn:aws:iam::12345678901:role/test/instanceRole_i-0123456789abcdef3", apierror.ErrForbidden},
+		{"arn:aws:iam::99999999999:role/apps/app-ecsTask", apierror.ErrForbidden},
+		{"arn:aws:iam::12345678901:role/apps/other/app-ecsTask", apierror.ErrBadRequest},
+		{"arn:aws:iam::12345678901:user/apps/app-ecsTask", apierror.ErrBadRequest},
+		{"arn:aws:iam:", apierror.ErrBadRequest},
+	} {
+		_, err := s.GrantAccess(context.TODO(), id, tst.roleArn, dataset.PermissionWrite)
+		if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != tst.code {
+			t.Errorf("expected %s error for %s, got: %v", tst.code, tst.roleArn, err)
+		}
+	}
+
+	// attach failure
+	s.IAM.(*mockIAMClient).err["AttachRolePolicyWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "not found", nil)
+	if _, err := s.GrantAccess(context.TODO(), id, roleArn, dataset.PermissionWrite); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestListRoleAccess(t *testing.T) {
+	id := "595AEBB1-431A-4A9E-AE12-2E747F27097F"
+
+	s := newTestS3Repository(t)
+	s.GrantRolePathPrefixes = []string{"/apps/", "/"}
+
+	got, err := s.ListAccess(context.TODO(), id)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := dataset.Access{
+		"i-0123456789abcdef3":                            "instanceRole_i-0123456789abcdef3",
+		"arn:aws:iam::12345678901:role/apps/app-ecsTask": "app-ecsTask",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected output %+v, got %+v", expected, got)
+	}
+}
+
+func TestRevokeRoleAccess(t *testing.T) {
+	id := "595AEBB1-431A-4A9E-AE12-2E747F27097F"
+
+	s := newTestS3Repository(t)
+	s.GrantRolePathPrefixes = []string{"/apps/"}
+
+	if err := s.RevokeAccess(context.TODO(), id, "arn:aws:iam::12345678901:role/apps/app-ecsTask"); err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
+	if err := s.RevokeAccess(context.TODO(), id, "arn:aws:iam::12345678901:role/admin"); err == nil {
+		t.Error("expected error for role outside of the allowed paths, got nil")
+	}
+
+	s.IAM.(*mockIAMClient).err["DetachRolePolicyWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "not attached", nil)
+	err := s.RevokeAccess(context.TODO(), id, "arn:aws:iam::12345678901:role/apps/app-ecsTask")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestNewDefaultRepositoryGrantRolePathPrefixes(t *testing.T) {
+	if _, err := NewDefaultRepository(map[string]interface{}{"grantRolePathPrefixes": []interface{}{"apps"}}); err == nil {
+		t.Error("expected error for invalid path prefix, got nil")
+	}
+
+	s, err := NewDefaultRepository(map[string]interface{}{"region": "us-east-1", "grantRolePathPrefixes": []interface{}{"/apps/"}})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(s.GrantRolePathPrefixes, []string{"/apps/"}) {
+		t.Errorf("expected grant role path prefixes [/apps/], got %v", s.GrantRolePathPrefixes)
+	}
+}
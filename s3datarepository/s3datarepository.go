@@ -18,6 +18,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -32,21 +34,40 @@ type S3RepositoryOption func(*S3Repository)
 
 // S3Repository is an implementation of a data respository in S3
 type S3Repository struct {
-	NamePrefix          string
-	IAMPathPrefix       string
-	LoggingBucket       string
-	LoggingBucketPrefix string
-	EC2                 ec2iface.EC2API
-	IAM                 iamiface.IAMAPI
-	S3                  s3iface.S3API
-	S3Uploader          s3manageriface.UploaderAPI
-	STS                 stsiface.STSAPI
-	config              *aws.Config
+	NamePrefix              string
+	IAMPathPrefix           string
+	LoggingBucket           string
+	LoggingBucketPrefix     string
+	InventoryBucket         string
+	InventoryPrefix         string
+	InventoryCacheTTL       time.Duration
+	ObjectLock              bool
+	ObjectLockRetentionDays int64
+	BreakGlassRoleArn       string
+	EncryptionMode          string
+	KMSKeyArn               string
+	KMSKeyDeletionDays      int64
+	NetworkRestriction      *dataset.NetworkRestriction
+	GrantRolePathPrefixes   []string
+	ActivityQueueArn        string
+	EC2                     ec2iface.EC2API
+	IAM                     iamiface.IAMAPI
+	KMS                     kmsiface.KMSAPI
+	S3                      s3iface.S3API
+	S3Uploader              s3manageriface.UploaderAPI
+	STS                     stsiface.STSAPI
+	config                  *aws.Config
+	inventoryCache          *inventoryCache
 }
 
 // NewDefaultRepository creates a new repository from the default config data
 func NewDefaultRepository(config map[string]interface{}) (*S3Repository, error) {
-	var akid, secret, token, region, endpoint, loggingBucket string
+	var akid, secret, token, region, endpoint, loggingBucket, inventoryBucket, inventoryPrefix, breakGlassRoleArn string
+	var encryption, kmsKeyArn, activityQueueArn string
+	var inventoryCacheTTL time.Duration
+	var objectLock bool
+	var objectLockRetentionDays, kmsKeyDeletionDays int64
+	var allowedVpcEndpoints, allowedSourceCidrs, grantRolePathPrefixes []string
 	if v, ok := config["akid"].(string); ok {
 		akid = v
 	}
@@ -71,6 +92,77 @@ func NewDefaultRepository(config map[string]interface{}) (*S3Repository, error)
 		loggingBucket = v
 	}
 
+	if v, ok := config["inventoryBucket"].(string); ok {
+		inventoryBucket = v
+	}
+
+	if v, ok := config["inventoryPrefix"].(string); ok {
+		inventoryPrefix = v
+	}
+
+	if v, ok := config["inventoryCacheTTL"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, errors.New("invalid inventoryCacheTTL: " + v)
+		}
+		inventoryCacheTTL = d
+	}
+
+	if v, ok := config["objectLock"].(bool); ok {
+		objectLock = v
+	}
+
+	if v, ok := config["objectLockRetentionDays"].(float64); ok {
+		objectLockRetentionDays = int64(v)
+	}
+
+	if v, ok := config["breakGlassRoleArn"].(string); ok {
+		breakGlassRoleArn = v
+	}
+
+	if v, ok := config["encryption"].(string); ok {
+		encryption = v
+	}
+
+	if v, ok := config["kmsKeyArn"].(string); ok {
+		kmsKeyArn = v
+	}
+
+	if v, ok := config["kmsKeyDeletionDays"].(float64); ok {
+		kmsKeyDeletionDays = int64(v)
+	}
+
+	if v, ok := config["allowedVpcEndpoints"]; ok {
+		list, err := stringList(v)
+		if err != nil {
+			return nil, errors.New("invalid allowedVpcEndpoints: " + err.Error())
+		}
+		allowedVpcEndpoints = list
+	}
+
+	if v, ok := config["allowedSourceCidrs"]; ok {
+		list, err := stringList(v)
+		if err != nil {
+			return nil, errors.New("invalid allowedSourceCidrs: " + err.Error())
+		}
+		allowedSourceCidrs = list
+	}
+
+	if v, ok := config["activityQueueArn"].(string); ok {
+		activityQueueArn = v
+	}
+
+	if v, ok := config["grantRolePathPrefixes"]; ok {
+		list, err := stringList(v)
+		if err != nil {
+			return nil, errors.New("invalid grantRolePathPrefixes: " + err.Error())
+		}
+		if err := validateGrantRolePathPrefixes(list); err != nil {
+			return nil, err
+		}
+		grantRolePathPrefixes = list
+	}
+
 	opts := []S3RepositoryOption{
 		WithStaticCredentials(akid, secret, token),
 	}
@@ -87,6 +179,55 @@ func NewDefaultRepository(config map[string]interface{}) (*S3Repository, error)
 		opts = append(opts, WithLoggingBucket(loggingBucket))
 	}
 
+	if inventoryBucket != "" {
+		opts = append(opts, WithInventoryBucket(inventoryBucket, inventoryPrefix))
+	}
+
+	if inventoryCacheTTL != 0 {
+		opts = append(opts, WithInventoryCacheTTL(inventoryCacheTTL))
+	}
+
+	if objectLock {
+		opts = append(opts, WithObjectLock(objectLockRetentionDays))
+	}
+
+	if breakGlassRoleArn != "" {
+		opts = append(opts, WithBreakGlassRole(breakGlassRoleArn))
+	}
+
+	if kmsKeyDeletionDays != 0 && (kmsKeyDeletionDays < 7 || kmsKeyDeletionDays > 30) {
+		return nil, fmt.Errorf("invalid kmsKeyDeletionDays %d, must be between 7 and 30", kmsKeyDeletionDays)
+	}
+
+	// the key settings also apply to datasets that require kms encryption when the default is AES256
+	switch encryption {
+	case "", s3.ServerSideEncryptionAes256:
+		opts = append(opts, WithKMSKey(kmsKeyArn, kmsKeyDeletionDays))
+	case s3.ServerSideEncryptionAwsKms:
+		opts = append(opts, WithKMSEncryption(kmsKeyArn, kmsKeyDeletionDays))
+	default:
+		return nil, errors.New("invalid encryption: " + encryption)
+	}
+
+	if len(allowedVpcEndpoints) > 0 || len(allowedSourceCidrs) > 0 {
+		restriction := &dataset.NetworkRestriction{
+			VPCEndpoints: allowedVpcEndpoints,
+			SourceCIDRs:  allowedSourceCidrs,
+		}
+		if err := validateNetworkRestriction(restriction); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithNetworkRestriction(restriction))
+	}
+
+	if len(grantRolePathPrefixes) > 0 {
+		opts = append(opts, WithGrantRolePathPrefixes(grantRolePathPrefixes...))
+	}
+
+	if activityQueueArn != "" {
+		opts = append(opts, WithActivityQueue(activityQueueArn))
+	}
+
 	// set default IAMPathPrefix
 	opts = append(opts, WithIAMPathPrefix("/spinup/dataset/"))
 
@@ -99,15 +240,18 @@ func New(opts ...S3RepositoryOption) (*S3Repository, error) {
 
 	s := S3Repository{}
 	s.config = aws.NewConfig()
+	s.inventoryCache = newInventoryCache()
 
 	for _, opt := range opts {
 		opt(&s)
 	}
 
 	sess := session.Must(session.NewSession(s.config))
+	sess.Handlers.Build.PushBackNamed(dataset.RequestIDHandler)
 
 	s.EC2 = ec2.New(sess)
 	s.IAM = iam.New(sess)
+	s.KMS = kms.New(sess)
 	s.S3 = s3.New(sess)
 	s.S3Uploader = s3manager.NewUploaderWithClient(s.S3)
 	s.STS = sts.New(sess)
@@ -161,13 +305,102 @@ func WithLoggingBucketPrefix(prefix string) S3RepositoryOption {
 	}
 }
 
+// WithInventoryBucket sets the bucket (and prefix) where S3 Inventory reports are delivered for the S3Repository
+func WithInventoryBucket(bucket, prefix string) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.InventoryBucket = bucket
+		s.InventoryPrefix = prefix
+	}
+}
+
+// WithInventoryCacheTTL sets how long the inventory of a data repository is cached
+func WithInventoryCacheTTL(ttl time.Duration) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.InventoryCacheTTL = ttl
+	}
+}
+
+// WithObjectLock enables S3 Object Lock for new data repositories, with the given governance retention period
+// applied when a data repository is finalized
+func WithObjectLock(retentionDays int64) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.ObjectLock = true
+		s.ObjectLockRetentionDays = retentionDays
+	}
+}
+
+// WithBreakGlassRole sets the role that is still allowed to modify finalized data repositories
+func WithBreakGlassRole(arn string) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.BreakGlassRoleArn = arn
+	}
+}
+
+// WithKMSEncryption encrypts new data repositories with a customer managed KMS key by default, see WithKMSKey
+func WithKMSEncryption(keyArn string, deletionDays int64) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.EncryptionMode = s3.ServerSideEncryptionAwsKms
+		WithKMSKey(keyArn, deletionDays)(s)
+	}
+}
+
+// WithKMSKey sets the customer managed KMS key of the data repositories encrypted with KMS.  If no key ARN is given,
+// a key is created for each data repository and scheduled for deletion after the given number of days when it's
+// deleted.
+func WithKMSKey(keyArn string, deletionDays int64) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.KMSKeyArn = keyArn
+		s.KMSKeyDeletionDays = deletionDays
+	}
+}
+
+// WithNetworkRestriction limits access to new data repositories to the given VPC endpoints or source CIDRs
+func WithNetworkRestriction(restriction *dataset.NetworkRestriction) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.NetworkRestriction = restriction
+	}
+}
+
+// WithGrantRolePathPrefixes allows granting data repository access to existing roles with the given path prefixes
+func WithGrantRolePathPrefixes(prefixes ...string) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.GrantRolePathPrefixes = prefixes
+	}
+}
+
+// WithActivityQueue sends the object activity in new data repositories to the SQS queue with the given ARN
+func WithActivityQueue(arn string) S3RepositoryOption {
+	return func(s *S3Repository) {
+		s.ActivityQueueArn = arn
+	}
+}
+
+// stringList converts a list from the json configuration to a slice of strings
+func stringList(v interface{}) ([]string, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("expected a list of strings")
+	}
+
+	list := make([]string, 0, len(items))
+	for _, i := range items {
+		str, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %v", i)
+		}
+		list = append(list, str)
+	}
+
+	return list, nil
+}
+
 // bucketEmpty lists the objects in a bucket with a max of 1, if there are any objects returned, we return false
 func (s *S3Repository) bucketEmpty(ctx context.Context, bucketName string) (bool, error) {
 	if bucketName == "" {
 		return false, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	log.Debugf("checking if bucket %s is empty", bucketName)
+	log.WithContext(ctx).Debugf("checking if bucket %s is empty", bucketName)
 
 	out, err := s.S3.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket:  aws.String(bucketName),
@@ -194,10 +427,10 @@ func (s *S3Repository) bucketExists(ctx context.Context, bucketName string) (boo
 			case s3.ErrCodeNoSuchBucket, "NotFound":
 				return false, nil
 			case "Forbidden":
-				msg := fmt.Sprintf("forbidden to access requested bucket %s: %s", bucketName, aerr.Error())
+				msg := fmt.Sprintf("forbidden to access requested bucket %s", bucketName)
 				return true, apierror.New(apierror.ErrForbidden, msg, err)
 			default:
-				return false, apierror.New(apierror.ErrBadRequest, aerr.Message(), err)
+				return false, apierror.New(apierror.ErrBadRequest, "failed to check for bucket", err)
 			}
 		}
 		return false, apierror.New(apierror.ErrInternalError, "unexpected error checking for bucket", err)
@@ -217,7 +450,7 @@ func (s *S3Repository) Describe(ctx context.Context, id string) (*dataset.Reposi
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Debugf("describing s3datarepository: %s", name)
+	log.WithContext(ctx).Debugf("describing s3datarepository: %s", name)
 
 	// check if bucket exists
 	exists, err := s.bucketExists(ctx, name)
@@ -234,7 +467,7 @@ func (s *S3Repository) Describe(ctx context.Context, id string) (*dataset.Reposi
 	}
 
 	// get tags
-	log.Debugf("getting tags for bucket %s", name)
+	log.WithContext(ctx).Debugf("getting tags for bucket %s", name)
 	datasetTags, err := s.S3.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(name)})
 	if err != nil {
 		return nil, ErrCode("failed to get tags for s3 bucket "+name, err)
@@ -249,33 +482,59 @@ func (s *S3Repository) Describe(ctx context.Context, id string) (*dataset.Reposi
 		}
 	}
 
+	// get inventory, but don't fail if we can't
+	inventory, err := s.inventory(ctx, name)
+	if err != nil {
+		log.WithContext(ctx).Warnf("failed to get inventory for s3 bucket %s: %s", name, err)
+	}
+
 	output := &dataset.Repository{
-		Name:  name,
-		Empty: empty,
-		Tags:  tags,
+		Name:      name,
+		Empty:     empty,
+		Tags:      tags,
+		Inventory: inventory,
 	}
 
 	return output, nil
 }
 
+// Encryption returns the server side encryption mode applied to new data repositories by default
+func (s *S3Repository) Encryption() string {
+	if s.kmsEnabled() {
+		return s3.ServerSideEncryptionAwsKms
+	}
+	return s3.ServerSideEncryptionAes256
+}
+
 // Provision creates and configures a data repository in S3, and creates a default IAM policy
 // 1. Check if the requested bucket already exists in S3
-// 2. Create the bucket and wait for it to be successfully created
+// 2. Create the bucket (with Object Lock enabled, if ObjectLock is set) and wait for it to be successfully created
 // 3. Block all public access to the bucket
-// 4. Enable AWS managed serverside encryption (AES-256) for the bucket
+// 4. Enable serverside encryption for the bucket as requested (or the default), AES-256 or a customer managed KMS key
 // 5. Enable server access logging for the bucket, if LoggingBucket specified
 // 6. Add tags to the bucket
-func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*dataset.Tag) (string, error) {
+// 7. Configure daily inventory reports for the bucket, if InventoryBucket specified
+// 8. Restrict access to the bucket by network, if NetworkRestriction specified
+// 9. Send object activity notifications to the ActivityQueueArn, if specified
+func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*dataset.Tag, encryption string) (string, error) {
 	if id == "" {
 		return "", apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
+	if encryption == "" {
+		encryption = s.Encryption()
+	}
+
+	if encryption != s3.ServerSideEncryptionAes256 && encryption != s3.ServerSideEncryptionAwsKms {
+		return "", apierror.New(apierror.ErrBadRequest, "invalid encryption "+encryption, nil)
+	}
+
 	name := id
 	if s.NamePrefix != "" {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Debugf("provisioning s3datarepository: %s", name)
+	log.WithContext(ctx).Debugf("provisioning s3datarepository: %s", name)
 
 	// checks if a bucket exists in the account
 	// in us-east-1 (only) bucket creation will succeed if the bucket already exists in your
@@ -300,23 +559,31 @@ func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*
 	var err error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error provisioning s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error provisioning s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
 
 	// create s3 bucket
-	log.Debugf("creating s3 bucket: %s", name)
-	if _, err = s.S3.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
+	log.WithContext(ctx).Debugf("creating s3 bucket: %s", name)
+	createBucketInput := &s3.CreateBucketInput{
 		Bucket: aws.String(name),
-	}); err != nil {
+	}
+
+	// object lock can only be enabled when the bucket is created
+	if s.ObjectLock {
+		log.WithContext(ctx).Debugf("enabling object lock for bucket: %s", name)
+		createBucketInput.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+
+	if _, err = s.S3.CreateBucketWithContext(ctx, createBucketInput); err != nil {
 		return "", ErrCode("failed to create s3 bucket "+name, err)
 	}
 
 	// append bucket delete to rollback tasks
 	rollBackTasks = append(rollBackTasks, func() error {
 		return func() error {
-			log.Debugf("deleting s3 bucket: %s", name)
+			log.WithContext(ctx).Debugf("deleting s3 bucket: %s", name)
 			if _, err := s.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)}); err != nil {
 				return err
 			}
@@ -328,14 +595,14 @@ func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*
 	if err = s.S3.WaitUntilBucketExistsWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(name)},
 		request.WithWaiterDelay(request.ConstantWaiterDelay(2*time.Second)),
 	); err != nil {
-		msg := fmt.Sprintf("failed to create bucket %s, timeout waiting for create: %s", name, err.Error())
+		msg := fmt.Sprintf("failed to create bucket %s, timeout waiting for create", name)
 		return "", apierror.New(apierror.ErrInternalError, msg, err)
 	}
 
-	log.Debugf("s3 bucket %s created successfully", name)
+	log.WithContext(ctx).Debugf("s3 bucket %s created successfully", name)
 
 	// block public access
-	log.Debugf("blocking all public access for bucket: %s", name)
+	log.WithContext(ctx).Debugf("blocking all public access for bucket: %s", name)
 	if _, err = s.S3.PutPublicAccessBlockWithContext(ctx, &s3.PutPublicAccessBlockInput{
 		Bucket: aws.String(name),
 		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
@@ -348,18 +615,36 @@ func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*
 		return "", ErrCode("failed to block public access for s3 bucket "+name, err)
 	}
 
-	// enable AWS managed serverside encryption for the bucket
-	log.Debugf("enabling s3 encryption for bucket: %s", name)
+	// enable serverside encryption for the bucket
+	encryptionRule := &s3.ServerSideEncryptionRule{
+		ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+			SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+		},
+	}
+
+	if encryption == s3.ServerSideEncryptionAwsKms {
+		var keyArn string
+		var keyRollBackTasks []func() error
+		keyArn, keyRollBackTasks, err = s.createKMSKey(ctx, name, datasetTags)
+		rollBackTasks = append(rollBackTasks, keyRollBackTasks...)
+		if err != nil {
+			return "", err
+		}
+
+		encryptionRule = &s3.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+				KMSMasterKeyID: aws.String(keyArn),
+				SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+			},
+			BucketKeyEnabled: aws.Bool(true),
+		}
+	}
+
+	log.WithContext(ctx).Debugf("enabling s3 encryption (%s) for bucket: %s", aws.StringValue(encryptionRule.ApplyServerSideEncryptionByDefault.SSEAlgorithm), name)
 	if _, err = s.S3.PutBucketEncryptionWithContext(ctx, &s3.PutBucketEncryptionInput{
 		Bucket: aws.String(name),
 		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
-			Rules: []*s3.ServerSideEncryptionRule{
-				&s3.ServerSideEncryptionRule{
-					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
-						SSEAlgorithm: aws.String("AES256"),
-					},
-				},
-			},
+			Rules: []*s3.ServerSideEncryptionRule{encryptionRule},
 		},
 	}); err != nil {
 		return "", ErrCode("failed to enable encryption for s3 bucket "+name, err)
@@ -367,25 +652,25 @@ func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*
 
 	// enable access logging for the bucket to a central repo if the logging bucket is set
 	if s.LoggingBucket != "" {
-		log.Debugf("enabling server access logging for bucket: %s", name)
+		log.WithContext(ctx).Debugf("enabling server access logging for bucket: %s", name)
 		if _, err = s.S3.PutBucketLoggingWithContext(ctx, &s3.PutBucketLoggingInput{
 			Bucket: aws.String(name),
 			BucketLoggingStatus: &s3.BucketLoggingStatus{
 				LoggingEnabled: &s3.LoggingEnabled{
 					TargetBucket: aws.String(s.LoggingBucket),
-					TargetPrefix: aws.String(s.LoggingBucketPrefix + id + "/"),
+					TargetPrefix: aws.String(s.accessLogPrefix(id)),
 				},
 			},
 		}); err != nil {
 			return "", ErrCode("failed to enable access logging for s3 bucket "+name, err)
 		}
 	} else {
-		log.Warnf("not enabling server access logging for bucket %s, configure loggingBucket in account config", name)
+		log.WithContext(ctx).Warnf("not enabling server access logging for bucket %s, configure loggingBucket in account config", name)
 	}
 
 	// add tags
 	if len(tags) > 0 {
-		log.Debugf("adding tags for bucket '%s': %+v", name, tags)
+		log.WithContext(ctx).Debugf("adding tags for bucket '%s': %+v", name, tags)
 		if _, err = s.S3.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
 			Bucket:  aws.String(name),
 			Tagging: &s3.Tagging{TagSet: tags},
@@ -394,10 +679,33 @@ func (s *S3Repository) Provision(ctx context.Context, id string, datasetTags []*
 		}
 	}
 
+	// configure inventory reports for the bucket if the inventory bucket is set
+	if s.InventoryBucket != "" {
+		if err = s.putInventoryConfiguration(ctx, name); err != nil {
+			return "", err
+		}
+	}
+
+	// restrict network access to the bucket if a network restriction is set
+	if !s.NetworkRestriction.Empty() {
+		if err = s.SetNetworkRestriction(ctx, id, s.NetworkRestriction); err != nil {
+			return "", err
+		}
+	}
+
+	// send object activity notifications to the activity queue if it's set
+	if s.ActivityQueueArn != "" {
+		if err = s.putActivityNotification(ctx, name); err != nil {
+			return "", err
+		}
+	}
+
 	return name, nil
 }
 
-// SetPolicy sets (or updates) the IAM access policy for the data repository, depending if it's a derivative or not
+// SetPolicy sets (or updates) the read-only and read-write IAM access policies for the data repository, depending
+// if it's a derivative or not.  The single access policy of datasets created before grants had permission levels is
+// updated like the read-write policy, so existing grants keep working.
 func (s *S3Repository) SetPolicy(ctx context.Context, id string, derivative bool) error {
 	if id == "" {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
@@ -408,20 +716,41 @@ func (s *S3Repository) SetPolicy(ctx context.Context, id string, derivative bool
 		name = s.NamePrefix + "-" + name
 	}
 
-	exists, err := s.policyExists(ctx, id)
+	policies, err := s.accessPolicies(ctx, name, derivative)
+	if err != nil {
+		return err
+	}
+
+	legacy, err := s.policyExists(ctx, name)
 	if err != nil {
 		return ErrCode("failed to check if policy exists for s3 bucket "+name, err)
 	}
 
-	if exists {
-		log.Infof("modifying existing access policy for bucket %s (derivative: %t)", name, derivative)
-		if err = s.modifyPolicy(ctx, id, derivative); err != nil {
+	if legacy {
+		log.WithContext(ctx).Infof("modifying legacy access policy for bucket %s (derivative: %t)", name, derivative)
+		if err = s.modifyPolicy(ctx, name, policies[accessPolicyName(name, dataset.PermissionWrite)]); err != nil {
 			return ErrCode("failed to modify access policy for s3 bucket "+name, err)
 		}
-	} else {
-		log.Infof("creating new access policy for bucket %s (derivative: %t)", name, derivative)
-		if err = s.createPolicy(ctx, id, derivative); err != nil {
-			return ErrCode("failed to create access policy for s3 bucket "+name, err)
+	}
+
+	for _, permission := range []string{dataset.PermissionRead, dataset.PermissionWrite} {
+		policyName := accessPolicyName(name, permission)
+
+		exists, err := s.policyExists(ctx, policyName)
+		if err != nil {
+			return ErrCode("failed to check if policy exists for s3 bucket "+name, err)
+		}
+
+		if exists {
+			log.WithContext(ctx).Infof("modifying existing access policy %s for bucket %s (derivative: %t)", policyName, name, derivative)
+			if err = s.modifyPolicy(ctx, policyName, policies[policyName]); err != nil {
+				return ErrCode("failed to modify access policy for s3 bucket "+name, err)
+			}
+		} else {
+			log.WithContext(ctx).Infof("creating new access policy %s for bucket %s (derivative: %t)", policyName, name, derivative)
+			if err = s.createPolicy(ctx, name, policyName, policies[policyName]); err != nil {
+				return ErrCode("failed to create access policy for s3 bucket "+name, err)
+			}
 		}
 	}
 
@@ -439,7 +768,7 @@ func (s *S3Repository) Deprovision(ctx context.Context, id string) error {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Debugf("deprovisioning s3datarepository: %s", name)
+	log.WithContext(ctx).Debugf("deprovisioning s3datarepository: %s", name)
 
 	return nil
 }
@@ -455,18 +784,30 @@ func (s *S3Repository) Delete(ctx context.Context, id string) error {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("deleting s3datarepository: %s", name)
+	log.WithContext(ctx).Infof("deleting s3datarepository: %s", name)
 
-	// delete the s3 bucket
-	_, err := s.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)})
+	// the key is looked up before the bucket is deleted, a per-dataset key is deleted with it
+	keyArn, err := s.kmsKeyArn(ctx, name)
 	if err != nil {
+		return err
+	}
+
+	// delete the s3 bucket
+	if _, err = s.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(name)}); err != nil {
 		return ErrCode("failed to delete s3 bucket "+name, err)
 	}
 
 	// delete associated dataset access policy
-	log.Debugf("deleting dataset access policy for %s", id)
+	log.WithContext(ctx).Debugf("deleting dataset access policy for %s", id)
 	if err = s.deletePolicy(ctx, id); err != nil {
-		log.Warnf("failed to delete access policy for s3 bucket %s: %s", id, err)
+		log.WithContext(ctx).Warnf("failed to delete access policy for s3 bucket %s: %s", id, err)
+	}
+
+	// schedule deletion of the dataset encryption key, unless it's the account key
+	if keyArn != "" && keyArn != s.KMSKeyArn {
+		if err = s.deleteKMSKey(ctx, name); err != nil {
+			log.WithContext(ctx).Warnf("failed to schedule deletion of kms key for s3 bucket %s: %s", name, err)
+		}
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package s3datarepository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -22,14 +23,16 @@ import (
 // mockS3Client is a fake S3 client
 type mockS3Client struct {
 	s3iface.S3API
-	t   *testing.T
-	err map[string]error
+	t       *testing.T
+	err     map[string]error
+	objects map[string][]byte
 }
 
 func newMockS3Client(t *testing.T) s3iface.S3API {
 	return &mockS3Client{
-		t:   t,
-		err: make(map[string]error),
+		t:       t,
+		err:     make(map[string]error),
+		objects: make(map[string][]byte),
 	}
 }
 
@@ -89,9 +92,33 @@ func (m *mockS3Client) PutBucketEncryptionWithContext(ctx context.Context, input
 	if err, ok := m.err["PutBucketEncryptionWithContext"]; ok {
 		return nil, err
 	}
+
+	// the kms key of the bucket is kept with the objects
+	for _, r := range input.ServerSideEncryptionConfiguration.Rules {
+		if d := r.ApplyServerSideEncryptionByDefault; aws.StringValue(d.SSEAlgorithm) == s3.ServerSideEncryptionAwsKms {
+			m.objects["encryption:"+aws.StringValue(input.Bucket)] = []byte(aws.StringValue(d.KMSMasterKeyID))
+		}
+	}
 	return &s3.PutBucketEncryptionOutput{}, nil
 }
 
+func (m *mockS3Client) GetBucketEncryptionWithContext(ctx context.Context, input *s3.GetBucketEncryptionInput, opts ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
+	if err, ok := m.err["GetBucketEncryptionWithContext"]; ok {
+		return nil, err
+	}
+
+	rule := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)}
+	if key, ok := m.objects["encryption:"+aws.StringValue(input.Bucket)]; ok {
+		rule = &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAwsKms), KMSMasterKeyID: aws.String(string(key))}
+	}
+
+	return &s3.GetBucketEncryptionOutput{
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: rule}},
+		},
+	}, nil
+}
+
 func (m *mockS3Client) PutBucketLoggingWithContext(ctx context.Context, input *s3.PutBucketLoggingInput, opts ...request.Option) (*s3.PutBucketLoggingOutput, error) {
 	if err, ok := m.err["PutBucketLoggingWithContext"]; ok {
 		return nil, err
@@ -103,6 +130,13 @@ func (m *mockS3Client) PutBucketTaggingWithContext(ctx context.Context, input *s
 	if err, ok := m.err["PutBucketTaggingWithContext"]; ok {
 		return nil, err
 	}
+
+	tagging, err := json.Marshal(input.Tagging.TagSet)
+	if err != nil {
+		return nil, err
+	}
+	m.objects["tagging:"+aws.StringValue(input.Bucket)] = tagging
+
 	return &s3.PutBucketTaggingOutput{}, nil
 }
 
@@ -115,11 +149,15 @@ func (m *mockS3Client) PutPublicAccessBlockWithContext(ctx context.Context, inpu
 
 func TestNewDefaultRepository(t *testing.T) {
 	testConfig := map[string]interface{}{
-		"region":        "us-east-1",
-		"akid":          "xxxxx",
-		"secret":        "yyyyy",
-		"endpoint":      "https://under.mydesk.amazonaws.com",
-		"loggingBucket": "dsapi-test-access-logs",
+		"region":                  "us-east-1",
+		"akid":                    "xxxxx",
+		"secret":                  "yyyyy",
+		"endpoint":                "https://under.mydesk.amazonaws.com",
+		"loggingBucket":           "dsapi-test-access-logs",
+		"objectLock":              true,
+		"objectLockRetentionDays": float64(30),
+		"breakGlassRoleArn":       "arn:aws:iam::12345678901:role/BreakGlass",
+		"activityQueueArn":        "arn:aws:sqs:us-east-1:12345678901:dsapi-activity",
 	}
 
 	expectedIAMPathPrefix := "/spinup/dataset/"
@@ -152,6 +190,18 @@ func TestNewDefaultRepository(t *testing.T) {
 	if s.IAMPathPrefix != expectedIAMPathPrefix {
 		t.Errorf("expected IAMPathPrefix to be '%s', got '%s'", expectedIAMPathPrefix, s.IAMPathPrefix)
 	}
+
+	if !s.ObjectLock || s.ObjectLockRetentionDays != 30 {
+		t.Errorf("expected ObjectLock with 30 days retention, got %t with %d days", s.ObjectLock, s.ObjectLockRetentionDays)
+	}
+
+	if s.BreakGlassRoleArn != "arn:aws:iam::12345678901:role/BreakGlass" {
+		t.Errorf("expected BreakGlassRoleArn to be set, got '%s'", s.BreakGlassRoleArn)
+	}
+
+	if s.ActivityQueueArn != "arn:aws:sqs:us-east-1:12345678901:dsapi-activity" {
+		t.Errorf("expected ActivityQueueArn to be set, got '%s'", s.ActivityQueueArn)
+	}
 }
 
 func TestNew(t *testing.T) {
@@ -258,7 +308,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	expected := "68004EEC-6044-45C9-91E5-AF836DCD9234"
 
-	got, err := s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", testTags)
+	got, err := s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", testTags, "")
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -271,7 +321,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	expected = "dataset-68004EEC-6044-45C9-91E5-AF836DCD9234"
 
-	got, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{})
+	got, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{}, "")
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -284,7 +334,20 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	expected = "dataset-68004EEC-6044-45C9-91E5-AF836DCD9234"
 
-	got, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{})
+	got, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{}, "")
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+	if got != expected {
+		t.Errorf("expected repository '%s', got: %s", expected, got)
+	}
+
+	// test success, without tags, with prefix, with InventoryBucket
+	s = S3Repository{NamePrefix: "dataset", InventoryBucket: "ds-test-inventory", S3: newMockS3Client(t), IAM: newMockIAMClient(t)}
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+	expected = "dataset-68004EEC-6044-45C9-91E5-AF836DCD9234"
+
+	got, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{}, "")
 	if err != nil {
 		t.Errorf("expected nil error, got: %s", err)
 	}
@@ -292,13 +355,22 @@ func TestProvision(t *testing.T) {
 		t.Errorf("expected repository '%s', got: %s", expected, got)
 	}
 
+	// test inventory configuration failure
+	s = S3Repository{NamePrefix: "dataset", InventoryBucket: "ds-test-inventory", S3: newMockS3Client(t), IAM: newMockIAMClient(t)}
+	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
+	s.S3.(*mockS3Client).err["PutBucketInventoryConfigurationWithContext"] = awserr.New("InvalidRequest", "bad destination", nil)
+
+	if _, err = s.Provision(context.TODO(), "68004EEC-6044-45C9-91E5-AF836DCD9234", []*dataset.Tag{}, ""); err == nil {
+		t.Error("expected error, got: nil")
+	}
+
 	// test empty id
 	s = S3Repository{S3: newMockS3Client(t)}
 	id = ""
 	expectedCode = apierror.ErrBadRequest
 	expectedMessage = "invalid input"
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -320,7 +392,7 @@ func TestProvision(t *testing.T) {
 	expectedCode = apierror.ErrConflict
 	expectedMessage = "s3 bucket already exists"
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -344,7 +416,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	s.S3.(*mockS3Client).err["CreateBucketWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -364,9 +436,9 @@ func TestProvision(t *testing.T) {
 	s = S3Repository{NamePrefix: "dataset", S3: newMockS3Client(t)}
 	id = "68004EEC-6044-45C9-91E5-AF836DCD9234-missing"
 	expectedCode = apierror.ErrInternalError
-	expectedMessage = fmt.Sprintf("failed to create bucket dataset-%s, timeout waiting for create: NoSuchBucket: Not Found", id)
+	expectedMessage = fmt.Sprintf("failed to create bucket dataset-%s, timeout waiting for create", id)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -390,7 +462,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	s.S3.(*mockS3Client).err["PutPublicAccessBlockWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -414,7 +486,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	s.S3.(*mockS3Client).err["PutBucketEncryptionWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -438,7 +510,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	s.S3.(*mockS3Client).err["PutBucketLoggingWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -462,7 +534,7 @@ func TestProvision(t *testing.T) {
 	s.S3.(*mockS3Client).err["HeadBucketWithContext"] = awserr.New("NotFound", "bucket not found", nil)
 	s.S3.(*mockS3Client).err["PutBucketTaggingWithContext"] = awserr.New("InternalError", "Internal Error", nil)
 
-	_, err = s.Provision(context.TODO(), id, testTags)
+	_, err = s.Provision(context.TODO(), id, testTags, "")
 	if err == nil {
 		t.Error("expected error, got: nil")
 	} else {
@@ -630,6 +702,12 @@ func TestSetPolicy(t *testing.T) {
 		t.Errorf("expected nil error, got: %s", err)
 	}
 
+	// test success, legacy policy exists without the read-only and read-write policies
+	s = S3Repository{NamePrefix: "dataset", IAM: newMockIAMClient(t), S3: newMockS3Client(t), STS: newMockSTSClient(t)}
+	if err = s.SetPolicy(context.TODO(), "LEGACY-DATASET", true); err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
 	// test empty id
 	s = S3Repository{NamePrefix: "dataset", IAM: newMockIAMClient(t), S3: newMockS3Client(t), STS: newMockSTSClient(t)}
 	err = s.SetPolicy(context.TODO(), "", false)
@@ -0,0 +1,276 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// awsAccountID matches a 12 digit AWS account id
+var awsAccountID = regexp.MustCompile(`^[0-9]{12}$`)
+
+// sharePolicySid returns the id of the bucket policy statement that grants a share, statement ids can only be alphanumeric
+func sharePolicySid(shareID string) string {
+	return "DatasetShare" + strings.ReplaceAll(shareID, "-", "")
+}
+
+// shareRoleName returns the name of the cross-account role of a share
+func shareRoleName(shareID string) string {
+	return "shareRole_" + shareID
+}
+
+// CreateShare shares the data repository with another AWS account.  The account root is granted access in the
+// bucket policy, read-only unless the share has write access.  If the share has an ExternalID, a cross-account
+// role that the other account can assume with the external id is also created, and its ARN is set on the share.
+// Data repositories encrypted with a customer managed key can only be shared with a role, since the key policy
+// doesn't allow other accounts.
+func (s *S3Repository) CreateShare(ctx context.Context, id string, share *dataset.Share) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if share == nil || share.ID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty share id"))
+	}
+
+	if !awsAccountID.MatchString(share.AccountID) {
+		return apierror.New(apierror.ErrBadRequest, "invalid account id "+share.AccountID, nil)
+	}
+
+	write := share.Access == dataset.ShareAccessWrite
+	if !write && share.Access != dataset.ShareAccessRead {
+		return apierror.New(apierror.ErrBadRequest, "invalid share access "+share.Access, nil)
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	if share.ExternalID == "" {
+		keyArn, err := s.kmsKeyArn(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if keyArn != "" {
+			return apierror.New(apierror.ErrBadRequest, "data repositories encrypted with kms can only be shared with a cross-account role", nil)
+		}
+	}
+
+	log.WithContext(ctx).Infof("sharing s3datarepository %s with account %s (%s)", name, share.AccountID, share.Access)
+
+	// setup rollback function list and defer execution
+	var rollBackTasks []func() error
+	var err error
+	defer func() {
+		if err != nil {
+			log.WithContext(ctx).Errorf("recovering from error sharing s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			rollBack(&rollBackTasks)
+		}
+	}()
+
+	if share.ExternalID != "" {
+		var roleArn string
+		var roleRollBackTasks []func() error
+		roleArn, roleRollBackTasks, err = s.createShareRole(ctx, name, share, write)
+		rollBackTasks = append(rollBackTasks, roleRollBackTasks...)
+		if err != nil {
+			return err
+		}
+		share.RoleArn = roleArn
+	}
+
+	if err = s.mergeBucketPolicy(ctx, name, sharePolicyStatements(name, share.ID, share.AccountID, write)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteShare removes the bucket policy statements of a share and deletes its cross-account role.  The bucket
+// may already be deleted, since shares are cleaned up after their dataset.
+func (s *S3Repository) DeleteShare(ctx context.Context, id string, share *dataset.Share) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	if share == nil || share.ID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty share id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("removing share %s of s3datarepository %s with account %s", share.ID, name, share.AccountID)
+
+	sid := sharePolicySid(share.ID)
+	if err := s.mergeBucketPolicy(ctx, name, nil, sid, sid+"Objects", sid+"Deny"); err != nil {
+		if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+			return err
+		}
+		log.WithContext(ctx).Warnf("s3 bucket %s not found, not removing share %s from bucket policy", name, share.ID)
+	}
+
+	if share.RoleArn == "" {
+		return nil
+	}
+
+	roleName := shareRoleName(share.ID)
+
+	log.WithContext(ctx).Debugf("deleting share role %s", roleName)
+
+	if _, err := s.IAM.DeleteRolePolicyWithContext(ctx, &iam.DeleteRolePolicyInput{
+		PolicyName: aws.String(name),
+		RoleName:   aws.String(roleName),
+	}); err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != iam.ErrCodeNoSuchEntityException {
+			return ErrCode("failed to delete policy of share role "+roleName, err)
+		}
+	}
+
+	if _, err := s.IAM.DeleteRoleWithContext(ctx, &iam.DeleteRoleInput{
+		RoleName: aws.String(roleName),
+	}); err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != iam.ErrCodeNoSuchEntityException {
+			return ErrCode("failed to delete share role "+roleName, err)
+		}
+	}
+
+	return nil
+}
+
+// createShareRole creates the cross-account role of a share, with the dataset access policy inline.  Returns the
+// role ARN and a slice of functions to perform rollback of its actions.
+func (s *S3Repository) createShareRole(ctx context.Context, bucket string, share *dataset.Share, write bool) (string, []func() error, error) {
+	var rollBackTasks []func() error
+
+	roleName := shareRoleName(share.ID)
+
+	trustDoc, err := json.Marshal(PolicyDoc{
+		Version: "2012-10-17",
+		Statement: []PolicyStatement{
+			{
+				Effect:    "Allow",
+				Action:    []string{"sts:AssumeRole"},
+				Principal: map[string][]string{"AWS": {fmt.Sprintf("arn:aws:iam::%s:root", share.AccountID)}},
+				Condition: map[string]map[string][]string{
+					"StringEquals": {"sts:ExternalId": {share.ExternalID}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", rollBackTasks, apierror.New(apierror.ErrInternalError, "failed to generate share role trust policy", err)
+	}
+
+	log.WithContext(ctx).Debugf("creating share role %s for account %s", roleName, share.AccountID)
+
+	roleOut, err := s.IAM.CreateRoleWithContext(ctx, &iam.CreateRoleInput{
+		AssumeRolePolicyDocument: aws.String(string(trustDoc)),
+		Description:              aws.String(fmt.Sprintf("Role for share %s of dataset bucket %s with account %s", share.ID, bucket, share.AccountID)),
+		Path:                     aws.String(s.IAMPathPrefix),
+		RoleName:                 aws.String(roleName),
+	})
+	if err != nil {
+		return "", rollBackTasks, ErrCode("failed to create share role "+roleName, err)
+	}
+
+	// append role delete to rollback tasks
+	rollBackTasks = append(rollBackTasks, func() error {
+		log.WithContext(ctx).Debugf("deleting share role %s", roleName)
+		_, err := s.IAM.DeleteRoleWithContext(ctx, &iam.DeleteRoleInput{RoleName: aws.String(roleName)})
+		return err
+	})
+
+	keyArn, err := s.kmsKeyArn(ctx, bucket)
+	if err != nil {
+		return "", rollBackTasks, err
+	}
+
+	var policyDoc []byte
+	if write {
+		policyDoc, err = s.derivativeAccessPolicy(bucket, keyArn)
+	} else {
+		policyDoc, err = s.originalAccessPolicy(bucket, keyArn)
+	}
+	if err != nil {
+		return "", rollBackTasks, ErrCode("failed to generate IAM policy for bucket "+bucket, err)
+	}
+
+	if _, err = s.IAM.PutRolePolicyWithContext(ctx, &iam.PutRolePolicyInput{
+		PolicyDocument: aws.String(string(policyDoc)),
+		PolicyName:     aws.String(bucket),
+		RoleName:       aws.String(roleName),
+	}); err != nil {
+		return "", rollBackTasks, ErrCode("failed to put policy for share role "+roleName, err)
+	}
+
+	// append role policy delete to rollback tasks
+	rollBackTasks = append(rollBackTasks, func() error {
+		log.WithContext(ctx).Debugf("deleting policy of share role %s", roleName)
+		_, err := s.IAM.DeleteRolePolicyWithContext(ctx, &iam.DeleteRolePolicyInput{
+			PolicyName: aws.String(bucket),
+			RoleName:   aws.String(roleName),
+		})
+		return err
+	})
+
+	return aws.StringValue(roleOut.Role.Arn), rollBackTasks, nil
+}
+
+// sharePolicyStatements returns the bucket policy statements that grant another account access to the bucket.
+// Writes are still denied to attachments and the manifest.
+func sharePolicyStatements(bucket, shareID, accountID string, write bool) []PolicyStatement {
+	sid := sharePolicySid(shareID)
+	principal := map[string][]string{"AWS": {fmt.Sprintf("arn:aws:iam::%s:root", accountID)}}
+
+	objectActions := []string{"s3:GetObject"}
+	if write {
+		objectActions = []string{"s3:DeleteObject", "s3:GetObject", "s3:PutObject"}
+	}
+
+	statements := []PolicyStatement{
+		{
+			Sid:       sid,
+			Effect:    "Allow",
+			Principal: principal,
+			Action:    []string{"s3:GetBucketLocation", "s3:ListBucket"},
+			Resource:  []string{fmt.Sprintf("arn:aws:s3:::%s", bucket)},
+		},
+		{
+			Sid:       sid + "Objects",
+			Effect:    "Allow",
+			Principal: principal,
+			Action:    objectActions,
+			Resource:  []string{fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
+		},
+	}
+
+	if write {
+		statements = append(statements, PolicyStatement{
+			Sid:       sid + "Deny",
+			Effect:    "Deny",
+			Principal: principal,
+			Action:    []string{"s3:DeleteObject", "s3:PutObject"},
+			Resource: []string{
+				fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, attachmentsPrefix),
+				fmt.Sprintf("arn:aws:s3:::%s/_manifest/*", bucket),
+			},
+		})
+	}
+
+	return statements
+}
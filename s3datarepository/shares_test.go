@@ -0,0 +1,148 @@
+package s3datarepository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func (i *mockIAMClient) PutRolePolicyWithContext(ctx context.Context, input *iam.PutRolePolicyInput, opts ...request.Option) (*iam.PutRolePolicyOutput, error) {
+	if err, ok := i.err["PutRolePolicyWithContext"]; ok {
+		return nil, err
+	}
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+func (i *mockIAMClient) DeleteRolePolicyWithContext(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...request.Option) (*iam.DeleteRolePolicyOutput, error) {
+	if err, ok := i.err["DeleteRolePolicyWithContext"]; ok {
+		return nil, err
+	}
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+func TestCreateShare(t *testing.T) {
+	s := newTestS3Repository(t)
+	m := s.S3.(*mockS3Client)
+
+	share := &dataset.Share{
+		ID:        "0d1c5b6e-7a3f-4c8e-9f21-6a1b2c3d4e5f",
+		AccountID: "111122223333",
+		Access:    dataset.ShareAccessRead,
+	}
+
+	if err := s.CreateShare(context.TODO(), "test", share); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if share.RoleArn != "" {
+		t.Errorf("expected no role arn without an external id, got %s", share.RoleArn)
+	}
+
+	sid := sharePolicySid(share.ID)
+	policy := testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 2 || policy.Statement[0].Sid != sid || policy.Statement[1].Sid != sid+"Objects" {
+		t.Fatalf("expected share statements, got %+v", policy.Statement)
+	}
+
+	if actions := policy.Statement[1].Action; len(actions) != 1 || actions[0] != "s3:GetObject" {
+		t.Errorf("expected read-only object actions, got %v", actions)
+	}
+
+	if principal := policy.Statement[0].Principal["AWS"]; len(principal) != 1 || principal[0] != "arn:aws:iam::111122223333:root" {
+		t.Errorf("expected account root principal, got %v", principal)
+	}
+
+	// write share with a cross-account role
+	writeShare := &dataset.Share{
+		ID:         "5f4e3d2c-1b6a-4e9f-8c3a-7e6b5c1d0d1c",
+		AccountID:  "111122223333",
+		Access:     dataset.ShareAccessWrite,
+		ExternalID: "secret",
+	}
+
+	if err := s.CreateShare(context.TODO(), "test", writeShare); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expectedRole := "arn:aws:iam::12345678901:role/test/shareRole_" + writeShare.ID
+	if writeShare.RoleArn != expectedRole {
+		t.Errorf("expected role arn %s, got %s", expectedRole, writeShare.RoleArn)
+	}
+
+	policy = testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 5 || policy.Statement[4].Sid != sharePolicySid(writeShare.ID)+"Deny" {
+		t.Fatalf("expected read and write share statements, got %+v", policy.Statement)
+	}
+
+	// removing a share keeps the others
+	if err := s.DeleteShare(context.TODO(), "test", writeShare); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	policy = testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 2 || policy.Statement[0].Sid != sid {
+		t.Errorf("expected only the read share statements, got %+v", policy.Statement)
+	}
+
+	// invalid input
+	for _, invalid := range []*dataset.Share{
+		nil,
+		{ID: share.ID, AccountID: "1111", Access: dataset.ShareAccessRead},
+		{ID: share.ID, AccountID: "111122223333", Access: "admin"},
+	} {
+		if err := s.CreateShare(context.TODO(), "test", invalid); err == nil {
+			t.Errorf("expected error for %+v, got nil", invalid)
+		}
+	}
+
+	// kms encrypted repositories require a role
+	m.objects["encryption:dataset-test"] = []byte("arn:aws:kms:us-east-1:123456789012:key/key-123")
+	if err := s.CreateShare(context.TODO(), "test", share); err == nil {
+		t.Error("expected error sharing kms encrypted repository without a role, got nil")
+	}
+	delete(m.objects, "encryption:dataset-test")
+
+	// role policy failure rolls back
+	s.IAM.(*mockIAMClient).err["PutRolePolicyWithContext"] = awserr.New("InternalError", "Internal Error", nil)
+	failed := &dataset.Share{ID: "9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d", AccountID: "111122223333", Access: dataset.ShareAccessRead, ExternalID: "secret"}
+	if err := s.CreateShare(context.TODO(), "test", failed); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	policy = testBucketPolicy(t, m, "dataset-test")
+	if len(policy.Statement) != 2 {
+		t.Errorf("expected bucket policy to be unchanged, got %+v", policy.Statement)
+	}
+}
+
+func TestDeleteShare(t *testing.T) {
+	s := newTestS3Repository(t)
+
+	share := &dataset.Share{
+		ID:        "0d1c5b6e-7a3f-4c8e-9f21-6a1b2c3d4e5f",
+		AccountID: "111122223333",
+		Access:    dataset.ShareAccessRead,
+		RoleArn:   "arn:aws:iam::12345678901:role/test/shareRole_0d1c5b6e-7a3f-4c8e-9f21-6a1b2c3d4e5f",
+	}
+
+	// deleted bucket and role are ignored
+	s.S3.(*mockS3Client).err["GetBucketPolicyWithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "not found", nil)
+	s.IAM.(*mockIAMClient).err["DeleteRoleWithContext"] = awserr.New(iam.ErrCodeNoSuchEntityException, "not found", nil)
+	if err := s.DeleteShare(context.TODO(), "test", share); err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
+	s.IAM.(*mockIAMClient).err["DeleteRolePolicyWithContext"] = awserr.New("InternalError", "Internal Error", nil)
+	if err := s.DeleteShare(context.TODO(), "test", share); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	if err := s.DeleteShare(context.TODO(), "", share); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+}
@@ -0,0 +1,63 @@
+package s3datarepository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// Tag adds tags to the bucket of a data repository.  Existing tags with the same keys are replaced, other
+// existing tags are kept.
+func (s *S3Repository) Tag(ctx context.Context, id string, tags []*dataset.Tag) error {
+	if id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
+	}
+
+	name := id
+	if s.NamePrefix != "" {
+		name = s.NamePrefix + "-" + name
+	}
+
+	log.WithContext(ctx).Infof("tagging s3datarepository: %s", name)
+
+	var tagSet []*s3.Tag
+	out, err := s.S3.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NoSuchTagSet" {
+			return ErrCode("failed to get tags for s3 bucket "+name, err)
+		}
+	} else {
+		tagSet = out.TagSet
+	}
+
+	for _, t := range tags {
+		replaced := false
+		for _, existing := range tagSet {
+			if aws.StringValue(existing.Key) == aws.StringValue(t.Key) {
+				existing.Value = t.Value
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			tagSet = append(tagSet, &s3.Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+
+	log.WithContext(ctx).Debugf("setting tags for bucket '%s': %+v", name, tagSet)
+
+	if _, err = s.S3.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(name),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	}); err != nil {
+		return ErrCode("failed to tag s3 bucket "+name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package s3datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+func (m *mockS3Client) GetBucketTaggingWithContext(ctx aws.Context, input *s3.GetBucketTaggingInput, opts ...request.Option) (*s3.GetBucketTaggingOutput, error) {
+	if err, ok := m.err["GetBucketTaggingWithContext"]; ok {
+		return nil, err
+	}
+
+	tagging, ok := m.objects["tagging:"+aws.StringValue(input.Bucket)]
+	if !ok {
+		return nil, awserr.New("NoSuchTagSet", "The TagSet does not exist", nil)
+	}
+
+	var tagSet []*s3.Tag
+	if err := json.Unmarshal(tagging, &tagSet); err != nil {
+		return nil, err
+	}
+
+	return &s3.GetBucketTaggingOutput{TagSet: tagSet}, nil
+}
+
+// testBucketTags returns the tags stored in the mock client as a map
+func testBucketTags(t *testing.T, m *mockS3Client, bucket string) map[string]string {
+	var tagSet []*s3.Tag
+	if err := json.Unmarshal(m.objects["tagging:"+bucket], &tagSet); err != nil {
+		t.Fatalf("failed to decode bucket tags for %s: %s", bucket, err)
+	}
+
+	tags := make(map[string]string, len(tagSet))
+	for _, tag := range tagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags
+}
+
+func TestTag(t *testing.T) {
+	s := S3Repository{
+		NamePrefix: "dataset",
+		S3:         newMockS3Client(t),
+	}
+	m := s.S3.(*mockS3Client)
+
+	// bucket without tags
+	if err := s.Tag(context.TODO(), "test", []*dataset.Tag{{Key: aws.String("Name"), Value: aws.String("foo")}}); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if tags := testBucketTags(t, m, "dataset-test"); !reflect.DeepEqual(tags, map[string]string{"Name": "foo"}) {
+		t.Errorf("expected Name tag, got %v", tags)
+	}
+
+	// existing tags are kept or replaced
+	if err := s.Tag(context.TODO(), "test", []*dataset.Tag{
+		{Key: aws.String("Project"), Value: aws.String("bar")},
+		{Key: aws.String("Name"), Value: aws.String("baz")},
+	}); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	expected := map[string]string{"Name": "baz", "Project": "bar"}
+	if tags := testBucketTags(t, m, "dataset-test"); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+
+	if err := s.Tag(context.TODO(), "", nil); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	m.err["GetBucketTaggingWithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "Not Found", nil)
+	err := s.Tag(context.TODO(), "test", []*dataset.Tag{{Key: aws.String("Name"), Value: aws.String("foo")}})
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected NotFound error, got %v", err)
+	}
+	delete(m.err, "GetBucketTaggingWithContext")
+
+	m.err["PutBucketTaggingWithContext"] = awserr.New("InternalError", "Internal Error", nil)
+	err = s.Tag(context.TODO(), "test", []*dataset.Tag{{Key: aws.String("Name"), Value: aws.String("foo")}})
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected ServiceUnavailable error, got %v", err)
+	}
+}
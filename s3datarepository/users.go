@@ -22,7 +22,7 @@ func (s *S3Repository) ListUsers(ctx context.Context, id string) (map[string]int
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("listing users of the s3datarepository %s", name)
+	log.WithContext(ctx).Infof("listing users of the s3datarepository %s", name)
 
 	groupName := fmt.Sprintf("%s-DsTmpGrp", name)
 	usersOutput, err := s.listGroupsUsers(ctx, groupName)
@@ -30,7 +30,7 @@ func (s *S3Repository) ListUsers(ctx context.Context, id string) (map[string]int
 		return nil, err
 	}
 
-	log.Debugf("got iam users response %+v", usersOutput)
+	log.WithContext(ctx).Debugf("got iam users response %+v", usersOutput)
 
 	output := make(map[string]interface{}, len(usersOutput))
 	for _, u := range usersOutput {
@@ -50,7 +50,7 @@ func (s *S3Repository) ListUsers(ctx context.Context, id string) (map[string]int
 		}{keys}
 	}
 
-	log.Debugf("returning map of users for dataset %s: %+v", id, output)
+	log.WithContext(ctx).Debugf("returning map of users for dataset %s: %+v", id, output)
 
 	return output, nil
 }
@@ -62,7 +62,7 @@ func (s *S3Repository) listGroupsUsers(ctx context.Context, groupName string) ([
 		return users, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group name"))
 	}
 
-	log.Infof("listing iam users for group %s", groupName)
+	log.WithContext(ctx).Infof("listing iam users for group %s", groupName)
 
 	input := &iam.GetGroupInput{GroupName: aws.String(groupName)}
 
@@ -98,20 +98,25 @@ func (s *S3Repository) CreateUser(ctx context.Context, id string) (interface{},
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("creating user of the s3datarepository %s", name)
+	log.WithContext(ctx).Infof("creating user of the s3datarepository %s", name)
 
-	policyDoc, err := s.temporaryAccessPolicy(name)
+	keyArn, err := s.kmsKeyArn(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	policyDoc, err := s.temporaryAccessPolicy(name, keyArn)
 	if err != nil {
 		return nil, ErrCode("generate temporary access policy for dataset "+id, err)
 	}
 
-	log.Debugf("generated temporary access policy document %s", string(policyDoc))
+	log.WithContext(ctx).Debugf("generated temporary access policy document %s", string(policyDoc))
 
 	// setup rollback function list and defer execution
 	var rollBackTasks []func() error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error creating user in s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error creating user in s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
@@ -140,7 +145,7 @@ func (s *S3Repository) CreateUser(ctx context.Context, id string) (interface{},
 		return nil, ErrCode("failed waiting for temporary access policy to exist for dataset "+id, err)
 	}
 
-	log.Debugf("got iam create policy response %+v", policyOutput)
+	log.WithContext(ctx).Debugf("got iam create policy response %+v", policyOutput)
 
 	groupName := name + "-DsTmpGrp"
 	groupOutput, err := s.IAM.CreateGroupWithContext(ctx, &iam.CreateGroupInput{
@@ -161,7 +166,7 @@ func (s *S3Repository) CreateUser(ctx context.Context, id string) (interface{},
 		}()
 	})
 
-	log.Debugf("got iam create group response %+v", groupOutput)
+	log.WithContext(ctx).Debugf("got iam create group response %+v", groupOutput)
 
 	if _, err = s.IAM.AttachGroupPolicyWithContext(ctx, &iam.AttachGroupPolicyInput{
 		GroupName: aws.String(groupName),
@@ -208,7 +213,7 @@ func (s *S3Repository) CreateUser(ctx context.Context, id string) (interface{},
 		return nil, ErrCode("failed waiting for user to exist for dataset "+id, err)
 	}
 
-	log.Debugf("got iam create user response %+v", userOutput)
+	log.WithContext(ctx).Debugf("got iam create user response %+v", userOutput)
 
 	keyOutput, err := s.IAM.CreateAccessKeyWithContext(ctx, &iam.CreateAccessKeyInput{
 		UserName: aws.String(userName),
@@ -237,7 +242,7 @@ func (s *S3Repository) CreateUser(ctx context.Context, id string) (interface{},
 		return nil, ErrCode("failed to add user to group for dataset "+id, err)
 	}
 
-	log.Debugf("added user %s to group %s", userName, groupName)
+	log.WithContext(ctx).Debugf("added user %s to group %s", userName, groupName)
 
 	output := struct {
 		Group       string            `json:"group"`
@@ -274,7 +279,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("deleting user of the s3datarepository %s", name)
+	log.WithContext(ctx).Infof("deleting user of the s3datarepository %s", name)
 
 	groupName := name + "-DsTmpGrp"
 	group, err := s.IAM.GetGroupWithContext(ctx, &iam.GetGroupInput{
@@ -284,7 +289,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 		return ErrCode("failed to get group for dataset "+id, err)
 	}
 
-	log.Debugf("found group '%s' %+v", groupName, group)
+	log.WithContext(ctx).Debugf("found group '%s' %+v", groupName, group)
 
 	groupPolicies, err := s.IAM.ListAttachedGroupPoliciesWithContext(ctx, &iam.ListAttachedGroupPoliciesInput{
 		GroupName:  aws.String(groupName),
@@ -294,11 +299,11 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 		return ErrCode("failed to list attached group policies for dataset "+id, err)
 	}
 
-	log.Debugf("found attached group policies for '%s' %+v", groupName, groupPolicies)
+	log.WithContext(ctx).Debugf("found attached group policies for '%s' %+v", groupName, groupPolicies)
 
 	policyName := name + "-DsTmpPlc"
 	for _, p := range groupPolicies.AttachedPolicies {
-		log.Debugf("detaching policy %s from group %s", aws.StringValue(p.PolicyName), groupName)
+		log.WithContext(ctx).Debugf("detaching policy %s from group %s", aws.StringValue(p.PolicyName), groupName)
 		if _, err := s.IAM.DetachGroupPolicyWithContext(ctx, &iam.DetachGroupPolicyInput{
 			GroupName: aws.String(groupName),
 			PolicyArn: p.PolicyArn,
@@ -307,7 +312,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 		}
 
 		if aws.StringValue(p.PolicyName) == policyName {
-			log.Debugf("deleting policy %s", policyName)
+			log.WithContext(ctx).Debugf("deleting policy %s", policyName)
 			if _, err := s.IAM.DeletePolicyWithContext(ctx, &iam.DeletePolicyInput{
 				PolicyArn: p.PolicyArn,
 			}); err != nil {
@@ -318,7 +323,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 
 	userName := name + "-DsTmpUsr"
 	for _, u := range group.Users {
-		log.Debugf("removing user %s from group %s", aws.StringValue(u.UserName), groupName)
+		log.WithContext(ctx).Debugf("removing user %s from group %s", aws.StringValue(u.UserName), groupName)
 		if _, err := s.IAM.RemoveUserFromGroupWithContext(ctx, &iam.RemoveUserFromGroupInput{
 			GroupName: aws.String(groupName),
 			UserName:  u.UserName,
@@ -335,7 +340,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 			}
 
 			for _, k := range keyOut.AccessKeyMetadata {
-				log.Debugf("deleting user %s access key %s (%s)", userName, aws.StringValue(k.AccessKeyId), aws.StringValue(k.Status))
+				log.WithContext(ctx).Debugf("deleting user %s access key %s (%s)", userName, aws.StringValue(k.AccessKeyId), aws.StringValue(k.Status))
 				if _, err := s.IAM.DeleteAccessKeyWithContext(ctx, &iam.DeleteAccessKeyInput{
 					AccessKeyId: k.AccessKeyId,
 					UserName:    aws.String(userName),
@@ -344,7 +349,7 @@ func (s *S3Repository) DeleteUser(ctx context.Context, id string) error {
 				}
 			}
 
-			log.Debugf("deleting user %s", userName)
+			log.WithContext(ctx).Debugf("deleting user %s", userName)
 			if _, err := s.IAM.DeleteUserWithContext(ctx, &iam.DeleteUserInput{
 				UserName: aws.String(userName),
 			}); err != nil {
@@ -380,7 +385,7 @@ func (s *S3Repository) UpdateUser(ctx context.Context, id string) (map[string]in
 		name = s.NamePrefix + "-" + name
 	}
 
-	log.Infof("updating user of the s3datarepository %s", name)
+	log.WithContext(ctx).Infof("updating user of the s3datarepository %s", name)
 
 	userName := name + "-DsTmpUsr"
 	keysOut, err := s.IAM.ListAccessKeysWithContext(ctx, &iam.ListAccessKeysInput{
@@ -390,13 +395,13 @@ func (s *S3Repository) UpdateUser(ctx context.Context, id string) (map[string]in
 		return nil, ErrCode("failed to list user access keys for dataset "+id, err)
 	}
 
-	log.Debugf("got user access keys output %+v", keysOut)
+	log.WithContext(ctx).Debugf("got user access keys output %+v", keysOut)
 
 	// setup rollback function list and defer execution
 	var rollBackTasks []func() error
 	defer func() {
 		if err != nil {
-			log.Errorf("recovering from error updating user in s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
+			log.WithContext(ctx).Errorf("recovering from error updating user in s3datarepository: %s, executing %d rollback tasks", err, len(rollBackTasks))
 			rollBack(&rollBackTasks)
 		}
 	}()
@@ -441,7 +446,7 @@ func (s *S3Repository) UpdateUser(ctx context.Context, id string) (map[string]in
 
 		keys[aws.StringValue(k.AccessKeyId)] = aws.StringValue(k.Status)
 		if aws.StringValue(k.Status) == "Active" {
-			log.Debugf("deactivating access key %s for dataset %s", aws.StringValue(k.AccessKeyId), id)
+			log.WithContext(ctx).Debugf("deactivating access key %s for dataset %s", aws.StringValue(k.AccessKeyId), id)
 			if _, err := s.IAM.UpdateAccessKeyWithContext(ctx, &iam.UpdateAccessKeyInput{
 				AccessKeyId: k.AccessKeyId,
 				Status:      aws.String("Inactive"),
@@ -0,0 +1,68 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	log "github.com/sirupsen/logrus"
+)
+
+// accessReportsPrefix is the prefix under each account where the access reports of datasets are stored.  Since
+// metadata objects are listed with a delimiter, access reports are never returned as dataset metadata.
+const accessReportsPrefix = "_accessreports/"
+
+// accessReportKey returns the key of the access report of a dataset
+func (s *S3Repository) accessReportKey(account, datasetID string) string {
+	return s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + accessReportsPrefix + datasetID
+}
+
+// PutAccessReport stores (or replaces) the access report of a dataset
+func (s *S3Repository) PutAccessReport(ctx context.Context, account string, report *dataset.AccessReport) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if report == nil || report.DatasetID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id"))
+	}
+
+	log.WithContext(ctx).Debugf("putting access report of dataset %s in account '%s'", report.DatasetID, account)
+
+	return s.putJSON(ctx, s.accessReportKey(account, report.DatasetID), report)
+}
+
+// GetAccessReport gets the access report of a dataset
+func (s *S3Repository) GetAccessReport(ctx context.Context, account, datasetID string) (*dataset.AccessReport, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id"))
+	}
+
+	report := &dataset.AccessReport{}
+	if err := s.getJSON(ctx, s.accessReportKey(account, datasetID), report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// DeleteAccessReport deletes the access report of a dataset
+func (s *S3Repository) DeleteAccessReport(ctx context.Context, account, datasetID string) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id"))
+	}
+
+	log.WithContext(ctx).Debugf("deleting access report of dataset %s in account '%s'", datasetID, account)
+
+	return s.deleteKey(ctx, s.accessReportKey(account, datasetID))
+}
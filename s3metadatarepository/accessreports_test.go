@@ -0,0 +1,73 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/pkg/errors"
+)
+
+func TestAccessReports(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	accessedAt := time.Now().UTC().Truncate(time.Second)
+
+	report := &dataset.AccessReport{
+		DatasetID: "abc",
+		Group:     "group1",
+		Principals: []*dataset.PrincipalAccess{
+			{Principal: "i-0123456789abcdef0", PrincipalType: dataset.AccessPrincipalInstance, Reads: 2, BytesRead: 150, FirstAccess: &accessedAt, LastAccess: &accessedAt},
+		},
+		UpdatedAt: &accessedAt,
+		LogCursor: "dataset/test/abc/2020-02-06-00-05-00-5A1B2C3D4E5F6A7B",
+	}
+
+	if err := s.PutAccessReport(context.TODO(), "acct", report); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_accessreports/abc"]; !ok {
+		t.Errorf("expected access report to be stored under _accessreports/, got %v", client.objects)
+	}
+
+	out, err := s.GetAccessReport(context.TODO(), "acct", "abc")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(out, report) {
+		t.Errorf("expected %+v, got %+v", report, out)
+	}
+
+	if err := s.DeleteAccessReport(context.TODO(), "acct", "abc"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	_, err = s.GetAccessReport(context.TODO(), "acct", "abc")
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error after delete, got %v", err)
+	}
+
+	// invalid input
+	if err := s.PutAccessReport(context.TODO(), "", report); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+
+	if err := s.PutAccessReport(context.TODO(), "acct", &dataset.AccessReport{}); err == nil {
+		t.Error("expected error for empty dataset id, got nil")
+	}
+
+	if _, err := s.GetAccessReport(context.TODO(), "acct", ""); err == nil {
+		t.Error("expected error for empty dataset id, got nil")
+	}
+
+	if err := s.DeleteAccessReport(context.TODO(), "", "abc"); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+}
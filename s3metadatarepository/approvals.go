@@ -0,0 +1,239 @@
+package s3metadatarepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// approvalsPrefix is the prefix under each account where approval requests are stored.  Since metadata
+// objects are listed with a delimiter, approvals are never returned as dataset metadata.
+const approvalsPrefix = "_approvals/"
+
+// approvalKey returns the key prefix for approvals of a dataset, or the key of an approval if id is given
+func (s *S3Repository) approvalKey(account, datasetID, id string) string {
+	key := s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + approvalsPrefix + datasetID + "/"
+	return key + id
+}
+
+// CreateApproval stores a new approval request for a dataset
+func (s *S3Repository) CreateApproval(ctx context.Context, account string, approval *dataset.Approval) (*dataset.Approval, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if approval == nil || approval.ID == "" || approval.DatasetID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty approval id or dataset id"))
+	}
+
+	log.WithContext(ctx).Debugf("creating approval %s for dataset %s in account '%s'", approval.ID, approval.DatasetID, account)
+
+	if err := s.putApproval(ctx, account, approval); err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// GetApproval gets an approval request for a dataset
+func (s *S3Repository) GetApproval(ctx context.Context, account, datasetID, id string) (*dataset.Approval, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" || id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty approval id or dataset id"))
+	}
+
+	log.WithContext(ctx).Debugf("getting approval %s for dataset %s in account '%s'", id, datasetID, account)
+
+	return s.getApproval(ctx, s.approvalKey(account, datasetID, id))
+}
+
+// ListApprovals lists all of the approval requests for a dataset, ordered by the time they were requested
+func (s *S3Repository) ListApprovals(ctx context.Context, account, datasetID string) ([]*dataset.Approval, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id"))
+	}
+
+	prefix := s.approvalKey(account, datasetID, "")
+
+	log.WithContext(ctx).Debugf("listing approvals for dataset %s in account '%s'", datasetID, account)
+
+	input := s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Bucket),
+		Delimiter: aws.String("/"),
+		Prefix:    aws.String(prefix),
+	}
+
+	approvals := []*dataset.Approval{}
+	truncated := true
+	for truncated {
+		out, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list approval objects in s3: "+prefix, err)
+		}
+
+		for _, o := range out.Contents {
+			key := aws.StringValue(o.Key)
+			if key == prefix {
+				continue
+			}
+
+			approval, err := s.getApproval(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			approvals = append(approvals, approval)
+		}
+
+		truncated = aws.BoolValue(out.IsTruncated)
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	sort.SliceStable(approvals, func(i, j int) bool {
+		a, b := approvals[i].RequestedAt, approvals[j].RequestedAt
+		if a == nil || b == nil {
+			return b != nil
+		}
+		return a.Before(*b)
+	})
+
+	return approvals, nil
+}
+
+// UpdateApproval replaces an existing approval request
+func (s *S3Repository) UpdateApproval(ctx context.Context, account string, approval *dataset.Approval) (*dataset.Approval, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if approval == nil || approval.ID == "" || approval.DatasetID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty approval id or dataset id"))
+	}
+
+	log.WithContext(ctx).Debugf("updating approval %s for dataset %s in account '%s'", approval.ID, approval.DatasetID, account)
+
+	// make sure the approval exists
+	if _, err := s.getApproval(ctx, s.approvalKey(account, approval.DatasetID, approval.ID)); err != nil {
+		return nil, err
+	}
+
+	if err := s.putApproval(ctx, account, approval); err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// DecideApproval replaces a pending approval request with its decision.  The approval is only replaced if it's
+// still pending and unchanged since it was read (with an If-Match condition on its ETag), so the same request can't be
+// decided twice, even by concurrent requests.
+func (s *S3Repository) DecideApproval(ctx context.Context, account string, approval *dataset.Approval) (*dataset.Approval, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if approval == nil || approval.ID == "" || approval.DatasetID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty approval id or dataset id"))
+	}
+
+	key := s.approvalKey(account, approval.DatasetID, approval.ID)
+
+	log.WithContext(ctx).Debugf("deciding approval %s for dataset %s in account '%s' (status: %s)", approval.ID, approval.DatasetID, account, approval.Status)
+
+	current, etag, err := s.getApprovalVersion(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Status != dataset.ApprovalStatusPending {
+		return nil, apierror.New(apierror.ErrConflict, "approval request is not pending: "+current.Status, nil)
+	}
+
+	j, err := json.MarshalIndent(approval, "", "\t")
+	if err != nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", err)
+	}
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(s.Bucket),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(key),
+	}, ifMatch(etag)); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "PreconditionFailed" || aerr.Code() == "ConditionalRequestConflict") {
+			return nil, apierror.New(apierror.ErrConflict, "approval request was decided concurrently", aerr)
+		}
+		return nil, ErrCode("failed to put s3 approval object: "+key, err)
+	}
+
+	return approval, nil
+}
+
+// ifMatch returns a request option making a put conditional on the ETag of the existing object
+func ifMatch(etag string) request.Option {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set("If-Match", etag)
+	}
+}
+
+func (s *S3Repository) putApproval(ctx context.Context, account string, approval *dataset.Approval) error {
+	key := s.approvalKey(account, approval.DatasetID, approval.ID)
+
+	j, err := json.MarshalIndent(approval, "", "\t")
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", err)
+	}
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(s.Bucket),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to put s3 approval object: "+key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Repository) getApproval(ctx context.Context, key string) (*dataset.Approval, error) {
+	approval, _, err := s.getApprovalVersion(ctx, key)
+	return approval, err
+}
+
+// getApprovalVersion gets an approval request and the ETag of its object
+func (s *S3Repository) getApprovalVersion(ctx context.Context, key string) (*dataset.Approval, string, error) {
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", ErrCode("failed to get approval object from s3: "+key, err)
+	}
+	defer out.Body.Close()
+
+	approval := &dataset.Approval{}
+	if err = json.NewDecoder(out.Body).Decode(approval); err != nil {
+		return nil, "", apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
+	}
+
+	return approval, aws.StringValue(out.ETag), nil
+}
@@ -0,0 +1,196 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+func TestApprovals(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	requestedAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := requestedAt.Add(72 * time.Hour)
+	earlier := requestedAt.Add(-1 * time.Hour)
+
+	first := &dataset.Approval{
+		ID:          "approval-2",
+		DatasetID:   "abc",
+		Action:      dataset.ApprovalActionDelete,
+		Status:      dataset.ApprovalStatusPending,
+		RequestedAt: &earlier,
+		RequestedBy: "requester",
+		ExpiresAt:   &expiresAt,
+	}
+
+	second := &dataset.Approval{
+		ID:          "approval-1",
+		DatasetID:   "abc",
+		Action:      dataset.ApprovalActionPromote,
+		Status:      dataset.ApprovalStatusPending,
+		RequestedAt: &requestedAt,
+		RequestedBy: "requester",
+		ExpiresAt:   &expiresAt,
+	}
+
+	for _, a := range []*dataset.Approval{first, second} {
+		if _, err := s.CreateApproval(context.TODO(), "acct", a); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_approvals/abc/approval-1"]; !ok {
+		t.Errorf("expected approval to be stored under _approvals/, got %v", client.objects)
+	}
+
+	out, err := s.GetApproval(context.TODO(), "acct", "abc", "approval-1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(out, second) {
+		t.Errorf("expected %+v, got %+v", second, out)
+	}
+
+	list, err := s.ListApprovals(context.TODO(), "acct", "abc")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(list) != 2 || list[0].ID != "approval-2" || list[1].ID != "approval-1" {
+		t.Errorf("expected approvals ordered by request time, got %+v", list)
+	}
+
+	second.Status = dataset.ApprovalStatusRejected
+	second.DecidedBy = "approver"
+	if _, err := s.UpdateApproval(context.TODO(), "acct", second); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	out, err = s.GetApproval(context.TODO(), "acct", "abc", "approval-1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if out.Status != dataset.ApprovalStatusRejected || out.DecidedBy != "approver" {
+		t.Errorf("expected updated approval, got %+v", out)
+	}
+
+	// test updating a missing approval
+	_, err = s.UpdateApproval(context.TODO(), "acct", &dataset.Approval{ID: "missing", DatasetID: "abc"})
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	// test invalid input
+	if _, err := s.CreateApproval(context.TODO(), "", first); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+
+	if _, err := s.GetApproval(context.TODO(), "acct", "abc", ""); err == nil {
+		t.Error("expected error for empty id, got nil")
+	}
+
+	// test s3 errors
+	client.err["PutObjectWithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "no such bucket", nil)
+	if _, err := s.CreateApproval(context.TODO(), "acct", first); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// racingS3Client changes an object after it's read, like a concurrent request would
+type racingS3Client struct {
+	*mockS3Client
+	race func(key string)
+}
+
+func (r *racingS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	out, err := r.mockS3Client.GetObjectWithContext(ctx, input, opts...)
+	if err == nil && r.race != nil {
+		r.race(aws.StringValue(input.Key))
+	}
+	return out, err
+}
+
+func TestDecideApproval(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	isConflict := func(err error) bool {
+		aerr, ok := errors.Cause(err).(apierror.Error)
+		return ok && aerr.Code == apierror.ErrConflict
+	}
+
+	approval := &dataset.Approval{ID: "approval-1", DatasetID: "abc", Action: dataset.ApprovalActionPromote, Status: dataset.ApprovalStatusPending, RequestedBy: "requester"}
+	if _, err := s.CreateApproval(context.TODO(), "acct", approval); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	decided := *approval
+	decided.Status = dataset.ApprovalStatusApproved
+	decided.DecidedBy = "approver"
+	if _, err := s.DecideApproval(context.TODO(), "acct", &decided); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	out, err := s.GetApproval(context.TODO(), "acct", "abc", "approval-1")
+	if err != nil || out.Status != dataset.ApprovalStatusApproved || out.DecidedBy != "approver" {
+		t.Errorf("expected approved approval, got %+v (%v)", out, err)
+	}
+
+	// test deciding an approval that isn't pending
+	again := *approval
+	again.Status = dataset.ApprovalStatusRejected
+	if _, err := s.DecideApproval(context.TODO(), "acct", &again); !isConflict(err) {
+		t.Errorf("expected conflict error deciding twice, got %v", err)
+	}
+
+	// test a concurrent decision between reading and replacing the approval
+	pending := &dataset.Approval{ID: "approval-2", DatasetID: "abc", Action: dataset.ApprovalActionDelete, Status: dataset.ApprovalStatusPending, RequestedBy: "requester"}
+	if _, err := s.CreateApproval(context.TODO(), "acct", pending); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	racing := &racingS3Client{mockS3Client: client}
+	racing.race = func(key string) {
+		other := *pending
+		other.Status = dataset.ApprovalStatusRejected
+		other.DecidedBy = "someoneelse"
+		client.objects[key], _ = json.Marshal(&other)
+	}
+	s.S3 = racing
+
+	decided = *pending
+	decided.Status = dataset.ApprovalStatusApproved
+	if _, err := s.DecideApproval(context.TODO(), "acct", &decided); !isConflict(err) {
+		t.Errorf("expected conflict error for concurrent decision, got %v", err)
+	}
+
+	s.S3 = client
+	if out, _ := s.GetApproval(context.TODO(), "acct", "abc", "approval-2"); out == nil || out.DecidedBy != "someoneelse" {
+		t.Errorf("expected the concurrent decision to be kept, got %+v", out)
+	}
+
+	// test deciding a missing approval
+	_, err = s.DecideApproval(context.TODO(), "acct", &dataset.Approval{ID: "missing", DatasetID: "abc"})
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	if _, err := s.DecideApproval(context.TODO(), "", &decided); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+}
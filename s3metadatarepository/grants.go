@@ -0,0 +1,142 @@
+package s3metadatarepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// grantsPrefix is the prefix under each account where expiring access grants are stored.  Since metadata
+// objects are listed with a delimiter, grants are never returned as dataset metadata.
+const grantsPrefix = "_grants/"
+
+// grantKey returns the key of the grant of an instance to a dataset
+func (s *S3Repository) grantKey(account, datasetID, instanceID string) string {
+	return s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + grantsPrefix + datasetID + "/" + instanceID
+}
+
+// PutGrant stores (or replaces) the expiring access grant of an instance to a dataset
+func (s *S3Repository) PutGrant(ctx context.Context, account string, grant *dataset.Grant) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if grant == nil || grant.DatasetID == "" || grant.InstanceID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id or instance id"))
+	}
+
+	key := s.grantKey(account, grant.DatasetID, grant.InstanceID)
+
+	log.WithContext(ctx).Debugf("putting grant for instance %s to dataset %s in account '%s'", grant.InstanceID, grant.DatasetID, account)
+
+	j, err := json.MarshalIndent(grant, "", "\t")
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", err)
+	}
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(s.Bucket),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to put s3 grant object: "+key, err)
+	}
+
+	return nil
+}
+
+// ListGrants lists the expiring access grants of all datasets in an account
+func (s *S3Repository) ListGrants(ctx context.Context, account string) ([]*dataset.Grant, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	prefix := s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + grantsPrefix
+
+	log.WithContext(ctx).Debugf("listing grants in account '%s'", account)
+
+	// grants are stored under a prefix per dataset, so they're listed without a delimiter
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	grants := []*dataset.Grant{}
+	truncated := true
+	for truncated {
+		out, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list grant objects in s3: "+prefix, err)
+		}
+
+		for _, o := range out.Contents {
+			key := aws.StringValue(o.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+
+			grant, err := s.getGrant(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			grants = append(grants, grant)
+		}
+
+		truncated = aws.BoolValue(out.IsTruncated)
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	return grants, nil
+}
+
+// DeleteGrant deletes the expiring access grant of an instance to a dataset
+func (s *S3Repository) DeleteGrant(ctx context.Context, account, datasetID, instanceID string) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" || instanceID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id or instance id"))
+	}
+
+	key := s.grantKey(account, datasetID, instanceID)
+
+	log.WithContext(ctx).Debugf("deleting grant for instance %s to dataset %s in account '%s'", instanceID, datasetID, account)
+
+	if _, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to delete s3 grant object: "+key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Repository) getGrant(ctx context.Context, key string) (*dataset.Grant, error) {
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get grant object from s3: "+key, err)
+	}
+	defer out.Body.Close()
+
+	grant := &dataset.Grant{}
+	if err = json.NewDecoder(out.Body).Decode(grant); err != nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
+	}
+
+	return grant, nil
+}
@@ -0,0 +1,74 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestGrants(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	grantedAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := grantedAt.Add(24 * time.Hour)
+
+	grants := []*dataset.Grant{
+		{DatasetID: "abc", Group: "group1", InstanceID: "i-1", GrantedAt: &grantedAt, GrantedBy: "awong", ExpiresAt: &expiresAt},
+		{DatasetID: "def", Group: "group1", InstanceID: "i-2", GrantedAt: &grantedAt, ExpiresAt: &expiresAt},
+	}
+
+	for _, g := range grants {
+		if err := s.PutGrant(context.TODO(), "acct", g); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_grants/abc/i-1"]; !ok {
+		t.Errorf("expected grant to be stored under _grants/, got %v", client.objects)
+	}
+
+	list, err := s.ListGrants(context.TODO(), "acct")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 grants, got %d", len(list))
+	}
+
+	for _, g := range list {
+		if g.InstanceID == "i-1" && !reflect.DeepEqual(g, grants[0]) {
+			t.Errorf("expected %+v, got %+v", grants[0], g)
+		}
+	}
+
+	if err := s.DeleteGrant(context.TODO(), "acct", "abc", "i-1"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if list, _ = s.ListGrants(context.TODO(), "acct"); len(list) != 1 || list[0].InstanceID != "i-2" {
+		t.Errorf("expected only grant for i-2 after delete, got %+v", list)
+	}
+
+	// test invalid input
+	if err := s.PutGrant(context.TODO(), "acct", &dataset.Grant{DatasetID: "abc"}); err == nil {
+		t.Error("expected error for empty instance id, got nil")
+	}
+
+	if _, err := s.ListGrants(context.TODO(), ""); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+
+	// test s3 errors
+	client.err["ListObjectsV2WithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "no such bucket", nil)
+	if _, err := s.ListGrants(context.TODO(), "acct"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
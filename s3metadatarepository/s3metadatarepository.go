@@ -95,6 +95,7 @@ func New(opts ...S3RepositoryOption) (*S3Repository, error) {
 	}
 
 	sess := session.Must(session.NewSession(s.config))
+	sess.Handlers.Build.PushBackNamed(dataset.RequestIDHandler)
 
 	s.S3 = s3.New(sess)
 	return &s, nil
@@ -162,7 +163,7 @@ func (s *S3Repository) Create(ctx context.Context, account, id string, metadata
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
-	log.Debugf("creating s3metadatarepository object in account '%s' with id '%s': %+v", account, id, metadata)
+	log.WithContext(ctx).Debugf("creating s3metadatarepository object in account '%s' with id '%s': %+v", account, id, metadata)
 
 	// set the created/modified time to right now
 	now := time.Now().UTC().Truncate(time.Second)
@@ -190,7 +191,7 @@ func (s *S3Repository) Create(ctx context.Context, account, id string, metadata
 		return nil, ErrCode("failed to put s3 metadata object: "+key, err)
 	}
 
-	log.Debugf("output from s3 metadata object put: %+v", out)
+	log.WithContext(ctx).Debugf("output from s3 metadata object put: %+v", out)
 
 	return metadata, nil
 }
@@ -205,7 +206,7 @@ func (s *S3Repository) Get(ctx context.Context, account, id string) (*dataset.Me
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
-	log.Debugf("getting s3metadatarepository object from account '%s' with id: %s", account, id)
+	log.WithContext(ctx).Debugf("getting s3metadatarepository object from account '%s' with id: %s", account, id)
 
 	key := s.Prefix + "/" + account
 	if !strings.HasSuffix(account, "/") && !strings.HasPrefix(id, "/") {
@@ -228,11 +229,71 @@ func (s *S3Repository) Get(ctx context.Context, account, id string) (*dataset.Me
 		return nil, apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
 	}
 
-	log.Debugf("output from getting s3 metadata '%s': %+v", key, metadata)
+	log.WithContext(ctx).Debugf("output from getting s3 metadata '%s': %+v", key, metadata)
 
 	return metadata, nil
 }
 
+// List gets all of the metadata objects in the repository for an account
+func (s *S3Repository) List(ctx context.Context, account string) ([]*dataset.Metadata, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	log.WithContext(ctx).Debugf("listing s3metadatarepository objects in account '%s'", account)
+
+	prefix := s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/"
+
+	// only list the objects directly under the account prefix
+	input := s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.Bucket),
+		Delimiter: aws.String("/"),
+		Prefix:    aws.String(prefix),
+	}
+
+	keys := []string{}
+	truncated := true
+	for truncated {
+		out, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list metadata objects in s3: "+prefix, err)
+		}
+
+		for _, o := range out.Contents {
+			if key := aws.StringValue(o.Key); key != prefix {
+				keys = append(keys, key)
+			}
+		}
+
+		truncated = aws.BoolValue(out.IsTruncated)
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	list := make([]*dataset.Metadata, 0, len(keys))
+	for _, key := range keys {
+		out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, ErrCode("failed to get metadata object from s3: "+key, err)
+		}
+
+		metadata := &dataset.Metadata{}
+		err = json.NewDecoder(out.Body).Decode(metadata)
+		out.Body.Close()
+		if err != nil {
+			return nil, apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
+		}
+
+		list = append(list, metadata)
+	}
+
+	log.WithContext(ctx).Debugf("listed %d metadata objects in account '%s'", len(list), account)
+
+	return list, nil
+}
+
 // Promote sets the finalized_at time and finalized_by user in the metadata object, as well as derivative=false
 func (s *S3Repository) Promote(ctx context.Context, account, id, user string) (*dataset.Metadata, error) {
 	if account == "" {
@@ -247,7 +308,7 @@ func (s *S3Repository) Promote(ctx context.Context, account, id, user string) (*
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty user"))
 	}
 
-	log.Infof("promoting s3metadatarepository '%s' in account '%s'", id, account)
+	log.WithContext(ctx).Infof("promoting s3metadatarepository '%s' in account '%s'", id, account)
 
 	key := s.Prefix + "/" + account
 	if !strings.HasSuffix(account, "/") && !strings.HasPrefix(id, "/") {
@@ -269,7 +330,7 @@ func (s *S3Repository) Promote(ctx context.Context, account, id, user string) (*
 		return nil, apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
 	}
 
-	log.Debugf("output from getting s3 metadata '%s': %+v", key, metadata)
+	log.WithContext(ctx).Debugf("output from getting s3 metadata '%s': %+v", key, metadata)
 
 	if metadata.FinalizedAt != nil {
 		return nil, apierror.New(apierror.ErrConflict, "dataset already finalized", nil)
@@ -312,7 +373,7 @@ func (s *S3Repository) Update(ctx context.Context, account, id string, metadata
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
-	log.Infof("updating s3metadatarepository object in account '%s' with id '%s': %+v", account, id, metadata)
+	log.WithContext(ctx).Infof("updating s3metadatarepository object in account '%s' with id '%s': %+v", account, id, metadata)
 
 	// set the modified time to right now
 	now := time.Now().UTC().Truncate(time.Second)
@@ -351,7 +412,7 @@ func (s *S3Repository) Delete(ctx context.Context, account, id string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty id"))
 	}
 
-	log.Infof("deleting s3metadatarepository object in account '%s' with id: %s", account, id)
+	log.WithContext(ctx).Infof("deleting s3metadatarepository object in account '%s' with id: %s", account, id)
 
 	key := s.Prefix + "/" + account
 	if !strings.HasSuffix(account, "/") && !strings.HasPrefix(id, "/") {
@@ -3,9 +3,11 @@ package s3metadatarepository
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
@@ -64,6 +66,7 @@ type mockS3Client struct {
 	t         *testing.T
 	err       map[string]error
 	headCount uint
+	objects   map[string][]byte
 }
 
 func newMockS3Client(t *testing.T) s3iface.S3API {
@@ -78,6 +81,11 @@ func (m *mockS3Client) DeleteObjectWithContext(ctx aws.Context, input *s3.Delete
 	if err, ok := m.err["DeleteObjectWithContext"]; ok {
 		return nil, err
 	}
+
+	if m.objects != nil {
+		delete(m.objects, aws.StringValue(input.Key))
+	}
+
 	return &s3.DeleteObjectOutput{}, nil
 }
 
@@ -86,6 +94,10 @@ func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObject
 		return nil, err
 	}
 
+	if body, ok := m.objects[aws.StringValue(input.Key)]; ok {
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(body)), ETag: aws.String(testETag(body))}, nil
+	}
+
 	for k, v := range testMetadata {
 		if strings.HasSuffix(aws.StringValue(input.Key), k) {
 			out, err := json.Marshal(v)
@@ -99,13 +111,85 @@ func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObject
 	return nil, awserr.New(s3.ErrCodeNoSuchKey, aws.StringValue(input.Key)+" not found", nil)
 }
 
+func (m *mockS3Client) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err, ok := m.err["ListObjectsV2WithContext"]; ok {
+		return nil, err
+	}
+
+	prefix := aws.StringValue(input.Prefix)
+	if m.objects != nil {
+		delimiter := aws.StringValue(input.Delimiter)
+		contents := []*s3.Object{}
+		for k := range m.objects {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+
+			if delimiter != "" && strings.Contains(strings.TrimPrefix(k, prefix), delimiter) {
+				continue
+			}
+
+			contents = append(contents, &s3.Object{Key: aws.String(k)})
+		}
+		return &s3.ListObjectsV2Output{Contents: contents, IsTruncated: aws.Bool(false)}, nil
+	}
+
+	if aws.StringValue(input.Delimiter) != "/" {
+		m.t.Errorf("expected delimiter /, got %s", aws.StringValue(input.Delimiter))
+	}
+
+	if input.ContinuationToken == nil {
+		return &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				&s3.Object{Key: aws.String(prefix)},
+				&s3.Object{Key: aws.String(prefix + "2D24607A-38DD-4E11-8A83-5F317ADA24F1")},
+			},
+			CommonPrefixes: []*s3.CommonPrefix{
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "_approvals/")},
+			},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page2"),
+		}, nil
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			&s3.Object{Key: aws.String(prefix + "8B7842E1-9032-4C8B-942E-B58FBA8E5744")},
+		},
+		IsTruncated: aws.Bool(false),
+	}, nil
+}
+
 func (m *mockS3Client) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
 	if err, ok := m.err["PutObjectWithContext"]; ok {
 		return nil, err
 	}
+
+	if m.objects != nil {
+		// conditional puts only replace the object if its ETag matches
+		r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+		r.ApplyOptions(opts...)
+		if etag := r.HTTPRequest.Header.Get("If-Match"); etag != "" {
+			if current, ok := m.objects[aws.StringValue(input.Key)]; !ok || testETag(current) != etag {
+				return nil, awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+			}
+		}
+
+		body, err := ioutil.ReadAll(input.Body)
+		if err != nil {
+			return nil, err
+		}
+		m.objects[aws.StringValue(input.Key)] = body
+	}
+
 	return &s3.PutObjectOutput{}, nil
 }
 
+// testETag returns the ETag of an object body in the mock S3 client
+func testETag(body []byte) string {
+	return fmt.Sprintf("\"%x\"", md5.Sum(body))
+}
+
 func TestNewDefaultRepository(t *testing.T) {
 	testConfig := map[string]interface{}{
 		"region":   "us-east-1",
@@ -610,3 +694,46 @@ func TestDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestList(t *testing.T) {
+	s := S3Repository{
+		S3:     newMockS3Client(t),
+		Bucket: "testBucket",
+		Prefix: "testPrefix",
+	}
+
+	out, err := s.List(context.TODO(), "testAccount")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("expected 2 metadata objects, got %d", len(out))
+	}
+
+	for i, id := range []string{"2D24607A-38DD-4E11-8A83-5F317ADA24F1", "8B7842E1-9032-4C8B-942E-B58FBA8E5744"} {
+		expected := testMetadata[id]
+		if !reflect.DeepEqual(out[i], &expected) {
+			t.Errorf("expected %+v, got %+v", expected, out[i])
+		}
+	}
+
+	// test empty account
+	_, err = s.List(context.TODO(), "")
+	if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected bad request error, got: %s", err)
+	}
+
+	// test list error
+	s.S3.(*mockS3Client).err["ListObjectsV2WithContext"] = awserr.New("AccessDenied", "denied", nil)
+	if _, err = s.List(context.TODO(), "testAccount"); err == nil {
+		t.Error("expected error, got nil")
+	}
+	delete(s.S3.(*mockS3Client).err, "ListObjectsV2WithContext")
+
+	// test get error
+	s.S3.(*mockS3Client).err["GetObjectWithContext"] = awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	if _, err = s.List(context.TODO(), "testAccount"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,159 @@
+package s3metadatarepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// sharesPrefix is the prefix under each account where cross-account shares are stored.  Since metadata
+// objects are listed with a delimiter, shares are never returned as dataset metadata.
+const sharesPrefix = "_shares/"
+
+// sharesKeyPrefix returns the key prefix of the shares of a dataset, or of all datasets if datasetID is empty
+func (s *S3Repository) sharesKeyPrefix(account, datasetID string) string {
+	prefix := s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + sharesPrefix
+	if datasetID != "" {
+		prefix = prefix + datasetID + "/"
+	}
+	return prefix
+}
+
+// PutShare stores (or replaces) a cross-account share of a dataset
+func (s *S3Repository) PutShare(ctx context.Context, account string, share *dataset.Share) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if share == nil || share.DatasetID == "" || share.ID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id or share id"))
+	}
+
+	key := s.sharesKeyPrefix(account, share.DatasetID) + share.ID
+
+	log.WithContext(ctx).Debugf("putting share %s of dataset %s in account '%s'", share.ID, share.DatasetID, account)
+
+	j, err := json.MarshalIndent(share, "", "\t")
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", err)
+	}
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(s.Bucket),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to put s3 share object: "+key, err)
+	}
+
+	return nil
+}
+
+// GetShare gets a cross-account share of a dataset
+func (s *S3Repository) GetShare(ctx context.Context, account, datasetID, id string) (*dataset.Share, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" || id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id or share id"))
+	}
+
+	return s.getShare(ctx, s.sharesKeyPrefix(account, datasetID)+id)
+}
+
+// ListShares lists the cross-account shares of a dataset, or of all datasets in the account if datasetID is empty
+func (s *S3Repository) ListShares(ctx context.Context, account, datasetID string) ([]*dataset.Share, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	prefix := s.sharesKeyPrefix(account, datasetID)
+
+	log.WithContext(ctx).Debugf("listing shares in account '%s' with prefix %s", account, prefix)
+
+	// shares are stored under a prefix per dataset, so they're listed without a delimiter
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	shares := []*dataset.Share{}
+	truncated := true
+	for truncated {
+		out, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list share objects in s3: "+prefix, err)
+		}
+
+		for _, o := range out.Contents {
+			key := aws.StringValue(o.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+
+			share, err := s.getShare(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			shares = append(shares, share)
+		}
+
+		truncated = aws.BoolValue(out.IsTruncated)
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	return shares, nil
+}
+
+// DeleteShare deletes a cross-account share of a dataset
+func (s *S3Repository) DeleteShare(ctx context.Context, account, datasetID, id string) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if datasetID == "" || id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty dataset id or share id"))
+	}
+
+	key := s.sharesKeyPrefix(account, datasetID) + id
+
+	log.WithContext(ctx).Debugf("deleting share %s of dataset %s in account '%s'", id, datasetID, account)
+
+	if _, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to delete s3 share object: "+key, err)
+	}
+
+	return nil
+}
+
+func (s *S3Repository) getShare(ctx context.Context, key string) (*dataset.Share, error) {
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to get share object from s3: "+key, err)
+	}
+	defer out.Body.Close()
+
+	share := &dataset.Share{}
+	if err = json.NewDecoder(out.Body).Decode(share); err != nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
+	}
+
+	return share, nil
+}
@@ -0,0 +1,86 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestShares(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	sharedAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := sharedAt.Add(24 * time.Hour)
+
+	shares := []*dataset.Share{
+		{ID: "s1", DatasetID: "abc", Group: "group1", AccountID: "012345678901", Access: dataset.ShareAccessRead, SharedAt: &sharedAt, SharedBy: "awong", ExpiresAt: &expiresAt},
+		{ID: "s2", DatasetID: "abc", Group: "group1", AccountID: "109876543210", Access: dataset.ShareAccessRead, RoleArn: "arn:aws:iam::12345678901:role/test/shareRole_s2", ExternalID: "xyz", SharedAt: &sharedAt},
+		{ID: "s3", DatasetID: "def", Group: "group1", AccountID: "012345678901", Access: dataset.ShareAccessWrite, SharedAt: &sharedAt},
+	}
+
+	for _, sh := range shares {
+		if err := s.PutShare(context.TODO(), "acct", sh); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_shares/abc/s1"]; !ok {
+		t.Errorf("expected share to be stored under _shares/, got %v", client.objects)
+	}
+
+	share, err := s.GetShare(context.TODO(), "acct", "abc", "s2")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(share, shares[1]) {
+		t.Errorf("expected %+v, got %+v", shares[1], share)
+	}
+
+	list, err := s.ListShares(context.TODO(), "acct", "abc")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(list) != 2 {
+		t.Errorf("expected 2 shares for dataset abc, got %d", len(list))
+	}
+
+	if list, _ = s.ListShares(context.TODO(), "acct", ""); len(list) != 3 {
+		t.Errorf("expected 3 shares in account, got %d", len(list))
+	}
+
+	if err := s.DeleteShare(context.TODO(), "acct", "abc", "s1"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if list, _ = s.ListShares(context.TODO(), "acct", "abc"); len(list) != 1 || list[0].ID != "s2" {
+		t.Errorf("expected only share s2 after delete, got %+v", list)
+	}
+
+	// test invalid input
+	if err := s.PutShare(context.TODO(), "acct", &dataset.Share{DatasetID: "abc"}); err == nil {
+		t.Error("expected error for empty share id, got nil")
+	}
+
+	if _, err := s.GetShare(context.TODO(), "acct", "", "s1"); err == nil {
+		t.Error("expected error for empty dataset id, got nil")
+	}
+
+	if _, err := s.ListShares(context.TODO(), "", "abc"); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+
+	// test s3 errors
+	client.err["ListObjectsV2WithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "no such bucket", nil)
+	if _, err := s.ListShares(context.TODO(), "acct", "abc"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
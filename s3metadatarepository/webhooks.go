@@ -0,0 +1,272 @@
+package s3metadatarepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhooksPrefix and deadLettersPrefix are the prefixes under each account where webhook subscriptions and
+// their undelivered events are stored.  Since metadata objects are listed with a delimiter, they're never
+// returned as dataset metadata.
+const (
+	webhooksPrefix    = "_webhooks/"
+	deadLettersPrefix = "_deadletters/"
+)
+
+// webhooksKeyPrefix returns the key prefix of the webhooks of a group
+func (s *S3Repository) webhooksKeyPrefix(account, group string) string {
+	return s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + webhooksPrefix + group + "/"
+}
+
+// deadLettersKeyPrefix returns the key prefix of the dead letters of a webhook
+func (s *S3Repository) deadLettersKeyPrefix(account, group, webhookID string) string {
+	return s.Prefix + "/" + strings.TrimSuffix(account, "/") + "/" + deadLettersPrefix + group + "/" + webhookID + "/"
+}
+
+// PutWebhook stores (or replaces) a webhook subscription of a group
+func (s *S3Repository) PutWebhook(ctx context.Context, account string, webhook *dataset.Webhook) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if webhook == nil || webhook.Group == "" || webhook.ID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group or webhook id"))
+	}
+
+	key := s.webhooksKeyPrefix(account, webhook.Group) + webhook.ID
+
+	log.WithContext(ctx).Debugf("putting webhook %s of group %s in account '%s'", webhook.ID, webhook.Group, account)
+
+	return s.putJSON(ctx, key, webhook)
+}
+
+// GetWebhook gets a webhook subscription of a group
+func (s *S3Repository) GetWebhook(ctx context.Context, account, group, id string) (*dataset.Webhook, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" || id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group or webhook id"))
+	}
+
+	webhook := &dataset.Webhook{}
+	if err := s.getJSON(ctx, s.webhooksKeyPrefix(account, group)+id, webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks lists the webhook subscriptions of a group
+func (s *S3Repository) ListWebhooks(ctx context.Context, account, group string) ([]*dataset.Webhook, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group"))
+	}
+
+	prefix := s.webhooksKeyPrefix(account, group)
+
+	log.WithContext(ctx).Debugf("listing webhooks in account '%s' with prefix %s", account, prefix)
+
+	keys, err := s.listKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*dataset.Webhook, 0, len(keys))
+	for _, key := range keys {
+		webhook := &dataset.Webhook{}
+		if err := s.getJSON(ctx, key, webhook); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook subscription of a group
+func (s *S3Repository) DeleteWebhook(ctx context.Context, account, group, id string) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" || id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group or webhook id"))
+	}
+
+	log.WithContext(ctx).Debugf("deleting webhook %s of group %s in account '%s'", id, group, account)
+
+	return s.deleteKey(ctx, s.webhooksKeyPrefix(account, group)+id)
+}
+
+// PutDeadLetter stores (or replaces) an event that couldn't be delivered to a webhook
+func (s *S3Repository) PutDeadLetter(ctx context.Context, account string, deadLetter *dataset.DeadLetter) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if deadLetter == nil || deadLetter.Group == "" || deadLetter.WebhookID == "" || deadLetter.ID == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group, webhook id or dead letter id"))
+	}
+
+	key := s.deadLettersKeyPrefix(account, deadLetter.Group, deadLetter.WebhookID) + deadLetter.ID
+
+	log.WithContext(ctx).Debugf("putting dead letter %s of webhook %s in account '%s'", deadLetter.ID, deadLetter.WebhookID, account)
+
+	return s.putJSON(ctx, key, deadLetter)
+}
+
+// GetDeadLetter gets an event that couldn't be delivered to a webhook
+func (s *S3Repository) GetDeadLetter(ctx context.Context, account, group, webhookID, id string) (*dataset.DeadLetter, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" || webhookID == "" || id == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group, webhook id or dead letter id"))
+	}
+
+	deadLetter := &dataset.DeadLetter{}
+	if err := s.getJSON(ctx, s.deadLettersKeyPrefix(account, group, webhookID)+id, deadLetter); err != nil {
+		return nil, err
+	}
+
+	return deadLetter, nil
+}
+
+// ListDeadLetters lists the events that couldn't be delivered to a webhook
+func (s *S3Repository) ListDeadLetters(ctx context.Context, account, group, webhookID string) ([]*dataset.DeadLetter, error) {
+	if account == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" || webhookID == "" {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group or webhook id"))
+	}
+
+	prefix := s.deadLettersKeyPrefix(account, group, webhookID)
+
+	log.WithContext(ctx).Debugf("listing dead letters in account '%s' with prefix %s", account, prefix)
+
+	keys, err := s.listKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := make([]*dataset.DeadLetter, 0, len(keys))
+	for _, key := range keys {
+		deadLetter := &dataset.DeadLetter{}
+		if err := s.getJSON(ctx, key, deadLetter); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, nil
+}
+
+// DeleteDeadLetter deletes an event that couldn't be delivered to a webhook
+func (s *S3Repository) DeleteDeadLetter(ctx context.Context, account, group, webhookID, id string) error {
+	if account == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty account"))
+	}
+
+	if group == "" || webhookID == "" || id == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", errors.New("empty group, webhook id or dead letter id"))
+	}
+
+	log.WithContext(ctx).Debugf("deleting dead letter %s of webhook %s in account '%s'", id, webhookID, account)
+
+	return s.deleteKey(ctx, s.deadLettersKeyPrefix(account, group, webhookID)+id)
+}
+
+// putJSON stores the json encoding of v in the object key
+func (s *S3Repository) putJSON(ctx context.Context, key string, v interface{}) error {
+	j, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", err)
+	}
+
+	if _, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:        bytes.NewReader(j),
+		Bucket:      aws.String(s.Bucket),
+		ContentType: aws.String("application/json"),
+		Key:         aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to put s3 object: "+key, err)
+	}
+
+	return nil
+}
+
+// getJSON decodes the json object key into v
+func (s *S3Repository) getJSON(ctx context.Context, key string, v interface{}) error {
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ErrCode("failed to get object from s3: "+key, err)
+	}
+	defer out.Body.Close()
+
+	if err = json.NewDecoder(out.Body).Decode(v); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to decode json from s3", err)
+	}
+
+	return nil
+}
+
+// listKeys lists the keys of the objects with the prefix, without a delimiter
+func (s *S3Repository) listKeys(ctx context.Context, prefix string) ([]string, error) {
+	input := s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	keys := []string{}
+	truncated := true
+	for truncated {
+		out, err := s.S3.ListObjectsV2WithContext(ctx, &input)
+		if err != nil {
+			return nil, ErrCode("failed to list objects in s3: "+prefix, err)
+		}
+
+		for _, o := range out.Contents {
+			if key := aws.StringValue(o.Key); !strings.HasSuffix(key, "/") {
+				keys = append(keys, key)
+			}
+		}
+
+		truncated = aws.BoolValue(out.IsTruncated)
+		input.ContinuationToken = out.NextContinuationToken
+	}
+
+	return keys, nil
+}
+
+// deleteKey deletes the object key
+func (s *S3Repository) deleteKey(ctx context.Context, key string) error {
+	if _, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return ErrCode("failed to delete s3 object: "+key, err)
+	}
+
+	return nil
+}
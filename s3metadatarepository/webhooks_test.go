@@ -0,0 +1,127 @@
+package s3metadatarepository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestWebhooks(t *testing.T) {
+	client := newMockS3Client(t).(*mockS3Client)
+	client.objects = map[string][]byte{}
+	s := S3Repository{S3: client, Bucket: "testBucket", Prefix: "dataset/test"}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+
+	webhooks := []*dataset.Webhook{
+		{ID: "w1", Group: "group1", URL: "https://example.com/hook", Secret: "s3cr3t", CreatedAt: &createdAt, CreatedBy: "awong"},
+		{ID: "w2", Group: "group1", URL: "https://example.org/hook", Events: []string{dataset.EventDatasetCreated}, Secret: "t0ps3cr3t", CreatedAt: &createdAt},
+		{ID: "w3", Group: "group2", URL: "https://example.net/hook", CreatedAt: &createdAt},
+	}
+
+	for _, w := range webhooks {
+		if err := s.PutWebhook(context.TODO(), "acct", w); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_webhooks/group1/w1"]; !ok {
+		t.Errorf("expected webhook to be stored under _webhooks/, got %v", client.objects)
+	}
+
+	webhook, err := s.GetWebhook(context.TODO(), "acct", "group1", "w2")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(webhook, webhooks[1]) {
+		t.Errorf("expected %+v, got %+v", webhooks[1], webhook)
+	}
+
+	list, err := s.ListWebhooks(context.TODO(), "acct", "group1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(list) != 2 {
+		t.Errorf("expected 2 webhooks for group1, got %d", len(list))
+	}
+
+	if err := s.DeleteWebhook(context.TODO(), "acct", "group1", "w1"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if list, _ = s.ListWebhooks(context.TODO(), "acct", "group1"); len(list) != 1 || list[0].ID != "w2" {
+		t.Errorf("expected only webhook w2 after delete, got %+v", list)
+	}
+
+	// test dead letters
+	event := dataset.NewEvent(context.TODO(), dataset.EventDatasetCreated, "acct", "group1", "abc", "awong", nil)
+	deadLetters := []*dataset.DeadLetter{
+		{ID: "d1", WebhookID: "w2", Group: "group1", Event: event, Attempts: 5, Error: "unexpected status 500", FailedAt: &createdAt},
+		{ID: "d2", WebhookID: "w2", Group: "group1", Event: event, Attempts: 1, Error: "unexpected status 404", FailedAt: &createdAt},
+	}
+
+	for _, d := range deadLetters {
+		if err := s.PutDeadLetter(context.TODO(), "acct", d); err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+	}
+
+	if _, ok := client.objects["dataset/test/acct/_deadletters/group1/w2/d1"]; !ok {
+		t.Errorf("expected dead letter to be stored under _deadletters/, got %v", client.objects)
+	}
+
+	deadLetter, err := s.GetDeadLetter(context.TODO(), "acct", "group1", "w2", "d1")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if !reflect.DeepEqual(deadLetter, deadLetters[0]) {
+		t.Errorf("expected %+v, got %+v", deadLetters[0], deadLetter)
+	}
+
+	if dl, _ := s.ListDeadLetters(context.TODO(), "acct", "group1", "w2"); len(dl) != 2 {
+		t.Errorf("expected 2 dead letters, got %d", len(dl))
+	}
+
+	if err := s.DeleteDeadLetter(context.TODO(), "acct", "group1", "w2", "d1"); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if dl, _ := s.ListDeadLetters(context.TODO(), "acct", "group1", "w2"); len(dl) != 1 || dl[0].ID != "d2" {
+		t.Errorf("expected only dead letter d2 after delete, got %+v", dl)
+	}
+
+	// test invalid input
+	if err := s.PutWebhook(context.TODO(), "acct", &dataset.Webhook{Group: "group1"}); err == nil {
+		t.Error("expected error for empty webhook id, got nil")
+	}
+
+	if _, err := s.GetWebhook(context.TODO(), "acct", "", "w1"); err == nil {
+		t.Error("expected error for empty group, got nil")
+	}
+
+	if _, err := s.ListWebhooks(context.TODO(), "", "group1"); err == nil {
+		t.Error("expected error for empty account, got nil")
+	}
+
+	if err := s.PutDeadLetter(context.TODO(), "acct", &dataset.DeadLetter{ID: "d3", Group: "group1"}); err == nil {
+		t.Error("expected error for empty webhook id, got nil")
+	}
+
+	// test s3 errors
+	if _, err := s.GetWebhook(context.TODO(), "acct", "group1", "w1"); err == nil {
+		t.Error("expected error for deleted webhook, got nil")
+	}
+
+	client.err["ListObjectsV2WithContext"] = awserr.New(s3.ErrCodeNoSuchBucket, "no such bucket", nil)
+	if _, err := s.ListWebhooks(context.TODO(), "acct", "group1"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
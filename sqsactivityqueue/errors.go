@@ -0,0 +1,79 @@
+package sqsactivityqueue
+
+import (
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+)
+
+func ErrCode(msg string, err error) error {
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		switch aerr.Code() {
+		case
+			"AccessDenied",
+
+			// The most likely cause is an invalid AWS access key ID or secret key.
+			"InvalidClientTokenId",
+
+			// ErrCodeKmsAccessDenied for service response error code
+			// "KmsAccessDenied".
+			//
+			// The caller doesn't have the required KMS access.
+			sqs.ErrCodeKmsAccessDenied:
+
+			return apierror.New(apierror.ErrForbidden, msg, aerr)
+		case
+
+			// ErrCodeQueueDoesNotExist for service response error code
+			// "QueueDoesNotExist".
+			//
+			// The specified queue doesn't exist.
+			sqs.ErrCodeQueueDoesNotExist,
+
+			// The query protocol error code of a missing queue
+			"AWS.SimpleQueueService.NonExistentQueue":
+
+			return apierror.New(apierror.ErrNotFound, msg, aerr)
+		case
+
+			// ErrCodeOverLimit for service response error code
+			// "OverLimit".
+			//
+			// The specified action violates a limit. For example, ReceiveMessage returns
+			// this error if the maximum number of in flight messages is reached and AddPermission
+			// returns this error if the maximum number of permissions for the queue is
+			// reached.
+			sqs.ErrCodeOverLimit,
+
+			// ErrCodeRequestThrottled for service response error code
+			// "RequestThrottled".
+			//
+			// The request was denied due to request throttling.
+			sqs.ErrCodeRequestThrottled,
+
+			"ThrottlingException":
+
+			return apierror.New(apierror.ErrLimitExceeded, msg, aerr)
+		case
+
+			// ErrCodeReceiptHandleIsInvalid for service response error code
+			// "ReceiptHandleIsInvalid".
+			//
+			// The specified receipt handle isn't valid.
+			sqs.ErrCodeReceiptHandleIsInvalid:
+
+			return apierror.New(apierror.ErrBadRequest, msg, aerr)
+		case
+			"InternalFailure",
+			"ServiceUnavailable":
+
+			return apierror.New(apierror.ErrServiceUnavailable, msg, aerr)
+		default:
+			m := msg + ": " + aerr.Message()
+			return apierror.New(apierror.ErrBadRequest, m, aerr)
+		}
+	}
+
+	return apierror.New(apierror.ErrInternalError, msg, err)
+}
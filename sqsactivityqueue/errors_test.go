@@ -0,0 +1,48 @@
+package sqsactivityqueue
+
+import (
+	"testing"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/pkg/errors"
+)
+
+func TestErrCode(t *testing.T) {
+	apiErrorTestCases := map[string]string{
+		"": apierror.ErrBadRequest,
+
+		"AccessDenied":             apierror.ErrForbidden,
+		"InvalidClientTokenId":     apierror.ErrForbidden,
+		sqs.ErrCodeKmsAccessDenied: apierror.ErrForbidden,
+
+		sqs.ErrCodeQueueDoesNotExist:              apierror.ErrNotFound,
+		"AWS.SimpleQueueService.NonExistentQueue": apierror.ErrNotFound,
+
+		sqs.ErrCodeOverLimit:        apierror.ErrLimitExceeded,
+		sqs.ErrCodeRequestThrottled: apierror.ErrLimitExceeded,
+		"ThrottlingException":       apierror.ErrLimitExceeded,
+
+		sqs.ErrCodeReceiptHandleIsInvalid: apierror.ErrBadRequest,
+
+		"InternalFailure":    apierror.ErrServiceUnavailable,
+		"ServiceUnavailable": apierror.ErrServiceUnavailable,
+	}
+
+	for awsErr, apiErr := range apiErrorTestCases {
+		err := ErrCode("test error", awserr.New(awsErr, awsErr, nil))
+		if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+			if aerr.Code != apiErr {
+				t.Errorf("expected sqs error %s to be an apierror.Error %s, got %s", awsErr, apiErr, aerr.Code)
+			}
+		} else {
+			t.Errorf("expected sqs error %s to be an apierror.Error %s, got %s", awsErr, apiErr, err)
+		}
+	}
+
+	err := ErrCode("test error", errors.New("Unknown"))
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrInternalError {
+		t.Errorf("expected unknown error to be an apierror.ErrInternalError, got %s", err)
+	}
+}
@@ -0,0 +1,294 @@
+// Package sqsactivityqueue receives the object activity in data repositories from an Amazon SQS queue, as S3 event
+// notifications.  The data repositories send their notifications to the queue when they're provisioned, see
+// s3datarepository.WithActivityQueue.
+package sqsactivityqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultWaitTime is how long a receive waits for messages, in seconds.  20 seconds is the maximum for long polling.
+const DefaultWaitTime = 20
+
+// maxMessages is the maximum number of messages returned by a receive
+const maxMessages = 10
+
+// SQSActivityQueueOption is a function to set queue options
+type SQSActivityQueueOption func(*SQSActivityQueue)
+
+// SQSActivityQueue is an implementation of an activity queue in SQS
+type SQSActivityQueue struct {
+	QueueArn string
+	WaitTime int64
+	SQS      sqsiface.SQSAPI
+	config   *aws.Config
+	queueURL string
+	urlMux   sync.Mutex
+}
+
+// s3Event is an S3 event notification, as sent to SQS.  Test events don't have any records.
+type s3Event struct {
+	Event   string `json:"Event"`
+	Records []struct {
+		EventName    string    `json:"eventName"`
+		EventTime    time.Time `json:"eventTime"`
+		UserIdentity struct {
+			PrincipalID string `json:"principalId"`
+		} `json:"userIdentity"`
+		RequestParameters struct {
+			SourceIPAddress string `json:"sourceIPAddress"`
+		} `json:"requestParameters"`
+		S3 struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// NewDefaultQueue creates a new activity queue from the default config data.  The queue is the ARN of the queue in
+// the account config activityQueueArn.
+func NewDefaultQueue(config map[string]interface{}) (*SQSActivityQueue, error) {
+	var akid, secret, token, region, endpoint, queueArn string
+	if v, ok := config["akid"].(string); ok {
+		akid = v
+	}
+
+	if v, ok := config["secret"].(string); ok {
+		secret = v
+	}
+
+	if v, ok := config["token"].(string); ok {
+		token = v
+	}
+
+	if v, ok := config["region"].(string); ok {
+		region = v
+	}
+
+	if v, ok := config["endpoint"].(string); ok {
+		endpoint = v
+	}
+
+	if v, ok := config["activityQueueArn"].(string); ok {
+		queueArn = v
+	}
+
+	if !arn.IsARN(queueArn) {
+		return nil, fmt.Errorf("invalid activityQueueArn '%s' for the sqs activity queue", queueArn)
+	}
+
+	opts := []SQSActivityQueueOption{
+		WithStaticCredentials(akid, secret, token),
+		WithQueueArn(queueArn),
+	}
+
+	if region != "" {
+		opts = append(opts, WithRegion(region))
+	}
+
+	if endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint))
+	}
+
+	return New(opts...)
+}
+
+// New creates an SQSActivityQueue from a list of SQSActivityQueueOption functions
+func New(opts ...SQSActivityQueueOption) (*SQSActivityQueue, error) {
+	log.Info("creating new sqs activity queue")
+
+	q := SQSActivityQueue{WaitTime: DefaultWaitTime}
+	q.config = aws.NewConfig()
+
+	for _, opt := range opts {
+		opt(&q)
+	}
+
+	sess := session.Must(session.NewSession(q.config))
+	sess.Handlers.Build.PushBackNamed(dataset.RequestIDHandler)
+
+	q.SQS = sqs.New(sess)
+
+	return &q, nil
+}
+
+// WithStaticCredentials authenticates with AWS static credentials (key, secret, token)
+func WithStaticCredentials(akid, secret, token string) SQSActivityQueueOption {
+	return func(q *SQSActivityQueue) {
+		log.Debugf("setting static credentials with akid %s", akid)
+		q.config.WithCredentials(credentials.NewStaticCredentials(akid, secret, token))
+	}
+}
+
+// WithRegion sets the region for the SQSActivityQueue
+func WithRegion(region string) SQSActivityQueueOption {
+	return func(q *SQSActivityQueue) {
+		log.Debugf("setting region %s", region)
+		q.config.WithRegion(region)
+	}
+}
+
+// WithEndpoint sets the endpoint for the SQSActivityQueue
+func WithEndpoint(endpoint string) SQSActivityQueueOption {
+	return func(q *SQSActivityQueue) {
+		log.Debugf("setting endpoint %s", endpoint)
+		q.config.WithEndpoint(endpoint)
+	}
+}
+
+// WithQueueArn sets the ARN of the queue the activity is received from
+func WithQueueArn(queueArn string) SQSActivityQueueOption {
+	return func(q *SQSActivityQueue) {
+		log.Debugf("setting activity queue %s", queueArn)
+		q.QueueArn = queueArn
+	}
+}
+
+// url returns the url of the queue, which is looked up by the name and owner in the queue ARN the first time
+func (q *SQSActivityQueue) url(ctx context.Context) (string, error) {
+	q.urlMux.Lock()
+	defer q.urlMux.Unlock()
+
+	if q.queueURL != "" {
+		return q.queueURL, nil
+	}
+
+	a, err := arn.Parse(q.QueueArn)
+	if err != nil {
+		return "", apierror.New(apierror.ErrBadRequest, "invalid activity queue arn "+q.QueueArn, err)
+	}
+
+	out, err := q.SQS.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{
+		QueueName:              aws.String(a.Resource),
+		QueueOwnerAWSAccountId: aws.String(a.AccountID),
+	})
+	if err != nil {
+		return "", ErrCode("failed to get url of sqs queue "+q.QueueArn, err)
+	}
+
+	q.queueURL = aws.StringValue(out.QueueUrl)
+	return q.queueURL, nil
+}
+
+// Receive waits for messages on the queue and returns the object activity they report.  Messages that aren't S3
+// event notifications are skipped, they're received again until the queue moves them to its dead-letter queue.
+func (q *SQSActivityQueue) Receive(ctx context.Context) ([]*dataset.ActivityMessage, error) {
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := q.SQS.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: aws.Int64(maxMessages),
+		WaitTimeSeconds:     aws.Int64(q.WaitTime),
+	})
+	if err != nil {
+		return nil, ErrCode("failed to receive messages from sqs queue "+q.QueueArn, err)
+	}
+
+	messages := make([]*dataset.ActivityMessage, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		message, err := activityMessage(m)
+		if err != nil {
+			log.WithContext(ctx).Errorf("skipping invalid message %s from sqs queue %s: %s", aws.StringValue(m.MessageId), q.QueueArn, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	log.WithContext(ctx).Debugf("received %d messages from sqs queue %s", len(messages), q.QueueArn)
+
+	return messages, nil
+}
+
+// Delete deletes a message from the queue, once its activity has been recorded
+func (q *SQSActivityQueue) Delete(ctx context.Context, message *dataset.ActivityMessage) error {
+	if message == nil || message.ReceiptHandle == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", fmt.Errorf("empty message or receipt handle"))
+	}
+
+	queueURL, err := q.url(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = q.SQS.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: aws.String(message.ReceiptHandle),
+	}); err != nil {
+		return ErrCode("failed to delete message "+message.ID+" from sqs queue "+q.QueueArn, err)
+	}
+
+	return nil
+}
+
+// activityMessage decodes the S3 event notification in an SQS message
+func activityMessage(m *sqs.Message) (*dataset.ActivityMessage, error) {
+	event := s3Event{}
+	if err := json.Unmarshal([]byte(aws.StringValue(m.Body)), &event); err != nil {
+		return nil, err
+	}
+
+	if event.Records == nil && event.Event == "" {
+		return nil, fmt.Errorf("not an s3 event notification")
+	}
+
+	message := &dataset.ActivityMessage{
+		ID:            aws.StringValue(m.MessageId),
+		ReceiptHandle: aws.StringValue(m.ReceiptHandle),
+		Activity:      make([]*dataset.ObjectActivity, 0, len(event.Records)),
+	}
+
+	for _, r := range event.Records {
+		var action string
+		switch {
+		case strings.HasPrefix(r.EventName, "ObjectCreated:"):
+			action = dataset.ObjectCreated
+		case strings.HasPrefix(r.EventName, "ObjectRemoved:"):
+			action = dataset.ObjectDeleted
+		default:
+			continue
+		}
+
+		// object keys in event notifications are url encoded
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			key = r.S3.Object.Key
+		}
+
+		message.Activity = append(message.Activity, &dataset.ObjectActivity{
+			Repository: r.S3.Bucket.Name,
+			Key:        key,
+			Action:     action,
+			EventName:  r.EventName,
+			Size:       r.S3.Object.Size,
+			Principal:  r.UserIdentity.PrincipalID,
+			SourceIP:   r.RequestParameters.SourceIPAddress,
+			Time:       r.EventTime,
+		})
+	}
+
+	return message, nil
+}
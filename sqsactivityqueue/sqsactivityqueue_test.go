@@ -0,0 +1,233 @@
+package sqsactivityqueue
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/pkg/errors"
+)
+
+var testQueueArn = "arn:aws:sqs:us-east-1:012345678901:dsapi-activity"
+var testQueueURL = "https://sqs.us-east-1.amazonaws.com/012345678901/dsapi-activity"
+
+type mockSQSClient struct {
+	sqsiface.SQSAPI
+	t        *testing.T
+	err      map[string]error
+	messages []*sqs.Message
+	deleted  []string
+	lookups  int
+}
+
+func newMockSQSClient(t *testing.T) *mockSQSClient {
+	return &mockSQSClient{
+		t:   t,
+		err: make(map[string]error),
+	}
+}
+
+func (m *mockSQSClient) GetQueueUrlWithContext(ctx context.Context, input *sqs.GetQueueUrlInput, opts ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	if err, ok := m.err["GetQueueUrlWithContext"]; ok {
+		return nil, err
+	}
+
+	m.lookups++
+
+	if aws.StringValue(input.QueueName) != "dsapi-activity" || aws.StringValue(input.QueueOwnerAWSAccountId) != "012345678901" {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist.", nil)
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(testQueueURL)}, nil
+}
+
+func (m *mockSQSClient) ReceiveMessageWithContext(ctx context.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	if err, ok := m.err["ReceiveMessageWithContext"]; ok {
+		return nil, err
+	}
+
+	if aws.StringValue(input.QueueUrl) != testQueueURL {
+		m.t.Errorf("expected queue url %s, got %s", testQueueURL, aws.StringValue(input.QueueUrl))
+	}
+
+	messages := m.messages
+	m.messages = nil
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (m *mockSQSClient) DeleteMessageWithContext(ctx context.Context, input *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	if err, ok := m.err["DeleteMessageWithContext"]; ok {
+		return nil, err
+	}
+
+	m.deleted = append(m.deleted, aws.StringValue(input.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestNewDefaultQueue(t *testing.T) {
+	testConfig := map[string]interface{}{
+		"region":           "us-east-1",
+		"akid":             "xxxxx",
+		"secret":           "yyyyy",
+		"endpoint":         "https://under.mydesk.amazonaws.com",
+		"activityQueueArn": testQueueArn,
+	}
+
+	q, err := NewDefaultQueue(testConfig)
+	if err != nil {
+		t.Errorf("expected nil error, got: %s", err)
+	}
+
+	to := reflect.TypeOf(q).String()
+	if to != "*sqsactivityqueue.SQSActivityQueue" {
+		t.Errorf("expected type to be '*sqsactivityqueue.SQSActivityQueue', got %s", to)
+	}
+
+	if q.config.Credentials == nil {
+		t.Error("expected config Credentials to be set, got nil")
+	}
+
+	if q.QueueArn != testQueueArn {
+		t.Errorf("expected queue arn %s, got %s", testQueueArn, q.QueueArn)
+	}
+
+	if q.WaitTime != DefaultWaitTime {
+		t.Errorf("expected wait time %d, got %d", DefaultWaitTime, q.WaitTime)
+	}
+
+	testConfig["activityQueueArn"] = "dsapi-activity"
+	if _, err = NewDefaultQueue(testConfig); err == nil {
+		t.Error("expected error for invalid activityQueueArn, got nil")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	client := newMockSQSClient(t)
+	q := SQSActivityQueue{QueueArn: testQueueArn, SQS: client}
+
+	client.messages = []*sqs.Message{
+		{
+			MessageId:     aws.String("m1"),
+			ReceiptHandle: aws.String("r1"),
+			Body: aws.String(`{"Records":[
+				{"eventName":"ObjectCreated:Put","eventTime":"2023-11-01T12:00:00.123Z","userIdentity":{"principalId":"AWS:AROAEXAMPLE:i-0123456789abcdef0"},"requestParameters":{"sourceIPAddress":"10.1.2.3"},"s3":{"bucket":{"name":"dataset-org-abc"},"object":{"key":"raw/my+file%281%29.csv","size":42}}},
+				{"eventName":"ObjectRemoved:Delete","eventTime":"2023-11-01T12:01:00.000Z","userIdentity":{"principalId":"AWS:AIDAEXAMPLE"},"requestParameters":{"sourceIPAddress":"10.1.2.4"},"s3":{"bucket":{"name":"dataset-org-abc"},"object":{"key":"old.csv"}}},
+				{"eventName":"ObjectRestore:Completed","eventTime":"2023-11-01T12:02:00.000Z","s3":{"bucket":{"name":"dataset-org-abc"},"object":{"key":"archived.csv"}}}
+			]}`),
+		},
+		{
+			MessageId:     aws.String("m2"),
+			ReceiptHandle: aws.String("r2"),
+			Body:          aws.String(`{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2023-11-01T11:59:00.000Z","Bucket":"dataset-org-abc"}`),
+		},
+		{
+			MessageId:     aws.String("m3"),
+			ReceiptHandle: aws.String("r3"),
+			Body:          aws.String(`not json`),
+		},
+	}
+
+	messages, err := q.Receive(context.TODO())
+	if err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	created, _ := time.Parse(time.RFC3339, "2023-11-01T12:00:00.123Z")
+	deleted, _ := time.Parse(time.RFC3339, "2023-11-01T12:01:00Z")
+	expected := []*dataset.ActivityMessage{
+		{
+			ID:            "m1",
+			ReceiptHandle: "r1",
+			Activity: []*dataset.ObjectActivity{
+				{
+					Repository: "dataset-org-abc",
+					Key:        "raw/my file(1).csv",
+					Action:     dataset.ObjectCreated,
+					EventName:  "ObjectCreated:Put",
+					Size:       42,
+					Principal:  "AWS:AROAEXAMPLE:i-0123456789abcdef0",
+					SourceIP:   "10.1.2.3",
+					Time:       created,
+				},
+				{
+					Repository: "dataset-org-abc",
+					Key:        "old.csv",
+					Action:     dataset.ObjectDeleted,
+					EventName:  "ObjectRemoved:Delete",
+					Principal:  "AWS:AIDAEXAMPLE",
+					SourceIP:   "10.1.2.4",
+					Time:       deleted,
+				},
+			},
+		},
+		{
+			ID:            "m2",
+			ReceiptHandle: "r2",
+			Activity:      []*dataset.ObjectActivity{},
+		},
+	}
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected messages %+v, got %+v", expected, messages)
+		for i, m := range messages {
+			t.Logf("message %d: %+v", i, m)
+			for _, a := range m.Activity {
+				t.Logf("  activity: %+v", a)
+			}
+		}
+	}
+
+	// the queue url is only looked up once
+	if _, err = q.Receive(context.TODO()); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if client.lookups != 1 {
+		t.Errorf("expected 1 queue url lookup, got %d", client.lookups)
+	}
+
+	// test receive error
+	client.err["ReceiveMessageWithContext"] = awserr.New(sqs.ErrCodeOverLimit, "too many messages in flight", nil)
+	_, err = q.Receive(context.TODO())
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrLimitExceeded {
+		t.Errorf("expected %s error, got %v", apierror.ErrLimitExceeded, err)
+	}
+
+	// test missing queue
+	missing := SQSActivityQueue{QueueArn: "arn:aws:sqs:us-east-1:012345678901:missing", SQS: newMockSQSClient(t)}
+	_, err = missing.Receive(context.TODO())
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrNotFound {
+		t.Errorf("expected %s error, got %v", apierror.ErrNotFound, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	client := newMockSQSClient(t)
+	q := SQSActivityQueue{QueueArn: testQueueArn, SQS: client}
+
+	if err := q.Delete(context.TODO(), &dataset.ActivityMessage{ID: "m1", ReceiptHandle: "r1"}); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(client.deleted, []string{"r1"}) {
+		t.Errorf("expected r1 to be deleted, got %v", client.deleted)
+	}
+
+	if err := q.Delete(context.TODO(), &dataset.ActivityMessage{ID: "m2"}); err == nil {
+		t.Error("expected error for message without receipt handle, got nil")
+	}
+
+	client.err["DeleteMessageWithContext"] = awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, "invalid receipt handle", nil)
+	err := q.Delete(context.TODO(), &dataset.ActivityMessage{ID: "m3", ReceiptHandle: "r3"})
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+		t.Errorf("expected %s error, got %v", apierror.ErrBadRequest, err)
+	}
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+)
+
+// ErrForbiddenAddress is returned when a webhook resolves to an address events can't be delivered to
+var ErrForbiddenAddress = errors.New("webhooks can't be delivered to private, loopback or link-local addresses")
+
+// ErrRedirect is returned when a webhook responds with a redirect, redirects aren't followed
+var ErrRedirect = errors.New("webhooks can't redirect")
+
+// forbiddenIP returns true for addresses that aren't reachable from the internet, ie. the loopback interface,
+// private networks and the link-local instance metadata service
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified()
+}
+
+// lookupIP resolves the addresses of a host, it's replaced in tests
+var lookupIP = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// CheckURL checks that a webhook URL is an absolute https URL, or http if allowHTTP is set, and that its host
+// only resolves to public addresses.  The addresses are checked again when events are delivered, since they
+// can change.
+func CheckURL(ctx context.Context, rawURL string, allowHTTP bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && (u.Scheme != "http" || !allowHTTP)) {
+		msg := "invalid url " + rawURL + ", it must be an absolute https url"
+		if allowHTTP {
+			msg = "invalid url " + rawURL + ", it must be an absolute http(s) url"
+		}
+		return apierror.New(apierror.ErrBadRequest, msg, err)
+	}
+
+	host := u.Hostname()
+	addrs, err := lookupIP(ctx, host)
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to resolve webhook host "+host, err)
+	}
+
+	for _, a := range addrs {
+		if forbiddenIP(a.IP) {
+			msg := fmt.Sprintf("invalid url %s, host %s resolves to %s", rawURL, host, a.IP)
+			return apierror.New(apierror.ErrBadRequest, msg, ErrForbiddenAddress)
+		}
+	}
+
+	return nil
+}
+
+// newHTTPClient returns the default http client to deliver events.  It doesn't use a proxy, refuses to connect
+// to forbidden addresses and doesn't follow redirects.
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       10 * time.Second,
+		Transport:     transport,
+		CheckRedirect: refuseRedirect,
+	}
+}
+
+// dialControl checks the resolved address right before connecting, so a webhook host can't be changed to resolve
+// to a forbidden address after it was registered
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("dial %s: %w", address, ErrForbiddenAddress)
+	}
+
+	return nil
+}
+
+// refuseRedirect fails requests that are redirected, so a webhook can't redirect deliveries to a forbidden address
+func refuseRedirect(req *http.Request, via []*http.Request) error {
+	return ErrRedirect
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signaturePrefix is the prefix of the X-DS-Signature header, it names the hash used for the HMAC
+const signaturePrefix = "sha256="
+
+// Sign returns the value of the X-DS-Signature header of an event delivery: the hex encoded HMAC-SHA256 of the
+// timestamp (unix seconds, as sent in the X-DS-Timestamp header), a dot and the body, keyed with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the X-DS-Signature and X-DS-Timestamp headers of a received event against the body and the webhook
+// secret.  Deliveries with a timestamp older (or newer) than the tolerance are rejected, to prevent replays.  A
+// tolerance of 0 skips the timestamp check.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return errors.New("missing or unsupported signature")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+
+	if tolerance > 0 {
+		if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+			return errors.New("timestamp outside of tolerance")
+		}
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
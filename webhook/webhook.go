@@ -0,0 +1,263 @@
+// Package webhook delivers dataset lifecycle events to the HTTP endpoints subscribed to them.  Events are POSTed
+// as JSON, signed with the secret of the webhook, and retried with an exponential backoff.  Events that can't be
+// delivered are stored as dead letters, so they can be inspected and redelivered.  Events are only delivered to
+// public addresses, and redirects aren't followed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRetries is the default number of times a failed delivery is retried before it's stored as a dead letter
+const DefaultRetries = 5
+
+// DefaultRetryWait is the default time to wait before the first retry, it's doubled for every following retry
+const DefaultRetryWait = 5 * time.Second
+
+// DefaultQueueSize is the default number of events and retries that can be waiting for a worker
+const DefaultQueueSize = 1000
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-DS-Event"
+	EventIDHeader   = "X-DS-Event-ID"
+	TimestampHeader = "X-DS-Timestamp"
+	SignatureHeader = "X-DS-Signature"
+)
+
+// Dispatcher delivers the events of an account to the webhooks of the group of the dataset
+type Dispatcher struct {
+	account    string
+	repo       dataset.WebhookRepository
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+	queue      chan *delivery
+	wg         sync.WaitGroup
+}
+
+// delivery is an event waiting in the queue.  Without a webhook, the event is delivered to all of the webhooks
+// subscribed to it, otherwise it's another attempt to deliver it to the webhook.
+type delivery struct {
+	webhook *dataset.Webhook
+	event   *dataset.Event
+	attempt int
+}
+
+// Option is a function to set dispatcher options
+type Option func(*Dispatcher)
+
+// New creates a new dispatcher for the account, using the repository to look up webhooks and store dead letters,
+// with the provided Option functions
+func New(account string, repo dataset.WebhookRepository, opts ...Option) *Dispatcher {
+	d := Dispatcher{
+		account:    account,
+		repo:       repo,
+		httpClient: newHTTPClient(),
+		retries:    DefaultRetries,
+		retryWait:  DefaultRetryWait,
+		queue:      make(chan *delivery, DefaultQueueSize),
+	}
+
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	return &d
+}
+
+// WithHTTPClient sets the http client used to deliver events, replacing the default client that refuses to
+// connect to private, loopback and link-local addresses and doesn't follow redirects
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.httpClient = httpClient
+	}
+}
+
+// WithRetries sets the number of times a failed delivery is retried and the time to wait before the first retry
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.retries = retries
+		d.retryWait = wait
+	}
+}
+
+// WithQueueSize sets the number of events and retries that can be waiting for a worker
+func WithQueueSize(size int) Option {
+	return func(d *Dispatcher) {
+		d.queue = make(chan *delivery, size)
+	}
+}
+
+// Publish queues an event for delivery, it doesn't wait for the event to be delivered.  An error is returned if
+// the queue is full.
+func (d *Dispatcher) Publish(ctx context.Context, event *dataset.Event) error {
+	if event == nil || event.Group == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", fmt.Errorf("empty event or group"))
+	}
+
+	select {
+	case d.queue <- &delivery{event: event}:
+		return nil
+	default:
+		return apierror.New(apierror.ErrLimitExceeded, "webhook queue is full, dropping event "+event.ID, nil)
+	}
+}
+
+// Run starts the workers delivering queued events and blocks until the context is cancelled.  Pending retries are
+// dropped when the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	log.Infof("starting %d webhook workers for account '%s'", workers, d.account)
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case dl := <-d.queue:
+					d.process(ctx, dl)
+				}
+			}
+		}()
+	}
+
+	d.wg.Wait()
+}
+
+// process delivers a queued event to the webhooks subscribed to it, or retries the delivery to a webhook
+func (d *Dispatcher) process(ctx context.Context, dl *delivery) {
+	ctx = dataset.NewRequestIDContext(ctx, dl.event.RequestID)
+
+	if dl.webhook != nil {
+		d.attempt(ctx, dl.webhook, dl.event, dl.attempt)
+		return
+	}
+
+	webhooks, err := d.repo.ListWebhooks(ctx, d.account, dl.event.Group)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to list webhooks of group %s in account '%s', dropping event %s: %s", dl.event.Group, d.account, dl.event.ID, err)
+		return
+	}
+
+	for _, w := range webhooks {
+		if w.Subscribed(dl.event.Type) {
+			d.attempt(ctx, w, dl.event, 1)
+		}
+	}
+}
+
+// attempt tries to deliver the event to the webhook.  Failed attempts are queued again after the backoff, until
+// the retries are exhausted or the webhook rejects the event, then the event is stored as a dead letter.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *dataset.Webhook, event *dataset.Event, attempt int) {
+	retry, err := d.send(ctx, webhook, event)
+	if err == nil {
+		log.WithContext(ctx).Debugf("delivered event %s to webhook %s (attempt %d)", event.ID, webhook.ID, attempt)
+		return
+	}
+
+	if retry && attempt <= d.retries {
+		wait := d.retryWait << (attempt - 1)
+		log.WithContext(ctx).Warnf("failed to deliver event %s to webhook %s (attempt %d), retrying in %s: %s", event.ID, webhook.ID, attempt, wait, err)
+
+		time.AfterFunc(wait, func() {
+			select {
+			case <-ctx.Done():
+			case d.queue <- &delivery{webhook: webhook, event: event, attempt: attempt + 1}:
+			}
+		})
+		return
+	}
+
+	log.WithContext(ctx).Errorf("failed to deliver event %s to webhook %s after %d attempts, storing dead letter: %s", event.ID, webhook.ID, attempt, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := d.repo.PutDeadLetter(ctx, d.account, &dataset.DeadLetter{
+		ID:        uuid.New().String(),
+		WebhookID: webhook.ID,
+		Group:     webhook.Group,
+		Event:     event,
+		Attempts:  attempt,
+		Error:     err.Error(),
+		FailedAt:  &now,
+	}); err != nil {
+		log.WithContext(ctx).Errorf("failed to store dead letter of event %s for webhook %s: %s", event.ID, webhook.ID, err)
+	}
+}
+
+// Deliver makes a single attempt to deliver the event to the webhook, ie. to redeliver a dead letter
+func (d *Dispatcher) Deliver(ctx context.Context, webhook *dataset.Webhook, event *dataset.Event) error {
+	_, err := d.send(ctx, webhook, event)
+	return err
+}
+
+// send POSTs the signed event to the webhook and returns whether a failed delivery can be retried.  Network errors,
+// timeouts, rate limits and server errors are retried, other responses, redirects and forbidden addresses mean the
+// webhook rejected the event.
+func (d *Dispatcher) send(ctx context.Context, webhook *dataset.Webhook, event *dataset.Event) (bool, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return false, apierror.New(apierror.ErrBadRequest, "failed to encode event", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, apierror.New(apierror.ErrBadRequest, "failed to create webhook request", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ds-api-webhook")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(EventIDHeader, event.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	if event.RequestID != "" {
+		req.Header.Set("X-Request-ID", event.RequestID)
+	}
+
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrRedirect) || errors.Is(err, ErrForbiddenAddress) {
+			return false, apierror.New(apierror.ErrServiceUnavailable, "failed to deliver event to webhook "+webhook.ID, err)
+		}
+		return ctx.Err() == nil, apierror.New(apierror.ErrServiceUnavailable, "failed to deliver event to webhook "+webhook.ID, err)
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = apierror.New(apierror.ErrServiceUnavailable, "failed to deliver event to webhook "+webhook.ID, fmt.Errorf("POST %s returned %d", webhook.URL, res.StatusCode))
+
+	switch {
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return true, err
+	}
+	return false, err
+}
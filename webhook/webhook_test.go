@@ -0,0 +1,450 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/ds-api/apierror"
+	"github.com/YaleSpinup/ds-api/dataset"
+)
+
+// mockWebhookRepository is a fake webhook repository, stored dead letters are also sent to the put channel
+// (if it's set), so tests can wait for them
+type mockWebhookRepository struct {
+	dataset.WebhookRepository
+	mu          sync.Mutex
+	webhooks    []*dataset.Webhook
+	deadLetters []*dataset.DeadLetter
+	put         chan *dataset.DeadLetter
+}
+
+func (m *mockWebhookRepository) ListWebhooks(ctx context.Context, account, group string) ([]*dataset.Webhook, error) {
+	out := []*dataset.Webhook{}
+	for _, w := range m.webhooks {
+		if w.Group == group {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockWebhookRepository) PutDeadLetter(ctx context.Context, account string, deadLetter *dataset.DeadLetter) error {
+	m.mu.Lock()
+	m.deadLetters = append(m.deadLetters, deadLetter)
+	m.mu.Unlock()
+
+	if m.put != nil {
+		m.put <- deadLetter
+	}
+	return nil
+}
+
+func (m *mockWebhookRepository) deadLetterCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.deadLetters)
+}
+
+// receiver is a local webhook endpoint that verifies the signature of the events it receives, and responds with
+// the next status of the list (or 200 once the list is exhausted)
+type receiver struct {
+	mu       sync.Mutex
+	t        *testing.T
+	secret   string
+	statuses []int
+	attempts int
+	events   chan *dataset.Event
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{t: t, secret: secret, statuses: statuses, events: make(chan *dataset.Event, 10)}
+	return r, httptest.NewServer(r)
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if err := Verify(r.secret, req.Header.Get(SignatureHeader), req.Header.Get(TimestampHeader), body, time.Minute); err != nil {
+		r.t.Errorf("expected valid signature, got %s", err)
+	}
+
+	event := &dataset.Event{}
+	if err := json.Unmarshal(body, event); err != nil {
+		r.t.Errorf("expected json event, got %s", err)
+	}
+
+	if req.Header.Get(EventHeader) != event.Type || req.Header.Get(EventIDHeader) != event.ID {
+		r.t.Errorf("expected event headers to match the event, got %v", req.Header)
+	}
+
+	r.mu.Lock()
+	status := http.StatusOK
+	if r.attempts < len(r.statuses) {
+		status = r.statuses[r.attempts]
+	}
+	r.attempts++
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+	if status < 300 {
+		r.events <- event
+	}
+}
+
+func (r *receiver) attemptCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts
+}
+
+// localClient delivers events to the local test receivers, the default client refuses loopback addresses
+var localClient = WithHTTPClient(&http.Client{Timeout: 5 * time.Second, CheckRedirect: refuseRedirect})
+
+// waitForEvent waits for the receiver to accept an event
+func waitForEvent(t *testing.T, r *receiver) *dataset.Event {
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return nil
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+	now := time.Now().Unix()
+	sig := Sign("s3cr3t", now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp int64
+		body      []byte
+		tolerance time.Duration
+		valid     bool
+	}{
+		{"valid", "s3cr3t", sig, now, body, time.Minute, true},
+		{"wrong secret", "other", sig, now, body, time.Minute, false},
+		{"modified body", "s3cr3t", sig, now, []byte(`{"id":"e2"}`), time.Minute, false},
+		{"missing signature", "s3cr3t", "", now, body, time.Minute, false},
+		{"old timestamp", "s3cr3t", Sign("s3cr3t", now-3600, body), now - 3600, body, time.Minute, false},
+		{"different timestamp", "s3cr3t", sig, now - 1, body, 0, false},
+		{"old timestamp without tolerance", "s3cr3t", Sign("s3cr3t", now-3600, body), now - 3600, body, 0, true},
+	}
+
+	for _, tc := range tests {
+		err := Verify(tc.secret, tc.signature, strconv.FormatInt(tc.timestamp, 10), tc.body, tc.tolerance)
+		if tc.valid && err != nil {
+			t.Errorf("%s: expected nil error, got %s", tc.name, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	rcv, ts := newReceiver(t, "s3cr3t")
+	defer ts.Close()
+
+	other, ots := newReceiver(t, "0th3r")
+	defer ots.Close()
+
+	repo := &mockWebhookRepository{
+		webhooks: []*dataset.Webhook{
+			{ID: "w1", Group: "group1", URL: ts.URL, Secret: "s3cr3t"},
+			{ID: "w2", Group: "group1", URL: ots.URL, Events: []string{dataset.EventDatasetDeleted}, Secret: "0th3r"},
+			{ID: "w3", Group: "group2", URL: ots.URL, Secret: "0th3r"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a single worker delivers the events in order
+	d := New("acct", repo, WithRetries(0, time.Millisecond), localClient)
+	go d.Run(ctx, 1)
+
+	ctx = dataset.NewRequestIDContext(ctx, "req-1")
+	event := dataset.NewEvent(ctx, dataset.EventDatasetCreated, "acct", "group1", "abc", "awong", map[string]interface{}{"name": "test"})
+	if err := d.Publish(ctx, event); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if got := waitForEvent(t, rcv); got.ID != event.ID || got.DatasetID != "abc" || got.RequestID != "req-1" || got.Data["name"] != "test" {
+		t.Errorf("expected %+v, got %+v", event, got)
+	}
+
+	// w2 isn't subscribed to dataset.created and w3 belongs to another group, so once the dataset.deleted event
+	// was delivered to w2, it's the only delivery to the other receiver
+	deleted := dataset.NewEvent(ctx, dataset.EventDatasetDeleted, "acct", "group1", "abc", "awong", nil)
+	if err := d.Publish(ctx, deleted); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if got := waitForEvent(t, other); got.ID != deleted.ID {
+		t.Errorf("expected %+v, got %+v", deleted, got)
+	}
+
+	if got := waitForEvent(t, rcv); got.ID != deleted.ID {
+		t.Errorf("expected %+v, got %+v", deleted, got)
+	}
+
+	if n := other.attemptCount(); n != 1 {
+		t.Errorf("expected a single delivery to the subscribed webhook of the group, got %d", n)
+	}
+
+	if err := d.Publish(ctx, &dataset.Event{ID: "e1"}); err == nil {
+		t.Error("expected error for event without group, got nil")
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	rcv, ts := newReceiver(t, "s3cr3t", http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer ts.Close()
+
+	repo := &mockWebhookRepository{webhooks: []*dataset.Webhook{{ID: "w1", Group: "group1", URL: ts.URL, Secret: "s3cr3t"}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New("acct", repo, WithRetries(3, time.Millisecond), localClient)
+	go d.Run(ctx, 1)
+
+	if err := d.Publish(ctx, dataset.NewEvent(ctx, dataset.EventAccessGranted, "acct", "group1", "abc", "", nil)); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	waitForEvent(t, rcv)
+
+	if n := rcv.attemptCount(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+
+	if n := repo.deadLetterCount(); n != 0 {
+		t.Errorf("expected no dead letters, got %d", n)
+	}
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	failing, fts := newReceiver(t, "s3cr3t", 500, 500, 500, 500)
+	defer fts.Close()
+
+	rejecting, rts := newReceiver(t, "s3cr3t", http.StatusGone, http.StatusGone)
+	defer rts.Close()
+
+	repo := &mockWebhookRepository{
+		webhooks: []*dataset.Webhook{
+			{ID: "failing", Group: "group1", URL: fts.URL, Secret: "s3cr3t"},
+			{ID: "rejecting", Group: "group1", URL: rts.URL, Secret: "s3cr3t"},
+		},
+		put: make(chan *dataset.DeadLetter, 2),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New("acct", repo, WithRetries(2, time.Millisecond), localClient)
+	go d.Run(ctx, 2)
+
+	event := dataset.NewEvent(ctx, dataset.EventDatasetDeleted, "acct", "group1", "abc", "awong", nil)
+	if err := d.Publish(ctx, event); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	attempts := map[string]int{}
+	for len(attempts) < 2 {
+		select {
+		case dl := <-repo.put:
+			if dl.Event.ID != event.ID || dl.Group != "group1" || dl.Error == "" || dl.FailedAt == nil {
+				t.Errorf("unexpected dead letter %+v", dl)
+			}
+			attempts[dl.WebhookID] = dl.Attempts
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for dead letters, got %v", attempts)
+		}
+	}
+
+	// failed deliveries are retried, rejected deliveries aren't
+	if attempts["failing"] != 3 || failing.attemptCount() != 3 {
+		t.Errorf("expected 3 attempts to the failing webhook, got %d (received %d)", attempts["failing"], failing.attemptCount())
+	}
+
+	if attempts["rejecting"] != 1 || rejecting.attemptCount() != 1 {
+		t.Errorf("expected 1 attempt to the rejecting webhook, got %d (received %d)", attempts["rejecting"], rejecting.attemptCount())
+	}
+
+	// redelivering a dead letter is a single attempt, that can succeed once the webhook accepts the event
+	if err := d.Deliver(ctx, repo.webhooks[1], event); err == nil {
+		t.Error("expected error redelivering rejected event, got nil")
+	}
+
+	if err := d.Deliver(ctx, repo.webhooks[1], event); err != nil {
+		t.Errorf("expected nil error on redelivery, got %s", err)
+	}
+
+	if got := waitForEvent(t, rejecting); got.ID != event.ID {
+		t.Errorf("expected redelivered event %s, got %+v", event.ID, got)
+	}
+
+	if n := repo.deadLetterCount(); n != 2 {
+		t.Errorf("expected redelivery not to store dead letters, got %d", n)
+	}
+}
+
+func TestPublishQueueFull(t *testing.T) {
+	d := New("acct", &mockWebhookRepository{}, WithQueueSize(1))
+
+	event := dataset.NewEvent(context.TODO(), dataset.EventDatasetCreated, "acct", "group1", "abc", "", nil)
+	if err := d.Publish(context.TODO(), event); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if err := d.Publish(context.TODO(), event); err == nil {
+		t.Error("expected error when the queue is full, got nil")
+	}
+}
+
+func TestDispatcherForbiddenAddresses(t *testing.T) {
+	rcv, ts := newReceiver(t, "s3cr3t")
+	defer ts.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(ts.URL, http.StatusFound))
+	defer redirect.Close()
+
+	repo := &mockWebhookRepository{put: make(chan *dataset.DeadLetter, 1)}
+
+	// the default client refuses to connect to the loopback receiver, and the delivery isn't retried
+	d := New("acct", repo, WithRetries(3, time.Millisecond))
+	event := dataset.NewEvent(context.TODO(), dataset.EventDatasetCreated, "acct", "group1", "abc", "", nil)
+
+	d.attempt(context.TODO(), &dataset.Webhook{ID: "w1", Group: "group1", URL: ts.URL, Secret: "s3cr3t"}, event, 1)
+
+	select {
+	case dl := <-repo.put:
+		if dl.Attempts != 1 || !strings.Contains(dl.Error, ErrForbiddenAddress.Error()) {
+			t.Errorf("expected dead letter for forbidden address after 1 attempt, got %+v", dl)
+		}
+	default:
+		t.Fatal("expected dead letter for forbidden address")
+	}
+
+	if n := rcv.attemptCount(); n != 0 {
+		t.Errorf("expected no deliveries to the loopback receiver, got %d", n)
+	}
+
+	// redirects aren't followed
+	d = New("acct", repo, localClient)
+	err := d.Deliver(context.TODO(), &dataset.Webhook{ID: "w2", Group: "group1", URL: redirect.URL, Secret: "s3cr3t"}, event)
+	if !errors.Is(err, ErrRedirect) {
+		t.Errorf("expected redirect error, got %v", err)
+	}
+
+	if n := rcv.attemptCount(); n != 0 {
+		t.Errorf("expected redirect not to be followed, got %d deliveries", n)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	lookup := lookupIP
+	defer func() { lookupIP = lookup }()
+
+	hosts := map[string][]string{
+		"hooks.example.com":    {"93.184.216.34"},
+		"internal.example.com": {"93.184.216.34", "10.0.1.5"},
+		"metadata.example.com": {"169.254.169.254"},
+	}
+	lookupIP = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			return []net.IPAddr{{IP: ip}}, nil
+		}
+
+		addrs, ok := hosts[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		out := []net.IPAddr{}
+		for _, a := range addrs {
+			out = append(out, net.IPAddr{IP: net.ParseIP(a)})
+		}
+		return out, nil
+	}
+
+	type test struct {
+		url       string
+		allowHTTP bool
+		valid     bool
+	}
+
+	tests := []test{
+		{"https://hooks.example.com/ds", false, true},
+		{"https://93.184.216.34:8443/ds", false, true},
+		{"http://hooks.example.com/ds", false, false},
+		{"http://hooks.example.com/ds", true, true},
+		{"ftp://hooks.example.com/ds", true, false},
+		{"hooks.example.com/ds", false, false},
+		{"https:///ds", false, false},
+		{"https://missing.example.com/ds", false, false},
+		{"https://internal.example.com/ds", false, false},
+		{"https://metadata.example.com/latest/meta-data", false, false},
+		{"https://127.0.0.1/ds", false, false},
+		{"https://localhost.:8080/ds", false, false},
+		{"https://[::1]/ds", false, false},
+		{"https://[fe80::1]/ds", false, false},
+		{"https://192.168.1.10/ds", false, false},
+		{"https://0.0.0.0/ds", false, false},
+	}
+
+	for _, tst := range tests {
+		err := CheckURL(context.TODO(), tst.url, tst.allowHTTP)
+		if tst.valid && err != nil {
+			t.Errorf("expected nil error for %s (allow http: %t), got %s", tst.url, tst.allowHTTP, err)
+		}
+
+		if !tst.valid {
+			if aerr, ok := err.(apierror.Error); !ok || aerr.Code != apierror.ErrBadRequest {
+				t.Errorf("expected bad request error for %s (allow http: %t), got %v", tst.url, tst.allowHTTP, err)
+			}
+		}
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	type test struct {
+		address string
+		allowed bool
+	}
+
+	tests := []test{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:443", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"169.254.169.254:80", false},
+		{"[::1]:443", false},
+		{"[fd00::1]:443", false},
+		{"localhost:443", false},
+	}
+
+	for _, tst := range tests {
+		err := dialControl("tcp", tst.address, nil)
+		if tst.allowed && err != nil {
+			t.Errorf("expected nil error dialing %s, got %s", tst.address, err)
+		}
+		if !tst.allowed && !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("expected forbidden address error dialing %s, got %v", tst.address, err)
+		}
+	}
+}